@@ -0,0 +1,189 @@
+package MyDb
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// IndexSuggestion is an index recommended by SuggestIndexes
+type IndexSuggestion struct {
+	Table         string   // Table to index
+	Columns       []string // Columns to index, those compared with = first
+	Ordered       bool     // Whether the index must be ordered, for a range on the last column
+	Scans         int      // Number of full scans the index would have avoided
+	RowsScanned   int      // Rows read by those scans
+	EstimatedRows int      // Rows the index would have read instead, estimated from the current rows
+	Benefit       int      // Rows the index would have saved reading, RowsScanned less EstimatedRows
+}
+
+// scanRecord counts the full scans of a table caused by WHERE clauses testing the same columns
+type scanRecord struct {
+	table   string
+	columns []string // Columns compared with =, sorted, then the column compared with a range, if any
+	ranged  bool     // Whether the last column is compared with a range
+	cond    expr     // Last condition, to tell whether an index now answers it
+	scans   int      // Number of scans
+	rows    int      // Rows read by the scans
+}
+
+// SetIndexAdvisor turns on or off the recording of the WHERE clauses of SELECT, UPDATE
+// and DELETE statements that scan their whole table because no index answers them.
+// SuggestIndexes then recommends indexes from what was recorded. Turning it off drops
+// the records
+func (db *Database) SetIndexAdvisor(enabled bool) {
+	db.scansMu.Lock()
+	defer db.scansMu.Unlock()
+	switch {
+	case !enabled:
+		db.scans = nil
+	case db.scans == nil:
+		db.scans = make(map[string]*scanRecord)
+	}
+}
+
+// recordScan records that a WHERE clause scanned a table when the index advisor is on
+// and no index answers the condition. Conditions without comparisons of columns with
+// values, which no index could answer, are not recorded
+func (db *Database) recordScan(tableName string, cond expr) {
+	if db.pinned != nil {
+		// Recorded once the tables of the database pinned from are unlocked
+		db.pinned.scans = append(db.pinned.scans, scanSeen{tableName, cond})
+		return
+	}
+
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists || cond == nil || db.use(tableName, table) != nil {
+		return
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	db.scansMu.Lock() // Lock scans last
+	defer db.scansMu.Unlock()
+	if db.scans == nil {
+		return
+	}
+	columns, ranged := scanColumns(table, cond)
+	if len(columns) == 0 {
+		return
+	}
+	if _, access := table.access(cond, nil); access != nil {
+		return
+	}
+	key := tableName + "(" + strings.Join(columns, ", ") + ")"
+	record, ok := db.scans[key]
+	if !ok {
+		record = &scanRecord{table: tableName, columns: columns, ranged: ranged}
+		db.scans[key] = record
+	}
+	record.cond = cond
+	record.scans++
+	record.rows += len(table.Rows)
+}
+
+// scanColumns returns the columns of the table that an index should cover to answer a
+// condition: those it compares with = in name order, then one it compares with a range,
+// reporting whether there is one
+func scanColumns(t *Table, cond expr) ([]string, bool) {
+	var columns []string
+	for col := range equalities(cond) {
+		if contains(t.Columns, col) {
+			columns = append(columns, col)
+		}
+	}
+	sort.Strings(columns)
+	var ranged []string
+	for col, bounds := range bounds(cond) {
+		if !contains(t.Columns, col) || contains(columns, col) {
+			continue
+		}
+		if slices.ContainsFunc(bounds, func(b bound) bool { return b.op != "=" }) {
+			ranged = append(ranged, col)
+		}
+	}
+	if len(ranged) == 0 {
+		return columns, false
+	}
+	sort.Strings(ranged)
+	return append(columns, ranged[0]), true
+}
+
+// SuggestIndexes recommends indexes for the full scans recorded since SetIndexAdvisor
+// turned the advisor on, the most beneficial first. The benefit of an index is the
+// number of rows it would have saved the scans reading, estimated from the distinct
+// values of its columns in the current rows, and from a third of the rows passing a
+// range. Scans that an index created since answers are left out
+func (db *Database) SuggestIndexes() []IndexSuggestion {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+	db.scansMu.Lock()
+	defer db.scansMu.Unlock()
+
+	var suggestions []IndexSuggestion
+	for _, record := range db.scans {
+		table, exists := db.Tables[record.table]
+		if !exists || db.use(record.table, table) != nil {
+			continue // Dropped, or failing to load back
+		}
+		table.mu.RLock() // Lock table second
+		suggestion, ok := table.suggest(record)
+		table.mu.RUnlock()
+		if ok {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Benefit != b.Benefit {
+			return a.Benefit > b.Benefit
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return strings.Join(a.Columns, ",") < strings.Join(b.Columns, ",")
+	})
+	return suggestions
+}
+
+// suggest returns the index recommended for the recorded scans of the table, or false
+// when its columns no longer exist or an index now answers them. The table lock must be held
+func (t *Table) suggest(record *scanRecord) (IndexSuggestion, bool) {
+	for _, col := range record.columns {
+		if !contains(t.Columns, col) {
+			return IndexSuggestion{}, false
+		}
+	}
+	if _, access := t.access(record.cond, nil); access != nil {
+		return IndexSuggestion{}, false
+	}
+
+	equal := record.columns
+	if record.ranged {
+		equal = equal[:len(equal)-1]
+	}
+	// The rows are assumed to be evenly spread over the distinct values of the columns
+	distinct := make(map[string]bool)
+	for _, row := range t.Rows {
+		if key, ok := indexKey(row, equal); ok {
+			distinct[key] = true
+		}
+	}
+	divisor := max(len(distinct), 1)
+	if record.ranged {
+		divisor *= 3
+	}
+	estimated := (record.rows + divisor - 1) / divisor
+	return IndexSuggestion{
+		Table:         record.table,
+		Columns:       slices.Clone(record.columns),
+		Ordered:       record.ranged,
+		Scans:         record.scans,
+		RowsScanned:   record.rows,
+		EstimatedRows: estimated,
+		Benefit:       record.rows - estimated,
+	}, true
+}
@@ -0,0 +1,178 @@
+package MyDb
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// aggregateFunctions are the functions computed over the rows of a group, e.g. SUM(amount)
+var aggregateFunctions = []string{"count", "sum", "avg", "min", "max"}
+
+// aggregateExpr is an aggregate of the column list of a SELECT. Its value is computed for
+// each group and stored in the row standing for the group under key
+type aggregateExpr struct {
+	name string // Lower case name of the function
+	arg  expr   // Aggregated expression, nil for COUNT(*)
+	key  string // Key of the value in the row of the group
+}
+
+func (e *aggregateExpr) eval(row map[string]string) (string, error) {
+	value, ok := row[e.key]
+	if !ok {
+		return Null, nil
+	}
+	return value, nil
+}
+
+// isAggregate reports whether a function is an aggregate, ignoring case
+func isAggregate(name string) bool {
+	return contains(aggregateFunctions, strings.ToLower(name))
+}
+
+// parseAggregate parses the parenthesized argument of a call to an aggregate, which only
+// the column list of a SELECT can hold and whose argument cannot hold another
+func (p *parser) parseAggregate(name string) (expr, error) {
+	if p.aggregates == nil {
+		return nil, fmt.Errorf("aggregate function %s is only allowed in the selected columns", strings.ToUpper(name))
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	aggregates := p.aggregates
+	e := &aggregateExpr{name: strings.ToLower(name), key: fmt.Sprintf("\x00aggregate%d", len(*aggregates))}
+	if e.name != "count" || !p.accept("*") {
+		p.aggregates = nil
+		arg, err := p.parseOr()
+		p.aggregates = aggregates
+		if err != nil {
+			return nil, err
+		}
+		e.arg = arg
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	*aggregates = append(*aggregates, e)
+	return e, nil
+}
+
+// aggregate groups rows by the GROUP BY columns of the statement, in order of first
+// appearance, and returns a row for each group holding the values of the aggregates
+// and the other columns of its first row. Without GROUP BY, every row is in one group,
+// which exists even without rows
+func (stmt *selectStmt) aggregate(rows []map[string]string) ([]map[string]string, error) {
+	var groups [][]map[string]string
+	index := make(map[string]int)
+	for _, row := range rows {
+		key := rowKey(row, stmt.groupBy)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], row)
+	}
+	if len(groups) == 0 && len(stmt.groupBy) == 0 {
+		groups = append(groups, nil)
+	}
+
+	results := make([]map[string]string, 0, len(groups))
+	for _, group := range groups {
+		result := make(map[string]string)
+		if len(group) > 0 {
+			result = copyRow(group[0])
+		}
+		for _, e := range stmt.aggregates {
+			value, err := e.compute(group)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", strings.ToUpper(e.name), err)
+			}
+			if value != Null {
+				result[e.key] = value
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// compute returns the value of the aggregate over the rows of a group. NULL values are
+// skipped, and SUM, AVG, MIN and MAX of no value are NULL. Sums and averages of DECIMAL
+// values are exact, sums of integers stay integers and the others are floats
+func (e *aggregateExpr) compute(rows []map[string]string) (string, error) {
+	if e.arg == nil {
+		return strconv.Itoa(len(rows)), nil
+	}
+	var values []string
+	for _, row := range rows {
+		value, err := e.arg.eval(row)
+		if err != nil {
+			return "", err
+		}
+		if value != Null {
+			values = append(values, value)
+		}
+	}
+	if e.name == "count" {
+		return strconv.Itoa(len(values)), nil
+	}
+	if len(values) == 0 {
+		return Null, nil
+	}
+
+	typ := exprType(e.arg)
+	switch e.name {
+	case "min", "max":
+		best := values[0]
+		for _, value := range values[1:] {
+			if c := typ.compare(value, best); c < 0 && e.name == "min" || c > 0 && e.name == "max" {
+				best = value
+			}
+		}
+		return best, nil
+	}
+	if typ == Decimal {
+		sum := new(big.Rat)
+		for _, value := range values {
+			d, ok := parseDecimal(value)
+			if !ok {
+				return "", fmt.Errorf("%q is not a number", value)
+			}
+			sum.Add(sum, d)
+		}
+		if e.name == "avg" {
+			sum.Quo(sum, new(big.Rat).SetInt64(int64(len(values))))
+		}
+		return formatDecimal(sum), nil
+	}
+
+	// Integers stay integers, except when averaged
+	var isum int64
+	integers := e.name == "sum"
+	for _, value := range values {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			integers = false
+			break
+		}
+		isum += n
+	}
+	if integers {
+		return strconv.FormatInt(isum, 10), nil
+	}
+	var sum float64
+	for _, value := range values {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a number", value)
+		}
+		sum += f
+	}
+	if e.name == "avg" {
+		sum /= float64(len(values))
+	}
+	return strconv.FormatFloat(sum, 'g', -1, 64), nil
+}
@@ -0,0 +1,71 @@
+package MyDb
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestAggregates checks the values of the aggregates, over every row and over groups,
+// DECIMAL sums and averages being exact
+func TestAggregates(t *testing.T) {
+	db := NewDatabase("aggregate_test", WithStorage(&MemoryStorage{}))
+	for _, command := range []string{
+		"create table items has id int primary key, cat, amount decimal, qty int, price float",
+		"insert into items values (1, a, 0.1, 2, 1.5), (2, a, 0.2, 3, 2.5), (3, b, 10.005, 1, 0.1)",
+		"insert into items (id, cat) values (4, b)",
+	} {
+		if _, err := db.Query(command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"select count(*) from items", "[map[count(*):4]]"},
+		{"select count(amount), count(*) as n from items where cat = b", "[map[count(amount):1 n:2]]"},
+		{"select sum(amount), avg(amount) from items", "[map[avg(amount):3.435 sum(amount):10.305]]"},
+		{"select sum(amount) as s from items where cat = a", "[map[s:0.3]]"},
+		{"select avg(amount) as a from items where id < 4 and cat = a or id = 3", "[map[a:3.435]]"},
+		{"select sum(qty), avg(qty) from items", "[map[avg(qty):2 sum(qty):6]]"},
+		{"select sum(price), avg(price) from items where cat = a", "[map[avg(price):2 sum(price):4]]"},
+		{"select min(amount), max(amount), min(cat), max(qty) from items", "[map[max(amount):10.005 max(qty):3 min(amount):0.1 min(cat):a]]"},
+		{"select sum(amount) * 2 as twice from items where cat = a", "[map[twice:0.6]]"},
+		{"select count(*) as n, sum(amount) as s from items where id > 100", "[map[n:0]]"},
+		{"select cat, count(*) as n, sum(amount) as total from items group by cat order by total desc", "[map[cat:b n:2 total:10.005] map[cat:a n:2 total:0.3]]"},
+		{"select cat, sum(qty) as q from items where id > 100 group by cat", "[]"},
+		{"select cat from items group by cat order by cat desc limit 1", "[map[cat:b]]"},
+	}
+	for _, tt := range tests {
+		res, err := db.Query(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := fmt.Sprint(res.Rows); got != tt.want {
+			t.Errorf("%s returned %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestAggregateErrors checks that aggregates are refused outside of the selected
+// columns, and over values that are not numbers
+func TestAggregateErrors(t *testing.T) {
+	db := NewDatabase("aggregate_test", WithStorage(&MemoryStorage{}))
+	if _, err := db.Query("create table items has id int, cat, amount decimal"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Query("insert into items values (1, a, 1.5)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		"select cat from items where sum(amount) > 1",
+		"select sum(count(*)) from items",
+		"select sum(cat) from items",
+		"update items set amount = sum(amount)",
+	} {
+		if _, err := db.Query(query); err == nil {
+			t.Errorf("%s succeeded, want an error", query)
+		}
+	}
+}
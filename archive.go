@@ -0,0 +1,155 @@
+package MyDb
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// walArchiveFile is the name of the archived write-ahead log in the archive directory
+const walArchiveFile = "wal.log"
+
+// SetWALArchive keeps the records of the write-ahead log in a directory rather than
+// dropping them when the database is saved, along with base backups of the database, so
+// that RestoreToTime can rebuild the database as it was at any time since. A base backup
+// is written right away and after every schema change, which the log does not record.
+// The log must be on. An empty dir stops archiving, leaving the directory as it is
+func (db *Database) SetWALArchive(dir string) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	if dir != "" {
+		if !db.wal.enabled() {
+			return fmt.Errorf("the write-ahead log must be on to archive it")
+		}
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+		if err := db.writeBase(dir); err != nil {
+			return err
+		}
+	}
+	db.wal.mu.Lock()
+	db.wal.archive = dir
+	db.wal.mu.Unlock()
+	return nil
+}
+
+// archiveDir returns the directory where the records are archived, empty when they are not
+func (w *writeAheadLog) archiveDir() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.archive
+}
+
+// writeBase writes a base backup of the database to the archive directory, named after
+// when it is taken and the last record it holds. The db lock must be held, but no table lock
+func (db *Database) writeBase(dir string) error {
+	snap, err := db.snapshotBackup()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("base-%d-%d.tar", snap.time.UnixNano(), snap.seq))
+	if err := writeAtomic(path, snap.write); err != nil {
+		return fmt.Errorf("failed to write base backup: %w", err)
+	}
+	syncDir(dir)
+	return nil
+}
+
+// findBase returns the path of the latest base backup of the archive directory taken at
+// or before a time, and the last record it holds
+func findBase(dir string, at time.Time) (string, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", 0, err
+	}
+	var path string
+	var latest, seq int64
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), "base-")
+		rest, isTar := strings.CutSuffix(rest, ".tar")
+		taken, last, _ := strings.Cut(rest, "-")
+		nanos, err1 := strconv.ParseInt(taken, 10, 64)
+		n, err2 := strconv.ParseInt(last, 10, 64)
+		if !ok || !isTar || err1 != nil || err2 != nil || nanos > at.UnixNano() {
+			continue
+		}
+		if path == "" || nanos > latest {
+			path, latest, seq = filepath.Join(dir, entry.Name()), nanos, n
+		}
+	}
+	if path == "" {
+		return "", 0, fmt.Errorf("no base backup in %s was taken by %s", dir, at.Format(time.RFC3339Nano))
+	}
+	return path, seq, nil
+}
+
+// RestoreToTime rebuilds the database as it was at a time, such as right before an
+// accidental mass delete, from the latest base backup of the WAL archive taken by then
+// and the records written since up to the time. The rebuilt tables replace those of the
+// database and are saved, after which a new base backup is taken, so that the database
+// can be restored to later times of either history
+func (db *Database) RestoreToTime(t time.Time) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	dir := db.wal.archiveDir()
+	if dir == "" {
+		return fmt.Errorf("the write-ahead log is not archived, see SetWALArchive")
+	}
+	base, seq, err := findBase(dir, t)
+	if err != nil {
+		return err
+	}
+
+	// Restore the base backup
+	staging := &Database{Name: db.Name, path: db.path, format: db.format, codec: db.codec, crypter: db.crypter, stemmers: maps.Clone(db.stemmers)}
+	db.funcsMu.RLock()
+	staging.funcs = maps.Clone(db.funcs)
+	db.funcsMu.RUnlock()
+	file, err := os.Open(base)
+	if err != nil {
+		return err
+	}
+	err = staging.restoreBackup(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// Replay the archived records, then those of the log, up to the time
+	seqs := make(map[string]int64, len(staging.Tables))
+	for tableName := range staging.Tables {
+		seqs[tableName] = seq
+	}
+	for _, path := range []string{filepath.Join(dir, walArchiveFile), db.walPath()} {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if _, _, err := staging.replayRecords(data, staging.Tables, seqs, t); err != nil {
+			return fmt.Errorf("failed to replay %s: %w", path, err)
+		}
+	}
+
+	// Replace the tables and save them
+	for tableName := range db.Tables {
+		if _, exists := staging.Tables[tableName]; !exists {
+			if db.dropped == nil {
+				db.dropped = make(map[string]bool)
+			}
+			db.dropped[tableName] = true
+		}
+	}
+	db.Tables, db.strict, db.savedTo = staging.Tables, staging.strict, ""
+	if err := db.saveLocked(context.Background()); err != nil {
+		return err
+	}
+	return db.writeBase(dir)
+}
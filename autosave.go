@@ -0,0 +1,82 @@
+package MyDb
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AutoSave tells when the database is saved without calling Save
+type AutoSave struct {
+	Writes   int             // Save once this many writes are unsaved, 1 to save after every write, 0 to not count writes
+	Interval time.Duration   // Save on this interval while writes are unsaved, 0 for no timer
+	OnError  func(err error) // Called with the errors of the saves on the timer, which no write returns
+}
+
+// autoSaver saves the database as configured by SetAutoSave
+type autoSaver struct {
+	mu      sync.Mutex
+	writes  int           // Unsaved writes that trigger a save, 0 when writes are not counted
+	stop    chan struct{} // Closed to stop the timer, nil when there is none
+	pending atomic.Int64  // Writes since the last save
+}
+
+// SetAutoSave makes the database save itself after writes, so that callers do not have to
+// call Save. With Writes set, the write that makes that many unsaved writes saves the
+// database before returning, and returns the error of the save. With Interval set, a
+// goroutine saves the database on the interval while it has unsaved writes, until
+// SetAutoSave is called again. Inserts, updates, deletes and schema changes each count as
+// a write. AutoSave{} turns saving off, which is the default
+func (db *Database) SetAutoSave(autoSave AutoSave) error {
+	if autoSave.Writes < 0 || autoSave.Interval < 0 {
+		return fmt.Errorf("auto-save writes and interval cannot be negative")
+	}
+	db.autoSave.mu.Lock()
+	defer db.autoSave.mu.Unlock()
+
+	if db.autoSave.stop != nil {
+		close(db.autoSave.stop)
+		db.autoSave.stop = nil
+	}
+	db.autoSave.writes = autoSave.Writes
+	if autoSave.Interval > 0 {
+		db.autoSave.stop = make(chan struct{})
+		go db.saveEvery(autoSave.Interval, autoSave.OnError, db.autoSave.stop)
+	}
+	return nil
+}
+
+// saveEvery saves the database on an interval while it has unsaved writes, until stop is closed
+func (db *Database) saveEvery(interval time.Duration, onError func(err error), stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if db.autoSave.pending.Load() == 0 {
+				continue
+			}
+			if err := db.Save(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// due reports whether enough writes are unsaved for a write to save the database
+func (a *autoSaver) due() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.writes > 0 && a.pending.Load() >= int64(a.writes)
+}
+
+// autoSaveAfter saves the database after a successful write when enough writes are
+// unsaved, setting the error of the write to that of the save. No lock must be held
+func (db *Database) autoSaveAfter(err *error) {
+	if *err == nil && db.autoSave.due() {
+		*err = db.Save()
+	}
+}
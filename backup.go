@@ -0,0 +1,155 @@
+package MyDb
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"time"
+)
+
+// Backup writes a tar archive of the database as it is at the call, holding the schema
+// file and the data of every table as Save writes them, in the format, with the codec
+// and encrypted with the key of the database. The tables are snapshotted at once, so
+// the archive is consistent across tables, and writes go on while it is written
+func (db *Database) Backup(w io.Writer) error {
+	db.mu.RLock() // Lock db first
+	snap, err := db.snapshotBackup()
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return snap.write(w)
+}
+
+// backupSnapshot is the state of a database captured for a backup
+type backupSnapshot struct {
+	backup *Database         // Database saving the snapshots to memory, holding the schema already
+	tables map[string]*Table // Snapshots of the tables, sharing their rows
+	format Format            // Format of the data of the tables
+	seq    int64             // Last write-ahead log record held by the snapshots
+	time   time.Time         // When the snapshots were taken
+}
+
+// snapshotBackup snapshots the tables and their schema, which copies no rows. The db
+// lock must be held, for reading at least, but no table lock
+func (db *Database) snapshotBackup() (*backupSnapshot, error) {
+	if err := db.useAll(); err != nil {
+		return nil, err
+	}
+	l := &tableLocks{tables: maps.Clone(db.Tables), write: make(map[*Table]bool)}
+	l.lock() // Lock tables second
+	defer l.unlock()
+
+	schema := savedSchema{Strict: db.strict, Tables: make(map[string]savedTable, len(l.tables))}
+	snap := &backupSnapshot{
+		backup: &Database{Name: db.Name, storage: &MemoryStorage{}, format: db.format, codec: db.codec, crypter: db.crypter},
+		tables: make(map[string]*Table, len(l.tables)),
+		format: db.format,
+		seq:    db.wal.lastSeq(),
+		time:   time.Now(),
+	}
+	for tableName, table := range l.tables {
+		schema.Tables[tableName] = table.schema()
+		snap.tables[tableName] = &Table{
+			Columns: table.Columns,
+			Rows:    table.snapshot(),
+			defs:    maps.Clone(table.defs),
+			lastID:  table.lastID,
+			dialect: table.dialect,
+		}
+	}
+	if err := snap.backup.writeSchema(schema); err != nil { // Before DDL changes the definitions
+		return nil, err
+	}
+	return snap, nil
+}
+
+// write saves the snapshots in memory, then writes them to a tar archive
+func (s *backupSnapshot) write(w io.Writer) error {
+	for tableName, table := range s.tables {
+		if _, err := s.backup.saveTable(tableName, table, 0); err != nil {
+			return fmt.Errorf("failed to back up table %s: %w", tableName, err)
+		}
+	}
+	store := s.backup.storage.(*MemoryStorage)
+	tw := tar.NewWriter(w)
+	ext := map[Format]string{CSV: ".csv", Gob: ".gob"}[s.format]
+	write := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: s.time, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := write(schemaFile, store.schema); err != nil {
+		return err
+	}
+	names, _ := store.ListTables()
+	for _, tableName := range names {
+		if err := write(tableName+ext, store.tables[tableName]); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// RestoreBackup returns a new database with the given name and options holding the
+// tables of a tar archive written by Backup. Its tables are only saved to its directory
+// by the next Save, which saves them all
+func RestoreBackup(name string, r io.Reader, options ...Option) (*Database, error) {
+	db := NewDatabase(name, options...)
+	if err := db.restoreBackup(r); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// restoreBackup loads the tables of a tar archive written by Backup into a new database
+func (db *Database) restoreBackup(r io.Reader) error {
+	store := &MemoryStorage{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid backup: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("invalid backup: %w", err)
+		}
+		if header.Name == schemaFile {
+			store.schema = data
+			continue
+		}
+		tableName, _, _ := strings.Cut(header.Name, ".")
+		if !isValidName(tableName) {
+			return fmt.Errorf("invalid backup: unexpected file %s", header.Name)
+		}
+		store.SaveTable(tableName, func(w io.Writer) error {
+			_, err := io.Copy(w, bytes.NewReader(data))
+			return err
+		})
+	}
+	if store.schema == nil {
+		return fmt.Errorf("invalid backup: %s is missing", schemaFile)
+	}
+
+	storage := db.storage
+	db.storage = store
+	err := db.load(false) // The log of the directory is not that of the backup
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.storage, db.savedTo = storage, ""
+	if err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+	return nil
+}
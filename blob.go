@@ -0,0 +1,82 @@
+package MyDb
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// blobDir returns the path of the directory holding the BLOB values of a table
+func (s DirStorage) blobDir(tableName string) string {
+	return filepath.Join(s.Dir, tableName+"_blobs")
+}
+
+// writeBlob saves a BLOB value of a table in a file named by its SHA-256 hash, unless
+// it is already saved, and returns the hash
+func (s DirStorage) writeBlob(tableName, value string) (string, error) {
+	sum := sha256.Sum256([]byte(value))
+	hash := hex.EncodeToString(sum[:])
+	path := filepath.Join(s.blobDir(tableName), hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil // Same content, same file
+	}
+	if err := os.MkdirAll(s.blobDir(tableName), os.ModePerm); err != nil {
+		return "", err
+	}
+	return hash, writeAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, value)
+		return err
+	})
+}
+
+// readBlob reads the BLOB value of a table saved under the given hash
+func (s DirStorage) readBlob(tableName, hash string) (string, error) {
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid blob reference %q in table %s", hash, tableName)
+	}
+	data, err := os.ReadFile(filepath.Join(s.blobDir(tableName), hash))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// removeUnusedBlobs deletes the blob files of a table whose hashes are not in use,
+// along with the directory once it has none left, and syncs the directory of the others
+func (s DirStorage) removeUnusedBlobs(tableName string, used map[string]bool) error {
+	if len(used) == 0 {
+		return os.RemoveAll(s.blobDir(tableName))
+	}
+	entries, err := os.ReadDir(s.blobDir(tableName))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !used[entry.Name()] {
+			if err := os.Remove(filepath.Join(s.blobDir(tableName), entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	syncDir(s.blobDir(tableName))
+	return nil
+}
+
+// encodeInlineBlob encodes a BLOB value saved in the data of its table, for storages
+// that do not keep BLOB values apart
+func encodeInlineBlob(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+// decodeInlineBlob decodes a BLOB value encoded by encodeInlineBlob
+func decodeInlineBlob(field string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(field)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 BLOB value")
+	}
+	return string(data), nil
+}
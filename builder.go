@@ -0,0 +1,257 @@
+package MyDb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// QueryBuilder builds a SELECT on a table by chaining calls, e.g.
+// db.Table("users").Where("age", ">", 30).OrderBy("name").Limit(10).Rows(), and runs it
+// like the command language runs a parsed one, through the indexes of the table. Calls
+// change the builder and return it, and errors, e.g. unknown columns, are returned when
+// the query runs
+type QueryBuilder struct {
+	db       *Database
+	table    string
+	fields   []string        // Selected columns, nil for every column
+	distinct bool            // Remove duplicate result rows
+	conds    []builderCond   // Conditions of the WHERE clause, in order
+	orderBy  []SortKey       // Sort keys of the ORDER BY clause
+	limit    int             // Maximum number of rows, -1 for no limit
+	offset   int             // Number of matching rows to skip
+	ctx      context.Context // Context whose end stops the query, nil when there is none
+}
+
+// builderCond is a condition of a QueryBuilder, combined with the conditions before it
+type builderCond struct {
+	or     bool // Combined with OR rather than AND
+	column string
+	op     string // Operator, lower case
+	value  any
+}
+
+// Table returns a builder of a query on the rows of a table
+func (db *Database) Table(tableName string) *QueryBuilder {
+	return &QueryBuilder{db: db, table: tableName, limit: -1}
+}
+
+// Select selects only the given columns, in that order
+func (q *QueryBuilder) Select(columns ...string) *QueryBuilder {
+	q.fields = append(q.fields, columns...)
+	return q
+}
+
+// Distinct removes duplicate result rows
+func (q *QueryBuilder) Distinct() *QueryBuilder {
+	q.distinct = true
+	return q
+}
+
+// Where keeps the rows whose column compares with a value, and the conditions before it
+// hold. The operator is one of =, !=, <>, <, >, <=, >=, like and not like, in and not in
+// with a slice of values, or is and is not with nil, comparing with NULL. Values are Go
+// values converted like InsertStruct converts them, nil being NULL
+func (q *QueryBuilder) Where(column, op string, value any) *QueryBuilder {
+	q.conds = append(q.conds, builderCond{column: column, op: strings.ToLower(op), value: value})
+	return q
+}
+
+// OrWhere keeps the rows whose column compares with a value like Where, or where the
+// conditions before it hold
+func (q *QueryBuilder) OrWhere(column, op string, value any) *QueryBuilder {
+	q.conds = append(q.conds, builderCond{or: true, column: column, op: strings.ToLower(op), value: value})
+	return q
+}
+
+// OrderBy sorts the rows by columns in ascending order, after the columns already given
+func (q *QueryBuilder) OrderBy(columns ...string) *QueryBuilder {
+	for _, col := range columns {
+		q.orderBy = append(q.orderBy, SortKey{Column: col})
+	}
+	return q
+}
+
+// OrderByDesc sorts the rows by columns in descending order, after the columns already
+// given
+func (q *QueryBuilder) OrderByDesc(columns ...string) *QueryBuilder {
+	for _, col := range columns {
+		q.orderBy = append(q.orderBy, SortKey{Column: col, Desc: true})
+	}
+	return q
+}
+
+// Limit returns at most n rows
+func (q *QueryBuilder) Limit(n int) *QueryBuilder {
+	q.limit = n
+	return q
+}
+
+// Offset skips the first n matching rows
+func (q *QueryBuilder) Offset(n int) *QueryBuilder {
+	q.offset = n
+	return q
+}
+
+// Context stops the query with the error of a context once it is done
+func (q *QueryBuilder) Context(ctx context.Context) *QueryBuilder {
+	q.ctx = ctx
+	return q
+}
+
+// Result runs the query and returns its rows and columns
+func (q *QueryBuilder) Result() (*Result, error) {
+	stmt, err := q.compile()
+	if err != nil {
+		return nil, err
+	}
+	return q.db.execSelect(stmt)
+}
+
+// Rows runs the query and returns its rows
+func (q *QueryBuilder) Rows() ([]map[string]string, error) {
+	result, err := q.Result()
+	if err != nil {
+		return nil, err
+	}
+	return result.Rows, nil
+}
+
+// First runs the query and returns its first row, nil when there is none
+func (q *QueryBuilder) First() (map[string]string, error) {
+	limit := q.limit
+	if limit != 0 {
+		q.limit = 1
+	}
+	rows, err := q.Rows()
+	q.limit = limit
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+// Count runs the query and returns how many rows it returns
+func (q *QueryBuilder) Count() (int, error) {
+	rows, err := q.Rows()
+	return len(rows), err
+}
+
+// Into runs the query and fills a slice of structs, or of pointers to structs, with its
+// rows like SelectInto
+func (q *QueryBuilder) Into(dest any) error {
+	rows, err := q.Rows()
+	if err != nil {
+		return err
+	}
+	return scanRows(rows, dest)
+}
+
+// compile returns the SELECT statement the builder describes
+func (q *QueryBuilder) compile() (*selectStmt, error) {
+	defs, err := q.db.tableDefs(q.table)
+	if err != nil {
+		return nil, err
+	}
+	stmt := &selectStmt{table: q.table, where: &rowFilter{ctx: q.ctx}, distinct: q.distinct, orderBy: q.orderBy, limit: q.limit, offset: q.offset}
+	types := make(map[string]ColumnType, len(defs))
+	for _, def := range defs {
+		types[def.Name] = def.Type
+		stmt.columns = append(stmt.columns, def.Name)
+	}
+	column := func(name string) (*columnExpr, error) {
+		typ, ok := types[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %s in table %s", name, q.table)
+		}
+		return &columnExpr{name: name, typ: typ}, nil
+	}
+
+	for _, name := range q.fields {
+		col, err := column(name)
+		if err != nil {
+			return nil, err
+		}
+		stmt.fields = append(stmt.fields, selectField{name: name, value: col})
+	}
+	for _, key := range q.orderBy {
+		if _, err := column(key.Column); err != nil {
+			return nil, err
+		}
+	}
+	var text []string
+	for i, c := range q.conds {
+		col, err := column(c.column)
+		if err != nil {
+			return nil, err
+		}
+		cond, err := c.compile(col)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0:
+			stmt.where.cond = cond
+		case c.or:
+			stmt.where.cond = &logicalExpr{or: true, left: stmt.where.cond, right: cond}
+			text = append(text, "or")
+		default:
+			stmt.where.cond = &logicalExpr{left: stmt.where.cond, right: cond}
+			text = append(text, "and")
+		}
+		text = append(text, fmt.Sprintf("%s %s %v", c.column, c.op, c.value))
+	}
+	stmt.where.text = strings.Join(text, " ")
+	return stmt, nil
+}
+
+// compile returns the expression of the condition on a column
+func (c builderCond) compile(col *columnExpr) (expr, error) {
+	switch c.op {
+	case "=", "!=", "<>", "<", ">", "<=", ">=":
+		value, err := c.literal(c.value, col.typ)
+		if err != nil {
+			return nil, err
+		}
+		return &compareExpr{op: c.op, left: col, right: value}, nil
+	case "like", "not like":
+		pattern, err := c.literal(c.value, String)
+		if err != nil {
+			return nil, err
+		}
+		return &likeExpr{left: col, pattern: pattern, not: c.op == "not like"}, nil
+	case "in", "not in":
+		list := reflect.ValueOf(c.value)
+		if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+			return nil, fmt.Errorf("operator %s on column %s needs a slice of values, not %T", c.op, c.column, c.value)
+		}
+		in := &inExpr{left: col, not: c.op == "not in"}
+		for i := 0; i < list.Len(); i++ {
+			item, err := c.literal(list.Index(i).Interface(), col.typ)
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, item)
+		}
+		return in, nil
+	case "is", "is not":
+		if c.value != nil {
+			return nil, fmt.Errorf("operator %s on column %s only compares with nil", c.op, c.column)
+		}
+		return &isNullExpr{inner: col, not: c.op == "is not"}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s on column %s", c.op, c.column)
+}
+
+// literal returns the expression of a value compared with a column of a type
+func (c builderCond) literal(value any, typ ColumnType) (expr, error) {
+	if value == nil {
+		return &literalExpr{value: Null}, nil
+	}
+	s, err := fieldValue(reflect.ValueOf(value), typ)
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %w", c.column, err)
+	}
+	return &literalExpr{value: s}, nil
+}
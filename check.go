@@ -0,0 +1,120 @@
+package MyDb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckError is returned when a row does not satisfy a CHECK constraint of its table
+type CheckError struct {
+	Table string // Table of the row
+	Check string // Condition of the violated constraint
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("row of table %s violates check constraint (%s)", e.Table, e.Check)
+}
+
+// checkConstraint is a condition every row of a table must satisfy
+type checkConstraint struct {
+	text    string   // Source text of the condition
+	cond    expr     // Parsed condition
+	columns []string // Columns the condition reads
+}
+
+// AddCheck adds a CHECK constraint to a table, e.g. "age >= 0 AND age < 150". The
+// condition uses the syntax of WHERE clauses without subqueries. Inserted and updated
+// rows must not make it false, while a NULL result passes like in SQL. It fails if
+// existing rows do not satisfy the condition
+func (db *Database) AddCheck(tableName, condition string) error {
+	cond, columns, err := db.parseRowCondition(tableName, condition, "check constraint")
+	if err != nil {
+		return err
+	}
+	check := checkConstraint{text: strings.TrimSpace(condition), cond: cond, columns: columns}
+
+	return db.alterTable(tableName, func(table *Table) error {
+		table.checks = append(table.checks, check)
+		if err := table.checkConditions(tableName, table.Rows); err != nil {
+			table.checks = table.checks[:len(table.checks)-1]
+			return err
+		}
+		return nil
+	})
+}
+
+// parseRowCondition parses a condition on the rows of a table with the syntax of WHERE
+// clauses without subqueries, and returns it with the columns it reads. what names the
+// condition in errors
+func (db *Database) parseRowCondition(tableName, condition, what string) (expr, []string, error) {
+	columns, err := db.tableDefs(tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db.parseColumnsCondition(tableName, columns, condition, what)
+}
+
+// parseColumnsCondition is like parseRowCondition for a table with the given columns,
+// e.g. one about to get a new column
+func (db *Database) parseColumnsCondition(tableName string, columns []ColumnDef, condition, what string) (expr, []string, error) {
+	p, err := newParser(db, condition)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", what, err)
+	}
+	if err := p.useColumns(tableName, columns); err != nil {
+		return nil, nil, err
+	}
+	cond, err := p.parseCondition()
+	if err == nil {
+		err = p.expectEOF()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", what, err)
+	}
+	if len(p.subqueries) > 0 {
+		return nil, nil, fmt.Errorf("%s cannot contain a subquery", what)
+	}
+	var used []string
+	for _, tok := range p.tokens {
+		if _, ok := p.columns[tok.text]; ok && tok.kind == tokenWord && !contains(used, tok.text) {
+			used = append(used, tok.text)
+		}
+	}
+	return cond, used, nil
+}
+
+// checkConditions returns a *CheckError if one of the rows makes a CHECK constraint
+// of the table false
+func (t *Table) checkConditions(tableName string, rows []map[string]string) error {
+	for _, check := range t.checks {
+		for _, row := range rows {
+			value, err := check.cond.eval(row)
+			if err != nil {
+				return fmt.Errorf("check constraint (%s) of table %s: %w", check.text, tableName, err)
+			}
+			if value != Null && !truthy(value) {
+				return &CheckError{Table: tableName, Check: check.text}
+			}
+		}
+	}
+	return nil
+}
+
+// usedByCheck returns the condition of a CHECK constraint reading the column, or
+// false when there is none
+func (t *Table) usedByCheck(column string) (string, bool) {
+	for _, check := range t.checks {
+		if contains(check.columns, column) {
+			return check.text, true
+		}
+	}
+	return "", false
+}
+
+// parseCheck parses "CHECK (condition)" and returns the source text of the condition
+func (p *parser) parseCheck() (string, error) {
+	if err := p.expect("check"); err != nil {
+		return "", err
+	}
+	return p.parseParenthesized()
+}
@@ -0,0 +1,753 @@
+package MyDb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// createTableStmt is a parsed CREATE TABLE command
+type createTableStmt struct {
+	table       string       // Name of the new table
+	columns     []ColumnDef  // Column definitions in order
+	unique      [][]string   // Columns of each table-level UNIQUE constraint
+	foreignKeys []ForeignKey // Foreign keys declared on columns or at table level
+	checks      []string     // Conditions of the CHECK constraints
+	primaryKey  []string     // Columns of a table-level PRIMARY KEY clause
+	query       *selectStmt  // SELECT of CREATE TABLE ... AS, giving the columns and rows, nil when the columns are defined
+}
+
+// queryCreateTable parses and executes "CREATE TABLE name HAS col [type] [attributes], ..."
+// and "CREATE TABLE name (col [type] [attributes], ..., [constraints])", the constraints
+// being PRIMARY KEY (col, ...), UNIQUE (col, ...), FOREIGN KEY (col, ...) REFERENCES
+// table (col, ...) and CHECK (condition). Columns without a type hold strings. A trailing
+// WITH TIMESTAMPS adds the created_at and updated_at columns maintained by the database.
+// "CREATE TABLE name AS SELECT ..." creates a table with the columns and rows of a SELECT
+func (db *Database) queryCreateTable(p *parser) (*Result, error) {
+	stmt, err := p.parseCreateTable()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CREATE TABLE command: %w", err)
+	}
+	if stmt.query != nil {
+		return db.createTableAs(stmt)
+	}
+	if err := db.CreateTableWithSchema(stmt.table, stmt.columns); err != nil {
+		return nil, err
+	}
+	for _, columns := range stmt.unique {
+		if err := db.AddUnique(stmt.table, columns...); err != nil {
+			return nil, err
+		}
+	}
+	for _, fk := range stmt.foreignKeys {
+		if err := db.AddForeignKey(stmt.table, fk); err != nil {
+			db.DropTable(stmt.table) // Do not leave a table without its constraints behind
+			return nil, err
+		}
+	}
+	for _, check := range stmt.checks {
+		if err := db.AddCheck(stmt.table, check); err != nil {
+			db.DropTable(stmt.table)
+			return nil, err
+		}
+	}
+	columns := make([]string, len(stmt.columns))
+	for i, def := range stmt.columns {
+		columns[i] = def.Name
+	}
+	return &Result{Columns: columns}, nil
+}
+
+// parseCreateTable parses the table name, column definitions and constraints of a CREATE TABLE command
+func (p *parser) parseCreateTable() (*createTableStmt, error) {
+	if err := p.expect("create"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("table"); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &createTableStmt{table: tableName}
+	if p.accept("as") {
+		if stmt.query, err = p.parseSelect(); err != nil {
+			return nil, err
+		}
+		return stmt, p.expectEOF()
+	}
+	parenthesized := p.accept("(")
+	if !parenthesized {
+		if err := p.expect("has"); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if p.peek().is("unique") && p.tokens[p.pos+1].is("(") {
+			// Table-level constraint
+			p.next()
+			columns, err := p.parseNameList()
+			if err != nil {
+				return nil, err
+			}
+			stmt.unique = append(stmt.unique, columns)
+		} else if p.peek().is("primary") && p.tokens[p.pos+1].is("key") && p.tokens[p.pos+2].is("(") {
+			p.next()
+			p.next()
+			columns, err := p.parseNameList()
+			if err != nil {
+				return nil, err
+			}
+			if stmt.primaryKey != nil {
+				return nil, fmt.Errorf("table %s has more than one PRIMARY KEY clause", tableName)
+			}
+			stmt.primaryKey = columns
+		} else if p.accept("foreign") {
+			if err := p.expect("key"); err != nil {
+				return nil, err
+			}
+			columns, err := p.parseNameList()
+			if err != nil {
+				return nil, err
+			}
+			fk, err := p.parseReferences(columns)
+			if err != nil {
+				return nil, err
+			}
+			stmt.foreignKeys = append(stmt.foreignKeys, fk)
+		} else if p.peek().is("check") && p.tokens[p.pos+1].is("(") {
+			check, err := p.parseCheck()
+			if err != nil {
+				return nil, err
+			}
+			stmt.checks = append(stmt.checks, check)
+		} else {
+			def, err := p.parseColumnDef(stmt)
+			if err != nil {
+				return nil, err
+			}
+			stmt.columns = append(stmt.columns, def)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if parenthesized {
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("with") {
+		if err := p.expect("timestamps"); err != nil {
+			return nil, err
+		}
+		stmt.columns = append(stmt.columns,
+			ColumnDef{Name: "created_at", Type: DateTime, CreatedAt: true},
+			ColumnDef{Name: "updated_at", Type: DateTime, UpdatedAt: true})
+	}
+
+	// Check the constraints here so that a bad one does not leave the table behind
+	for _, col := range stmt.primaryKey {
+		i := stmt.columnIndex(col)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %s in PRIMARY KEY constraint", col)
+		}
+		for _, def := range stmt.columns {
+			if def.PrimaryKey && !contains(stmt.primaryKey, def.Name) {
+				return nil, fmt.Errorf("table %s has more than one primary key", tableName)
+			}
+		}
+		stmt.columns[i].PrimaryKey = true
+	}
+	for _, columns := range stmt.unique {
+		for _, col := range columns {
+			if !stmt.hasColumn(col) {
+				return nil, fmt.Errorf("unknown column %s in UNIQUE constraint", col)
+			}
+		}
+	}
+	for _, fk := range stmt.foreignKeys {
+		for _, col := range fk.Columns {
+			if !stmt.hasColumn(col) {
+				return nil, fmt.Errorf("unknown column %s in FOREIGN KEY constraint", col)
+			}
+		}
+	}
+	return stmt, p.expectEOF()
+}
+
+// hasColumn reports whether the statement defines a column
+func (stmt *createTableStmt) hasColumn(name string) bool {
+	return stmt.columnIndex(name) >= 0
+}
+
+// columnIndex returns the position of a column defined by the statement, or -1
+func (stmt *createTableStmt) columnIndex(name string) int {
+	for i, def := range stmt.columns {
+		if def.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseColumnDef parses a column name followed by an optional type and attributes,
+// ending before a WITH TIMESTAMPS clause. A REFERENCES attribute adds a foreign key to
+// the statement
+func (p *parser) parseColumnDef(stmt *createTableStmt) (ColumnDef, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return ColumnDef{}, err
+	}
+	def := ColumnDef{Name: name}
+	if tok := p.peek(); tok.kind == tokenWord && !isColumnAttribute(tok) && !tok.is("with") {
+		typ, ok := parseColumnType(tok.text)
+		if !ok {
+			return ColumnDef{}, fmt.Errorf("unknown type %s of column %s", tok.text, name)
+		}
+		p.next()
+		def.Type = typ
+	}
+	for {
+		switch {
+		case p.accept("primary"):
+			if err := p.expect("key"); err != nil {
+				return ColumnDef{}, err
+			}
+			def.PrimaryKey = true
+		case p.accept("unique"):
+			def.Unique = true
+		case p.accept("auto_increment"), p.accept("autoincrement"):
+			def.AutoIncrement = true
+		case p.accept("generated"), p.peek().is("as"):
+			if !p.peek().is("as") {
+				// GENERATED ALWAYS AS (expr)
+				if err := p.expect("always"); err != nil {
+					return ColumnDef{}, err
+				}
+			}
+			if err := p.expect("as"); err != nil {
+				return ColumnDef{}, err
+			}
+			if def.Generated, err = p.parseParenthesized(); err != nil {
+				return ColumnDef{}, err
+			}
+			p.accept("stored") // Generated columns are always stored
+		case p.peek().is("check"):
+			check, err := p.parseCheck()
+			if err != nil {
+				return ColumnDef{}, err
+			}
+			stmt.checks = append(stmt.checks, check)
+		case p.peek().is("references"):
+			fk, err := p.parseReferences([]string{name})
+			if err != nil {
+				return ColumnDef{}, err
+			}
+			stmt.foreignKeys = append(stmt.foreignKeys, fk)
+		case p.accept("not"):
+			if err := p.expect("null"); err != nil {
+				return ColumnDef{}, err
+			}
+			def.NotNull = true
+		case p.accept("default"):
+			if tok := p.peek(); tok.kind == tokenWord && p.tokens[p.pos+1].is("(") {
+				// Function default, e.g. DEFAULT now()
+				p.next()
+				p.next()
+				if err := p.expect(")"); err != nil {
+					return ColumnDef{}, err
+				}
+				def.DefaultFunc = tok.text
+				break
+			}
+			value, err := p.parseValue(append([]string{")", "with"}, columnAttributes...)...)
+			if err != nil {
+				return ColumnDef{}, err
+			}
+			if value != Null {
+				def.Default = value
+			}
+		default:
+			return def, nil
+		}
+	}
+}
+
+// columnAttributes are the words starting a column attribute
+var columnAttributes = []string{"primary", "unique", "not", "default", "auto_increment", "autoincrement", "references", "check", "generated", "as"}
+
+// isColumnAttribute reports whether a token starts a column attribute rather than a type
+func isColumnAttribute(tok token) bool {
+	return isTerminator(tok, columnAttributes)
+}
+
+// insertStmt is a parsed INSERT or UPSERT command
+type insertStmt struct {
+	table     string           // Table to insert into
+	columns   []string         // Columns given values, nil for every column in order
+	rows      [][]string       // Values of each row
+	query     *selectStmt      // SELECT providing the rows, nil when they are listed with VALUES
+	conflict  *conflictClause  // ON CONFLICT clause, nil for a plain insert
+	returning *returningClause // RETURNING clause, nil when no rows are returned
+}
+
+// conflictClause describes what to do with inserted rows whose key already exists
+type conflictClause struct {
+	keys      []string          // Key columns identifying a conflicting row
+	doNothing bool              // Skip conflicting rows
+	set       map[string]string // Assignments applied to conflicting rows, nil to apply the inserted values
+}
+
+// queryInsert parses and executes "INSERT INTO table [(col, ...)] VALUES (value, ...), (value, ...)
+// [ON CONFLICT (col, ...) DO UPDATE SET col = value, ... | DO NOTHING] [RETURNING col, ...]" and the original
+// "INSERT TO table value, value, ..." form. The VALUES list can be replaced by a SELECT
+// whose result columns are matched to the inserted columns by position. Columns missing
+// from the column list are NULL. UPSERT INTO is the same as INSERT INTO except that on a conflict the
+// existing row is updated with the inserted values when no DO clause is given
+func (db *Database) queryInsert(p *parser) (*Result, error) {
+	stmt, err := p.parseInsert()
+	if err != nil {
+		return nil, fmt.Errorf("invalid INSERT command: %w", err)
+	}
+	tableColumns, err := db.tableColumns(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	columns := stmt.columns
+	if columns == nil {
+		// Values are given for every column that can be written
+		defs, err := db.tableDefs(stmt.table)
+		if err != nil {
+			return nil, err
+		}
+		for _, def := range defs {
+			if def.Generated == "" && !def.CreatedAt && !def.UpdatedAt {
+				columns = append(columns, def.Name)
+			}
+		}
+	} else if err := checkColumns(stmt.table, tableColumns, columns); err != nil {
+		return nil, err
+	}
+	returned, err := stmt.returning.resolve(stmt.table, tableColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.query != nil {
+		selected, err := db.execSelect(stmt.query)
+		if err != nil {
+			return nil, err
+		}
+		if len(selected.Columns) != len(columns) {
+			return nil, fmt.Errorf("SELECT returns %d columns but %d are inserted into table %s", len(selected.Columns), len(columns), stmt.table)
+		}
+		for _, row := range selected.Rows {
+			values := make([]string, len(selected.Columns))
+			for i, col := range selected.Columns {
+				value, ok := row[col]
+				if !ok {
+					value = Null
+				}
+				values[i] = value
+			}
+			stmt.rows = append(stmt.rows, values)
+		}
+	}
+
+	rows := make([]map[string]string, 0, len(stmt.rows))
+	for _, rowValues := range stmt.rows {
+		if len(rowValues) != len(columns) {
+			return nil, fmt.Errorf("mismatch between columns and values in table %s", stmt.table)
+		}
+		data := make(map[string]string)
+		for i, col := range columns {
+			data[col] = rowValues[i]
+		}
+		rows = append(rows, data)
+	}
+
+	var affected []map[string]string
+	var lastID int64
+	if stmt.conflict != nil {
+		affected, lastID, err = db.upsertRows(p.ctx, p.tx, stmt.table, rows, stmt.conflict)
+	} else {
+		affected, lastID, err = db.insertRows(stmt.table, rows, p.restoring)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Columns: tableColumns, RowsAffected: len(affected), LastInsertID: lastID}
+	if stmt.returning != nil {
+		result.Columns, result.Rows = returned, projectRows(affected, returned)
+	}
+	return result, nil
+}
+
+// parseInsert parses an INSERT or UPSERT command
+func (p *parser) parseInsert() (*insertStmt, error) {
+	upsert := p.accept("upsert")
+	if !upsert {
+		if err := p.expect("insert"); err != nil {
+			return nil, err
+		}
+	}
+	into := p.accept("into")
+	if !into && !upsert {
+		if err := p.expect("to"); err != nil {
+			return nil, err
+		}
+	} else if !into {
+		return nil, p.unexpected()
+	}
+	tableName, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &insertStmt{table: tableName}
+
+	if into && p.accept("(") {
+		for {
+			col, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			if contains(stmt.columns, col) {
+				return nil, fmt.Errorf("column %s is listed more than once", col)
+			}
+			stmt.columns = append(stmt.columns, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if !p.peek().is("values") && !p.peek().is("select") {
+			return nil, p.unexpected()
+		}
+	}
+
+	switch {
+	case into && p.peek().is("select"):
+		if stmt.query, err = p.parseSelect(); err != nil {
+			return nil, err
+		}
+
+	case p.accept("values"):
+		for {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			values, err := p.parseValueList(")")
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			stmt.rows = append(stmt.rows, values)
+			if !p.accept(",") {
+				break
+			}
+		}
+
+	default:
+		// Original syntax: a single row of comma-separated values
+		values, err := p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.rows = [][]string{values}
+		return stmt, p.expectEOF()
+	}
+
+	if p.accept("on") {
+		if stmt.conflict, err = p.parseConflict(); err != nil {
+			return nil, err
+		}
+	} else if upsert {
+		return nil, fmt.Errorf("UPSERT requires an ON CONFLICT clause")
+	}
+	if stmt.returning, err = p.parseReturning(); err != nil {
+		return nil, err
+	}
+	return stmt, p.expectEOF()
+}
+
+// parseConflict parses "CONFLICT (col, ...) [DO UPDATE SET col = value, ... | DO NOTHING]"
+func (p *parser) parseConflict() (*conflictClause, error) {
+	if err := p.expect("conflict"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	clause := &conflictClause{}
+	for {
+		col, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		clause.keys = append(clause.keys, col)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if !p.accept("do") {
+		return clause, nil
+	}
+	if p.accept("nothing") {
+		clause.doNothing = true
+		return clause, nil
+	}
+	if err := p.expect("update"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("set"); err != nil {
+		return nil, err
+	}
+	set, err := p.parseAssignments("returning")
+	if err != nil {
+		return nil, err
+	}
+	clause.set = set
+	return clause, nil
+}
+
+// parseAssignments parses "col = value, ..." up to the end of the command or a terminator
+func (p *parser) parseAssignments(terminators ...string) (map[string]string, error) {
+	data := make(map[string]string)
+	for {
+		col, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue(terminators...)
+		if err != nil {
+			return nil, err
+		}
+		data[col] = value
+		if !p.accept(",") {
+			return data, nil
+		}
+	}
+}
+
+// parseValueList parses comma-separated values, see parseValue
+func (p *parser) parseValueList(terminators ...string) ([]string, error) {
+	var values []string
+	for {
+		value, err := p.parseValue(terminators...)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if !p.accept(",") {
+			return values, nil
+		}
+	}
+}
+
+// updateStmt is a parsed UPDATE command
+type updateStmt struct {
+	table     string            // Updated table
+	data      map[string]string // New values of the assigned columns
+	where     *rowFilter        // Rows to update
+	all       bool              // ALL keyword, allows updating every row in safe mode
+	returning *returningClause  // RETURNING clause, nil when no rows are returned
+}
+
+// queryUpdate parses and executes "UPDATE [ALL] table [[AS] alias] SET col = value, ... [WHERE condition]
+// [RETURNING col, ...]". In safe mode an UPDATE without WHERE must say ALL
+func (db *Database) queryUpdate(p *parser) (*Result, error) {
+	stmt, err := p.parseUpdate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPDATE command: %w", err)
+	}
+	returned, err := db.returningColumns(stmt.table, stmt.returning)
+	if err != nil {
+		return nil, err
+	}
+	if err := stmt.where.prepare(db); err != nil {
+		return nil, err
+	}
+	db.recordScan(stmt.table, stmt.where.cond)
+	updated, err := db.updateRows(p.ctx, p.tx, stmt.table, equalities(stmt.where.cond), stmt.where.condition(), stmt.data, stmt.all)
+	if err == nil {
+		err = stmt.where.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{RowsAffected: len(updated)}
+	if stmt.returning != nil {
+		result.Columns, result.Rows = returned, projectRows(updated, returned)
+	}
+	return result, nil
+}
+
+// parseUpdate parses an UPDATE command
+func (p *parser) parseUpdate() (*updateStmt, error) {
+	if err := p.expect("update"); err != nil {
+		return nil, err
+	}
+	stmt := &updateStmt{all: p.accept("all")}
+	tableName, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	alias, err := p.parseAlias()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.useTable(tableName, alias); err != nil {
+		return nil, err
+	}
+	stmt.table = tableName
+	if err := p.expect("set"); err != nil {
+		return nil, err
+	}
+	if stmt.data, err = p.parseAssignments("where", "returning"); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.parseOptionalWhere(stmt.all); err != nil {
+		return nil, err
+	}
+	if stmt.returning, err = p.parseReturning(); err != nil {
+		return nil, err
+	}
+	return stmt, p.expectEOF()
+}
+
+// deleteStmt is a parsed DELETE command
+type deleteStmt struct {
+	table     string           // Table to delete from
+	where     *rowFilter       // Rows to delete
+	all       bool             // ALL keyword, allows deleting every row in safe mode
+	returning *returningClause // RETURNING clause, nil when no rows are returned
+}
+
+// queryDelete parses and executes "DELETE [ALL] FROM table [[AS] alias] [WHERE condition] [RETURNING col, ...]".
+// In safe mode a DELETE without WHERE must say ALL
+func (db *Database) queryDelete(p *parser) (*Result, error) {
+	stmt, err := p.parseDelete()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DELETE command: %w", err)
+	}
+	returned, err := db.returningColumns(stmt.table, stmt.returning)
+	if err != nil {
+		return nil, err
+	}
+	if err := stmt.where.prepare(db); err != nil {
+		return nil, err
+	}
+	db.recordScan(stmt.table, stmt.where.cond)
+	deleted, err := db.deleteRows(p.ctx, p.tx, stmt.table, equalities(stmt.where.cond), stmt.where.condition(), stmt.all)
+	if err == nil {
+		err = stmt.where.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{RowsAffected: len(deleted)}
+	if stmt.returning != nil {
+		result.Columns, result.Rows = returned, projectRows(deleted, returned)
+	}
+	return result, nil
+}
+
+// parseDelete parses a DELETE command
+func (p *parser) parseDelete() (*deleteStmt, error) {
+	if err := p.expect("delete"); err != nil {
+		return nil, err
+	}
+	stmt := &deleteStmt{all: p.accept("all")}
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	alias, err := p.parseAlias()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.useTable(tableName, alias); err != nil {
+		return nil, err
+	}
+	stmt.table = tableName
+	if stmt.where, err = p.parseOptionalWhere(stmt.all); err != nil {
+		return nil, err
+	}
+	if stmt.returning, err = p.parseReturning(); err != nil {
+		return nil, err
+	}
+	return stmt, p.expectEOF()
+}
+
+// parseOptionalWhere parses a "WHERE condition" clause if there is one. A command
+// that said ALL cannot also have a condition
+func (p *parser) parseOptionalWhere(all bool) (*rowFilter, error) {
+	if all || !p.peek().is("where") {
+		return &rowFilter{ctx: p.ctx}, nil
+	}
+	return p.parseWhere()
+}
+
+// parseWhere parses a mandatory "WHERE condition" clause
+func (p *parser) parseWhere() (*rowFilter, error) {
+	if err := p.expect("where"); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	return &rowFilter{cond: cond, subqueries: p.subqueries, ctx: p.ctx}, nil
+}
+
+// parseValue parses a literal value. Quoted strings keep their content exactly,
+// while unquoted values run until the next comma or terminator and may contain
+// spaces. An unquoted NULL is returned as Null
+func (p *parser) parseValue(terminators ...string) (string, error) {
+	first := p.peek()
+	if first.kind == tokenString {
+		p.next()
+		return first.text, nil
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind == tokenEOF || tok.is(",") || isTerminator(tok, terminators) {
+			break
+		}
+		p.next()
+	}
+	if p.peek().pos == first.pos {
+		return "", p.unexpected()
+	}
+	value := strings.TrimSpace(p.input[first.pos:p.peek().pos])
+	if strings.EqualFold(value, "null") {
+		return Null, nil
+	}
+	return value, nil
+}
+
+// isTerminator reports whether the token is one of the given keywords or symbols
+func isTerminator(tok token, terminators []string) bool {
+	for _, t := range terminators {
+		if tok.is(t) {
+			return true
+		}
+	}
+	return false
+}
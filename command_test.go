@@ -0,0 +1,119 @@
+package MyDb
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// TestCreateTableWithTimestamps checks that both forms of CREATE TABLE take a trailing
+// WITH TIMESTAMPS, whether the last column has a type and attributes or not
+func TestCreateTableWithTimestamps(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"create table posts has id, title with timestamps", []string{"id", "title", "created_at", "updated_at"}},
+		{"create table posts has id int primary key, title text with timestamps", []string{"id", "title", "created_at", "updated_at"}},
+		{"create table posts has id, title default hello with timestamps", []string{"id", "title", "created_at", "updated_at"}},
+		{"create table posts (id, title) with timestamps", []string{"id", "title", "created_at", "updated_at"}},
+		{"create table posts has id, title", []string{"id", "title"}},
+	}
+	for _, tt := range tests {
+		db := NewDatabase("command_test", WithStorage(&MemoryStorage{}))
+		if _, err := db.Query(tt.query); err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := db.Tables["posts"].Columns; !slices.Equal(got, tt.want) {
+			t.Errorf("%s created columns %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestAlterTableAddColumn checks that ALTER TABLE ADD COLUMN takes the column definitions
+// of CREATE TABLE and fills the column in the existing rows, and that a column whose
+// constraints the rows break is not added, leaving the table as it was
+func TestAlterTableAddColumn(t *testing.T) {
+	unchanged := "[map[id:1 name:x] map[id:2 name:y]]"
+	tests := []struct {
+		command string
+		want    string // Rows of the table afterwards
+		fails   bool
+	}{
+		{"alter table b add column n int", unchanged, false},
+		{"alter table b add n int default 5", "[map[id:1 n:5 name:x] map[id:2 n:5 name:y]]", false},
+		{"alter table b add column day date default '2024-01-02'", "[map[day:2024-01-02 id:1 name:x] map[day:2024-01-02 id:2 name:y]]", false},
+		{"alter table b add column n int not null default 0", "[map[id:1 n:0 name:x] map[id:2 n:0 name:y]]", false},
+		{"alter table b add column seq auto_increment unique", "[map[id:1 name:x seq:1] map[id:2 name:y seq:2]]", false},
+		{"alter table b add column twice int as (id * 2)", "[map[id:1 name:x twice:2] map[id:2 name:y twice:4]]", false},
+		{"alter table b add column a_id int references a (id) default 1", "[map[a_id:1 id:1 name:x] map[a_id:1 id:2 name:y]]", false},
+		{"alter table b add column n int not null", unchanged, true},
+		{"alter table b add column n int default x", unchanged, true},
+		{"alter table b add column code unique default z", unchanged, true},
+		{"alter table b add column n int primary key", unchanged, true},
+		{"alter table b add column age int default 5 check (age > 10)", unchanged, true},
+		{"alter table b add column a_id int references a (id) default 2", unchanged, true},
+		{"alter table b add column name int", unchanged, true},
+	}
+	for _, tt := range tests {
+		db := NewDatabase("command_test", WithStorage(&MemoryStorage{}))
+		for _, command := range []string{
+			"create table a (id int primary key)",
+			"create table b (id int primary key, name)",
+			"insert into a values (1)",
+			"insert into b values (1, x), (2, y)",
+		} {
+			if _, err := db.Query(command); err != nil {
+				t.Fatalf("%s: %v", command, err)
+			}
+		}
+		_, err := db.Query(tt.command)
+		if (err != nil) != tt.fails {
+			t.Errorf("%s returned %v, want failure %v", tt.command, err, tt.fails)
+			continue
+		}
+		res, err := db.Query("get from b order by id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(res.Rows); got != tt.want {
+			t.Errorf("after %s the rows are %s, want %s", tt.command, got, tt.want)
+		}
+		if tt.fails {
+			if got := db.Tables["b"].Columns; !slices.Equal(got, []string{"id", "name"}) {
+				t.Errorf("after %s the columns are %v, want them unchanged", tt.command, got)
+			}
+			if _, err := db.Query("insert into b values (3, z)"); err != nil {
+				t.Errorf("after %s: %v", tt.command, err)
+			}
+		}
+	}
+
+	db := NewDatabase("command_test", WithStorage(&MemoryStorage{}))
+	if _, err := db.Query("create table b (id int primary key, name)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddColumnDef("b", ColumnDef{Name: "n", Type: Int, NotNull: true, Default: "7"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddColumnDef("b", ColumnDef{Name: "n", Type: Int}); err == nil {
+		t.Errorf("adding column n twice succeeded")
+	}
+	if err := db.InsertInto("b", map[string]string{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertInto("b", map[string]string{"id": "2", "n": "x"}); err == nil {
+		t.Errorf("inserting a string into the int column n succeeded")
+	}
+	if err := db.InsertInto("b", map[string]string{"id": "3", "n": Null}); err == nil {
+		t.Errorf("inserting NULL into the NOT NULL column n succeeded")
+	}
+	res, err := db.Query("get from b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(res.Rows); got != "[map[id:1 n:7]]" {
+		t.Errorf("rows are %s, want [map[id:1 n:7]]", got)
+	}
+}
@@ -0,0 +1,115 @@
+package MyDb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Codec compresses the data of tables when they are saved. GzipCodec is built in, and
+// other codecs, such as zstd, plug in by implementing this interface
+type Codec interface {
+	Name() string  // Name of the codec, the extension of the compressed files, e.g. "gz"
+	Magic() []byte // First bytes of compressed data, by which Load recognizes it
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCodec compresses with gzip
+type GzipCodec struct {
+	Level int // Level of compress/gzip, 0 for gzip.DefaultCompression
+}
+
+// Name returns "gz"
+func (c GzipCodec) Name() string {
+	return "gz"
+}
+
+// Magic returns the first bytes of gzip data
+func (c GzipCodec) Magic() []byte {
+	return []byte{0x1f, 0x8b}
+}
+
+// NewWriter returns a writer compressing to w
+func (c GzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// NewReader returns a reader decompressing from r
+func (c GzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// SetCompression sets the codec compressing the data of tables when they are saved, nil
+// to save them uncompressed, which is the default. DirStorage names the compressed files
+// after the codec, e.g. users.csv.gz. Load reads uncompressed data, gzip data and data
+// compressed with the codec set. The next Save saves every table with the new codec
+func (db *Database) SetCompression(codec Codec) error {
+	if codec != nil && (!isValidName(codec.Name()) || len(codec.Magic()) == 0) {
+		return fmt.Errorf("codec needs a name and magic bytes")
+	}
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+	db.codec = codec
+	db.markDirty(nil)
+	return nil
+}
+
+// storeTable saves the data that write writes as the data of a table, compressed with the
+// codec of the database and then encrypted with its key
+func (db *Database) storeTable(tableName string, write func(w io.Writer) error) error {
+	codec := db.codec
+	if codec == nil && db.crypter == nil {
+		return db.store().SaveTable(tableName, write)
+	}
+	ext := map[Format]string{CSV: ".csv", Gob: ".gob"}[db.format]
+	if codec != nil {
+		ext += "." + codec.Name()
+		uncompressed := write
+		write = func(w io.Writer) error {
+			cw, err := codec.NewWriter(w)
+			if err != nil {
+				return err
+			}
+			if err := uncompressed(cw); err != nil {
+				cw.Close()
+				return err
+			}
+			return cw.Close()
+		}
+	}
+	if db.crypter != nil {
+		ext += ".enc"
+		write = db.sealed("table "+tableName, write)
+	}
+	if dir, ok := db.store().(DirStorage); ok {
+		return dir.saveTableAs(tableName, func() string { return ext }, write)
+	}
+	return db.store().SaveTable(tableName, write)
+}
+
+// decompress returns a reader of the data of a table, decompressed when it starts with
+// the magic bytes of gzip or of the codec of the database
+func (db *Database) decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	for _, codec := range []Codec{db.codec, GzipCodec{}} {
+		if codec == nil {
+			continue
+		}
+		magic := codec.Magic()
+		if head, _ := br.Peek(len(magic)); bytes.Equal(head, magic) {
+			cr, err := codec.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress with %s: %w", codec.Name(), err)
+			}
+			return cr, nil
+		}
+	}
+	return io.NopCloser(br), nil
+}
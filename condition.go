@@ -0,0 +1,84 @@
+package MyDb
+
+import "strings"
+
+// Condition compares a column of a row against a value
+type Condition struct {
+	Column   string // Column to compare
+	Operator string // One of =, !=, >, <, >=, <=, like
+	Value    string // Value to compare against
+}
+
+// Match reports whether the row satisfies the condition. Values are compared
+// numerically when both sides are numbers and lexicographically otherwise
+func (c Condition) Match(row map[string]string) bool {
+	return matchOperator(c.Operator, row[c.Column], c.Value)
+}
+
+// matchOperator applies a comparison or LIKE operator to two values
+func matchOperator(op, left, right string) bool {
+	return matchTyped(op, String, left, right)
+}
+
+// matchTyped applies a comparison or LIKE operator to two values compared as the given type
+func matchTyped(op string, typ ColumnType, left, right string) bool {
+	if strings.EqualFold(op, "like") {
+		return Like(left, right)
+	}
+	cmp := typ.compare(left, right)
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Where returns a row filter that matches rows satisfying all the given conditions
+func Where(conditions ...Condition) func(row map[string]string) bool {
+	return func(row map[string]string) bool {
+		for _, c := range conditions {
+			if !c.Match(row) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Like reports whether value matches a SQL LIKE pattern, where % matches any
+// sequence of characters and _ matches exactly one character
+func Like(value, pattern string) bool {
+	v, p := []rune(value), []rune(pattern)
+	vi, pi := 0, 0
+	starP, starV := -1, 0 // Position of the last % in the pattern and the value index it matched from
+	for vi < len(v) {
+		switch {
+		case pi < len(p) && (p[pi] == '_' || p[pi] == v[vi]) && p[pi] != '%':
+			vi++
+			pi++
+		case pi < len(p) && p[pi] == '%':
+			starP, starV = pi, vi
+			pi++
+		case starP >= 0:
+			// Let the last % swallow one more character and retry
+			starV++
+			vi, pi = starV, starP+1
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '%' {
+		pi++
+	}
+	return pi == len(p)
+}
@@ -0,0 +1,142 @@
+package MyDb
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// CopyTable creates a table with the columns, constraints, indexes and foreign keys of
+// another, holding its rows when withData is set, e.g. to try a risky bulk update on a
+// copy first. Indexes named after the source table are named after the copy, and a
+// foreign key of the source table referencing itself references the copy
+func (db *Database) CopyTable(src, dst string, withData bool) error {
+	copies, err := db.copyTables(src)
+	if err != nil {
+		return err
+	}
+	c := copies[src]
+	if !withData {
+		c.rows, c.schema.LastID = nil, 0
+	}
+	renameIndexes := func(indexes []savedIndex) []savedIndex {
+		renamed := make([]savedIndex, len(indexes))
+		for i, ix := range indexes {
+			if rest, ok := strings.CutPrefix(ix.Name, src+"_"); ok {
+				ix.Name = dst + "_" + rest
+			}
+			renamed[i] = ix
+		}
+		return renamed
+	}
+	c.schema.Indexes = renameIndexes(c.schema.Indexes)
+	c.schema.FullText = renameIndexes(c.schema.FullText)
+	c.schema.Fuzzy = renameIndexes(c.schema.Fuzzy)
+	foreignKeys := make([]ForeignKey, len(c.schema.ForeignKeys))
+	for i, fk := range c.schema.ForeignKeys {
+		if fk.RefTable == src {
+			fk.RefTable = dst
+		}
+		foreignKeys[i] = fk
+	}
+	c.schema.ForeignKeys = foreignKeys
+
+	outside, err := db.createCopies(map[string]tableCopy{dst: c}, false)
+	if err != nil {
+		return err
+	}
+	if err := db.addForeignKeys(outside); err != nil {
+		db.DropTable(dst) // Do not leave a table without its constraints behind
+		return err
+	}
+	return nil
+}
+
+// Clone returns an independent copy of the database held in memory under another name,
+// for tests or what-if analysis that change the copy and leave the database alone. The
+// tables are copied at once with their schemas and rows, their indexes being rebuilt, and
+// the copy has the modes, isolation level, functions and stemmers of the database. It
+// saves to a MemoryStorage of its own
+func (db *Database) Clone(newName string) (*Database, error) {
+	copies, err := db.copyTables()
+	if err != nil {
+		return nil, err
+	}
+	for tableName, c := range copies {
+		rows := make([]map[string]string, len(c.rows))
+		for i, row := range c.rows {
+			rows[i] = copyRow(row)
+		}
+		c.rows = rows
+		copies[tableName] = c
+	}
+
+	clone := NewDatabase(newName, WithStorage(&MemoryStorage{}))
+	db.mu.RLock()
+	clone.safeMode, clone.strict, clone.isolation = db.safeMode, db.strict, db.isolation
+	clone.format = db.format
+	clone.stemmers = maps.Clone(db.stemmers)
+	db.mu.RUnlock()
+	db.funcsMu.RLock()
+	clone.funcs = maps.Clone(db.funcs)
+	db.funcsMu.RUnlock()
+	db.rowLocks.mu.Lock()
+	clone.rowLocks.timeout = db.rowLocks.timeout
+	db.rowLocks.mu.Unlock()
+
+	// Every table being copied, no foreign key is left to add
+	if _, err := clone.createCopies(copies, false); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// createTableAs creates the table of a CREATE TABLE ... AS SELECT command with the rows
+// of the SELECT. Columns read from a table keep their type, the others get the type
+// their values have
+func (db *Database) createTableAs(stmt *createTableStmt) (*Result, error) {
+	selected, err := db.execSelect(stmt.query)
+	if err != nil {
+		return nil, err
+	}
+	var sourceDefs []ColumnDef
+	if stmt.query.fields == nil && len(stmt.query.joins) == 0 {
+		if sourceDefs, err = db.tableDefs(stmt.query.table); err != nil {
+			return nil, err
+		}
+	}
+	defs := make([]ColumnDef, len(selected.Columns))
+	for i, col := range selected.Columns {
+		defs[i] = ColumnDef{Name: col}
+		switch {
+		case sourceDefs != nil:
+			defs[i].Type = sourceDefs[i].Type
+		case stmt.query.fields != nil && isColumnExpr(stmt.query.fields[i].value):
+			defs[i].Type = stmt.query.fields[i].value.(*columnExpr).typ
+		default:
+			var ti typeInference
+			for _, row := range selected.Rows {
+				if value, ok := row[col]; ok && value != Null {
+					ti.add(value)
+				}
+			}
+			defs[i].Type = ti.columnType()
+		}
+	}
+	if err := db.CreateTableWithSchema(stmt.table, defs); err != nil {
+		return nil, err
+	}
+	if len(selected.Rows) > 0 {
+		if err := db.InsertMany(stmt.table, selected.Rows); err != nil {
+			db.DropTable(stmt.table) // The table is created with its rows or not at all
+			return nil, fmt.Errorf("failed to insert the selected rows: %w", err)
+		}
+	}
+	return &Result{Columns: selected.Columns, RowsAffected: len(selected.Rows)}, nil
+}
+
+// isColumnExpr reports whether an expression reads a column
+func isColumnExpr(e expr) bool {
+	_, ok := e.(*columnExpr)
+	return ok
+}
@@ -0,0 +1,162 @@
+package MyDb
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Rows is a cursor over the rows of a table matching a condition, returned by QueryIter.
+// Rows are matched one at a time as Next moves to them, so that going through them takes
+// constant memory whatever their number, e.g.
+//
+//	rows, err := db.QueryIter("users", nil)
+//	...
+//	defer rows.Close()
+//	for rows.Next() {
+//		var u User
+//		if err := rows.Scan(&u); err != nil { ... }
+//	}
+//	err = rows.Err()
+type Rows struct {
+	ctx       context.Context
+	columns   []string
+	rows      []map[string]string // Snapshot of the rows of the table, nil once closed
+	condition func(row map[string]string) bool
+	pos       int               // Position of the next row to match
+	row       map[string]string // Current row, nil before the first and after the last
+	err       error
+}
+
+// QueryIter returns a cursor over the rows of a table matching the condition, every row
+// when it is nil. The cursor reads the rows as they were when it was returned, a
+// snapshot that copies no rows and holds no lock, whatever is written meanwhile
+func (db *Database) QueryIter(tableName string, condition func(row Row) bool) (*Rows, error) {
+	return db.QueryIterCtx(context.Background(), tableName, condition)
+}
+
+// QueryIterCtx is QueryIter whose cursor stops with the error of the context once it is
+// done
+func (db *Database) QueryIterCtx(ctx context.Context, tableName string, condition func(row Row) bool) (*Rows, error) {
+	db.mu.RLock() // Lock db first
+	table, exists := db.Tables[tableName]
+	if !exists {
+		db.mu.RUnlock()
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		db.mu.RUnlock()
+		return nil, err
+	}
+	table.mu.RLock() // Lock table second
+	columns, rows := table.Columns, table.snapshot()
+	table.mu.RUnlock()
+	db.mu.RUnlock()
+
+	if condition == nil {
+		condition = func(row Row) bool { return true }
+	}
+	return &Rows{ctx: ctx, columns: columns, rows: rows, condition: condition}, nil
+}
+
+// Next moves to the next matching row, and reports whether there is one. Once there is
+// none the cursor is closed, and Err tells whether it stopped on an error
+func (r *Rows) Next() bool {
+	r.row = nil
+	for r.rows != nil && r.pos < len(r.rows) {
+		if r.pos%cancelCheckRows == 0 && r.ctx.Err() != nil {
+			r.err = r.ctx.Err()
+			break
+		}
+		row := r.rows[r.pos]
+		r.pos++
+		if r.condition(row) {
+			r.row = row
+			return true
+		}
+	}
+	r.Close()
+	return false
+}
+
+// Columns returns the columns of the table in order
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// Row returns the current row, which must not be changed
+func (r *Rows) Row() map[string]string {
+	return r.row
+}
+
+// Scan copies the columns of the current row into the values dest points to. Given a
+// single pointer to a struct, Scan fills its fields like SelectInto. Otherwise dest holds
+// a pointer for every column in column order, a string, a number, a bool, a time.Time, a
+// []byte, a JSON document or any of them behind a pointer, and NULL gives a value its
+// zero value and a pointer nil. A pointer to an empty interface gets the stored string,
+// or nil for NULL
+func (r *Rows) Scan(dest ...any) error {
+	if r.row == nil {
+		return fmt.Errorf("Scan called without a current row, see Next")
+	}
+	if len(dest) == 1 {
+		if v := reflect.ValueOf(dest[0]); v.Kind() == reflect.Pointer && !v.IsNil() && v.Elem().Kind() == reflect.Struct && !isScannedValue(v.Elem()) {
+			return scanStruct(r.row, v.Elem())
+		}
+	}
+	if len(dest) != len(r.columns) {
+		return fmt.Errorf("Scan expected %d destinations, one for every column, got %d", len(r.columns), len(dest))
+	}
+	for i, d := range dest {
+		col := r.columns[i]
+		value, ok := r.row[col]
+		if !ok {
+			value = Null
+		}
+		if p, ok := d.(*any); ok {
+			if value == Null {
+				*p = nil
+			} else {
+				*p = value
+			}
+			continue
+		}
+		v := reflect.ValueOf(d)
+		if v.Kind() != reflect.Pointer || v.IsNil() {
+			return fmt.Errorf("Scan needs pointers, got %T for column %s", d, col)
+		}
+		if value == Null {
+			v.Elem().SetZero()
+			continue
+		}
+		if err := scanValue(value, v.Elem()); err != nil {
+			return fmt.Errorf("column %s: %w", col, err)
+		}
+	}
+	return nil
+}
+
+// Err returns the error that stopped the cursor, nil when it went through every row or
+// was closed
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close releases the rows of the cursor, after which Next returns false. Closing a
+// closed cursor does nothing
+func (r *Rows) Close() error {
+	r.rows, r.row = nil, nil
+	return nil
+}
+
+// isScannedValue reports whether a struct is scanned from a single column rather than
+// field by field, e.g. a time.Time
+func isScannedValue(v reflect.Value) bool {
+	switch v.Addr().Interface().(type) {
+	case *time.Time, encoding.TextUnmarshaler:
+		return true
+	}
+	return false
+}
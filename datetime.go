@@ -0,0 +1,124 @@
+package MyDb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	customLayouts   []string     // Layouts registered with SetDateLayouts
+	customLayoutsMu sync.RWMutex // Guards customLayouts
+)
+
+// SetDateLayouts sets additional layouts accepted for Date and DateTime values, in the
+// format of the time package, e.g. "02/01/2006" or "Jan 2, 2006 at 15:04". They are tried
+// after the built-in formats, and values are still stored in the built-in formats. The
+// layouts apply to every database of the process
+func SetDateLayouts(layouts ...string) {
+	customLayoutsMu.Lock()
+	defer customLayoutsMu.Unlock()
+	customLayouts = append([]string(nil), layouts...)
+}
+
+// parseCustomDate parses a value in one of the layouts registered with SetDateLayouts
+func parseCustomDate(value string) (time.Time, bool) {
+	customLayoutsMu.RLock()
+	defer customLayoutsMu.RUnlock()
+	for _, layout := range customLayouts {
+		if d, err := time.Parse(layout, value); err == nil {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// funcDateAdd adds an amount of a unit to a date or time: DATE_ADD(value, amount, unit)
+// with unit one of year, month, week, day, hour, minute or second. Dates stay dates
+// unless the unit is shorter than a day
+func funcDateAdd(args ...string) (string, error) {
+	if err := checkArgs(args, 3, 3); err != nil {
+		return "", err
+	}
+	d, ok := parseDateTime(args[0])
+	if !ok {
+		return "", fmt.Errorf("invalid date %q", args[0])
+	}
+	_, err := time.Parse(dateLayout, args[0])
+	isDate := err == nil
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid amount %q", args[1])
+	}
+	switch strings.TrimSuffix(strings.ToLower(args[2]), "s") {
+	case "year":
+		d = d.AddDate(n, 0, 0)
+	case "month":
+		d = d.AddDate(0, n, 0)
+	case "week":
+		d = d.AddDate(0, 0, 7*n)
+	case "day":
+		d = d.AddDate(0, 0, n)
+	case "hour":
+		d, isDate = d.Add(time.Duration(n)*time.Hour), false
+	case "minute":
+		d, isDate = d.Add(time.Duration(n)*time.Minute), false
+	case "second":
+		d, isDate = d.Add(time.Duration(n)*time.Second), false
+	default:
+		return "", fmt.Errorf("unknown unit %q", args[2])
+	}
+	if isDate {
+		return d.Format(dateLayout), nil
+	}
+	return d.UTC().Format(time.RFC3339Nano), nil
+}
+
+// strftimeVerbs maps the conversions of STRFTIME to time layouts
+var strftimeVerbs = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2",
+	'H': "15", 'I': "03", 'M': "04", 'S': "05", 'p': "PM",
+	'b': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+	'Z': "MST", 'z': "-0700",
+}
+
+// funcStrftime formats a date or time: STRFTIME(format, value), where the format uses
+// the conversions of C's strftime, e.g. '%Y-%m-%d %H:%M'. %j is the day of the year,
+// %w the day of the week with Sunday as 0 and %s the Unix time
+func funcStrftime(args ...string) (string, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return "", err
+	}
+	d, ok := parseDateTime(args[1])
+	if !ok {
+		return "", fmt.Errorf("invalid date %q", args[1])
+	}
+	format := args[0]
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch verb := format[i]; verb {
+		case '%':
+			b.WriteByte('%')
+		case 'j':
+			fmt.Fprintf(&b, "%03d", d.YearDay())
+		case 'w':
+			b.WriteString(strconv.Itoa(int(d.Weekday())))
+		case 's':
+			b.WriteString(strconv.FormatInt(d.Unix(), 10))
+		default:
+			layout, ok := strftimeVerbs[verb]
+			if !ok {
+				return "", fmt.Errorf("unknown conversion %%%c", verb)
+			}
+			b.WriteString(d.Format(layout))
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,823 @@
+package MyDb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DropTable removes a table from the database. Its CSV file is deleted on the next Save
+func (db *Database) DropTable(name string) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	if err := db.dropTable(name); err != nil {
+		return err
+	}
+	return db.checkpointDDL()
+}
+
+// DropTableNow removes a table from the database and deletes its CSV file right away
+func (db *Database) DropTableNow(name string) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	if err := db.dropTable(name); err != nil {
+		return err
+	}
+	if err := db.store().DeleteTable(name); err != nil {
+		return err
+	}
+	delete(db.dropped, name)
+	return db.checkpointDDL()
+}
+
+// dropTable removes a table and schedules its file for deletion, db.mu must be held
+func (db *Database) dropTable(name string) error {
+	table, exists := db.Tables[name]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", name)
+	}
+	err := db.referencing(name, func(childName string, child *Table, fk ForeignKey) error {
+		if child == table {
+			return nil
+		}
+		return fmt.Errorf("cannot drop table %s: it is referenced by %s", name, fk.describe(childName))
+	})
+	if err != nil {
+		return err
+	}
+	delete(db.Tables, name)
+	if db.dropped == nil {
+		db.dropped = make(map[string]bool)
+	}
+	db.dropped[name] = true
+	return nil
+}
+
+// queryDropTable parses and executes "DROP TABLE [IF EXISTS] name"
+func (db *Database) queryDropTable(p *parser) (*Result, error) {
+	tableName, ifExists, err := p.parseDropTable()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DROP TABLE command: %w", err)
+	}
+	if ifExists {
+		if _, err := db.tableColumns(tableName); err != nil {
+			return &Result{}, nil
+		}
+	}
+	if err := db.DropTable(tableName); err != nil {
+		return nil, err
+	}
+	return &Result{}, nil
+}
+
+// parseDropTable parses the table name of a DROP TABLE command
+func (p *parser) parseDropTable() (string, bool, error) {
+	if err := p.expect("drop"); err != nil {
+		return "", false, err
+	}
+	if err := p.expect("table"); err != nil {
+		return "", false, err
+	}
+	ifExists := false
+	if p.accept("if") {
+		if err := p.expect("exists"); err != nil {
+			return "", false, err
+		}
+		ifExists = true
+	}
+	tableName, err := p.parseName()
+	if err != nil {
+		return "", false, err
+	}
+	return tableName, ifExists, p.expectEOF()
+}
+
+// Truncate removes every row of a table but keeps its columns. The old rows are
+// released rather than kept alive in the backing array of the slice
+func (db *Database) Truncate(tableName string) error {
+	_, err := db.truncate(tableName)
+	return err
+}
+
+// truncate empties a table and returns how many rows it held
+func (db *Database) truncate(tableName string) (int, error) {
+	var removed int
+	err := db.retryLocked(context.Background(), nil, func() (err error) {
+		removed, err = db.tryTruncate(tableName)
+		return err
+	})
+	return removed, err
+}
+
+// tryTruncate is truncate without waiting for rows locked by transactions, for which it
+// returns a *rowWait error
+func (db *Database) tryTruncate(tableName string) (int, error) {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	// Rows referencing the table are deleted or protect it like with DELETE
+	l, err := db.linkedTables(tableName, deleting)
+	if err != nil {
+		return 0, err
+	}
+	l.lock() // Lock tables second
+	defer l.unlock()
+	table := l.tables[tableName]
+	all := make(map[int]bool, len(table.Rows))
+	for i := range table.Rows {
+		all[i] = true
+	}
+	removed, err := l.deleteCascading(tableName, table, all)
+	if err != nil {
+		return 0, err
+	}
+	table.Rows = []map[string]string{}
+	return len(removed), table.rebuildIndexes(tableName)
+}
+
+// queryTruncate parses and executes "TRUNCATE [TABLE] name"
+func (db *Database) queryTruncate(p *parser) (*Result, error) {
+	tableName, err := p.parseTruncate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRUNCATE command: %w", err)
+	}
+	removed, err := db.truncate(tableName)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{RowsAffected: removed}, nil
+}
+
+// parseTruncate parses the table name of a TRUNCATE command
+func (p *parser) parseTruncate() (string, error) {
+	if err := p.expect("truncate"); err != nil {
+		return "", err
+	}
+	p.accept("table")
+	tableName, err := p.parseName()
+	if err != nil {
+		return "", err
+	}
+	return tableName, p.expectEOF()
+}
+
+// RenameTable renames a table and its saved data and blobs, if the table was already saved
+func (db *Database) RenameTable(oldName, newName string) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	if !isValidName(newName) {
+		return fmt.Errorf("invalid table name: %s", newName)
+	}
+	table, exists := db.Tables[oldName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", oldName)
+	}
+	if _, exists := db.Tables[newName]; exists {
+		return fmt.Errorf("table %s already exists", newName)
+	}
+	if err := db.use(oldName, table); err != nil {
+		return err // Its data is saved under the old name
+	}
+
+	delete(db.dropped, newName)
+	delete(db.Tables, oldName)
+	db.Tables[newName] = table
+
+	// Foreign keys follow the referenced table
+	for _, other := range db.Tables {
+		other.mu.Lock()
+		for i := range other.foreignKeys {
+			if other.foreignKeys[i].RefTable == oldName {
+				other.foreignKeys[i].RefTable = newName
+			}
+		}
+		other.mu.Unlock()
+	}
+
+	// Move the saved data along with the table
+	if err := db.renameSaved(oldName, newName, table); err != nil {
+		return err
+	}
+	return db.checkpointDDL()
+}
+
+// renameSaved saves a renamed table under its new name, if it was saved under the old one,
+// and renames it in the saved schema. The db lock must be held
+func (db *Database) renameSaved(oldName, newName string, table *Table) error {
+	names, err := db.store().ListTables()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // Nothing saved yet
+	}
+	if err != nil || !contains(names, oldName) {
+		return err
+	}
+	schema, err := db.readSchema()
+	if err != nil {
+		return err
+	}
+
+	table.mu.RLock() // Lock table second
+	err = db.saveTableFiles(newName, table, db.wal.lastSeq())
+	if err == nil && schema != nil {
+		delete(schema.Tables, oldName)
+		schema.Tables[newName] = table.schema()
+		for _, saved := range schema.Tables {
+			for i := range saved.ForeignKeys {
+				if saved.ForeignKeys[i].RefTable == oldName {
+					saved.ForeignKeys[i].RefTable = newName
+				}
+			}
+		}
+		err = db.writeSchema(*schema)
+	}
+	table.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return db.store().DeleteTable(oldName)
+}
+
+// AddColumn adds a column to a table, filling it with defaultValue in every existing row.
+// A non-empty defaultValue is also given to rows inserted later without the column. An
+// empty or Null defaultValue leaves the column NULL, like in rows inserted without it
+func (db *Database) AddColumn(tableName, column, defaultValue string) error {
+	if defaultValue == Null {
+		defaultValue = ""
+	}
+	return db.AddColumnDef(tableName, ColumnDef{Name: column, Default: defaultValue})
+}
+
+// AddColumnDef adds a column defined like those of CreateTableWithSchema to a table.
+// Existing rows get its default value or the result of its default function, the next
+// ids for an auto-increment column, the current time for a timestamp column and the
+// value of its expression for a generated column. It fails, leaving the table as it
+// was, if the rows would then break a NOT NULL, PRIMARY KEY or UNIQUE constraint
+func (db *Database) AddColumnDef(tableName string, col ColumnDef) error {
+	return db.addColumn(tableName, col, nil, nil)
+}
+
+// addColumn adds a column to a table along with CHECK constraints and foreign keys on
+// it, as declared by ALTER TABLE ... ADD COLUMN. Either all of them are added or none
+func (db *Database) addColumn(tableName string, col ColumnDef, checks []string, foreignKeys []ForeignKey) error {
+	// Parse the expressions before locking, as parsing looks up functions
+	columns, err := db.tableDefs(tableName)
+	if err != nil {
+		return err
+	}
+	columns = append(columns, col)
+	var gen generatedColumn
+	isGenerated := col.Generated != ""
+	if isGenerated {
+		generated, err := db.parseGenerated(tableName, columns)
+		if err != nil {
+			return err
+		}
+		gen = generated[col.Name]
+	}
+	conditions := make([]checkConstraint, len(checks))
+	for i, check := range checks {
+		cond, used, err := db.parseColumnsCondition(tableName, columns, check, "check constraint")
+		if err != nil {
+			return err
+		}
+		conditions[i] = checkConstraint{text: strings.TrimSpace(check), cond: cond, columns: used}
+	}
+
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	col, err = db.checkColumnDef(col)
+	if err != nil {
+		return err
+	}
+	if contains(table.Columns, col.Name) {
+		return fmt.Errorf("column %s already exists in table %s", col.Name, tableName)
+	}
+	for _, other := range table.Columns {
+		def := table.columnDef(other)
+		switch {
+		case col.AutoIncrement && def.AutoIncrement:
+			return fmt.Errorf("table %s has more than one auto-increment column", tableName)
+		case isGenerated && def.Generated != "" && contains(gen.columns, other):
+			return fmt.Errorf("generated column %s cannot use generated column %s", col.Name, other)
+		}
+	}
+	for _, used := range gen.columns {
+		if used != col.Name && !contains(table.Columns, used) {
+			return fmt.Errorf("column %s does not exist in table %s", used, tableName)
+		}
+	}
+	if col.PrimaryKey && table.primaryKey != nil {
+		return fmt.Errorf("table %s already has a primary key", tableName)
+	}
+	l := &tableLocks{tables: map[string]*Table{tableName: table}, write: map[*Table]bool{table: true}}
+	for _, fk := range foreignKeys {
+		parent, exists := db.Tables[fk.RefTable]
+		if !exists {
+			return fmt.Errorf("table %s does not exist", fk.RefTable)
+		}
+		l.tables[fk.RefTable] = parent
+	}
+	for name, table := range l.tables {
+		if err := db.use(name, table); err != nil {
+			return err
+		}
+	}
+
+	l.lock() // Lock tables second
+	err = db.addTableColumn(tableName, table, col, gen, conditions, foreignKeys, l)
+	table.dirty = true
+	l.unlock()
+	if err != nil {
+		return err
+	}
+	return db.checkpointDDL()
+}
+
+// addTableColumn adds a column, generated when gen has an expression, and the CHECK
+// constraints and foreign keys on it to the table, filling the column in the existing
+// rows. The table is left as it was when the rows break a constraint. The locks of
+// the table and of the tables the foreign keys reference must be held
+func (db *Database) addTableColumn(tableName string, table *Table, col ColumnDef, gen generatedColumn, checks []checkConstraint, foreignKeys []ForeignKey, l *tableLocks) error {
+	rows := make([]map[string]string, len(table.Rows))
+	lastID, now := table.lastID, timestampNow()
+	for i, row := range table.Rows {
+		rows[i] = copyRow(row)
+		value := Null
+		switch {
+		case col.AutoIncrement:
+			lastID++
+			value = strconv.FormatInt(lastID, 10)
+		case col.CreatedAt || col.UpdatedAt:
+			value = now
+		case col.DefaultFunc != "":
+			fn, _ := db.lookupFunction(col.DefaultFunc)
+			var err error
+			if value, err = fn(); err == nil {
+				value, err = col.Type.normalize(value)
+			}
+			if err != nil {
+				return fmt.Errorf("default of column %s of table %s: %w", col.Name, tableName, err)
+			}
+		case col.Default != "":
+			value = col.Default
+		case gen.value != nil:
+			var err error
+			if value, err = gen.value.eval(rows[i]); err == nil && value != Null {
+				value, err = col.Type.normalize(value)
+			}
+			if err != nil {
+				return fmt.Errorf("generated column %s of table %s: %w", col.Name, tableName, err)
+			}
+		}
+		if value != Null {
+			rows[i][col.Name] = value
+		}
+	}
+
+	oldColumns, oldRows, oldLastID := table.Columns, table.Rows, table.lastID
+	oldGenerated, oldPrimaryKey, oldUnique := table.generated, table.primaryKey, table.unique
+	oldChecks, oldForeignKeys := table.checks, table.foreignKeys
+	table.Columns = append(append([]string(nil), table.Columns...), col.Name)
+	table.setColumnDef(col)
+	if gen.value != nil {
+		table.generated = maps.Clone(table.generated)
+		if table.generated == nil {
+			table.generated = make(map[string]generatedColumn)
+		}
+		table.generated[col.Name] = gen
+	}
+	if col.PrimaryKey {
+		table.primaryKey = newUniqueIndex("primary key", []string{col.Name})
+	}
+	if col.Unique {
+		table.unique = append(slices.Clip(table.unique), newUniqueIndex("unique key", []string{col.Name}))
+	}
+	table.checks = append(slices.Clip(table.checks), checks...)
+	table.foreignKeys = append(slices.Clip(table.foreignKeys), foreignKeys...)
+	if col.AutoIncrement {
+		table.lastID = lastID
+	}
+	table.Rows = rows
+	table.shared.Store(false)
+
+	err := table.rebuildIndexes(tableName)
+	for _, fk := range foreignKeys {
+		if err == nil {
+			err = checkForeignKey(tableName, table, l.tables[fk.RefTable], fk)
+		}
+	}
+	if err == nil {
+		err = l.checkReferences(tableName, table, table.Rows)
+	}
+	if err != nil {
+		// Put the table back as it was, the old rows being shared with snapshots maybe
+		table.Columns, table.Rows, table.lastID = oldColumns, oldRows, oldLastID
+		table.generated, table.primaryKey, table.unique = oldGenerated, oldPrimaryKey, oldUnique
+		table.checks, table.foreignKeys = oldChecks, oldForeignKeys
+		delete(table.defs, col.Name)
+		table.shared.Store(true)
+		table.rebuildIndexes(tableName)
+		return err
+	}
+	return nil
+}
+
+// DropColumn removes a column and its values from a table
+func (db *Database) DropColumn(tableName, column string) error {
+	return db.alterTable(tableName, func(table *Table) error {
+		if !contains(table.Columns, column) {
+			return fmt.Errorf("column %s does not exist in table %s", column, tableName)
+		}
+		if len(table.Columns) == 1 {
+			return fmt.Errorf("cannot drop the only column of table %s", tableName)
+		}
+		if table.columnDef(column).PrimaryKey {
+			return fmt.Errorf("cannot drop primary key column %s of table %s", column, tableName)
+		}
+		if check, used := table.usedByCheck(column); used {
+			return fmt.Errorf("cannot drop column %s of table %s: it is used by check constraint (%s)", column, tableName, check)
+		}
+		if generated, used := table.usedByGenerated(column); used {
+			return fmt.Errorf("cannot drop column %s of table %s: it is used by generated column %s", column, tableName, generated)
+		}
+		for _, fk := range table.foreignKeys {
+			if contains(fk.Columns, column) {
+				return fmt.Errorf("cannot drop column %s of table %s: it is part of %s", column, tableName, fk.describe(tableName))
+			}
+		}
+		err := db.referencing(tableName, func(childName string, child *Table, fk ForeignKey) error {
+			if contains(fk.RefColumns, column) {
+				return fmt.Errorf("cannot drop column %s of table %s: it is referenced by %s", column, tableName, fk.describe(childName))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		var columns []string
+		for _, col := range table.Columns {
+			if col != column {
+				columns = append(columns, col)
+			}
+		}
+		table.Columns = columns
+		delete(table.defs, column)
+		delete(table.generated, column)
+
+		// UNIQUE constraints involving the column go with it
+		var unique []*uniqueIndex
+		for _, ix := range table.unique {
+			if !contains(ix.columns, column) {
+				unique = append(unique, ix)
+			}
+		}
+		table.unique = unique
+
+		// And so do the indexes
+		var indexes []*secondaryIndex
+		for _, ix := range table.indexes {
+			if !contains(ix.columns, column) && !contains(ix.exprColumns, column) && !contains(ix.filterColumns, column) {
+				indexes = append(indexes, ix)
+			}
+		}
+		table.indexes = indexes
+		var fullText []*fullTextIndex
+		for _, ix := range table.fullText {
+			if ix.column != column {
+				fullText = append(fullText, ix)
+			}
+		}
+		table.fullText = fullText
+		var fuzzy []*trigramIndex
+		for _, ix := range table.fuzzy {
+			if ix.column != column {
+				fuzzy = append(fuzzy, ix)
+			}
+		}
+		table.fuzzy = fuzzy
+		return table.rewriteRows(tableName, func(row map[string]string) {
+			delete(row, column)
+		})
+	})
+}
+
+// RenameColumn renames a column of a table, moving its values in every row
+func (db *Database) RenameColumn(tableName, oldName, newName string) error {
+	if !isValidName(newName) {
+		return fmt.Errorf("invalid column name: %s", newName)
+	}
+	return db.alterTable(tableName, func(table *Table) error {
+		if !contains(table.Columns, oldName) {
+			return fmt.Errorf("column %s does not exist in table %s", oldName, tableName)
+		}
+		if contains(table.Columns, newName) {
+			return fmt.Errorf("column %s already exists in table %s", newName, tableName)
+		}
+		if check, used := table.usedByCheck(oldName); used {
+			return fmt.Errorf("cannot rename column %s of table %s: it is used by check constraint (%s)", oldName, tableName, check)
+		}
+		if generated, used := table.usedByGenerated(oldName); used {
+			return fmt.Errorf("cannot rename column %s of table %s: it is used by generated column %s", oldName, tableName, generated)
+		}
+		for _, ix := range table.indexes {
+			if contains(ix.exprColumns, oldName) || contains(ix.filterColumns, oldName) {
+				return fmt.Errorf("cannot rename column %s of table %s: it is used by index %s", oldName, tableName, ix.name)
+			}
+		}
+		if gen, ok := table.generated[oldName]; ok {
+			delete(table.generated, oldName)
+			table.generated[newName] = gen
+		}
+		columns := make([]string, len(table.Columns))
+		for i, col := range table.Columns {
+			if col == oldName {
+				col = newName
+			}
+			columns[i] = col
+		}
+		table.Columns = columns
+		def := table.columnDef(oldName)
+		delete(table.defs, oldName)
+		def.Name = newName
+		table.setColumnDef(def)
+		for _, ix := range table.uniqueIndexes() {
+			renameIn(ix.columns, oldName, newName)
+		}
+		for _, ix := range table.indexes {
+			renameIn(ix.columns, oldName, newName)
+		}
+		for _, ix := range table.fullText {
+			if ix.column == oldName {
+				ix.column = newName
+			}
+		}
+		for _, ix := range table.fuzzy {
+			if ix.column == oldName {
+				ix.column = newName
+			}
+		}
+		for _, fk := range table.foreignKeys {
+			renameIn(fk.Columns, oldName, newName)
+		}
+		for _, other := range db.Tables {
+			for _, fk := range other.foreignKeys {
+				if fk.RefTable == tableName {
+					renameIn(fk.RefColumns, oldName, newName)
+				}
+			}
+		}
+		return table.rewriteRows(tableName, func(row map[string]string) {
+			if value, ok := row[oldName]; ok {
+				row[newName] = value
+				delete(row, oldName)
+			}
+		})
+	})
+}
+
+// renameIn replaces a column name in a list of columns
+func renameIn(columns []string, oldName, newName string) {
+	for i, col := range columns {
+		if col == oldName {
+			columns[i] = newName
+		}
+	}
+}
+
+// alterTable runs a schema change on a table while holding its locks
+func (db *Database) alterTable(tableName string, change func(table *Table) error) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		return err
+	}
+
+	table.mu.Lock() // Lock table second
+	err := change(table)
+	table.dirty = true
+	table.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return db.checkpointDDL()
+}
+
+// queryAlterTable parses and executes "ALTER TABLE name RENAME TO new_name",
+// "ALTER TABLE name ADD [COLUMN] col [type] [attributes]" with the column definitions of
+// CREATE TABLE, "ALTER TABLE name DROP [COLUMN] col"
+// "ALTER TABLE name RENAME COLUMN col TO new_col", "ALTER TABLE name ADD UNIQUE (col, ...)"
+// "ALTER TABLE name ADD FOREIGN KEY (col, ...) REFERENCES table (col, ...) [ON DELETE action]"
+// and "ALTER TABLE name ADD CHECK (condition)"
+func (db *Database) queryAlterTable(p *parser) (*Result, error) {
+	alter, err := p.parseAlterTable()
+	if err != nil {
+		return nil, fmt.Errorf("invalid ALTER TABLE command: %w", err)
+	}
+	if err := alter(db); err != nil {
+		return nil, err
+	}
+	return &Result{}, nil
+}
+
+// parseAlterTable parses an ALTER TABLE command into the change it applies
+func (p *parser) parseAlterTable() (func(db *Database) error, error) {
+	if err := p.expect("alter"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("table"); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+
+	var alter func(db *Database) error
+	switch {
+	case p.accept("add"):
+		if p.accept("unique") {
+			columns, err := p.parseNameList()
+			if err != nil {
+				return nil, err
+			}
+			alter = func(db *Database) error { return db.AddUnique(tableName, columns...) }
+			break
+		}
+		if p.peek().is("check") {
+			check, err := p.parseCheck()
+			if err != nil {
+				return nil, err
+			}
+			alter = func(db *Database) error { return db.AddCheck(tableName, check) }
+			break
+		}
+		if p.accept("foreign") {
+			if err := p.expect("key"); err != nil {
+				return nil, err
+			}
+			columns, err := p.parseNameList()
+			if err != nil {
+				return nil, err
+			}
+			fk, err := p.parseReferences(columns)
+			if err != nil {
+				return nil, err
+			}
+			alter = func(db *Database) error { return db.AddForeignKey(tableName, fk) }
+			break
+		}
+		p.accept("column")
+		var stmt createTableStmt
+		col, err := p.parseColumnDef(&stmt)
+		if err != nil {
+			return nil, err
+		}
+		alter = func(db *Database) error { return db.addColumn(tableName, col, stmt.checks, stmt.foreignKeys) }
+
+	case p.accept("drop"):
+		p.accept("column")
+		column, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		alter = func(db *Database) error { return db.DropColumn(tableName, column) }
+
+	case p.accept("rename"):
+		if p.accept("column") {
+			oldName, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("to"); err != nil {
+				return nil, err
+			}
+			newName, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			alter = func(db *Database) error { return db.RenameColumn(tableName, oldName, newName) }
+			break
+		}
+		if err := p.expect("to"); err != nil {
+			return nil, err
+		}
+		newName, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		alter = func(db *Database) error { return db.RenameTable(tableName, newName) }
+
+	default:
+		return nil, p.unexpected()
+	}
+	return alter, p.expectEOF()
+}
+
+// queryCreateIndex parses and executes "CREATE [UNIQUE | ORDERED] INDEX ON table (col, ...)
+// [WHERE condition]", "CREATE [ORDERED] INDEX ON table (expression) [WHERE condition]",
+// "CREATE FULLTEXT INDEX ON table (col) [USING stemmer]" and "CREATE FUZZY INDEX ON table
+// (col)". Indexes get the names of CreateIndex and the other functions creating them
+func (db *Database) queryCreateIndex(p *parser) (*Result, error) {
+	create, err := p.parseCreateIndex()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CREATE INDEX command: %w", err)
+	}
+	if err := create(db); err != nil {
+		return nil, err
+	}
+	return &Result{}, nil
+}
+
+// parseCreateIndex parses a CREATE INDEX command into the index it creates
+func (p *parser) parseCreateIndex() (func(db *Database) error, error) {
+	if err := p.expect("create"); err != nil {
+		return nil, err
+	}
+	kind := ""
+	for _, k := range []string{"unique", "ordered", "fulltext", "fuzzy"} {
+		if p.accept(k) {
+			kind = k
+			break
+		}
+	}
+	if err := p.expect("index"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("on"); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+
+	// A list of names is a list of columns, anything else an expression
+	start := p.pos
+	columns, err := p.parseNameList()
+	expression := ""
+	if err != nil {
+		p.pos = start
+		if expression, err = p.parseParenthesized(); err != nil {
+			return nil, err
+		}
+		if kind != "" && kind != "ordered" {
+			return nil, fmt.Errorf("%s index must be on columns", kind)
+		}
+	}
+	if (kind == "fulltext" || kind == "fuzzy") && len(columns) != 1 {
+		return nil, fmt.Errorf("%s index must have one column", kind)
+	}
+
+	var options []IndexOption
+	if kind == "ordered" {
+		options = append(options, Ordered())
+	}
+	if kind != "fulltext" && kind != "fuzzy" && kind != "unique" && p.accept("where") {
+		if p.peek().kind == tokenEOF {
+			return nil, p.unexpected()
+		}
+		options = append(options, WithFilter(p.input[p.peek().pos:]))
+		p.pos = len(p.tokens) - 1
+	}
+	var fullTextOptions []FullTextOption
+	if kind == "fulltext" && p.accept("using") {
+		stemmer, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		fullTextOptions = append(fullTextOptions, WithStemmer(stemmer))
+	}
+
+	var create func(db *Database) error
+	switch {
+	case kind == "unique":
+		create = func(db *Database) error { return db.CreateUniqueIndex(tableName, columns...) }
+	case kind == "fulltext":
+		create = func(db *Database) error { return db.CreateFullTextIndex(tableName, columns[0], fullTextOptions...) }
+	case kind == "fuzzy":
+		create = func(db *Database) error { return db.CreateFuzzyIndex(tableName, columns[0]) }
+	case expression != "":
+		create = func(db *Database) error { return db.CreateExpressionIndex(tableName, expression, options...) }
+	default:
+		create = func(db *Database) error { return db.CreateCompositeIndex(tableName, columns, options...) }
+	}
+	return create, p.expectEOF()
+}
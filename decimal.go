@@ -0,0 +1,74 @@
+package MyDb
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// decimalDivisionScale is the number of decimal places kept when a division does not
+// have an exact decimal result
+const decimalDivisionScale = 18
+
+// parseDecimal parses a decimal number such as "12.50" or "-1e3" exactly
+func parseDecimal(value string) (*big.Rat, bool) {
+	if strings.ContainsAny(value, "/_") {
+		return nil, false // Fractions and digit separators are not decimals
+	}
+	return new(big.Rat).SetString(value)
+}
+
+// formatDecimal formats a number without trailing zeros, rounded to decimalDivisionScale
+// decimal places when it has no exact decimal form
+func formatDecimal(d *big.Rat) string {
+	// The denominator of a finite decimal only has the factors 2 and 5
+	denom := new(big.Int).Set(d.Denom())
+	places := 0
+	for _, factor := range []int64{2, 5} {
+		f := big.NewInt(factor)
+		n := 0
+		for new(big.Int).Mod(denom, f).Sign() == 0 {
+			denom.Div(denom, f)
+			n++
+		}
+		places = max(places, n)
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		places = decimalDivisionScale
+	}
+	s := d.FloatString(places)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+// decimalArith applies an arithmetic operator to two numbers exactly
+func decimalArith(op, left, right string) (string, error) {
+	x, ok := parseDecimal(left)
+	if !ok {
+		return "", fmt.Errorf("%q is not a number", left)
+	}
+	y, ok := parseDecimal(right)
+	if !ok {
+		return "", fmt.Errorf("%q is not a number", right)
+	}
+	z := new(big.Rat)
+	switch op {
+	case "+":
+		z.Add(x, y)
+	case "-":
+		z.Sub(x, y)
+	case "*":
+		z.Mul(x, y)
+	default:
+		if y.Sign() == 0 {
+			return "", fmt.Errorf("division by zero")
+		}
+		z.Quo(x, y)
+	}
+	return formatDecimal(z), nil
+}
@@ -0,0 +1,189 @@
+package MyDb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TableSchema describes the structure of a table
+type TableSchema struct {
+	Name        string       // Table name
+	Columns     []ColumnDef  // Column definitions in order
+	PrimaryKey  []string     // Columns of the primary key, nil when the table has none
+	Unique      [][]string   // Columns of each UNIQUE constraint
+	ForeignKeys []ForeignKey // Foreign keys referencing other tables
+	Checks      []string     // Conditions of the CHECK constraints
+}
+
+// IndexInfo describes an index of a table
+type IndexInfo struct {
+	Name       string   // Index name, to drop it with DropIndex
+	Columns    []string // Indexed columns
+	Primary    bool     // Whether the index is the primary key
+	Unique     bool     // Whether rows may not share the same values in all of the columns
+	Ordered    bool     // Whether the index answers range conditions and ORDER BY
+	FullText   bool     // Whether the index is a full-text index
+	Fuzzy      bool     // Whether the index is a trigram index for fuzzy matching
+	Filter     string   // Condition of the rows of a partial index, empty when it holds every row
+	Expression string   // Indexed expression of an expression index, whose Columns are those it reads
+}
+
+// ListTables returns the names of the tables of the database in alphabetical order
+func (db *Database) ListTables() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	names := make([]string, 0, len(db.Tables))
+	for name := range db.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DescribeTable returns the columns and constraints of a table
+func (db *Database) DescribeTable(tableName string) (TableSchema, error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return TableSchema{}, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	schema := TableSchema{Name: tableName, Columns: make([]ColumnDef, len(table.Columns))}
+	for i, col := range table.Columns {
+		schema.Columns[i] = table.columnDef(col)
+	}
+	if table.primaryKey != nil {
+		schema.PrimaryKey = append([]string(nil), table.primaryKey.columns...)
+	}
+	for _, ix := range table.unique {
+		schema.Unique = append(schema.Unique, append([]string(nil), ix.columns...))
+	}
+	for _, fk := range table.foreignKeys {
+		fk.Columns = append([]string(nil), fk.Columns...)
+		fk.RefColumns = append([]string(nil), fk.RefColumns...)
+		schema.ForeignKeys = append(schema.ForeignKeys, fk)
+	}
+	for _, check := range table.checks {
+		schema.Checks = append(schema.Checks, check.text)
+	}
+	return schema, nil
+}
+
+// ListIndexes returns the indexes of a table: the primary key, the unique indexes
+// including those of UNIQUE constraints, then the indexes created with CreateIndex and
+// CreateCompositeIndex, then the full-text and fuzzy indexes
+func (db *Database) ListIndexes(tableName string) ([]IndexInfo, error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	var indexes []IndexInfo
+	if table.primaryKey != nil {
+		indexes = append(indexes, IndexInfo{Name: tableName + "_pkey", Columns: append([]string(nil), table.primaryKey.columns...), Primary: true, Unique: true})
+	}
+	for _, ix := range table.unique {
+		indexes = append(indexes, IndexInfo{Name: uniqueIndexName(tableName, ix.columns), Columns: append([]string(nil), ix.columns...), Unique: true})
+	}
+	for _, ix := range table.indexes {
+		info := IndexInfo{Name: ix.name, Columns: append([]string(nil), ix.columns...), Ordered: ix.ordered, Filter: ix.filter}
+		if ix.expression != nil {
+			info.Columns, info.Expression = append([]string(nil), ix.exprColumns...), ix.columns[0]
+		}
+		indexes = append(indexes, info)
+	}
+	for _, ix := range table.fullText {
+		indexes = append(indexes, IndexInfo{Name: ix.name, Columns: []string{ix.column}, FullText: true})
+	}
+	for _, ix := range table.fuzzy {
+		indexes = append(indexes, IndexInfo{Name: ix.name, Columns: []string{ix.column}, Fuzzy: true})
+	}
+	return indexes, nil
+}
+
+// queryShowTables parses "SHOW TABLES" and returns one row per table
+func (db *Database) queryShowTables(p *parser) (*Result, error) {
+	if err := p.expect("show"); err != nil {
+		return nil, err
+	}
+	err := p.expect("tables")
+	if err == nil {
+		err = p.expectEOF()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid SHOW command: %w", err)
+	}
+	result := &Result{Columns: []string{"table"}}
+	for _, name := range db.ListTables() {
+		result.Rows = append(result.Rows, map[string]string{"table": name})
+	}
+	return result, nil
+}
+
+// queryDescribe parses "DESCRIBE name" or "DESC name" and returns one row per column
+// with its type, whether it can be NULL, its key, its default and other attributes
+func (db *Database) queryDescribe(p *parser) (*Result, error) {
+	if !p.accept("describe") && !p.accept("desc") {
+		return nil, p.unexpected()
+	}
+	tableName, err := p.parseName()
+	if err == nil {
+		err = p.expectEOF()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid DESCRIBE command: %w", err)
+	}
+	schema, err := db.DescribeTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Columns: []string{"column", "type", "null", "key", "default", "extra"}}
+	for _, def := range schema.Columns {
+		row := map[string]string{"column": def.Name, "type": def.Type.String(), "null": "yes"}
+		if def.NotNull || def.PrimaryKey {
+			row["null"] = "no"
+		}
+		switch {
+		case def.PrimaryKey:
+			row["key"] = "primary"
+		case def.Unique:
+			row["key"] = "unique"
+		}
+		switch {
+		case def.DefaultFunc != "":
+			row["default"] = def.DefaultFunc + "()"
+		case def.Default != "":
+			row["default"] = def.Default
+		}
+		var extra []string
+		if def.AutoIncrement {
+			extra = append(extra, "auto_increment")
+		}
+		if def.Generated != "" {
+			extra = append(extra, "generated as ("+def.Generated+")")
+		}
+		if def.CreatedAt {
+			extra = append(extra, "set on insert")
+		}
+		if def.UpdatedAt {
+			extra = append(extra, "set on insert and update")
+		}
+		if extra != nil {
+			row["extra"] = strings.Join(extra, ", ")
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package MyDb
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// utf8BOM is the UTF-8 byte order mark, which Excel writes at the start of UTF-8 CSV files
+const utf8BOM = "\xef\xbb\xbf"
+
+// CSVDialect describes how CSV data is written and read, so that files shared with
+// spreadsheets and other tools round-trip. The zero value is the dialect of encoding/csv
+type CSVDialect struct {
+	Comma      rune `json:"comma,omitempty"`       // Field delimiter, ',' when 0, e.g. ';' or '\t'
+	QuoteAll   bool `json:"quote_all,omitempty"`   // Quote every field, rather than only those that need it
+	CRLF       bool `json:"crlf,omitempty"`        // End lines with \r\n, as Excel does
+	BOM        bool `json:"bom,omitempty"`         // Start with a UTF-8 byte order mark, which Excel needs to read UTF-8. Data read may start with one either way
+	NoHeader   bool `json:"no_header,omitempty"`   // Data has no header row, only for imports and exports as saved tables keep their header
+	LazyQuotes bool `json:"lazy_quotes,omitempty"` // Accept quotes in unquoted fields and lone quotes in quoted ones when reading
+}
+
+// comma returns the field delimiter of the dialect
+func (d CSVDialect) comma() rune {
+	if d.Comma == 0 {
+		return ','
+	}
+	return d.Comma
+}
+
+// check returns an error if the delimiter of the dialect cannot delimit fields
+func (d CSVDialect) check() error {
+	c := d.comma()
+	if c == '"' || c == '\r' || c == '\n' || c == utf8.RuneError || !utf8.ValidRune(c) {
+		return fmt.Errorf("invalid CSV delimiter %q", c)
+	}
+	return nil
+}
+
+// SetCSVDialect sets the dialect of the CSV data of a table, which is saved in the schema
+// so that Load reads the data back. The next Save rewrites the table in the dialect. Saved
+// tables keep their header row, which holds the types of their columns
+func (db *Database) SetCSVDialect(tableName string, dialect CSVDialect) error {
+	if err := dialect.check(); err != nil {
+		return err
+	}
+	if dialect.NoHeader {
+		return fmt.Errorf("saved tables need their header row")
+	}
+	return db.alterTable(tableName, func(table *Table) error {
+		table.dialect = dialect
+		return nil
+	})
+}
+
+// newCSVWriter returns a writer of CSV data in a dialect, which it starts with a byte
+// order mark if the dialect has one
+func newCSVWriter(w io.Writer, dialect CSVDialect) (tableWriter, error) {
+	if dialect.BOM {
+		if _, err := io.WriteString(w, utf8BOM); err != nil {
+			return nil, err
+		}
+	}
+	if dialect.QuoteAll {
+		return &quotingWriter{w: bufio.NewWriter(w), dialect: dialect}, nil
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma, writer.UseCRLF = dialect.comma(), dialect.CRLF
+	return csvTableWriter{writer}, nil
+}
+
+// quotingWriter writes CSV data with every field quoted, which csv.Writer cannot do
+type quotingWriter struct {
+	w       *bufio.Writer
+	dialect CSVDialect
+}
+
+func (w *quotingWriter) Write(record []string) error {
+	for i, field := range record {
+		if i > 0 {
+			w.w.WriteRune(w.dialect.comma())
+		}
+		w.w.WriteString(`"` + strings.ReplaceAll(field, `"`, `""`) + `"`)
+	}
+	if w.dialect.CRLF {
+		w.w.WriteString("\r\n")
+	} else {
+		w.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (w *quotingWriter) Flush() error {
+	return w.w.Flush()
+}
+
+// newCSVReader returns a reader of CSV data in a dialect, skipping the byte order mark
+// the data may start with
+func newCSVReader(r io.Reader, dialect CSVDialect) *csv.Reader {
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(len(utf8BOM)); string(bom) == utf8BOM {
+		br.Discard(len(utf8BOM))
+	}
+	reader := csv.NewReader(br)
+	reader.Comma, reader.LazyQuotes = dialect.comma(), dialect.LazyQuotes
+	return reader
+}
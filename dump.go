@@ -0,0 +1,470 @@
+package MyDb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DumpFlavor is the SQL dialect of the statements written by DumpSQL
+type DumpFlavor int
+
+const (
+	// DumpNative writes the commands of this package, which Restore runs
+	DumpNative DumpFlavor = iota
+	// DumpSQLite writes statements for SQLite
+	DumpSQLite
+	// DumpMySQL writes statements for MySQL
+	DumpMySQL
+)
+
+// dumpBatch is the number of rows of each INSERT statement of a dump
+const dumpBatch = 100
+
+// dumpedTable is the definition and the rows of a table being dumped
+type dumpedTable struct {
+	schema savedTable
+	rows   []map[string]string
+}
+
+// Dump writes the database to any writer as commands of this package, which Restore runs
+// to rebuild it elsewhere: a CREATE TABLE for every table, INSERT statements holding the
+// rows, then CREATE INDEX for the indexes and ALTER TABLE for the foreign keys, which are
+// added once every row exists. The tables are snapshotted at once, so the dump is
+// consistent while writes go on
+func (db *Database) Dump(w io.Writer) error {
+	return db.DumpSQL(w, DumpNative)
+}
+
+// DumpSQL writes the database to any writer as Dump does, in an SQL flavor. SQLite and
+// MySQL dumps keep the columns and their types, keys, UNIQUE constraints, foreign keys,
+// defaults that are values, the indexes on columns without a filter and the rows, while
+// generated and timestamp columns become plain columns holding their values
+func (db *Database) DumpSQL(w io.Writer, flavor DumpFlavor) error {
+	if flavor < DumpNative || flavor > DumpMySQL {
+		return fmt.Errorf("unknown dump flavor %d", flavor)
+	}
+	tables, err := db.dumpTables()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(tables))
+	for tableName := range tables {
+		names = append(names, tableName)
+	}
+	sort.Strings(names)
+
+	d := &dumper{w: bufio.NewWriter(w), flavor: flavor, tables: tables}
+	fmt.Fprintf(d.w, "-- Dump of database %s\n", db.Name)
+	switch flavor {
+	case DumpSQLite:
+		d.w.WriteString("BEGIN TRANSACTION;\n")
+	case DumpMySQL:
+		d.w.WriteString("SET NAMES utf8mb4;\n")
+	}
+	for _, tableName := range names {
+		d.createTable(tableName)
+	}
+	for _, tableName := range names {
+		d.insertRows(tableName)
+	}
+	for _, tableName := range names {
+		d.createIndexes(tableName)
+	}
+	if flavor != DumpSQLite { // SQLite declares them in CREATE TABLE
+		for _, tableName := range names {
+			for _, fk := range tables[tableName].schema.ForeignKeys {
+				fmt.Fprintf(d.w, "ALTER TABLE %s ADD %s;\n", d.name(tableName), d.foreignKey(fk))
+			}
+		}
+	}
+	if flavor == DumpSQLite {
+		d.w.WriteString("COMMIT;\n")
+	}
+	return d.w.Flush()
+}
+
+// dumpTables snapshots the definition and the rows of every table at once, which copies
+// no rows
+func (db *Database) dumpTables() (map[string]dumpedTable, error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	if err := db.useAll(); err != nil {
+		return nil, err
+	}
+	l := &tableLocks{tables: db.Tables, write: make(map[*Table]bool)}
+	l.lock() // Lock tables second
+	defer l.unlock()
+
+	tables := make(map[string]dumpedTable, len(db.Tables))
+	for tableName, table := range db.Tables {
+		tables[tableName] = dumpedTable{schema: table.schema(), rows: table.snapshot()}
+	}
+	return tables, nil
+}
+
+// dumper writes the statements of a dump
+type dumper struct {
+	w      *bufio.Writer
+	flavor DumpFlavor
+	tables map[string]dumpedTable
+}
+
+// createTable writes the CREATE TABLE statement of a table
+func (d *dumper) createTable(tableName string) {
+	schema := d.tables[tableName].schema
+	timestamps := d.flavor == DumpNative && hasTimestamps(schema.Columns)
+	var primaryKey []string
+	for _, def := range schema.Columns {
+		if def.PrimaryKey {
+			primaryKey = append(primaryKey, def.Name)
+		}
+	}
+
+	var lines []string
+	for _, def := range schema.Columns {
+		if timestamps && (def.CreatedAt || def.UpdatedAt) {
+			continue
+		}
+		lines = append(lines, d.columnDef(tableName, def, len(primaryKey) == 1))
+	}
+	if len(primaryKey) > 1 {
+		lines = append(lines, "PRIMARY KEY "+d.names(primaryKey))
+	}
+	for _, columns := range schema.Unique {
+		lines = append(lines, "UNIQUE "+d.names(columns))
+	}
+	if d.flavor == DumpNative {
+		for _, check := range schema.Checks {
+			lines = append(lines, "CHECK ("+check+")")
+		}
+	}
+	if d.flavor == DumpSQLite {
+		for _, fk := range schema.ForeignKeys {
+			lines = append(lines, d.foreignKey(fk))
+		}
+	}
+
+	fmt.Fprintf(d.w, "\nCREATE TABLE %s (\n  %s\n)", d.name(tableName), strings.Join(lines, ",\n  "))
+	switch {
+	case timestamps:
+		d.w.WriteString(" WITH TIMESTAMPS")
+	case d.flavor == DumpMySQL:
+		d.w.WriteString(" ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	}
+	d.w.WriteString(";\n")
+}
+
+// hasTimestamps reports whether columns hold those of WITH TIMESTAMPS
+func hasTimestamps(columns []ColumnDef) bool {
+	created, updated := false, false
+	for _, def := range columns {
+		created = created || def.Name == "created_at" && def.CreatedAt && !def.UpdatedAt
+		updated = updated || def.Name == "updated_at" && def.UpdatedAt && !def.CreatedAt
+	}
+	return created && updated
+}
+
+// columnDef returns the definition of a column in a CREATE TABLE statement, which holds
+// the primary key when it is the only column of the key
+func (d *dumper) columnDef(tableName string, def ColumnDef, singleKey bool) string {
+	parts := []string{d.name(def.Name), d.columnType(tableName, def)}
+	if def.PrimaryKey && singleKey {
+		parts = append(parts, "PRIMARY KEY")
+	}
+	if def.Unique {
+		parts = append(parts, "UNIQUE")
+	}
+	if def.AutoIncrement {
+		switch {
+		case d.flavor == DumpNative:
+			parts = append(parts, "AUTO_INCREMENT")
+		case d.flavor == DumpSQLite && def.PrimaryKey && singleKey:
+			parts = append(parts, "AUTOINCREMENT")
+		case d.flavor == DumpMySQL && (def.PrimaryKey || def.Unique):
+			parts = append(parts, "AUTO_INCREMENT")
+		}
+	}
+	if def.NotNull {
+		parts = append(parts, "NOT NULL")
+	}
+	switch {
+	case def.DefaultFunc != "" && d.flavor == DumpNative:
+		parts = append(parts, "DEFAULT "+def.DefaultFunc+"()")
+	case def.Default == "" || def.DefaultFunc != "":
+	case d.flavor == DumpMySQL && (def.Type == String || def.Type == JSON || def.Type == Blob):
+		// MySQL has no literal defaults for TEXT, JSON and BLOB columns
+	default:
+		parts = append(parts, "DEFAULT "+d.literal(def.Default, true, def.Type))
+	}
+	if def.Generated != "" && d.flavor == DumpNative {
+		parts = append(parts, "GENERATED ALWAYS AS ("+def.Generated+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// columnType returns the type of a column in the flavor
+func (d *dumper) columnType(tableName string, def ColumnDef) string {
+	switch d.flavor {
+	case DumpSQLite:
+		return [...]string{"TEXT", "INTEGER", "REAL", "INTEGER", "TEXT", "TEXT", "TEXT", "NUMERIC", "BLOB"}[def.Type]
+	case DumpMySQL:
+		if def.Type == String && d.keyed(tableName, def) {
+			return "VARCHAR(255)" // MySQL cannot index TEXT columns
+		}
+		return [...]string{"TEXT", "BIGINT", "DOUBLE", "BOOLEAN", "DATE", "DATETIME(6)", "JSON", "DECIMAL(65,30)", "LONGBLOB"}[def.Type]
+	}
+	return def.Type.String()
+}
+
+// keyed reports whether a column of a table is in a key, a UNIQUE constraint, an index
+// or a foreign key
+func (d *dumper) keyed(tableName string, def ColumnDef) bool {
+	schema, column := d.tables[tableName].schema, def.Name
+	if def.PrimaryKey || def.Unique {
+		return true
+	}
+	for _, columns := range schema.Unique {
+		if contains(columns, column) {
+			return true
+		}
+	}
+	for _, ix := range schema.Indexes {
+		if ix.Expression == "" && contains(ix.Columns, column) {
+			return true
+		}
+	}
+	for _, fk := range schema.ForeignKeys {
+		if contains(fk.Columns, column) {
+			return true
+		}
+	}
+	for _, table := range d.tables {
+		for _, fk := range table.schema.ForeignKeys {
+			if fk.RefTable == tableName && contains(fk.RefColumns, column) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// insertRows writes the INSERT statements holding the rows of a table, leaving out the
+// generated columns of native dumps which Restore computes again
+func (d *dumper) insertRows(tableName string) {
+	table := d.tables[tableName]
+	var columns []ColumnDef
+	for _, def := range table.schema.Columns {
+		if def.Generated == "" || d.flavor != DumpNative {
+			columns = append(columns, def)
+		}
+	}
+	names := make([]string, len(columns))
+	for i, def := range columns {
+		names[i] = def.Name
+	}
+
+	for i, row := range table.rows {
+		if i%dumpBatch == 0 {
+			if i > 0 {
+				d.w.WriteString(";\n")
+			}
+			fmt.Fprintf(d.w, "\nINSERT INTO %s %s VALUES\n(", d.name(tableName), d.names(names))
+		} else {
+			d.w.WriteString(",\n(")
+		}
+		for j, def := range columns {
+			if j > 0 {
+				d.w.WriteString(", ")
+			}
+			value, ok := row[def.Name]
+			d.w.WriteString(d.literal(value, ok, def.Type))
+		}
+		d.w.WriteString(")")
+	}
+	if len(table.rows) > 0 {
+		d.w.WriteString(";\n")
+	}
+}
+
+// createIndexes writes the CREATE INDEX statements of the indexes of a table. SQLite and
+// MySQL dumps only hold the indexes on columns without a filter
+func (d *dumper) createIndexes(tableName string) {
+	schema := d.tables[tableName].schema
+	table := d.name(tableName)
+	if d.flavor != DumpNative {
+		for _, ix := range schema.Indexes {
+			if ix.Expression == "" && ix.Filter == "" {
+				fmt.Fprintf(d.w, "CREATE INDEX %s ON %s %s;\n", d.name(ix.Name), table, d.names(ix.Columns))
+			}
+		}
+		return
+	}
+
+	for _, ix := range schema.Indexes {
+		d.w.WriteString("CREATE ")
+		if ix.Ordered && (len(ix.Columns) == 1 || ix.Expression != "") {
+			d.w.WriteString("ORDERED ")
+		}
+		if ix.Expression != "" {
+			fmt.Fprintf(d.w, "INDEX ON %s (%s)", table, ix.Expression)
+		} else {
+			fmt.Fprintf(d.w, "INDEX ON %s %s", table, d.names(ix.Columns))
+		}
+		if ix.Filter != "" {
+			d.w.WriteString(" WHERE " + ix.Filter)
+		}
+		d.w.WriteString(";\n")
+	}
+	for _, ix := range schema.FullText {
+		fmt.Fprintf(d.w, "CREATE FULLTEXT INDEX ON %s %s", table, d.names(ix.Columns))
+		if ix.Stemmer != "" {
+			d.w.WriteString(" USING " + ix.Stemmer)
+		}
+		d.w.WriteString(";\n")
+	}
+	for _, ix := range schema.Fuzzy {
+		fmt.Fprintf(d.w, "CREATE FUZZY INDEX ON %s %s;\n", table, d.names(ix.Columns))
+	}
+}
+
+// foreignKey returns the FOREIGN KEY clause of a foreign key
+func (d *dumper) foreignKey(fk ForeignKey) string {
+	return fmt.Sprintf("FOREIGN KEY %s REFERENCES %s %s ON DELETE %s",
+		d.names(fk.Columns), d.name(fk.RefTable), d.names(fk.RefColumns), strings.ToUpper(fk.OnDelete.String()))
+}
+
+// name returns a table, column or index name, quoted in the flavor
+func (d *dumper) name(name string) string {
+	switch d.flavor {
+	case DumpSQLite:
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	case DumpMySQL:
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return name
+}
+
+// names returns a parenthesized list of names
+func (d *dumper) names(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = d.name(name)
+	}
+	return "(" + strings.Join(quoted, ", ") + ")"
+}
+
+// literal returns a value of a column type as a literal of the flavor, NULL when the row
+// leaves the column out. BLOB values and text that is not valid UTF-8 are written in
+// hexadecimal so that they are read back byte for byte
+func (d *dumper) literal(value string, ok bool, typ ColumnType) string {
+	switch {
+	case !ok || value == Null:
+		return "NULL"
+	case typ == Blob || !utf8.ValidString(value):
+		return "X'" + hex.EncodeToString([]byte(value)) + "'"
+	case (typ == Int || typ == Float || typ == Decimal) && isFinite(value):
+		return value
+	case typ == Bool && (value == "true" || value == "false"):
+		switch {
+		case d.flavor == DumpSQLite && value == "true":
+			return "1"
+		case d.flavor == DumpSQLite:
+			return "0"
+		case d.flavor == DumpMySQL:
+			return strings.ToUpper(value)
+		}
+		return value
+	case typ == DateTime && d.flavor == DumpMySQL:
+		if t, ok := parseDateTime(value); ok {
+			value = t.UTC().Format("2006-01-02 15:04:05.999999")
+		}
+	}
+	if d.flavor != DumpSQLite {
+		value = strings.ReplaceAll(value, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// isFinite reports whether a value is a finite number, which SQL writes without quotes
+func isFinite(value string) bool {
+	f, err := strconv.ParseFloat(value, 64)
+	return err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
+// Restore runs the commands of a dump written by Dump, e.g. to copy a database to another
+// environment, into a database that does not hold its tables. Inserted rows keep the
+// values of their timestamp columns, and auto-increment columns continue after the
+// highest restored value. Restore stops at the first failing statement, which is
+// reported as a *ScriptError, the statements before it being kept
+func (db *Database) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+	index := 0
+	for {
+		text, readErr := readStatement(br)
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		statements, err := splitStatements(text)
+		if err != nil {
+			return fmt.Errorf("invalid dump: %w", err)
+		}
+		for _, statement := range statements { // None for blank text and comments
+			index++
+			p, err := newParser(db, statement)
+			if err == nil {
+				p.restoring = true
+				_, err = db.exec(p)
+			}
+			if err != nil {
+				return &ScriptError{Index: index, Statement: statement, Err: err}
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// readStatement reads data up to the next semicolon outside quoted strings and "--"
+// comments, and returns io.EOF with the data after the last one
+func readStatement(r *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	var quote byte // Quote of the string being read, 0 outside strings
+	comment := false
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return sb.String(), err
+		}
+		switch {
+		case comment:
+			comment = c != '\n'
+		case quote != 0 && c == '\\':
+			// The escaped character cannot end the string
+			sb.WriteByte(c)
+			if c, err = r.ReadByte(); err != nil {
+				return sb.String(), err
+			}
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '-':
+			next, _ := r.Peek(1)
+			comment = len(next) == 1 && next[0] == '-'
+		case c == ';':
+			return sb.String(), nil
+		}
+		sb.WriteByte(c)
+	}
+}
@@ -0,0 +1,163 @@
+package MyDb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// encMagic starts data encrypted by a database with a key, followed by the nonce and the
+// AES-GCM sealed data
+const encMagic = "\x00MyDbEnc\x01"
+
+// WithEncryptionKey encrypts every file the database saves with AES-GCM under a key of
+// 16, 24 or 32 bytes, for AES-128, AES-192 or AES-256. Load decrypts the files and fails
+// on data encrypted with another key, changed since it was saved or not encrypted. BLOB
+// values are saved encrypted in the data of their table instead of files of their own
+func WithEncryptionKey(key []byte) Option {
+	key = slices.Clone(key)
+	return WithKeyProvider(func() ([]byte, error) {
+		return key, nil
+	})
+}
+
+// WithKeyProvider is WithEncryptionKey with a key fetched by a function, such as from a
+// key management service, when the database first saves or loads encrypted data
+func WithKeyProvider(provider func() ([]byte, error)) Option {
+	return func(db *Database) {
+		db.crypter = &crypter{provider: provider}
+		db.wal.crypter = db.crypter
+	}
+}
+
+// crypter encrypts and authenticates the saved data of a database
+type crypter struct {
+	provider func() ([]byte, error)
+	mu       sync.Mutex
+	aead     cipher.AEAD // Cipher of the key, nil until the provider is called
+}
+
+// cipher returns the cipher of the key, calling the provider the first time
+func (c *crypter) cipher() (cipher.AEAD, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.aead != nil {
+		return c.aead, nil
+	}
+	key, err := c.provider()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the encryption key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if c.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+	return c.aead, nil
+}
+
+// seal encrypts data saved under a name, which authenticates it too so that the data of
+// one name cannot pass for that of another
+func (c *crypter) seal(data []byte, name string) ([]byte, error) {
+	aead, err := c.cipher()
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, len(encMagic)+aead.NonceSize(), len(encMagic)+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(sealed, encMagic)
+	nonce := sealed[len(encMagic):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(sealed, nonce, data, []byte(name)), nil
+}
+
+// open decrypts data sealed under a name, failing when it was not sealed with the key
+// or has changed since
+func (c *crypter) open(sealed []byte, name string) ([]byte, error) {
+	if !bytes.HasPrefix(sealed, []byte(encMagic)) {
+		return nil, fmt.Errorf("%s is not encrypted", name)
+	}
+	aead, err := c.cipher()
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[len(encMagic):]
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s is truncated", name)
+	}
+	data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: wrong key or tampered data", name)
+	}
+	return data, nil
+}
+
+// sealLine encrypts a line of the write-ahead log, base64 encoded so that it holds no
+// newline
+func (c *crypter) sealLine(line []byte) ([]byte, error) {
+	sealed, err := c.seal(line, walFile)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.AppendEncode(nil, sealed), nil
+}
+
+// openLine decrypts a line of the write-ahead log sealed by sealLine
+func (c *crypter) openLine(line []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.AppendDecode(nil, line)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not encrypted", walFile)
+	}
+	return c.open(sealed, walFile)
+}
+
+// sealed returns a write function writing the data that write writes encrypted under a
+// name, or write itself when the database has no key
+func (db *Database) sealed(name string, write func(w io.Writer) error) func(w io.Writer) error {
+	if db.crypter == nil {
+		return write
+	}
+	return func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			return err
+		}
+		sealed, err := db.crypter.seal(buf.Bytes(), name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(sealed)
+		return err
+	}
+}
+
+// unsealed returns a reader of the data of r decrypted as saved under a name. Without a
+// key, encrypted data is refused
+func (db *Database) unsealed(r io.Reader, name string) (io.Reader, error) {
+	if db.crypter == nil {
+		br := bufio.NewReader(r)
+		if magic, _ := br.Peek(len(encMagic)); bytes.Equal(magic, []byte(encMagic)) {
+			return nil, fmt.Errorf("%s is encrypted, open the database with its key", name)
+		}
+		return br, nil
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := db.crypter.open(sealed, name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
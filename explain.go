@@ -0,0 +1,192 @@
+package MyDb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// planStep is one operation of a query plan shown by EXPLAIN
+type planStep struct {
+	operation string // What the step does, e.g. SCAN or HASH JOIN
+	table     string // Table the step reads, empty when it works on the rows of earlier steps
+	detail    string // Condition, keys or other parameters of the step
+	rows      int    // Estimated number of rows produced by the step, an upper bound unless Analyze gathered statistics
+}
+
+// queryExplain parses "EXPLAIN SELECT ..." and returns the plan of the query,
+// one row per step in execution order, without running it
+func (db *Database) queryExplain(p *parser) (*Result, error) {
+	if err := p.expect("explain"); err != nil {
+		return nil, err
+	}
+	stmt, err := p.parseSelect()
+	if err == nil {
+		err = p.expectEOF()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXPLAIN command: %w", err)
+	}
+
+	steps, _, err := db.explainSelect(stmt)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Columns: []string{"step", "operation", "table", "detail", "rows"}}
+	for i, step := range steps {
+		result.Rows = append(result.Rows, map[string]string{
+			"step":      strconv.Itoa(i + 1),
+			"operation": step.operation,
+			"table":     step.table,
+			"detail":    step.detail,
+			"rows":      strconv.Itoa(step.rows),
+		})
+	}
+	return result, nil
+}
+
+// explainSelect returns the plan of a SELECT statement and its estimated number of rows
+func (db *Database) explainSelect(stmt *selectStmt) ([]planStep, int, error) {
+	// Like execSelect, the first part only sorts its rows itself when there is no UNION
+	orderBy := stmt.orderBy
+	if len(stmt.unions) > 0 {
+		orderBy = nil
+	}
+	steps, rows, sorted, err := db.explainCore(stmt, orderBy)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, part := range stmt.unions {
+		partSteps, partRows, _, err := db.explainCore(part.stmt, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		steps = append(steps, partSteps...)
+		rows += partRows
+		operation := "UNION"
+		if part.all {
+			operation = "UNION ALL"
+		}
+		steps = append(steps, planStep{operation: operation, rows: rows})
+	}
+
+	if len(stmt.orderBy) > 0 && !sorted {
+		keys := make([]string, len(stmt.orderBy))
+		for i, key := range stmt.orderBy {
+			keys[i] = key.Column
+			if key.Desc {
+				keys[i] += " desc"
+			}
+		}
+		steps = append(steps, planStep{operation: "SORT", detail: strings.Join(keys, ", "), rows: rows})
+	}
+	if stmt.limit >= 0 || stmt.offset > 0 {
+		rows = len(pageRows(make([]map[string]string, rows), stmt.offset, stmt.limit))
+		detail := fmt.Sprintf("offset %d", stmt.offset)
+		if stmt.limit >= 0 {
+			detail = fmt.Sprintf("limit %d %s", stmt.limit, detail)
+		}
+		steps = append(steps, planStep{operation: "LIMIT", detail: detail, rows: rows})
+	}
+	return steps, rows, nil
+}
+
+// explainCore returns the plan of a single SELECT without its UNION, ORDER BY and LIMIT
+// clauses, and whether its rows already come in the given order
+func (db *Database) explainCore(stmt *selectStmt, orderBy []SortKey) ([]planStep, int, bool, error) {
+	var steps []planStep
+
+	// Subqueries run before the statement itself
+	for _, in := range stmt.where.subqueries {
+		subSteps, subRows, err := db.explainSelect(in.subquery)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		steps = append(steps, subSteps...)
+		steps = append(steps, planStep{operation: "SUBQUERY", detail: "IN list", rows: subRows})
+	}
+
+	rows, err := db.tableRowCount(stmt.table)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	sorted, scanned := false, false
+	if len(stmt.joins) > 0 {
+		steps = append(steps, planStep{operation: "SCAN", table: stmt.table, detail: "full table scan", rows: rows})
+		scanned = true
+	} else if found, access, err := db.lookupWhere(stmt.table, stmt.where.cond, orderBy); err != nil {
+		return nil, 0, false, err
+	} else if access != nil {
+		rows = len(found)
+		sorted = access.sorted
+		steps = append(steps, planStep{operation: access.operation, table: stmt.table, detail: access.detail, rows: rows})
+	} else {
+		steps = append(steps, planStep{operation: "SCAN", table: stmt.table, detail: "full table scan", rows: rows})
+		scanned = true
+	}
+
+	qualifiers := map[string]string{sourceTable{name: stmt.table, alias: stmt.alias}.qualifier(): stmt.table}
+	for _, join := range stmt.joins {
+		qualifiers[sourceTable{name: join.table, alias: join.alias}.qualifier()] = join.table
+		joinedRows, err := db.tableRowCount(join.table)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		steps = append(steps, planStep{operation: "SCAN", table: join.table, detail: "full table scan", rows: joinedRows})
+
+		operation := "NESTED LOOP JOIN"
+		estimate := rows * joinedRows
+		if join.leftKey != "" {
+			operation = "HASH JOIN"
+			estimate = rows
+			if joinedRows > estimate {
+				estimate = joinedRows
+			}
+			// Statistics gathered by Analyze give a closer estimate
+			if analyzed, ok := db.estimateJoin(qualifiers, join, rows, joinedRows); ok {
+				estimate = analyzed
+			}
+		}
+		kind := "inner"
+		switch join.kind {
+		case leftJoin:
+			kind = "left"
+		case rightJoin:
+			kind = "right"
+		}
+		rows = estimate
+		steps = append(steps, planStep{operation: operation, table: join.table, detail: kind + " on " + join.on.text, rows: rows})
+	}
+
+	if stmt.where.cond != nil {
+		if scanned {
+			rows = db.estimateFilter(stmt.table, qualifiers, stmt.where.cond, rows)
+		}
+		steps = append(steps, planStep{operation: "FILTER", detail: stmt.where.text, rows: rows})
+	}
+	if stmt.fields != nil {
+		steps = append(steps, planStep{operation: "PROJECT", detail: strings.Join(stmt.resultColumns(), ", "), rows: rows})
+	}
+	if stmt.distinct {
+		steps = append(steps, planStep{operation: "DISTINCT", rows: rows})
+	}
+	return steps, rows, sorted, nil
+}
+
+// tableRowCount returns the number of rows of a table
+func (db *Database) tableRowCount(tableName string) (int, error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return 0, fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		return 0, err
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	return len(table.Rows), nil
+}
@@ -0,0 +1,137 @@
+package MyDb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+)
+
+// ExportTable writes the data of a table to any writer, such as an HTTP response, a gzip
+// writer or an upload, in a format and as Save writes it, with the types of the columns
+// in the header and BLOB values base64 encoded. The rows are snapshotted first, so writes
+// go on while the data is written
+func (db *Database) ExportTable(tableName string, w io.Writer, format Format) error {
+	if format != CSV && format != Gob {
+		return fmt.Errorf("unknown format %d", format)
+	}
+	tables, err := db.snapshotTables(tableName)
+	if err != nil {
+		return err
+	}
+
+	// A database without BLOB storage encodes the BLOB values in the data
+	exporter := &Database{Name: db.Name, storage: &MemoryStorage{}}
+	return exporter.writeTable(w, tableName, tables[tableName], format, 0, nil)
+}
+
+// StreamTable calls fn with every row of a table in turn, stopping with the first error
+// it returns, to export or transform large tables without copying their rows. The rows
+// are snapshotted first, which copies none of them, so writes go on while they are read
+// and fn may write to the table. Rows are shared with the table and must not be changed
+func (db *Database) StreamTable(tableName string, fn func(row Row) error) error {
+	return db.StreamTableCtx(context.Background(), tableName, fn)
+}
+
+// StreamTableCtx is StreamTable stopping with the error of the context once it is done
+func (db *Database) StreamTableCtx(ctx context.Context, tableName string, fn func(row Row) error) error {
+	db.mu.RLock() // Lock db first
+	table, exists := db.Tables[tableName]
+	if !exists {
+		db.mu.RUnlock()
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		db.mu.RUnlock()
+		return err
+	}
+	table.mu.RLock() // Lock table second
+	rows := table.snapshot()
+	table.mu.RUnlock()
+	db.mu.RUnlock()
+
+	for i, row := range rows {
+		if i%cancelCheckRows == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotTables snapshots tables at once, every table when no name is given, which
+// copies no rows
+func (db *Database) snapshotTables(names ...string) (map[string]*Table, error) {
+	snaps := make(map[string]*Table)
+	err := db.readTables(names, func(tableName string, table *Table) {
+		snaps[tableName] = &Table{
+			Columns: table.Columns,
+			Rows:    table.snapshot(),
+			defs:    maps.Clone(table.defs),
+			lastID:  table.lastID,
+			dialect: table.dialect,
+		}
+	})
+	return snaps, err
+}
+
+// readTables calls read with tables while they are all locked for reading, every table
+// when no name is given
+func (db *Database) readTables(names []string, read func(tableName string, table *Table)) error {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	l := &tableLocks{tables: make(map[string]*Table), write: make(map[*Table]bool)}
+	if len(names) == 0 {
+		l.tables = maps.Clone(db.Tables)
+	}
+	for _, tableName := range names {
+		table, exists := db.Tables[tableName]
+		if !exists {
+			return fmt.Errorf("table %s does not exist", tableName)
+		}
+		l.tables[tableName] = table
+	}
+	for tableName, table := range l.tables {
+		if err := db.use(tableName, table); err != nil {
+			return err
+		}
+	}
+	l.lock() // Lock tables second
+	defer l.unlock()
+
+	for tableName, table := range l.tables {
+		read(tableName, table)
+	}
+	return nil
+}
+
+// WriteCSV writes the rows of the table to any writer as plain CSV in the dialect of the
+// table, for other tools: a header row of the column names, then the values as they are,
+// NULL being an empty field. The rows are snapshotted first, so writes go on while the
+// data is written
+func (t *Table) WriteCSV(w io.Writer) error {
+	t.mu.RLock()
+	columns, rows, dialect := t.Columns, t.snapshot(), t.dialect
+	t.mu.RUnlock()
+
+	writer, err := newCSVWriter(w, dialect)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, col := range columns {
+			record[i] = row[col]
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
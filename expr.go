@@ -0,0 +1,574 @@
+package MyDb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// expr is a node of a parsed boolean or value expression. Expressions evaluate to
+// Null when a value is NULL, and conditions use three-valued logic: comparing with
+// NULL gives NULL, which does not match
+type expr interface {
+	eval(row map[string]string) (string, error)
+}
+
+// literalExpr is a constant value
+type literalExpr struct {
+	value string
+}
+
+func (e *literalExpr) eval(row map[string]string) (string, error) {
+	return e.value, nil
+}
+
+// columnExpr reads a column of the current row
+type columnExpr struct {
+	name string
+	typ  ColumnType // Type of the column, used to compare its values
+}
+
+func (e *columnExpr) eval(row map[string]string) (string, error) {
+	value, ok := row[e.name]
+	if !ok {
+		return Null, nil
+	}
+	return value, nil
+}
+
+// compareExpr compares two values with a relational operator
+type compareExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *compareExpr) eval(row map[string]string) (string, error) {
+	left, err := e.left.eval(row)
+	if err != nil {
+		return "", err
+	}
+	right, err := e.right.eval(row)
+	if err != nil {
+		return "", err
+	}
+	if left == Null || right == Null {
+		return Null, nil
+	}
+	return boolString(matchTyped(e.op, exprType(e.left, e.right), left, right)), nil
+}
+
+// exprType returns the type of the first typed column among the expressions, or String.
+// Arithmetic on DECIMAL columns is a DECIMAL
+func exprType(exprs ...expr) ColumnType {
+	for _, e := range exprs {
+		if col, ok := e.(*columnExpr); ok && col.typ != String {
+			return col.typ
+		}
+		if arith, ok := e.(*arithExpr); ok && arith.exact {
+			return Decimal
+		}
+	}
+	return String
+}
+
+// arithExpr applies an arithmetic operator (+, -, * or /) to two numbers
+type arithExpr struct {
+	op          string
+	left, right expr
+	exact       bool // Whether an operand is a DECIMAL, computed exactly
+}
+
+func (e *arithExpr) eval(row map[string]string) (string, error) {
+	left, err := e.left.eval(row)
+	if err != nil {
+		return "", err
+	}
+	right, err := e.right.eval(row)
+	if err != nil {
+		return "", err
+	}
+	if left == Null || right == Null {
+		return Null, nil
+	}
+	if e.exact {
+		return decimalArith(e.op, left, right)
+	}
+
+	// Integers stay integers, except when divided
+	a, errA := strconv.ParseInt(left, 10, 64)
+	b, errB := strconv.ParseInt(right, 10, 64)
+	if errA == nil && errB == nil && e.op != "/" {
+		switch e.op {
+		case "+":
+			return strconv.FormatInt(a+b, 10), nil
+		case "-":
+			return strconv.FormatInt(a-b, 10), nil
+		default:
+			return strconv.FormatInt(a*b, 10), nil
+		}
+	}
+
+	x, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a number", left)
+	}
+	y, err := strconv.ParseFloat(right, 64)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a number", right)
+	}
+	var z float64
+	switch e.op {
+	case "+":
+		z = x + y
+	case "-":
+		z = x - y
+	case "*":
+		z = x * y
+	default:
+		if y == 0 {
+			return "", fmt.Errorf("division by zero")
+		}
+		z = x / y
+	}
+	return strconv.FormatFloat(z, 'g', -1, 64), nil
+}
+
+// likeExpr matches a value against a LIKE pattern
+type likeExpr struct {
+	left, pattern expr
+	not           bool
+}
+
+func (e *likeExpr) eval(row map[string]string) (string, error) {
+	value, err := e.left.eval(row)
+	if err != nil {
+		return "", err
+	}
+	pattern, err := e.pattern.eval(row)
+	if err != nil {
+		return "", err
+	}
+	if value == Null || pattern == Null {
+		return Null, nil
+	}
+	return boolString(Like(value, pattern) != e.not), nil
+}
+
+// inExpr tests whether a value is in a list of values or in the results of a subquery
+type inExpr struct {
+	left     expr
+	list     []expr          // Literal list, nil for a subquery
+	subquery *selectStmt     // Single-column subquery
+	values   map[string]bool // Subquery results, filled in before evaluation
+	not      bool
+}
+
+func (e *inExpr) eval(row map[string]string) (string, error) {
+	value, err := e.left.eval(row)
+	if err != nil {
+		return "", err
+	}
+	if value == Null {
+		return Null, nil
+	}
+	if e.subquery != nil {
+		if e.values == nil {
+			return "", fmt.Errorf("subquery was not executed")
+		}
+		return boolString(e.values[joinKey(value)] != e.not), nil
+	}
+	typ := exprType(e.left)
+	for _, item := range e.list {
+		candidate, err := item.eval(row)
+		if err != nil {
+			return "", err
+		}
+		if typ.compare(value, candidate) == 0 {
+			return boolString(!e.not), nil
+		}
+	}
+	return boolString(e.not), nil
+}
+
+// logicalExpr combines two boolean expressions with AND or OR
+type logicalExpr struct {
+	or          bool
+	left, right expr
+}
+
+func (e *logicalExpr) eval(row map[string]string) (string, error) {
+	left, err := e.left.eval(row)
+	if err != nil {
+		return "", err
+	}
+	// Short-circuit once the outcome is known
+	if left != Null && truthy(left) == e.or {
+		return boolString(e.or), nil
+	}
+	right, err := e.right.eval(row)
+	if err != nil {
+		return "", err
+	}
+	if right != Null && truthy(right) == e.or {
+		return boolString(e.or), nil
+	}
+	// Neither side decides the outcome, which is unknown if either is NULL
+	if left == Null || right == Null {
+		return Null, nil
+	}
+	return boolString(!e.or), nil
+}
+
+// notExpr negates a boolean expression
+type notExpr struct {
+	inner expr
+}
+
+func (e *notExpr) eval(row map[string]string) (string, error) {
+	value, err := e.inner.eval(row)
+	if err != nil {
+		return "", err
+	}
+	if value == Null {
+		return Null, nil
+	}
+	return boolString(!truthy(value)), nil
+}
+
+// truthy reports whether a value counts as true in a boolean context
+func truthy(value string) bool {
+	return value == "true" || value == "1"
+}
+
+// boolString converts a boolean to its stored representation
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// parseCondition parses a full WHERE clause. Top-level commas act as AND for
+// compatibility with the original "a=1, b=2" condition syntax
+func (p *parser) parseCondition() (expr, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(",") {
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseOr parses expressions joined by OR
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses expressions joined by AND
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseNot parses an optionally negated comparison
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("not") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{inner: inner}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses a value optionally followed by a comparison, IN, LIKE, MATCH,
+// SIMILAR, BETWEEN or IS [NOT] NULL
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	switch {
+	case tok.kind == tokenSymbol && isCompareOperator(tok.text):
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &compareExpr{op: tok.text, left: left, right: right}, nil
+
+	case tok.is("in"), tok.is("not") && p.tokens[p.pos+1].is("in"):
+		not := p.accept("not")
+		p.next()
+		return p.parseIn(left, not)
+
+	case tok.is("like"), tok.is("not") && p.tokens[p.pos+1].is("like"):
+		not := p.accept("not")
+		p.next()
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &likeExpr{left: left, pattern: pattern, not: not}, nil
+
+	case tok.is("match"):
+		p.next()
+		return p.parseMatch(left)
+
+	case tok.is("similar"):
+		p.next()
+		return p.parseSimilar(left)
+
+	case tok.is("between"), tok.is("not") && p.tokens[p.pos+1].is("between"):
+		not := p.accept("not")
+		p.next()
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("and"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		var between expr = &logicalExpr{
+			left:  &compareExpr{op: ">=", left: left, right: low},
+			right: &compareExpr{op: "<=", left: left, right: high},
+		}
+		if not {
+			between = &notExpr{inner: between}
+		}
+		return between, nil
+
+	case tok.is("is"):
+		p.next()
+		not := p.accept("not")
+		if err := p.expect("null"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{inner: left, not: not}, nil
+	}
+	return left, nil
+}
+
+// parseAdditive parses values joined by + and -
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("+") || p.peek().is("-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithExpr{op: op, left: left, right: right, exact: exprType(left, right) == Decimal}
+	}
+	return left, nil
+}
+
+// parseMultiplicative parses values joined by * and /
+func (p *parser) parseMultiplicative() (expr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("*") || p.peek().is("/") {
+		op := p.next().text
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithExpr{op: op, left: left, right: right, exact: exprType(left, right) == Decimal}
+	}
+	return left, nil
+}
+
+// parseIn parses the parenthesized value list or subquery of an IN operator
+func (p *parser) parseIn(left expr, not bool) (expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	in := &inExpr{left: left, not: not}
+
+	if p.peek().is("select") {
+		// The subquery has its own tables, restore ours once it is parsed
+		tables, columns := p.tables, p.columns
+		sub, err := p.parseSelect()
+		p.tables, p.columns = tables, columns
+		if err != nil {
+			return nil, err
+		}
+		in.subquery = sub
+		p.subqueries = append(p.subqueries, in)
+	} else {
+		for {
+			item, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// parsePrimary parses a literal, a column reference, a function call or a parenthesized expression
+func (p *parser) parsePrimary() (expr, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokenString, tokenNumber:
+		p.next()
+		return &literalExpr{value: tok.text}, nil
+
+	case tokenWord:
+		p.next()
+		if p.peek().is("(") {
+			return p.parseCall(tok.text)
+		}
+		key, found, err := p.lookupColumn(tok.text)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			if tok.is("null") {
+				return &literalExpr{value: Null}, nil
+			}
+			// Bare words that are not columns are values, e.g. name = bob
+			return &literalExpr{value: tok.text}, nil
+		}
+		return &columnExpr{name: key, typ: p.types[key]}, nil
+
+	case tokenSymbol:
+		if p.accept("(") {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+		if p.accept("-") {
+			// Negative numeric literal
+			if num := p.peek(); num.kind == tokenNumber {
+				p.next()
+				return &literalExpr{value: "-" + num.text}, nil
+			}
+			return nil, p.unexpected()
+		}
+	}
+	return nil, p.unexpected()
+}
+
+// isCompareOperator reports whether a symbol is a relational operator
+func isCompareOperator(op string) bool {
+	switch op {
+	case "=", "!=", "<>", "<", ">", "<=", ">=":
+		return true
+	}
+	return false
+}
+
+// rowFilter evaluates a parsed condition against rows, remembering the first evaluation error
+type rowFilter struct {
+	cond       expr
+	subqueries []*inExpr // Subqueries to execute before the condition is evaluated
+	text       string    // Source text of the condition, shown by EXPLAIN
+	err        error
+	ctx        context.Context // Context of the command, nil when there is none
+	scanned    int             // Rows matched so far, to check the context every few rows
+}
+
+// prepare executes the subqueries of the condition. It must be called before
+// match, and without holding any database lock
+func (f *rowFilter) prepare(db *Database) error {
+	for _, in := range f.subqueries {
+		result, err := db.execSelect(in.subquery)
+		if err != nil {
+			return err
+		}
+		if len(result.Columns) != 1 {
+			return fmt.Errorf("subquery must return exactly one column, got %d", len(result.Columns))
+		}
+		in.values = make(map[string]bool, len(result.Rows))
+		for _, row := range result.Rows {
+			in.values[joinKey(row[result.Columns[0]])] = true
+		}
+	}
+	return nil
+}
+
+// condition returns match as a row condition, or nil when there is no condition
+func (f *rowFilter) condition() func(row map[string]string) bool {
+	if f.cond == nil {
+		return nil
+	}
+	return f.match
+}
+
+// match reports whether the row satisfies the condition. Once the context of the
+// command is done no row does, and its error is the error of the filter
+func (f *rowFilter) match(row map[string]string) bool {
+	if f.ctx != nil {
+		if f.scanned%cancelCheckRows == 0 && f.err == nil {
+			f.err = f.ctx.Err()
+		}
+		f.scanned++
+		if f.err != nil {
+			return false
+		}
+	}
+	if f.cond == nil {
+		return true
+	}
+	value, err := f.cond.eval(row)
+	if err != nil {
+		if f.err == nil {
+			f.err = err
+		}
+		return false
+	}
+	return truthy(value)
+}
@@ -0,0 +1,135 @@
+package MyDb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// CreateExpressionIndex creates an index on the result of an expression over the
+// columns of a table, e.g. "lower(email)", named after its words like
+// "users_lower_email_idx". WHERE clauses comparing the same expression with a value,
+// such as "lower(email) = 'john@example.com'", then find their rows through the index
+// instead of computing the expression for every row. The expression uses the syntax of
+// WHERE clauses without subqueries and must give the same result every time for the
+// same row, so functions such as now() and uuid() do not belong in it
+func (db *Database) CreateExpressionIndex(tableName, expression string, options ...IndexOption) error {
+	text := strings.TrimSpace(expression)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	name := tableName + "_" + strings.Join(words, "_") + "_idx"
+	ix := &secondaryIndex{name: name, columns: []string{text}}
+	for _, option := range options {
+		option(ix)
+	}
+	if err := db.parseExpression(tableName, ix); err != nil {
+		return err
+	}
+	if err := db.parseFilter(tableName, ix); err != nil {
+		return err
+	}
+	return db.alterTable(tableName, func(table *Table) error {
+		if err := checkColumns(tableName, table.Columns, ix.exprColumns); err != nil {
+			return err
+		}
+		if table.findIndex(name) != nil {
+			return fmt.Errorf("index %s already exists on table %s", name, tableName)
+		}
+		table.addIndex(ix, nil)
+		return nil
+	})
+}
+
+// parseExpression parses the expression of an expression index on a table, given as
+// its only column
+func (db *Database) parseExpression(tableName string, ix *secondaryIndex) error {
+	expression, columns, err := db.parseRowCondition(tableName, ix.columns[0], "index expression")
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("index expression %s reads no column", ix.columns[0])
+	}
+	ix.expression, ix.exprColumns = expression, columns
+	return nil
+}
+
+// expressionBounds returns the comparisons of the indexed expression with values that
+// a condition requires, keyed by the text of the expression like bounds keys columns
+func (ix *secondaryIndex) expressionBounds(cond expr) map[string][]bound {
+	return boundsOf(cond, func(e expr) (string, bool) {
+		return ix.columns[0], sameExpr(e, ix.expression)
+	})
+}
+
+// expressionValues returns the indexable value that a condition requires the indexed
+// expression to equal, keyed by the text of the expression like equalities keys columns
+func (ix *secondaryIndex) expressionValues(cond expr) map[string]string {
+	values := make(map[string]string)
+	for key, bounds := range ix.expressionBounds(cond) {
+		for _, b := range bounds {
+			if b.op == "=" && indexable(ix.types[0], b.value) {
+				values[key] = b.value
+				break
+			}
+		}
+	}
+	return values
+}
+
+// sameExpr reports whether two parsed expressions compute the same thing, e.g. two
+// parses of "lower(email)"
+func sameExpr(a, b expr) bool {
+	switch a := a.(type) {
+	case *funcExpr:
+		b, ok := b.(*funcExpr)
+		return ok && strings.EqualFold(a.name, b.name) && sameExprs(a.args, b.args)
+	case *coalesceExpr:
+		b, ok := b.(*coalesceExpr)
+		return ok && sameExprs(a.args, b.args)
+	case *compareExpr:
+		b, ok := b.(*compareExpr)
+		return ok && a.op == b.op && sameExpr(a.left, b.left) && sameExpr(a.right, b.right)
+	case *arithExpr:
+		b, ok := b.(*arithExpr)
+		return ok && a.op == b.op && sameExpr(a.left, b.left) && sameExpr(a.right, b.right)
+	case *logicalExpr:
+		b, ok := b.(*logicalExpr)
+		return ok && a.or == b.or && sameExpr(a.left, b.left) && sameExpr(a.right, b.right)
+	case *notExpr:
+		b, ok := b.(*notExpr)
+		return ok && sameExpr(a.inner, b.inner)
+	case *isNullExpr:
+		b, ok := b.(*isNullExpr)
+		return ok && a.not == b.not && sameExpr(a.inner, b.inner)
+	case *likeExpr:
+		b, ok := b.(*likeExpr)
+		return ok && a.not == b.not && sameExpr(a.left, b.left) && sameExpr(a.pattern, b.pattern)
+	case *inExpr:
+		b, ok := b.(*inExpr)
+		// Subquery results change with the rows of the subquery
+		return ok && a.subquery == nil && b.subquery == nil && a.not == b.not && sameExpr(a.left, b.left) && sameExprs(a.list, b.list)
+	case *matchExpr:
+		b, ok := b.(*matchExpr)
+		return ok && sameExpr(a.left, b.left) && sameExpr(a.query, b.query)
+	case *similarExpr:
+		b, ok := b.(*similarExpr)
+		return ok && a.distance == b.distance && sameExpr(a.left, b.left) && sameExpr(a.value, b.value)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// sameExprs reports whether two lists of expressions are the same, see sameExpr
+func sameExprs(a, b []expr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameExpr(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package MyDb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+)
+
+// fileMagic starts a database file, followed by the version of its format
+const fileMagic = "MyDb\x00\x01"
+
+// fileSchema is the name of the segment holding the schema, which is not a valid table name
+const fileSchema = "_schema.json"
+
+// FileStorage stores a whole database in a single file, which is easier to copy and embed
+// than a directory. The file holds the schema and the data of each table in segments,
+// followed by a CRC-32 checksum of its content. It is read once and kept in memory, and
+// written at once, atomically, when the schema is saved, which Save does after the tables
+type FileStorage struct {
+	path     string
+	mu       sync.Mutex
+	segments map[string][]byte // Data of the tables and schema by name, nil until the file is read
+	pending  bool              // Whether tables were saved since the file was written
+}
+
+// NewFileStorage returns a storage of the database file at the given path, which is
+// created by the first save
+func NewFileStorage(path string) *FileStorage {
+	return &FileStorage{path: path}
+}
+
+// ListTables returns the names of the tables of the file in order
+func (s *FileStorage) ListTables() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(s.segments)) {
+		if name != fileSchema {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// LoadTable returns a reader of the data of a table
+func (s *FileStorage) LoadTable(name string) (io.ReadCloser, error) {
+	return s.load(name)
+}
+
+// SaveTable keeps the data of a table until the schema is saved
+func (s *FileStorage) SaveTable(name string, write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.read(); err != nil {
+		return err
+	}
+	s.segments[name] = buf.Bytes()
+	s.pending = true
+	return nil
+}
+
+// DeleteTable removes the data of a table and writes the file
+func (s *FileStorage) DeleteTable(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.read(); err != nil {
+		return err
+	}
+	if _, exists := s.segments[name]; !exists && !s.pending {
+		return nil
+	}
+	delete(s.segments, name)
+	return s.write()
+}
+
+// LoadSchema returns a reader of the schema
+func (s *FileStorage) LoadSchema() (io.ReadCloser, error) {
+	return s.load(fileSchema)
+}
+
+// SaveSchema replaces the schema and writes the file with the tables saved before it
+func (s *FileStorage) SaveSchema(write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.read(); err != nil {
+		return err
+	}
+	s.segments[fileSchema] = buf.Bytes()
+	return s.write()
+}
+
+// load returns a reader of a segment
+func (s *FileStorage) load(name string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	data, ok := s.segments[name]
+	if !ok {
+		return nil, fmt.Errorf("%s in %s: %w", name, s.path, fs.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// read reads the segments of the file unless they were read already. A missing file has
+// none. The mutex must be held
+func (s *FileStorage) read() error {
+	if s.segments != nil {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.segments = make(map[string][]byte)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	segments, err := decodeSegments(data)
+	if err != nil {
+		return fmt.Errorf("invalid database file %s: %w", s.path, err)
+	}
+	s.segments = segments
+	return nil
+}
+
+// write writes every segment to the file. The mutex must be held
+func (s *FileStorage) write() error {
+	err := writeAtomic(s.path, func(w io.Writer) error {
+		_, err := w.Write(encodeSegments(s.segments))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.pending = false
+	return nil
+}
+
+// encodeSegments returns the content of a database file: the magic and version, then the
+// length and name, length and data of each segment, then the CRC-32 of all that
+func encodeSegments(segments map[string][]byte) []byte {
+	data := []byte(fileMagic)
+	for _, name := range slices.Sorted(maps.Keys(segments)) {
+		data = binary.AppendUvarint(data, uint64(len(name)))
+		data = append(data, name...)
+		data = binary.AppendUvarint(data, uint64(len(segments[name])))
+		data = append(data, segments[name]...)
+	}
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+// decodeSegments returns the segments of the content of a database file written by
+// encodeSegments, checking its checksum
+func decodeSegments(data []byte) (map[string][]byte, error) {
+	if len(data) < len(fileMagic)+4 || string(data[:len(fileMagic)-1]) != fileMagic[:len(fileMagic)-1] {
+		return nil, fmt.Errorf("not a database file")
+	}
+	if data[len(fileMagic)-1] != fileMagic[len(fileMagic)-1] {
+		return nil, fmt.Errorf("unsupported version %d", data[len(fileMagic)-1])
+	}
+	content, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(content) != sum {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+
+	segments := make(map[string][]byte)
+	rest := content[len(fileMagic):]
+	next := func() ([]byte, error) {
+		n, size := binary.Uvarint(rest)
+		if size <= 0 || n > uint64(len(rest)-size) {
+			return nil, fmt.Errorf("truncated segment")
+		}
+		field := rest[size : size+int(n)]
+		rest = rest[size+int(n):]
+		return field, nil
+	}
+	for len(rest) > 0 {
+		name, err := next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := next()
+		if err != nil {
+			return nil, err
+		}
+		segments[string(name)] = value
+	}
+	return segments, nil
+}
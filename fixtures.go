@@ -0,0 +1,233 @@
+package MyDb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FixtureOption configures LoadFixtures
+type FixtureOption func(l *fixtureLoad)
+
+// fixtureLoad is how LoadFixtures loads the fixtures
+type fixtureLoad struct {
+	transaction bool // Whether the fixtures are loaded all or none
+}
+
+// InTransaction makes LoadFixtures load every fixture or none: when one fails, the
+// tables it created are dropped and the others get back the rows they had
+func InTransaction() FixtureOption {
+	return func(l *fixtureLoad) {
+		l.transaction = true
+	}
+}
+
+// fixture is a table and its rows declared by a fixture file
+type fixture struct {
+	Table       string            `json:"table"`        // Table of the rows, by default the name of the file
+	Columns     []ColumnDef       `json:"columns"`      // Columns of the table to create when it does not exist
+	ForeignKeys []ForeignKey      `json:"foreign_keys"` // Foreign keys of the created table
+	Rows        []json.RawMessage `json:"rows"`         // Rows of the table
+	file        string            // Name of the file declaring the fixture
+}
+
+// LoadFixtures loads the .json, .yaml and .yml files of a directory into tables, e.g. to
+// set up the data of tests. A file holds the rows of the table named after it, as a list
+// of objects, or an object with the "rows" of a "table" and the "columns" and
+// "foreign_keys" to create it with when it does not exist. A YAML file may hold several
+// tables as documents separated by "---". Tables created without columns get the types
+// ImportJSON infers. Files are loaded in the order of their names, so that numbering
+// them, e.g. "01_users.yml", loads referenced tables first, a number prefix being left
+// out of the table name. Every file is read before any row is inserted
+func (db *Database) LoadFixtures(dir string, options ...FixtureOption) error {
+	var load fixtureLoad
+	for _, option := range options {
+		option(&load)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var fixtures []fixture
+	for _, entry := range entries { // Sorted by name
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || ext != ".json" && ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		read, err := readFixtures(entry.Name(), data)
+		if err != nil {
+			return fmt.Errorf("fixture %s: %w", entry.Name(), err)
+		}
+		fixtures = append(fixtures, read...)
+	}
+
+	// Remember the rows of the tables a failed load puts back
+	var before map[string]tableCopy
+	if load.transaction {
+		var existing []string
+		for _, f := range fixtures {
+			if _, err := db.tableColumns(f.Table); err == nil && !slices.Contains(existing, f.Table) {
+				existing = append(existing, f.Table)
+			}
+		}
+		if len(existing) > 0 {
+			if before, err = db.copyTables(existing...); err != nil {
+				return err
+			}
+		}
+	}
+	var created []string
+	for _, f := range fixtures {
+		if err := db.loadFixture(f, &created); err != nil {
+			err = fmt.Errorf("fixture %s: %w", f.file, err)
+			if load.transaction {
+				if undoErr := db.undoFixtures(created, before); undoErr != nil {
+					return fmt.Errorf("%w, and putting the tables back failed: %v", err, undoErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readFixtures reads the fixtures of a file
+func readFixtures(name string, data []byte) ([]fixture, error) {
+	var docs []any
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	} else {
+		var err error
+		if docs, err = parseYAML(data); err != nil {
+			return nil, err
+		}
+	}
+
+	// The table is named after the file without its extension and number prefix
+	table := strings.TrimSuffix(name, filepath.Ext(name))
+	if prefix := strings.TrimLeft(table, "0123456789"); len(prefix) < len(table) && prefix != "" && (prefix[0] == '_' || prefix[0] == '-') {
+		table = prefix[1:]
+	}
+	var fixtures []fixture
+	for _, doc := range docs {
+		f := fixture{Table: table, file: name}
+		if rows, ok := doc.([]any); ok {
+			doc = map[string]any{"rows": rows}
+		}
+		declared, ok := doc.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected a list of rows or an object with rows")
+		}
+
+		// Defaults are strings even when written as numbers or booleans
+		columns, _ := declared["columns"].([]any)
+		for _, column := range columns {
+			if column, ok := column.(map[string]any); ok && column["default"] != nil {
+				column["default"] = fmt.Sprint(column["default"])
+			}
+		}
+		data, err := json.Marshal(declared)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+// loadFixture inserts the rows of a fixture, creating its table when it does not exist
+// and adding it to the created tables
+func (db *Database) loadFixture(f fixture, created *[]string) error {
+	_, err := db.tableColumns(f.Table)
+	exists := err == nil
+	if !exists && len(f.Columns) > 0 {
+		if err := db.CreateTableWithSchema(f.Table, f.Columns); err != nil {
+			return err
+		}
+		*created = append(*created, f.Table)
+		exists = true
+		for _, fk := range f.ForeignKeys {
+			if err := db.AddForeignKey(f.Table, fk); err != nil {
+				return err
+			}
+		}
+	}
+	ji, err := db.newJSONImport(f.Table, ImportOptions{CreateTable: true})
+	if err != nil {
+		return err
+	}
+	for i, row := range f.Rows {
+		if err = ji.add(row, 0, i+1); err != nil {
+			break
+		}
+	}
+	if flushErr := ji.flush(); err == nil {
+		err = flushErr
+	}
+	if _, tableErr := db.tableColumns(f.Table); !exists && tableErr == nil {
+		*created = append(*created, f.Table)
+	}
+	return err
+}
+
+// undoFixtures drops the tables created by fixtures, the last first, and puts the rows of
+// the others back as they were
+func (db *Database) undoFixtures(created []string, before map[string]tableCopy) error {
+	for i := len(created) - 1; i >= 0; i-- {
+		if err := db.DropTable(created[i]); err != nil {
+			return err
+		}
+	}
+	for tableName, c := range before {
+		if err := db.putBack(tableName, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putBack puts the rows of a table and its auto-increment value back as they were in a
+// copy of it, saving the database when the log is on like a schema change, as the log
+// only records changes to rows
+func (db *Database) putBack(tableName string, c tableCopy) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		return err
+	}
+
+	table.mu.Lock() // Lock table second
+	table.Rows = slices.Clone(c.rows)
+	table.shared.Store(false)
+	table.lastID = c.schema.LastID
+	table.dirty = true
+	err := table.rebuildIndexes(tableName)
+	table.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return db.checkpointDDL()
+}
@@ -0,0 +1,381 @@
+package MyDb
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// RefAction is what deleting a referenced row does to the rows referencing it
+type RefAction int
+
+const (
+	Restrict RefAction = iota // The delete fails
+	Cascade                   // The referencing rows are deleted too
+)
+
+// String returns the SQL name of the action
+func (a RefAction) String() string {
+	switch a {
+	case Restrict:
+		return "restrict"
+	case Cascade:
+		return "cascade"
+	}
+	return fmt.Sprintf("RefAction(%d)", int(a))
+}
+
+// MarshalText returns the SQL name of the action, for the saved schema
+func (a RefAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText sets the action from its SQL name
+func (a *RefAction) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "restrict":
+		*a = Restrict
+	case "cascade":
+		*a = Cascade
+	default:
+		return fmt.Errorf("unknown ON DELETE action %s", text)
+	}
+	return nil
+}
+
+// ForeignKey declares that the values of columns of a table must exist in the
+// primary key or a UNIQUE constraint of another table
+type ForeignKey struct {
+	Columns    []string  `json:"columns"`     // Referencing columns
+	RefTable   string    `json:"ref_table"`   // Referenced table
+	RefColumns []string  `json:"ref_columns"` // Referenced columns, in the order of Columns
+	OnDelete   RefAction `json:"on_delete"`   // What deleting a referenced row does
+}
+
+// AddForeignKey adds a foreign key to a table, e.g. orders.user_id referencing users.id.
+// Rows whose referencing columns are all set must match a row of the referenced table,
+// while rows with a NULL in them are exempt. It fails if existing rows do not match
+func (db *Database) AddForeignKey(tableName string, fk ForeignKey) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	parent, exists := db.Tables[fk.RefTable]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", fk.RefTable)
+	}
+	if err := checkForeignKey(tableName, table, parent, fk); err != nil {
+		return err
+	}
+	fk.Columns = append([]string(nil), fk.Columns...)
+	fk.RefColumns = append([]string(nil), fk.RefColumns...)
+
+	l := &tableLocks{tables: map[string]*Table{tableName: table, fk.RefTable: parent}, write: map[*Table]bool{table: true}}
+	for name, table := range l.tables {
+		if err := db.use(name, table); err != nil {
+			return err
+		}
+	}
+	l.lock() // Lock tables second
+	table.foreignKeys = append(table.foreignKeys, fk)
+	err := l.checkReferences(tableName, table, table.Rows)
+	if err != nil {
+		table.foreignKeys = table.foreignKeys[:len(table.foreignKeys)-1]
+	}
+	l.unlock()
+	if err != nil {
+		return err
+	}
+	return db.checkpointDDL()
+}
+
+// checkForeignKey returns an error if a foreign key of a table does not reference as
+// many columns as it has, or the primary key or a unique constraint of its parent
+func checkForeignKey(tableName string, table, parent *Table, fk ForeignKey) error {
+	if len(fk.Columns) == 0 || len(fk.Columns) != len(fk.RefColumns) {
+		return fmt.Errorf("foreign key of table %s must reference as many columns as it has", tableName)
+	}
+	if fk.OnDelete != Restrict && fk.OnDelete != Cascade {
+		return fmt.Errorf("invalid ON DELETE action for foreign key of table %s", tableName)
+	}
+	if err := checkColumns(tableName, table.Columns, fk.Columns); err != nil {
+		return err
+	}
+	if err := checkColumns(fk.RefTable, parent.Columns, fk.RefColumns); err != nil {
+		return err
+	}
+	if parent.findUnique(fk.RefColumns) == nil {
+		return fmt.Errorf("columns (%s) of table %s are not a primary key or unique", strings.Join(fk.RefColumns, ", "), fk.RefTable)
+	}
+	return nil
+}
+
+// findUnique returns the primary key or UNIQUE index on exactly the given columns, in any order
+func (t *Table) findUnique(columns []string) *uniqueIndex {
+	for _, ix := range t.uniqueIndexes() {
+		if len(ix.columns) != len(columns) {
+			continue
+		}
+		found := true
+		for _, col := range columns {
+			found = found && contains(ix.columns, col)
+		}
+		if found {
+			return ix
+		}
+	}
+	return nil
+}
+
+// refRow returns the values a row references, keyed by referenced column, or false
+// when one of the referencing columns is NULL
+func (fk ForeignKey) refRow(row map[string]string) (map[string]string, bool) {
+	values := make(map[string]string, len(fk.Columns))
+	for i, col := range fk.Columns {
+		value, ok := row[col]
+		if !ok || value == Null {
+			return nil, false
+		}
+		values[fk.RefColumns[i]] = value
+	}
+	return values, true
+}
+
+// describe formats the foreign key for error messages
+func (fk ForeignKey) describe(tableName string) string {
+	return fmt.Sprintf("foreign key %s (%s) referencing %s (%s)", tableName, strings.Join(fk.Columns, ", "), fk.RefTable, strings.Join(fk.RefColumns, ", "))
+}
+
+// checkReferences returns an error if one of the rows references a row that does not
+// exist. The locks must hold the tables referenced by the table
+func (l *tableLocks) checkReferences(tableName string, table *Table, rows []map[string]string) error {
+	for _, fk := range table.foreignKeys {
+		ix := l.tables[fk.RefTable].findUnique(fk.RefColumns)
+		for _, row := range rows {
+			ref, ok := fk.refRow(row)
+			if !ok {
+				continue
+			}
+			key, _ := ix.key(ref)
+			if _, found := ix.rows[key]; !found {
+				return fmt.Errorf("%s: no row of table %s has %s", fk.describe(tableName), fk.RefTable, ix.describeValues(ref))
+			}
+		}
+	}
+	return nil
+}
+
+// describeValues formats values of the indexed columns for error messages
+func (ix *uniqueIndex) describeValues(row map[string]string) string {
+	values := make([]string, len(ix.columns))
+	for i, col := range ix.columns {
+		values[i] = row[col]
+	}
+	return fmt.Sprintf("(%s) = (%s)", strings.Join(ix.columns, ", "), strings.Join(values, ", "))
+}
+
+// referencing calls fn for each foreign key referencing a table, with the table holding it
+func (db *Database) referencing(tableName string, fn func(childName string, child *Table, fk ForeignKey) error) error {
+	for childName, child := range db.Tables {
+		for _, fk := range child.foreignKeys {
+			if fk.RefTable == tableName {
+				if err := fn(childName, child, fk); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// refKeys returns the keys of the values of the rows referenced through a foreign key
+func refKeys(fk ForeignKey, rows []map[string]string) map[string]bool {
+	keys := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if key, ok := indexKey(row, fk.RefColumns); ok {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// references reports whether a row references one of the keys built by refKeys
+func (fk ForeignKey) references(row map[string]string, keys map[string]bool) bool {
+	ref, ok := fk.refRow(row)
+	if !ok {
+		return false
+	}
+	key, _ := indexKey(ref, fk.RefColumns)
+	return keys[key]
+}
+
+// planDeletes marks for deletion the rows referencing the deleted rows of a table
+// through foreign keys with ON DELETE CASCADE, and fails if a foreign key with ON
+// DELETE RESTRICT references one of them. doomed holds the indexes of the rows to
+// delete by table. The locks must be those of a delete from the table
+func (l *tableLocks) planDeletes(tableName string, deleted []map[string]string, doomed map[string]map[int]bool) error {
+	return l.referencing(tableName, func(childName string, child *Table, fk ForeignKey) error {
+		keys := refKeys(fk, deleted)
+		if len(keys) == 0 {
+			return nil
+		}
+		if doomed[childName] == nil {
+			doomed[childName] = make(map[int]bool)
+		}
+		var cascaded []map[string]string
+		for i, row := range child.Rows {
+			if doomed[childName][i] || !fk.references(row, keys) {
+				continue
+			}
+			if fk.OnDelete == Restrict {
+				return fmt.Errorf("cannot delete from table %s: rows are still referenced by %s", tableName, fk.describe(childName))
+			}
+			doomed[childName][i] = true
+			cascaded = append(cascaded, row)
+		}
+		if len(cascaded) == 0 {
+			return nil
+		}
+		// The cascade continues to the tables referencing the child
+		return l.planDeletes(childName, cascaded, doomed)
+	})
+}
+
+// deleteCascading deletes the rows of a table at the given indexes along with the rows
+// of other tables that reference them through foreign keys with ON DELETE CASCADE. Nothing
+// is deleted if a foreign key with ON DELETE RESTRICT references one of the deleted rows.
+// It returns the deleted rows of the table. The locks must be those of a delete from the table
+func (l *tableLocks) deleteCascading(tableName string, table *Table, rows map[int]bool) ([]map[string]string, error) {
+	var deleted []map[string]string
+	for _, i := range slices.Sorted(maps.Keys(rows)) {
+		deleted = append(deleted, table.Rows[i])
+	}
+	doomed := map[string]map[int]bool{tableName: rows}
+	if err := l.planDeletes(tableName, deleted, doomed); err != nil {
+		return nil, err
+	}
+	// The tables are logged in order of name, for the log to be the same on every run
+	var changes []walChange
+	for _, name := range slices.Sorted(maps.Keys(doomed)) {
+		rows, other := doomed[name], l.tables[name]
+		var locked []map[string]string
+		for _, i := range slices.Sorted(maps.Keys(rows)) {
+			locked = append(locked, other.Rows[i])
+		}
+		if err := l.lockRows(name, other, locked); err != nil {
+			return nil, err
+		}
+		changes = append(changes, walChange{Table: name, Delete: locked})
+	}
+	if err := l.log(changes...); err != nil {
+		return nil, err
+	}
+	for name, rows := range doomed {
+		if other := l.tables[name]; other != table && len(rows) > 0 {
+			other.removeRows(rows)
+		}
+	}
+	return table.removeRows(rows), nil
+}
+
+// removeRows deletes the rows at the given indexes and returns them, freeing their slots
+// in the kept positions. The table lock must be held
+func (t *Table) removeRows(doomed map[int]bool) []map[string]string {
+	positions := slices.Sorted(maps.Keys(doomed))
+	removed := make([]map[string]string, len(positions))
+	for j, i := range positions {
+		removed[j] = t.Rows[i]
+		if t.positions == nil {
+			continue
+		}
+		if p, ok := t.positions.position(t.Rows[i]); !ok || p != i {
+			t.positions = nil // Stale, gathered again once used
+		}
+	}
+	if t.positions != nil {
+		for _, row := range removed {
+			t.positions.remove(row)
+		}
+	}
+
+	// Rows are moved down in place unless a snapshot shares them
+	remaining := t.Rows[:0]
+	if t.shared.Load() {
+		remaining = make([]map[string]string, 0, len(t.Rows)-len(removed))
+	}
+	start := 0
+	for _, i := range positions {
+		remaining = append(remaining, t.Rows[start:i]...)
+		start = i + 1
+	}
+	remaining = append(remaining, t.Rows[start:]...)
+	if !t.shared.Load() {
+		clear(t.Rows[len(remaining):])
+	}
+	t.Rows = remaining
+	t.shared.Store(false)
+	t.unindexRows(removed)
+	return removed
+}
+
+// checkReferenced returns an error if an update changes the values of rows that other
+// rows still reference. The locks must be those of an update of the table
+func (l *tableLocks) checkReferenced(tableName string, oldRows, newRows []map[string]string) error {
+	return l.referencing(tableName, func(childName string, child *Table, fk ForeignKey) error {
+		var changed []map[string]string
+		for i, row := range oldRows {
+			if rowKey(row, fk.RefColumns) != rowKey(newRows[i], fk.RefColumns) {
+				changed = append(changed, row)
+			}
+		}
+		keys := refKeys(fk, changed)
+		if len(keys) == 0 {
+			return nil
+		}
+		for _, row := range child.Rows {
+			if fk.references(row, keys) {
+				return fmt.Errorf("cannot update table %s: rows are still referenced by %s", tableName, fk.describe(childName))
+			}
+		}
+		return nil
+	})
+}
+
+// parseReferences parses "REFERENCES table (col, ...) [ON DELETE CASCADE | RESTRICT]"
+// into a foreign key on the given columns
+func (p *parser) parseReferences(columns []string) (ForeignKey, error) {
+	fk := ForeignKey{Columns: columns}
+	if err := p.expect("references"); err != nil {
+		return fk, err
+	}
+	refTable, err := p.parseName()
+	if err != nil {
+		return fk, err
+	}
+	fk.RefTable = refTable
+	if fk.RefColumns, err = p.parseNameList(); err != nil {
+		return fk, err
+	}
+	if p.accept("on") {
+		if err := p.expect("delete"); err != nil {
+			return fk, err
+		}
+		switch {
+		case p.accept("cascade"):
+			fk.OnDelete = Cascade
+		case p.accept("restrict"):
+			fk.OnDelete = Restrict
+		case p.accept("no"):
+			if err := p.expect("action"); err != nil {
+				return fk, err
+			}
+		default:
+			return fk, p.unexpected()
+		}
+	}
+	return fk, nil
+}
@@ -0,0 +1,133 @@
+package MyDb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"maps"
+)
+
+// Format is how Save encodes the data of tables. Load reads tables in any format
+type Format int
+
+const (
+	// CSV saves tables as CSV text, which other programs can read
+	CSV Format = iota
+	// Gob saves tables in the binary encoding/gob format, which is faster to save and load
+	Gob
+)
+
+// gobMagic starts the data of a table in the Gob format, which a CSV header cannot
+const gobMagic = "\x00MyDbGob\x01"
+
+// SetFormat sets how Save encodes the data of tables, CSV by default. The next Save saves
+// every table in the new format
+func (db *Database) SetFormat(format Format) error {
+	if format != CSV && format != Gob {
+		return fmt.Errorf("unknown format %d", format)
+	}
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+	db.format = format
+	db.markDirty(nil)
+	return nil
+}
+
+// markDirty marks the tables for which only returns true, or every table when only is
+// nil, as changed so that the next Save rewrites them. The db lock must be held, but no
+// table lock
+func (db *Database) markDirty(only func(t *Table) bool) {
+	l := &tableLocks{tables: maps.Clone(db.Tables), write: make(map[*Table]bool)}
+	for _, table := range l.tables {
+		l.write[table] = true
+	}
+	l.lock() // Lock tables second
+	defer l.unlock()
+	for _, table := range l.tables {
+		if only == nil || only(table) {
+			table.dirty = true
+		}
+	}
+}
+
+// tableWriter writes the header and then the rows of a table, as lists of fields
+type tableWriter interface {
+	Write(record []string) error
+	Flush() error
+}
+
+// newTableWriter returns a writer of table data in a format, in a dialect for CSV
+func newTableWriter(w io.Writer, format Format, dialect CSVDialect) (tableWriter, error) {
+	if format == CSV {
+		return newCSVWriter(w, dialect)
+	}
+	if _, err := io.WriteString(w, gobMagic); err != nil {
+		return nil, err
+	}
+	return gobTableWriter{gob.NewEncoder(w)}, nil
+}
+
+// csvTableWriter writes tables as CSV
+type csvTableWriter struct {
+	*csv.Writer
+}
+
+func (w csvTableWriter) Flush() error {
+	w.Writer.Flush()
+	return w.Error()
+}
+
+// gobTableWriter writes tables in the Gob format, as a stream of records
+type gobTableWriter struct {
+	enc *gob.Encoder
+}
+
+func (w gobTableWriter) Write(record []string) error {
+	return w.enc.Encode(record)
+}
+
+func (w gobTableWriter) Flush() error {
+	return nil
+}
+
+// tableReader reads the header and then the rows of a table, returning io.EOF after the
+// last one
+type tableReader interface {
+	Read() ([]string, error)
+}
+
+// newTableReader returns a reader of table data in the format it is in, in a dialect for CSV
+func newTableReader(r io.Reader, dialect CSVDialect) tableReader {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gobMagic)); bytes.Equal(magic, []byte(gobMagic)) {
+		br.Discard(len(gobMagic))
+		return &gobTableReader{dec: gob.NewDecoder(br)}
+	}
+	return newCSVReader(br, dialect)
+}
+
+// gobTableReader reads tables written by gobTableWriter, checking that every row has as
+// many fields as the header like csv.Reader does
+type gobTableReader struct {
+	dec    *gob.Decoder
+	fields int // Number of fields of the header, 0 before it is read
+}
+
+func (r *gobTableReader) Read() ([]string, error) {
+	var record []string
+	if err := r.dec.Decode(&record); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated table data")
+		}
+		return nil, err
+	}
+	if r.fields == 0 {
+		r.fields = len(record)
+	} else if len(record) != r.fields {
+		return nil, fmt.Errorf("row has %d fields instead of %d", len(record), r.fields)
+	}
+	return record, nil
+}
@@ -0,0 +1,400 @@
+package MyDb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// fullTextIndex maps the words of a text column to the rows holding them. Words are
+// lower cased and reduced to their stem by the stemmer of the index, if any
+type fullTextIndex struct {
+	name     string               // Name of the index, unique within its table
+	column   string               // Indexed column
+	stemmer  string               // Name of the stemmer, empty to keep words as they are
+	stem     func(string) string  // Stemmer function, nil when there is none
+	postings map[string][]posting // Rows holding each term
+	rows     int                  // Number of indexed rows, those where the column is not NULL
+}
+
+// posting is a row holding a term, with the number of times it holds it
+type posting struct {
+	row   map[string]string
+	count int
+}
+
+// SearchResult is a row found by Search with its relevance to the query
+type SearchResult struct {
+	Row   map[string]string // Matching row
+	Score float64           // Relevance, higher for rows holding the words of the query more often and for rarer words
+}
+
+// FullTextOption configures an index created with CreateFullTextIndex
+type FullTextOption func(ix *fullTextIndex)
+
+// WithStemmer makes CreateFullTextIndex reduce words to their stem with the stemmer
+// registered under the given name, so that e.g. "running" matches "runs". The built-in
+// "english" stemmer strips common English suffixes
+func WithStemmer(name string) FullTextOption {
+	return func(ix *fullTextIndex) {
+		ix.stemmer = strings.ToLower(name)
+	}
+}
+
+// builtinStemmers are the stemmers available without RegisterStemmer
+var builtinStemmers = map[string]func(string) string{
+	"english": stemEnglish,
+}
+
+// RegisterStemmer makes a Go function reducing a lower case word to its stem usable by
+// full-text indexes under the given name. Register the stemmers of saved indexes before
+// calling Load
+func (db *Database) RegisterStemmer(name string, stem func(word string) string) error {
+	if !isValidName(name) {
+		return fmt.Errorf("invalid stemmer name %s", name)
+	}
+	if stem == nil {
+		return fmt.Errorf("stemmer %s is nil", name)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.stemmers == nil {
+		db.stemmers = make(map[string]func(string) string)
+	}
+	db.stemmers[strings.ToLower(name)] = stem
+	return nil
+}
+
+// findStemmer returns the stemmer with the given lower case name. The db lock must be held
+func (db *Database) findStemmer(name string) (func(string) string, bool) {
+	if stem, ok := db.stemmers[name]; ok {
+		return stem, true
+	}
+	stem, ok := builtinStemmers[name]
+	return stem, ok
+}
+
+// CreateFullTextIndex creates a full-text index named "<table>_<column>_fts" on a text
+// column. It splits values into words, which Search and the MATCH operator of WHERE
+// clauses then look up, e.g. "select * from articles where body match 'go database'"
+// finds the articles whose body holds both words
+func (db *Database) CreateFullTextIndex(tableName, column string, options ...FullTextOption) error {
+	ix := &fullTextIndex{name: tableName + "_" + column + "_fts", column: column}
+	for _, option := range options {
+		option(ix)
+	}
+	return db.alterTable(tableName, func(table *Table) error {
+		if err := checkColumns(tableName, table.Columns, []string{column}); err != nil {
+			return err
+		}
+		if table.findIndex(ix.name) != nil || table.findFullText(column) != nil {
+			return fmt.Errorf("full-text index on column %s already exists on table %s", column, tableName)
+		}
+		return table.addFullText(db, ix)
+	})
+}
+
+// addFullText fills a new full-text index from the rows of the table and adds it to the
+// table. The db lock and the table lock must be held
+func (t *Table) addFullText(db *Database, ix *fullTextIndex) error {
+	if ix.stemmer != "" {
+		stem, ok := db.findStemmer(ix.stemmer)
+		if !ok {
+			return fmt.Errorf("unknown stemmer %s", ix.stemmer)
+		}
+		ix.stem = stem
+	}
+	ix.build(t.Rows)
+	t.fullText = append(t.fullText, ix)
+	return nil
+}
+
+// findFullText returns the full-text index on a column of the table, or nil
+func (t *Table) findFullText(column string) *fullTextIndex {
+	for _, ix := range t.fullText {
+		if ix.column == column {
+			return ix
+		}
+	}
+	return nil
+}
+
+// describe formats the index for EXPLAIN
+func (ix *fullTextIndex) describe() string {
+	return "full-text index " + ix.name + " (" + ix.column + ")"
+}
+
+// terms splits a text into lower case words reduced to their stem, in order
+func (ix *fullTextIndex) terms(text string) []string {
+	return textTerms(text, ix.stem)
+}
+
+// textTerms splits a text into lower case words, made of letters and digits, reduced to
+// their stem when stem is not nil
+func textTerms(text string, stem func(string) string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := words[:0]
+	for _, word := range words {
+		if stem != nil {
+			word = stem(word)
+		}
+		if word != "" {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// build fills the index from the rows of its table
+func (ix *fullTextIndex) build(rows []map[string]string) {
+	ix.postings = make(map[string][]posting)
+	ix.rows = 0
+	ix.add(rows)
+}
+
+// add adds rows to the index
+func (ix *fullTextIndex) add(rows []map[string]string) {
+	for _, row := range rows {
+		value, ok := row[ix.column]
+		if !ok || value == Null {
+			continue
+		}
+		ix.rows++
+		counts := make(map[string]int)
+		var order []string
+		for _, term := range ix.terms(value) {
+			if counts[term] == 0 {
+				order = append(order, term)
+			}
+			counts[term]++
+		}
+		for _, term := range order {
+			ix.postings[term] = append(ix.postings[term], posting{row: row, count: counts[term]})
+		}
+	}
+}
+
+// remove removes rows from the index
+func (ix *fullTextIndex) remove(rows []map[string]string) {
+	for _, row := range rows {
+		value, ok := row[ix.column]
+		if !ok || value == Null {
+			continue
+		}
+		ix.rows--
+		for _, term := range ix.terms(value) {
+			list := ix.postings[term]
+			for i, p := range list {
+				if sameRow(p.row, row) {
+					list = append(list[:i:i], list[i+1:]...)
+					break
+				}
+			}
+			if len(list) == 0 {
+				delete(ix.postings, term)
+			} else {
+				ix.postings[term] = list
+			}
+		}
+	}
+}
+
+// search returns the rows holding every word of the query, the most relevant first.
+// Each word adds to the score of a row with the number of times the row holds it,
+// weighted by how rare the word is among the rows (tf-idf)
+func (ix *fullTextIndex) search(query string) []SearchResult {
+	terms := ix.terms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	var results []SearchResult
+	for i, term := range terms {
+		list := ix.postings[term]
+		idf := math.Log(1 + float64(ix.rows)/float64(max(len(list), 1)))
+		scores := make(map[uintptr]float64, len(list))
+		for _, p := range list {
+			scores[rowID(p.row)] += (1 + math.Log(float64(p.count))) * idf
+		}
+		if i == 0 {
+			for _, p := range list {
+				results = append(results, SearchResult{Row: p.row})
+			}
+		}
+		// Rows must hold every word
+		kept := results[:0]
+		for _, result := range results {
+			if score, ok := scores[rowID(result.Row)]; ok {
+				result.Score += score
+				kept = append(kept, result)
+			}
+		}
+		results = kept
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// Search returns the rows of a table whose column holds every word of the query, found
+// through the full-text index of the column, the most relevant first
+func (db *Database) Search(tableName, column, query string) ([]SearchResult, error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		return nil, err
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	ix := table.findFullText(column)
+	if ix == nil {
+		return nil, fmt.Errorf("column %s of table %s has no full-text index", column, tableName)
+	}
+	return ix.search(query), nil
+}
+
+// matchExpr tests whether a text holds every word of a query, like a full-text index
+type matchExpr struct {
+	left, query expr
+	stem        func(string) string // Stemmer of the full-text index of the column, nil when none
+}
+
+func (e *matchExpr) eval(row map[string]string) (string, error) {
+	value, err := e.left.eval(row)
+	if err != nil {
+		return "", err
+	}
+	query, err := e.query.eval(row)
+	if err != nil {
+		return "", err
+	}
+	if value == Null || query == Null {
+		return Null, nil
+	}
+	held := make(map[string]bool)
+	for _, term := range textTerms(value, e.stem) {
+		held[term] = true
+	}
+	terms := textTerms(query, e.stem)
+	for _, term := range terms {
+		if !held[term] {
+			return boolString(false), nil
+		}
+	}
+	return boolString(len(terms) > 0), nil
+}
+
+// parseMatch parses the query of "column MATCH query", using the stemmer of the
+// full-text index of the column so that rows match like through the index
+func (p *parser) parseMatch(left expr) (expr, error) {
+	query, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	match := &matchExpr{left: left, query: query}
+	if col, ok := left.(*columnExpr); ok {
+		match.stem = p.db.fullTextStemmer(p.columnTable(col.name))
+	}
+	return match, nil
+}
+
+// columnTable returns the table of the source holding a column, given its row key, and
+// the column name within the table
+func (p *parser) columnTable(key string) (string, string) {
+	if qualifier, col, ok := strings.Cut(key, "."); ok && len(p.tables) > 1 {
+		for _, t := range p.tables {
+			if t.qualifier() == qualifier {
+				return t.name, col
+			}
+		}
+	}
+	if len(p.tables) == 0 {
+		return "", key
+	}
+	return p.tables[0].name, key
+}
+
+// fullTextStemmer returns the stemmer of the full-text index on a column, or nil when
+// the column has no full-text index or its index keeps words as they are
+func (db *Database) fullTextStemmer(tableName, column string) func(string) string {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	if ix := table.findFullText(column); ix != nil {
+		return ix.stem
+	}
+	return nil
+}
+
+// matches returns the queries that a condition requires columns to match, taken from
+// "col MATCH 'query'" tests joined by AND
+func matches(cond expr) map[string]string {
+	queries := make(map[string]string)
+	var walk func(e expr)
+	walk = func(e expr) {
+		switch e := e.(type) {
+		case *logicalExpr:
+			if !e.or {
+				walk(e.left)
+				walk(e.right)
+			}
+		case *matchExpr:
+			col, ok := e.left.(*columnExpr)
+			lit, isLiteral := e.query.(*literalExpr)
+			if ok && isLiteral && lit.value != Null {
+				if _, seen := queries[col.name]; !seen {
+					queries[col.name] = lit.value
+				}
+			}
+		}
+	}
+	if cond != nil {
+		walk(cond)
+	}
+	return queries
+}
+
+// stemEnglish strips common English suffixes from a lower case word, e.g. "running",
+// "runs" and "run" all become "run". It is a light stemmer, not a full Porter stemmer
+func stemEnglish(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	for _, rule := range []struct{ suffix, replacement string }{
+		{"sses", "ss"},
+		{"ies", "y"},
+		{"ing", ""},
+		{"ed", ""},
+		{"s", ""},
+	} {
+		stem, ok := strings.CutSuffix(word, rule.suffix)
+		if !ok || len(stem) < 3 || strings.HasSuffix(word, "ss") && rule.suffix == "s" {
+			continue
+		}
+		stem += rule.replacement
+		// Undouble the final consonant, e.g. "running" to "run"
+		if n := len(stem); rule.replacement == "" && n > 3 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiouslz", rune(stem[n-1])) {
+			stem = stem[:n-1]
+		}
+		return stem
+	}
+	return word
+}
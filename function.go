@@ -0,0 +1,232 @@
+package MyDb
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// scalarFunc is a function callable from commands, e.g. UPPER(name)
+type scalarFunc func(args ...string) (string, error)
+
+// builtinFunctions are the functions available in every command, keyed by lower case name
+var builtinFunctions = map[string]scalarFunc{
+	"upper":  funcUpper,
+	"lower":  funcLower,
+	"length": funcLength,
+	"concat": funcConcat,
+	"trim":   funcTrim,
+	"substr": funcSubstr,
+	"now":    funcNow,
+	"uuid":   funcUUID,
+
+	"date_add": funcDateAdd,
+	"strftime": funcStrftime,
+
+	"json_extract": funcJSONExtract,
+	"json_valid":   funcJSONValid,
+
+	"levenshtein": funcLevenshtein,
+}
+
+// RegisterFunction makes a Go function callable from commands under the given name,
+// e.g. "select slugify(title) from posts". Names are case insensitive and a registered
+// function takes precedence over a built-in function with the same name
+func (db *Database) RegisterFunction(name string, fn func(args ...string) (string, error)) error {
+	if !isValidName(name) {
+		return fmt.Errorf("invalid function name %s", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("function %s is nil", name)
+	}
+
+	db.funcsMu.Lock()
+	defer db.funcsMu.Unlock()
+	if db.funcs == nil {
+		db.funcs = make(map[string]scalarFunc)
+	}
+	db.funcs[strings.ToLower(name)] = fn
+	return nil
+}
+
+// lookupFunction returns the function with the given name, ignoring case
+func (db *Database) lookupFunction(name string) (scalarFunc, bool) {
+	db.funcsMu.RLock()
+	defer db.funcsMu.RUnlock()
+	if fn, ok := db.funcs[strings.ToLower(name)]; ok {
+		return fn, true
+	}
+	fn, ok := builtinFunctions[strings.ToLower(name)]
+	return fn, ok
+}
+
+// funcExpr calls a function with the values of its arguments
+type funcExpr struct {
+	name string
+	fn   scalarFunc
+	args []expr
+}
+
+func (e *funcExpr) eval(row map[string]string) (string, error) {
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		value, err := arg.eval(row)
+		if err != nil {
+			return "", err
+		}
+		if value == Null {
+			// Functions of NULL are NULL
+			return Null, nil
+		}
+		args[i] = value
+	}
+	value, err := e.fn(args...)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.ToUpper(e.name), err)
+	}
+	return value, nil
+}
+
+// parseCall parses the parenthesized argument list of a call to the named function.
+// COALESCE is handled here since, unlike other functions, it accepts NULL arguments
+func (p *parser) parseCall(name string) (expr, error) {
+	if isAggregate(name) {
+		return p.parseAggregate(name)
+	}
+	fn, ok := p.db.lookupFunction(name)
+	coalesce := strings.EqualFold(name, "coalesce")
+	if !ok && !coalesce {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []expr
+	for !p.peek().is(")") {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if !ok {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("COALESCE expects at least 1 argument")
+		}
+		return &coalesceExpr{args: args}, nil
+	}
+	return &funcExpr{name: name, fn: fn, args: args}, nil
+}
+
+// checkArgs returns an error if the number of arguments is not between min and max, -1 for no maximum
+func checkArgs(args []string, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		if min == max {
+			return fmt.Errorf("expected %d arguments, got %d", min, len(args))
+		}
+		return fmt.Errorf("expected at least %d arguments, got %d", min, len(args))
+	}
+	return nil
+}
+
+// funcUpper converts a value to upper case
+func funcUpper(args ...string) (string, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(args[0]), nil
+}
+
+// funcLower converts a value to lower case
+func funcLower(args ...string) (string, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+	return strings.ToLower(args[0]), nil
+}
+
+// funcLength returns the number of characters of a value
+func funcLength(args ...string) (string, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(utf8.RuneCountInString(args[0])), nil
+}
+
+// funcConcat joins its arguments
+func funcConcat(args ...string) (string, error) {
+	if err := checkArgs(args, 1, -1); err != nil {
+		return "", err
+	}
+	return strings.Join(args, ""), nil
+}
+
+// funcTrim removes leading and trailing white space
+func funcTrim(args ...string) (string, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(args[0]), nil
+}
+
+// funcSubstr returns the characters of a value from a 1-based start position,
+// optionally limited to a length: SUBSTR(value, start [, length])
+func funcSubstr(args ...string) (string, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", fmt.Errorf("expected 2 or 3 arguments, got %d", len(args))
+	}
+	runes := []rune(args[0])
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid start position %q", args[1])
+	}
+	end := len(runes) + 1
+	if len(args) == 3 {
+		length, err := strconv.Atoi(args[2])
+		if err != nil || length < 0 {
+			return "", fmt.Errorf("invalid length %q", args[2])
+		}
+		end = start + length
+	}
+	// Clamp the 1-based [start, end) range to the value
+	if start < 1 {
+		start = 1
+	}
+	if end > len(runes)+1 {
+		end = len(runes) + 1
+	}
+	if start >= end {
+		return "", nil
+	}
+	return string(runes[start-1 : end-1]), nil
+}
+
+// funcNow returns the current time in UTC in RFC 3339 format
+func funcNow(args ...string) (string, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+	return timestampNow(), nil
+}
+
+// funcUUID returns a random version 4 UUID
+func funcUUID(args ...string) (string, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return "", err
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,301 @@
+package MyDb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// trigramIndex maps the trigrams of the values of a column, the sequences of three
+// characters of their lower case form padded with spaces, to the rows holding them. Values
+// within a few edits of each other share most of their trigrams, so the index finds the
+// candidates of fuzzy matches without computing the edit distance of every row
+type trigramIndex struct {
+	name     string                         // Name of the index, unique within its table
+	column   string                         // Indexed column
+	postings map[string][]map[string]string // Rows holding each trigram
+	rows     []map[string]string            // Indexed rows, those where the column is not NULL
+}
+
+// trigramSize is the length of the sequences of characters of a trigram index
+const trigramSize = 3
+
+// CreateFuzzyIndex creates a trigram index named "<table>_<column>_trgm" on a text
+// column. Fuzzy conditions of WHERE clauses such as "name SIMILAR 'ahmd' WITHIN 2" and
+// SearchSimilar then find their rows through the index instead of scanning the table
+func (db *Database) CreateFuzzyIndex(tableName, column string) error {
+	return db.alterTable(tableName, func(table *Table) error {
+		if err := checkColumns(tableName, table.Columns, []string{column}); err != nil {
+			return err
+		}
+		if table.findFuzzy(column) != nil {
+			return fmt.Errorf("fuzzy index on column %s already exists on table %s", column, tableName)
+		}
+		table.addFuzzy(&trigramIndex{name: tableName + "_" + column + "_trgm", column: column})
+		return nil
+	})
+}
+
+// addFuzzy fills a new trigram index from the rows of the table and adds it to the
+// table. The table lock must be held
+func (t *Table) addFuzzy(ix *trigramIndex) {
+	ix.build(t.Rows)
+	t.fuzzy = append(t.fuzzy, ix)
+}
+
+// findFuzzy returns the trigram index on a column of the table, or nil
+func (t *Table) findFuzzy(column string) *trigramIndex {
+	for _, ix := range t.fuzzy {
+		if ix.column == column {
+			return ix
+		}
+	}
+	return nil
+}
+
+// describe formats the index for EXPLAIN
+func (ix *trigramIndex) describe() string {
+	return "trigram index " + ix.name + " (" + ix.column + ")"
+}
+
+// trigrams returns the distinct trigrams of the lower case form of a value, padded with
+// spaces so that its first and last characters also appear in trigramSize trigrams
+func trigrams(value string) []string {
+	padding := strings.Repeat(" ", trigramSize-1)
+	runes := []rune(padding + strings.ToLower(value) + padding)
+	seen := make(map[string]bool, len(runes))
+	var grams []string
+	for i := 0; i+trigramSize <= len(runes); i++ {
+		gram := string(runes[i : i+trigramSize])
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+	return grams
+}
+
+// build fills the index from the rows of its table
+func (ix *trigramIndex) build(rows []map[string]string) {
+	ix.postings = make(map[string][]map[string]string)
+	ix.rows = nil
+	ix.add(rows)
+}
+
+// add adds rows to the index
+func (ix *trigramIndex) add(rows []map[string]string) {
+	for _, row := range rows {
+		value, ok := row[ix.column]
+		if !ok || value == Null {
+			continue
+		}
+		ix.rows = append(ix.rows, row)
+		for _, gram := range trigrams(value) {
+			ix.postings[gram] = append(ix.postings[gram], row)
+		}
+	}
+}
+
+// remove removes rows from the index
+func (ix *trigramIndex) remove(rows []map[string]string) {
+	for _, row := range rows {
+		value, ok := row[ix.column]
+		if !ok || value == Null {
+			continue
+		}
+		ix.rows = removeRow(ix.rows, row)
+		for _, gram := range trigrams(value) {
+			if list := removeRow(ix.postings[gram], row); len(list) == 0 {
+				delete(ix.postings, gram)
+			} else {
+				ix.postings[gram] = list
+			}
+		}
+	}
+}
+
+// removeRow returns the rows without the given row map
+func removeRow(rows []map[string]string, row map[string]string) []map[string]string {
+	for i, r := range rows {
+		if sameRow(r, row) {
+			return append(rows[:i:i], rows[i+1:]...)
+		}
+	}
+	return rows
+}
+
+// search returns the rows whose value is within the given number of edits of the query,
+// the closest first. An edit changes at most trigramSize trigrams, so the candidates are
+// the rows sharing enough trigrams with the query, and every row when the query is too
+// short for that to exclude any
+func (ix *trigramIndex) search(query string, distance int) []map[string]string {
+	grams := trigrams(query)
+	candidates := ix.rows
+	if needed := len(grams) - trigramSize*distance; needed > 0 {
+		shared := make(map[uintptr]int)
+		candidates = nil
+		for _, gram := range grams {
+			for _, row := range ix.postings[gram] {
+				id := rowID(row)
+				shared[id]++
+				if shared[id] == needed {
+					candidates = append(candidates, row)
+				}
+			}
+		}
+	}
+	return closest(candidates, ix.column, query, distance)
+}
+
+// closest returns the rows whose column is within the given number of edits of a value,
+// the closest first
+func closest(rows []map[string]string, column, value string, distance int) []map[string]string {
+	type match struct {
+		row      map[string]string
+		distance int
+	}
+	var matches []match
+	for _, row := range rows {
+		stored, ok := row[column]
+		if !ok || stored == Null {
+			continue
+		}
+		if d := editDistance(stored, value); d <= distance {
+			matches = append(matches, match{row: row, distance: d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+	found := make([]map[string]string, len(matches))
+	for i, m := range matches {
+		found[i] = m.row
+	}
+	return found
+}
+
+// editDistance returns the Levenshtein distance between the lower case forms of two
+// values, the number of characters to insert, delete or replace to turn one into the other
+func editDistance(a, b string) int {
+	x, y := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	previous := make([]int, len(y)+1)
+	current := make([]int, len(y)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		current[0] = i
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(y)]
+}
+
+// SearchSimilar returns the rows of a table whose column is within the given number of
+// edits of a value, ignoring case, the closest first. It uses the fuzzy index of the
+// column when there is one and scans the table otherwise
+func (db *Database) SearchSimilar(tableName, column, value string, distance int) ([]map[string]string, error) {
+	if distance < 0 {
+		return nil, fmt.Errorf("edit distance cannot be negative")
+	}
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := checkColumns(tableName, table.Columns, []string{column}); err != nil {
+		return nil, err
+	}
+	if err := db.use(tableName, table); err != nil {
+		return nil, err
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	if ix := table.findFuzzy(column); ix != nil {
+		return ix.search(value, distance), nil
+	}
+	return closest(table.Rows, column, value, distance), nil
+}
+
+// similarExpr tests whether a value is within a number of edits of another, ignoring case
+type similarExpr struct {
+	left, value expr
+	distance    int // Maximum number of edits
+}
+
+func (e *similarExpr) eval(row map[string]string) (string, error) {
+	left, err := e.left.eval(row)
+	if err != nil {
+		return "", err
+	}
+	value, err := e.value.eval(row)
+	if err != nil {
+		return "", err
+	}
+	if left == Null || value == Null {
+		return Null, nil
+	}
+	return boolString(editDistance(left, value) <= e.distance), nil
+}
+
+// parseSimilar parses the rest of "value SIMILAR other [WITHIN distance]", where the
+// distance is the maximum number of edits and defaults to 1
+func (p *parser) parseSimilar(left expr) (expr, error) {
+	value, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	similar := &similarExpr{left: left, value: value, distance: 1}
+	if p.accept("within") {
+		if similar.distance, err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+	return similar, nil
+}
+
+// similarities returns the fuzzy conditions that a condition requires columns to
+// satisfy, taken from "col SIMILAR 'value' WITHIN n" tests joined by AND
+func similarities(cond expr) map[string]*similarExpr {
+	found := make(map[string]*similarExpr)
+	var walk func(e expr)
+	walk = func(e expr) {
+		switch e := e.(type) {
+		case *logicalExpr:
+			if !e.or {
+				walk(e.left)
+				walk(e.right)
+			}
+		case *similarExpr:
+			col, ok := e.left.(*columnExpr)
+			lit, isLiteral := e.value.(*literalExpr)
+			if ok && isLiteral && lit.value != Null {
+				if _, seen := found[col.name]; !seen {
+					found[col.name] = e
+				}
+			}
+		}
+	}
+	if cond != nil {
+		walk(cond)
+	}
+	return found
+}
+
+// funcLevenshtein returns the number of edits between two values, ignoring case
+func funcLevenshtein(args ...string) (string, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(editDistance(args[0], args[1])), nil
+}
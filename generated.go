@@ -0,0 +1,99 @@
+package MyDb
+
+import (
+	"fmt"
+)
+
+// generatedColumn is a column computed from the other columns of its row
+type generatedColumn struct {
+	value   expr     // Expression computing the column
+	columns []string // Columns the expression reads
+}
+
+// parseGenerated parses the expressions of the generated columns of a table definition,
+// keyed by column. It must be called without holding the db lock
+func (db *Database) parseGenerated(tableName string, columns []ColumnDef) (map[string]generatedColumn, error) {
+	var generated map[string]generatedColumn
+	for _, col := range columns {
+		if col.Generated == "" {
+			continue
+		}
+		if col.Default != "" || col.DefaultFunc != "" || col.AutoIncrement {
+			return nil, fmt.Errorf("generated column %s cannot have a default", col.Name)
+		}
+		p, err := newParser(db, col.Generated)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression of generated column %s: %w", col.Name, err)
+		}
+		if err := p.useColumns(tableName, columns); err != nil {
+			return nil, err
+		}
+		value, err := p.parseOr()
+		if err == nil {
+			err = p.expectEOF()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression of generated column %s: %w", col.Name, err)
+		}
+		if len(p.subqueries) > 0 {
+			return nil, fmt.Errorf("generated column %s cannot contain a subquery", col.Name)
+		}
+
+		gen := generatedColumn{value: value}
+		for _, tok := range p.tokens {
+			if _, ok := p.columns[tok.text]; !ok || tok.kind != tokenWord || contains(gen.columns, tok.text) {
+				continue
+			}
+			for _, other := range columns {
+				if other.Name == tok.text && other.Generated != "" {
+					return nil, fmt.Errorf("generated column %s cannot use generated column %s", col.Name, other.Name)
+				}
+			}
+			gen.columns = append(gen.columns, tok.text)
+		}
+		if generated == nil {
+			generated = make(map[string]generatedColumn)
+		}
+		generated[col.Name] = gen
+	}
+	return generated, nil
+}
+
+// checkWritable returns an error if a row sets a generated or timestamp column
+func (t *Table) checkWritable(tableName string, row map[string]string) error {
+	for col := range row {
+		if _, ok := t.generated[col]; ok {
+			return fmt.Errorf("column %s of table %s is generated and cannot be set", col, tableName)
+		}
+		if def := t.columnDef(col); def.CreatedAt || def.UpdatedAt {
+			return fmt.Errorf("column %s of table %s is a timestamp and cannot be set", col, tableName)
+		}
+	}
+	return nil
+}
+
+// computeGenerated sets the generated columns of a row from its other columns
+func (t *Table) computeGenerated(tableName string, row map[string]string) error {
+	for col, gen := range t.generated {
+		value, err := gen.value.eval(row)
+		if err == nil && value != Null {
+			value, err = t.columnDef(col).Type.normalize(value)
+		}
+		if err != nil {
+			return fmt.Errorf("generated column %s of table %s: %w", col, tableName, err)
+		}
+		row[col] = value
+	}
+	return nil
+}
+
+// usedByGenerated returns the generated column whose expression reads the column, or
+// false when there is none
+func (t *Table) usedByGenerated(column string) (string, bool) {
+	for col, gen := range t.generated {
+		if contains(gen.columns, column) {
+			return col, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,259 @@
+package MyDb
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultImportBatch is the number of rows ImportCSV inserts at once by default
+const DefaultImportBatch = 1000
+
+// ImportOptions tells ImportCSV how to read CSV data and map it to a table
+type ImportOptions struct {
+	Dialect     CSVDialect        // Dialect of the data
+	Header      []string          // Names of the CSV columns when the dialect has no header row, the columns of the table by default
+	Columns     map[string]string // Table column of CSV columns by name, "" to leave a CSV column out. Other CSV columns go to the table column of the same name
+	SkipBadRows bool              // Skip the rows that cannot be inserted and report them, rather than stopping at the first one
+	BatchSize   int               // Number of rows inserted at once, while holding the table lock, DefaultImportBatch when 0
+
+	// Tables that do not exist are created by ImportCSV and ImportJSON when CreateTable is
+	// set, with the columns of the data typed after the values of its first rows
+	CreateTable bool                  // Create the table when it does not exist
+	SampleRows  int                   // Number of rows read to infer the column types of a created table, DefaultSampleRows when 0
+	Types       map[string]ColumnType // Types of columns of a created table by name, overriding the inferred ones
+}
+
+// ImportReport tells what ImportCSV imported
+type ImportReport struct {
+	Rows    int           // Number of rows inserted
+	Skipped []ImportError // Rows skipped by SkipBadRows
+}
+
+// ImportError is a row of imported data that could not be imported
+type ImportError struct {
+	Line int   // Line of the row in the data, starting at 1, 0 for the rows of a JSON array
+	Row  int   // Number of the row in the data, starting at 1
+	Err  error // Why the row was not imported
+}
+
+func (e ImportError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e ImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportCSV streams the rows of CSV data into an existing table, in batches each taking
+// the table lock once. Each row is inserted like InsertInto, its values being checked
+// against the types and constraints of the table and missing columns getting their
+// defaults. A bad row stops the import with an ImportError, the rows before it being
+// imported, unless SkipBadRows is set. The auto-increment values taken by a batch with a
+// bad row are not reused. With CreateTable a table that does not exist is created with
+// the columns of the header, the int, float, bool, date or datetime type that every value
+// of a column in the first SampleRows rows has, string otherwise, unless Types gives it.
+// Empty cells are NULL in every column but string ones
+func (db *Database) ImportCSV(tableName string, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	var report ImportReport
+	if err := opts.Dialect.check(); err != nil {
+		return report, err
+	}
+	reader := newCSVReader(r, opts.Dialect)
+	header := opts.Header
+	if !opts.Dialect.NoHeader {
+		var err error
+		if header, err = reader.Read(); err != nil {
+			return report, fmt.Errorf("failed to read the header: %w", err)
+		}
+	}
+
+	// Read the first rows of a table to create before reading them for good
+	var sample []csvRecord
+	if _, err := db.tableColumns(tableName); err != nil && opts.CreateTable {
+		if header == nil {
+			return report, fmt.Errorf("table %s does not exist and the data has no header to create it from", tableName)
+		}
+		reader.FieldsPerRecord = len(header)
+		s := &tableSample{names: header, inferences: make([]typeInference, len(header))}
+		for len(sample) < cmp.Or(opts.SampleRows, DefaultSampleRows) {
+			record, err := readCSVRecord(reader)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return report, err
+			}
+			sample = append(sample, record)
+			for i, value := range record.fields {
+				s.inferences[i].add(value)
+			}
+		}
+		if opts, err = db.createSampledTable(tableName, s, opts); err != nil {
+			return report, err
+		}
+	}
+	im, table, err := db.newImporter(tableName, opts)
+	if err != nil {
+		return report, err
+	}
+
+	// Map the CSV columns to those of the table
+	table.mu.RLock()
+	tableColumns := table.Columns
+	types := make(map[string]ColumnType, len(tableColumns))
+	for _, col := range tableColumns {
+		types[col] = table.columnDef(col).Type
+	}
+	table.mu.RUnlock()
+	if header == nil {
+		header = tableColumns
+	}
+	reader.FieldsPerRecord = len(header)
+	columns := make([]string, 0, len(header))
+	for _, name := range header {
+		if column, mapped := opts.Columns[name]; mapped {
+			name = column
+		}
+		columns = append(columns, name)
+		if name != "" {
+			if err := checkColumns(tableName, tableColumns, []string{name}); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	// Insert the rows batch by batch
+	for rowNumber := 1; ; rowNumber++ {
+		var record csvRecord
+		if len(sample) > 0 {
+			record, sample = sample[0], sample[1:]
+		} else if record, err = readCSVRecord(reader); err == io.EOF {
+			break
+		} else if err != nil {
+			return im.report, err
+		}
+		if record.err != nil {
+			if err := im.reject(ImportError{Line: record.line, Row: rowNumber, Err: record.err}); err != nil {
+				return im.report, err
+			}
+			continue
+		}
+		row := make(map[string]string, len(record.fields))
+		for i, value := range record.fields {
+			switch {
+			case columns[i] == "":
+			case value == "" && types[columns[i]] != String:
+				row[columns[i]] = Null // Empty cells of typed columns are NULL
+			default:
+				row[columns[i]] = value
+			}
+		}
+		if err := im.add(row, record.line, rowNumber); err != nil {
+			return im.report, err
+		}
+	}
+	return im.report, im.flush()
+}
+
+// csvRecord is a record of CSV data, or the error of a record that could not be parsed
+type csvRecord struct {
+	fields []string
+	line   int
+	err    error
+}
+
+// readCSVRecord reads the next record of CSV data, io.EOF at the end of the data
+func readCSVRecord(reader *csv.Reader) (csvRecord, error) {
+	fields, err := reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return csvRecord{line: parseErr.StartLine, err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return csvRecord{}, err
+	}
+	line, _ := reader.FieldPos(0)
+	return csvRecord{fields: fields, line: line}, nil
+}
+
+// importer inserts the rows of an import into a table batch by batch
+type importer struct {
+	db        *Database
+	tableName string
+	table     *Table
+	opts      ImportOptions
+	report    ImportReport
+	batch     []map[string]string // Rows read but not inserted yet
+	positions []ImportError       // Lines and numbers of the rows of the batch
+}
+
+// newImporter returns an importer of rows into a table, and the table
+func (db *Database) newImporter(tableName string, opts ImportOptions) (*importer, *Table, error) {
+	db.mu.RLock()
+	table, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+	if !exists {
+		return nil, nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultImportBatch
+	}
+	return &importer{db: db, tableName: tableName, table: table, opts: opts}, table, nil
+}
+
+// add adds a row to the batch, at a line of the data, 0 when it has none, and inserts the
+// batch once full
+func (im *importer) add(row map[string]string, line, number int) error {
+	im.batch = append(im.batch, row)
+	im.positions = append(im.positions, ImportError{Line: line, Row: number})
+	if len(im.batch) < im.opts.BatchSize {
+		return nil
+	}
+	return im.flush()
+}
+
+// reject records a row that could not be read, after inserting the rows before it so that
+// the report follows the data, and returns it unless bad rows are skipped
+func (im *importer) reject(bad ImportError) error {
+	if err := im.flush(); err != nil {
+		return err
+	}
+	if !im.opts.SkipBadRows {
+		return bad
+	}
+	im.report.Skipped = append(im.report.Skipped, bad)
+	return nil
+}
+
+// flush inserts the rows of the batch while taking the table lock once, then one by one
+// to tell the bad ones if that fails
+func (im *importer) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+	batch, positions := im.batch, im.positions
+	im.batch, im.positions = im.batch[:0], im.positions[:0]
+	if err := im.db.InsertMany(im.tableName, batch); err == nil {
+		im.report.Rows += len(batch)
+		return nil
+	}
+	for i, row := range batch {
+		if err := im.db.InsertInto(im.tableName, row); err != nil {
+			bad := positions[i]
+			bad.Err = err
+			if !im.opts.SkipBadRows {
+				return bad
+			}
+			im.report.Skipped = append(im.report.Skipped, bad)
+			continue
+		}
+		im.report.Rows++
+	}
+	return nil
+}
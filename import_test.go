@@ -0,0 +1,48 @@
+package MyDb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestImportCSVEmptyCells checks that a table created by ImportCSV gets the types of the
+// values of its columns whatever their empty cells, and that the empty cells of typed
+// columns are imported as NULL while those of string columns stay empty
+func TestImportCSVEmptyCells(t *testing.T) {
+	db := NewDatabase("import_test", WithStorage(&MemoryStorage{}))
+	data := "id,qty,price,day,name\n1,2,1.5,2024-01-02,a\n2,,,,\n3,5,2,2024-03-04,c\n"
+	report, err := db.ImportCSV("items", strings.NewReader(data), ImportOptions{CreateTable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Rows != 3 {
+		t.Errorf("imported %d rows, want 3", report.Rows)
+	}
+	wantTypes := map[string]ColumnType{"id": Int, "qty": Int, "price": Float, "day": Date, "name": String}
+	for col, typ := range wantTypes {
+		if got := db.Tables["items"].columnDef(col).Type; got != typ {
+			t.Errorf("column %s has type %s, want %s", col, got, typ)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"get from items where id = 2", "[map[id:2 name:]]"},
+		{"select sum(qty) as q, sum(price) as p, count(day) as d from items", "[map[d:2 p:3.5 q:7]]"},
+		{"select id, qty + 1 as next from items order by id", "[map[id:1 next:3] map[id:2] map[id:3 next:6]]"},
+		{"select id from items where qty < 3 order by id", "[map[id:1]]"},
+	}
+	for _, tt := range tests {
+		res, err := db.Query(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := fmt.Sprint(res.Rows); got != tt.want {
+			t.Errorf("%s returned %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
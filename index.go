@@ -0,0 +1,683 @@
+package MyDb
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// uniqueIndex maps the values of a set of columns to the only row holding them
+type uniqueIndex struct {
+	name    string                       // Constraint described in errors, e.g. "primary key"
+	columns []string                     // Indexed columns
+	rows    map[string]map[string]string // Rows by key
+}
+
+// newUniqueIndex returns an empty index on the given columns
+func newUniqueIndex(name string, columns []string) *uniqueIndex {
+	return &uniqueIndex{name: name, columns: columns, rows: make(map[string]map[string]string)}
+}
+
+// key returns the index key of a row, or false when one of the indexed columns is NULL
+func (ix *uniqueIndex) key(row map[string]string) (string, bool) {
+	return indexKey(row, ix.columns)
+}
+
+// indexKey returns a key identifying the values of the columns of a row, or false when
+// one of them is NULL. Numbers are normalized like join keys so that keys agree with
+// the = operator
+func indexKey(row map[string]string, columns []string) (string, bool) {
+	values := make(map[string]string, len(columns))
+	for _, col := range columns {
+		value, ok := row[col]
+		if !ok || value == Null {
+			return "", false
+		}
+		values[col] = joinKey(value)
+	}
+	return rowKey(values, columns), true
+}
+
+// describe formats the indexed values of a row for error messages
+func (ix *uniqueIndex) describe(row map[string]string) string {
+	values := make([]string, len(ix.columns))
+	for i, col := range ix.columns {
+		values[i] = row[col]
+	}
+	return fmt.Sprintf("%s (%s) = (%s)", ix.name, strings.Join(ix.columns, ", "), strings.Join(values, ", "))
+}
+
+// uniqueIndexes returns the indexes whose keys must be unique
+func (t *Table) uniqueIndexes() []*uniqueIndex {
+	if t.primaryKey == nil {
+		return t.unique
+	}
+	return append([]*uniqueIndex{t.primaryKey}, t.unique...)
+}
+
+// AddUnique adds a UNIQUE constraint on one or more columns of a table. Rows may not
+// share the same values in all of the columns, but rows with a NULL in any of them are
+// exempt. It fails if the existing rows already break the constraint
+func (db *Database) AddUnique(tableName string, columns ...string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("unique constraint needs at least one column")
+	}
+	return db.alterTable(tableName, func(table *Table) error {
+		return table.addUnique(tableName, columns)
+	})
+}
+
+// CreateUniqueIndex creates a unique index named "<table>_<col1>_<col2>_key" on one or
+// more columns of a table. Like a UNIQUE constraint, it rejects rows sharing the same
+// values in all of the columns, and finds the rows of conditions on all of them without
+// scanning the table. It can be dropped with DropIndex
+func (db *Database) CreateUniqueIndex(tableName string, columns ...string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("unique index needs at least one column")
+	}
+	return db.alterTable(tableName, func(table *Table) error {
+		name := uniqueIndexName(tableName, columns)
+		if table.findIndex(name) != nil || table.findUniqueIndex(tableName, name) != nil {
+			return fmt.Errorf("index %s already exists on table %s", name, tableName)
+		}
+		return table.addUnique(tableName, columns)
+	})
+}
+
+// addUnique adds a UNIQUE constraint on columns of the table. The table lock must be held
+func (t *Table) addUnique(tableName string, columns []string) error {
+	if err := checkColumns(tableName, t.Columns, columns); err != nil {
+		return err
+	}
+	t.unique = append(t.unique, newUniqueIndex("unique key", append([]string(nil), columns...)))
+	if err := t.rebuildIndexes(tableName); err != nil {
+		t.unique = t.unique[:len(t.unique)-1]
+		t.rebuildIndexes(tableName)
+		return err
+	}
+	if len(columns) == 1 {
+		def := t.columnDef(columns[0])
+		def.Unique = true
+		t.setColumnDef(def)
+	}
+	return nil
+}
+
+// uniqueIndexName returns the name of the unique index of a table on the given columns
+func uniqueIndexName(tableName string, columns []string) string {
+	return tableName + "_" + strings.Join(columns, "_") + "_key"
+}
+
+// findUniqueIndex returns the UNIQUE index of the table with the given name, or nil. The
+// primary key is named "<table>_pkey"
+func (t *Table) findUniqueIndex(tableName, name string) *uniqueIndex {
+	if t.primaryKey != nil && name == tableName+"_pkey" {
+		return t.primaryKey
+	}
+	for _, ix := range t.unique {
+		if uniqueIndexName(tableName, ix.columns) == name {
+			return ix
+		}
+	}
+	return nil
+}
+
+// checkRows returns an error if adding the rows to the table would break a NOT NULL,
+// CHECK or unique constraint. The replaced rows are about to be removed, e.g. the old
+// versions of updated rows, so their keys are free. The table lock must be held
+func (t *Table) checkRows(tableName string, rows, replaced []map[string]string) error {
+	if err := t.checkNotNull(tableName, rows); err != nil {
+		return err
+	}
+	if err := t.checkConditions(tableName, rows); err != nil {
+		return err
+	}
+	for _, ix := range t.uniqueIndexes() {
+		freed := make(map[string]bool, len(replaced))
+		for _, row := range replaced {
+			if key, ok := ix.key(row); ok {
+				freed[key] = true
+			}
+		}
+		seen := make(map[string]bool, len(rows))
+		for _, row := range rows {
+			key, ok := ix.key(row)
+			if !ok {
+				if ix == t.primaryKey {
+					return fmt.Errorf("primary key (%s) of table %s cannot be NULL", strings.Join(ix.columns, ", "), tableName)
+				}
+				continue
+			}
+			if _, exists := ix.rows[key]; (exists && !freed[key]) || seen[key] {
+				return fmt.Errorf("duplicate %s in table %s", ix.describe(row), tableName)
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+// indexRows adds rows to the indexes of the table. The table lock must be held
+func (t *Table) indexRows(rows []map[string]string) {
+	for _, ix := range t.uniqueIndexes() {
+		for _, row := range rows {
+			if key, ok := ix.key(row); ok {
+				ix.rows[key] = row
+			}
+		}
+	}
+	for _, ix := range t.indexes {
+		ix.add(rows)
+	}
+	for _, ix := range t.fullText {
+		ix.add(rows)
+	}
+	for _, ix := range t.fuzzy {
+		ix.add(rows)
+	}
+}
+
+// unindexRows removes rows from the indexes of the table. The table lock must be held
+func (t *Table) unindexRows(rows []map[string]string) {
+	for _, ix := range t.uniqueIndexes() {
+		for _, row := range rows {
+			if key, ok := ix.key(row); ok {
+				delete(ix.rows, key)
+			}
+		}
+	}
+	for _, ix := range t.indexes {
+		ix.remove(rows)
+	}
+	for _, ix := range t.fullText {
+		ix.remove(rows)
+	}
+	for _, ix := range t.fuzzy {
+		ix.remove(rows)
+	}
+}
+
+// rebuildIndexes fills the indexes of the table from its rows, returning an error if
+// the rows break a unique constraint. The table lock must be held
+func (t *Table) rebuildIndexes(tableName string) error {
+	for _, ix := range t.uniqueIndexes() {
+		ix.rows = make(map[string]map[string]string, len(t.Rows))
+	}
+	if err := t.checkRows(tableName, t.Rows, nil); err != nil {
+		return err
+	}
+	for _, ix := range t.uniqueIndexes() {
+		for _, row := range t.Rows {
+			if key, ok := ix.key(row); ok {
+				ix.rows[key] = row
+			}
+		}
+	}
+	for _, ix := range t.indexes {
+		ix.build(t.Rows, nil)
+	}
+	for _, ix := range t.fullText {
+		ix.build(t.Rows)
+	}
+	for _, ix := range t.fuzzy {
+		ix.build(t.Rows)
+	}
+	return nil
+}
+
+// SearchByKey returns the rows of a table whose columns equal the values of key, e.g.
+// {"tenant_id": "7", "id": "42"}. When the key covers the primary key, a UNIQUE
+// constraint or an index created with CreateIndex the rows are found through the index
+// instead of a scan
+func (db *Database) SearchByKey(tableName string, key map[string]string) ([]map[string]string, error) {
+	key, err := db.normalizeKey(tableName, key)
+	if err != nil {
+		return nil, err
+	}
+	rows, indexed, err := db.lookupKey(tableName, key)
+	if err != nil || indexed {
+		return filterRows(rows, keyCondition(key)), err
+	}
+	return db.SearchRows(tableName, keyCondition(key))
+}
+
+// UpdateByKey updates the rows of a table whose columns equal the values of key like
+// SearchByKey finds them, and returns how many were updated
+func (db *Database) UpdateByKey(tableName string, key, data map[string]string) (int, error) {
+	key, err := db.normalizeKey(tableName, key)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := db.updateRows(context.Background(), nil, tableName, key, keyCondition(key), data, false)
+	return len(updated), err
+}
+
+// DeleteByKey removes the rows of a table whose columns equal the values of key like
+// SearchByKey finds them, and returns how many were removed
+func (db *Database) DeleteByKey(tableName string, key map[string]string) (int, error) {
+	key, err := db.normalizeKey(tableName, key)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := db.deleteRows(context.Background(), nil, tableName, key, keyCondition(key), false)
+	return len(deleted), err
+}
+
+// normalizeKey checks the columns of a key and converts its values to their stored form
+func (db *Database) normalizeKey(tableName string, key map[string]string) (map[string]string, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("key for table %s has no columns", tableName)
+	}
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	return table.normalizeRow(tableName, key)
+}
+
+// keyCondition returns a condition matching the rows whose columns equal the values of a key
+func keyCondition(key map[string]string) func(row map[string]string) bool {
+	return func(row map[string]string) bool {
+		for col, value := range key {
+			if stored, ok := row[col]; !ok || stored != value {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// indexAccess describes how an index finds the rows of a query, for EXPLAIN
+type indexAccess struct {
+	operation string          // INDEX LOOKUP, INDEX RANGE SCAN, INDEX SCAN, FULL-TEXT SEARCH or FUZZY SEARCH
+	detail    string          // Index and columns, e.g. "primary key (id)"
+	sorted    bool            // Whether the rows come in the order the query asked for
+	index     *secondaryIndex // Ordered index the rows were read from, nil for lookups
+}
+
+// lookupKey returns the rows of a table that may hold the given values, found through
+// an index. It reports false when the values do not cover the columns of any index
+func (db *Database) lookupKey(tableName string, values map[string]string) ([]map[string]string, bool, error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, false, fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		return nil, false, err
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	var rows []map[string]string
+	var access *indexAccess
+	db.indexed(table, func(indexed *Table) {
+		rows, access = indexed.lookup(values)
+	})
+	return rows, access != nil, nil
+}
+
+// lookupWhere returns the rows of a table that may match a condition, found through an
+// index, along with how the index found them. The access is nil when no index helps
+// and the table must be scanned
+func (db *Database) lookupWhere(tableName string, cond expr, orderBy []SortKey) ([]map[string]string, *indexAccess, error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		return nil, nil, err
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	var rows []map[string]string
+	var access *indexAccess
+	db.indexed(table, func(indexed *Table) {
+		rows, access = indexed.access(cond, orderBy)
+	})
+	return rows, access, nil
+}
+
+// access returns the rows that may match a condition through the cheapest index, along
+// with how the index found them. It considers every unique or equality lookup, every
+// range scan of an ordered index with equalities on a prefix of its columns and a range
+// on the next one, and every ordered index walked in the order of the ORDER BY clause.
+// Each costs the rows it reads, plus sorting them when they do not come in the order of
+// the ORDER BY clause, and the access is nil when scanning the table costs no more. The
+// table lock must be held
+func (t *Table) access(cond expr, orderBy []SortKey) ([]map[string]string, *indexAccess) {
+	var best []map[string]string
+	var bestAccess *indexAccess
+	bestCost := readCost(len(t.Rows), len(orderBy) > 0)
+	consider := func(rows []map[string]string, access *indexAccess) {
+		if cost := readCost(len(rows), len(orderBy) > 0 && !access.sorted); cost < bestCost {
+			best, bestAccess, bestCost = rows, access, cost
+		}
+	}
+
+	values := equalities(cond)
+	t.lookups(values, cond, consider)
+	for col, query := range matches(cond) {
+		if ix := t.findFullText(col); ix != nil {
+			// The rows come the most relevant first
+			var rows []map[string]string
+			for _, result := range ix.search(query) {
+				rows = append(rows, result.Row)
+			}
+			consider(rows, &indexAccess{operation: "FULL-TEXT SEARCH", detail: ix.describe()})
+		}
+	}
+	for col, similar := range similarities(cond) {
+		if ix := t.findFuzzy(col); ix != nil {
+			// The rows come the closest first
+			rows := ix.search(similar.value.(*literalExpr).value, similar.distance)
+			consider(rows, &indexAccess{operation: "FUZZY SEARCH", detail: ix.describe()})
+		}
+	}
+	ranges := bounds(cond)
+	for _, ix := range t.indexes {
+		if !ix.ordered || !ix.covers(cond, values) {
+			continue
+		}
+		indexed := ranges
+		if ix.expression != nil {
+			indexed = ix.expressionBounds(cond)
+		}
+		prefix, usable := ix.match(indexed)
+		if len(prefix) == 0 && len(usable) == 0 {
+			if ix.ordersBy(orderBy, 0) {
+				consider(ix.sorted, &indexAccess{operation: "INDEX SCAN", detail: ix.describe() + " in order", sorted: true, index: ix})
+			}
+			continue
+		}
+		lo, hi := ix.span(prefix, usable)
+		access := &indexAccess{operation: "INDEX RANGE SCAN", detail: ix.describe(), sorted: ix.ordersBy(orderBy, len(prefix)), index: ix}
+		consider(ix.sorted[lo:hi], access)
+	}
+
+	if bestAccess == nil {
+		return nil, nil
+	}
+	if bestAccess.sorted && orderBy[0].Desc {
+		return bestAccess.index.descending(best), bestAccess
+	}
+	// The rows belong to the index, and callers may sort them
+	return append([]map[string]string(nil), best...), bestAccess
+}
+
+// readCost estimates the cost of reading n rows, and of sorting them when sort is set
+func readCost(n int, sort bool) int {
+	if sort {
+		return n + n*bits.Len(uint(n))
+	}
+	return n
+}
+
+// lookup returns the rows that may hold the given values, found through the index
+// finding the fewest of the primary key, UNIQUE indexes and secondary indexes whose
+// columns all have a value, along with how they were found. The access is nil when the
+// values cover no index. The table lock must be held
+func (t *Table) lookup(values map[string]string) ([]map[string]string, *indexAccess) {
+	var best []map[string]string
+	var bestAccess *indexAccess
+	t.lookups(values, nil, func(rows []map[string]string, access *indexAccess) {
+		if bestAccess == nil || len(rows) < len(best) {
+			best, bestAccess = rows, access
+		}
+	})
+	return best, bestAccess
+}
+
+// lookups calls found with the rows that may hold the given values found by each index
+// whose columns all have a value, unique indexes first. Expression indexes take the value
+// of their expression from cond, and partial indexes must cover the rows satisfying cond
+// and the values. The table lock must be held
+func (t *Table) lookups(values map[string]string, cond expr, found func(rows []map[string]string, access *indexAccess)) {
+	for _, ix := range t.uniqueIndexes() {
+		key, covered := t.lookupIndexKey(values, ix.columns)
+		if !covered {
+			continue
+		}
+		access := &indexAccess{operation: "INDEX LOOKUP", detail: ix.name + " (" + strings.Join(ix.columns, ", ") + ")"}
+		if row, ok := ix.rows[key]; ok {
+			found([]map[string]string{row}, access)
+		} else {
+			found(nil, access)
+		}
+	}
+	for _, ix := range t.indexes {
+		indexed := values
+		if ix.expression != nil {
+			indexed = ix.expressionValues(cond)
+		}
+		key, covered := t.lookupIndexKey(indexed, ix.columns)
+		if !covered || !ix.covers(cond, values) {
+			continue
+		}
+		found(ix.rows[key], &indexAccess{operation: "INDEX LOOKUP", detail: ix.describe()})
+	}
+}
+
+// lookupIndexKey returns the index key of the values of the given columns, converted to
+// their stored form. It reports whether every column has a value valid for its type, as
+// the rows holding an invalid one, e.g. 3.0 for an int, can only be found by a scan
+func (t *Table) lookupIndexKey(values map[string]string, columns []string) (string, bool) {
+	key := make(map[string]string, len(columns))
+	for _, col := range columns {
+		value, ok := values[col]
+		if !ok || value == Null {
+			return "", false
+		}
+		normalized, err := t.columnDef(col).Type.normalize(value)
+		if err != nil || normalized == Null {
+			return "", false
+		}
+		key[col] = normalized
+	}
+	k, _ := indexKey(key, columns)
+	return k, true
+}
+
+// indexable reports whether the rows a condition compares equal to a value are the rows
+// an index of a column of a type finds for it. Typed columns compare by type, so the
+// value must be valid for the type. Other columns compare numbers numerically, as index
+// keys hold them, e.g. 3 equal to 3.0, and the other values as they are, so the value
+// must be its own stored form, e.g. a compact JSON document
+func indexable(typ ColumnType, value string) bool {
+	normalized, err := typ.normalize(value)
+	switch typ {
+	case Int, Float, Bool, Date, DateTime, Decimal:
+		return err == nil && value != ""
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return true
+	}
+	return err == nil && normalized == value
+}
+
+// sameRow reports whether two rows are the same map rather than equal copies
+func sameRow(a, b map[string]string) bool {
+	return reflect.ValueOf(a).UnsafePointer() == reflect.ValueOf(b).UnsafePointer()
+}
+
+// rowID returns a value identifying a row map, equal for the same map and different
+// for equal copies
+func rowID(row map[string]string) uintptr {
+	return reflect.ValueOf(row).Pointer()
+}
+
+// rowPositions returns the positions of rows of the table, found through rowPosition.
+// The table lock must be held for writing
+func (t *Table) rowPositions(rows []map[string]string) map[int]bool {
+	positions := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		if i, ok := t.rowPosition(row); ok {
+			positions[i] = true
+		}
+	}
+	return positions
+}
+
+// rowPosition returns the position of a row of the table, found through the slots of
+// its rows rather than by going through them, which are only gathered again when the
+// row is not at the position its slot gives. The table lock must be held for writing
+func (t *Table) rowPosition(row map[string]string) (int, bool) {
+	if t.positions != nil {
+		if i, ok := t.positions.position(row); ok && i < len(t.Rows) && sameRow(t.Rows[i], row) {
+			return i, true
+		}
+	}
+	t.positions = newRowSlots(t.Rows)
+	return t.positions.position(row)
+}
+
+// rowSlots keeps the positions of the rows of a table by rowID without rewriting them
+// as rows are removed: each row keeps the slot it was given, its position when the slots
+// were gathered, and its position now is its slot less the removed slots before it,
+// which a Fenwick tree counts
+type rowSlots struct {
+	slots   map[uintptr]int // Slot of each row by rowID
+	removed []int           // Fenwick tree of the removed slots, node i counting slots up to i - 1
+}
+
+// newRowSlots gives each row its position as its slot
+func newRowSlots(rows []map[string]string) *rowSlots {
+	s := &rowSlots{slots: make(map[uintptr]int, len(rows)), removed: make([]int, len(rows)+1)}
+	for i, row := range rows {
+		s.slots[rowID(row)] = i
+	}
+	return s
+}
+
+// position returns the position of a row given by its slot, false when it has none
+func (s *rowSlots) position(row map[string]string) (int, bool) {
+	slot, ok := s.slots[rowID(row)]
+	if !ok {
+		return 0, false
+	}
+	for i := slot; i > 0; i -= i & -i {
+		slot -= s.removed[i]
+	}
+	return slot, true
+}
+
+// remove frees the slot of a removed row, moving the positions of the rows after it
+func (s *rowSlots) remove(row map[string]string) {
+	slot, ok := s.slots[rowID(row)]
+	if !ok {
+		return
+	}
+	delete(s.slots, rowID(row))
+	for i := slot + 1; i < len(s.removed); i += i & -i {
+		s.removed[i]++
+	}
+}
+
+// replace gives the slot of a row to its new version
+func (s *rowSlots) replace(row, version map[string]string) {
+	if slot, ok := s.slots[rowID(row)]; ok {
+		delete(s.slots, rowID(row))
+		s.slots[rowID(version)] = slot
+	}
+}
+
+// equalities returns the values that a condition requires columns to be equal to,
+// taken from "col = value" comparisons joined by AND whose values are indexable
+func equalities(cond expr) map[string]string {
+	values := make(map[string]string)
+	var walk func(e expr)
+	walk = func(e expr) {
+		switch e := e.(type) {
+		case *logicalExpr:
+			if !e.or {
+				walk(e.left)
+				walk(e.right)
+			}
+		case *compareExpr:
+			if e.op != "=" {
+				return
+			}
+			col, ok := e.left.(*columnExpr)
+			lit, isLiteral := e.right.(*literalExpr)
+			if !ok || !isLiteral {
+				col, ok = e.right.(*columnExpr)
+				lit, isLiteral = e.left.(*literalExpr)
+			}
+			if ok && isLiteral && lit.value != Null && indexable(col.typ, lit.value) {
+				if _, seen := values[col.name]; !seen {
+					values[col.name] = lit.value
+				}
+			}
+		}
+	}
+	if cond != nil {
+		walk(cond)
+	}
+	return values
+}
+
+// bound is a comparison of a column with a value, e.g. "> 30"
+type bound struct {
+	op    string // =, >, >=, < or <=
+	value string
+}
+
+// bounds returns the comparisons of columns with values that a condition requires,
+// taken from comparisons joined by AND such as "age >= 18 AND age < 65"
+func bounds(cond expr) map[string][]bound {
+	return boundsOf(cond, func(e expr) (string, bool) {
+		if col, ok := e.(*columnExpr); ok {
+			return col.name, true
+		}
+		return "", false
+	})
+}
+
+// boundsOf returns the comparisons with values that a condition requires of the
+// expressions for which key reports true, keyed by the key it returns
+func boundsOf(cond expr, key func(e expr) (string, bool)) map[string][]bound {
+	ranges := make(map[string][]bound)
+	flipped := map[string]string{"=": "=", ">": "<", ">=": "<=", "<": ">", "<=": ">="}
+	var walk func(e expr)
+	walk = func(e expr) {
+		switch e := e.(type) {
+		case *logicalExpr:
+			if !e.or {
+				walk(e.left)
+				walk(e.right)
+			}
+		case *compareExpr:
+			op, ok := flipped[e.op]
+			if !ok {
+				return
+			}
+			name, isKey := key(e.left)
+			lit, isLiteral := e.right.(*literalExpr)
+			if isKey && isLiteral {
+				op = e.op
+			} else {
+				name, isKey = key(e.right)
+				lit, isLiteral = e.left.(*literalExpr)
+			}
+			if isKey && isLiteral && lit.value != Null {
+				ranges[name] = append(ranges[name], bound{op: op, value: lit.value})
+			}
+		}
+	}
+	if cond != nil {
+		walk(cond)
+	}
+	return ranges
+}
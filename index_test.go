@@ -0,0 +1,198 @@
+package MyDb
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// indexTestColumns are the columns of the table of the index tests, one of every type
+// but blobs, and indexTestRows its rows. Missing values are NULL
+var (
+	indexTestColumns = []ColumnDef{
+		{Name: "id", Type: Int},
+		{Name: "i", Type: Int},
+		{Name: "f", Type: Float},
+		{Name: "b", Type: Bool},
+		{Name: "d", Type: Date},
+		{Name: "dt", Type: DateTime},
+		{Name: "dec", Type: Decimal},
+		{Name: "s"},
+		{Name: "j", Type: JSON},
+	}
+	indexTestRows = []map[string]string{
+		{"id": "1", "i": "3", "f": "3", "b": "true", "d": "2024-01-02", "dt": "2024-01-02T10:00:00Z", "dec": "3", "s": "3", "j": `{"a":1}`},
+		{"id": "2", "i": "-4", "f": "1.5", "b": "false", "d": "2023-12-31", "dt": "2023-12-31T23:59:59Z", "dec": "1.50", "s": "abc", "j": "[1,2]"},
+		{"id": "3", "i": "10", "f": "-0.25", "d": "2024-02-29", "dt": "2024-02-29T00:00:00Z", "dec": "10.25", "s": "", "j": "5"},
+		{"id": "4", "i": "0", "f": "100", "d": "2000-01-01", "dt": "2000-01-01T12:30:00Z", "dec": "-2", "s": "3.0", "j": `"x"`},
+		{"id": "5"},
+	}
+)
+
+// indexTestValues are values compared with the columns of the index tests, valid ones,
+// values scans compare equal to a stored value in another form, and invalid ones
+var indexTestValues = map[string][]string{
+	"i":   {"3", "03", "3.0", "'+3'", "-4", "3.5", "abc", "''", "1e1"},
+	"f":   {"3", "3.0", "1.50", "-0.25", "1e2", "abc", "''"},
+	"b":   {"true", "false", "1", "0", "t", "yes", "''"},
+	"d":   {"'2024-01-02'", "'2024-01-02T00:00:00'", "'2024-02-29'", "'2024-13-01'", "abc", "''"},
+	"dt":  {"'2024-01-02T10:00:00Z'", "'2024-01-02 10:00:00'", "'2024-01-02T12:00:00+02:00'", "'2024-01-02'", "abc", "''"},
+	"dec": {"3", "3.00", "1.5", "1.50", "10.25", "-2.0", "abc", "''"},
+	"s":   {"3", "3.0", "03", "'3'", "abc", "''", "'ABC'"},
+	"j":   {`'{"a":1}'`, `'{"a": 1}'`, "'[1,2]'", "'[1, 2]'", "5", "5.0", `'"x"'`, "''"},
+}
+
+// indexTestDB returns a database holding the table of the index tests, with the index
+// that index creates on one of its columns, none when index is nil
+func indexTestDB(t *testing.T, index func(db *Database) error) *Database {
+	t.Helper()
+	db := NewDatabase("index_test", WithStorage(&MemoryStorage{}))
+	if err := db.CreateTableWithSchema("t", indexTestColumns); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertMany("t", indexTestRows); err != nil {
+		t.Fatal(err)
+	}
+	if index != nil {
+		if err := index(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// selectIDs returns the ids of the rows a query returns, in order
+func selectIDs(t *testing.T, db *Database, query string) []string {
+	t.Helper()
+	res, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	var ids []string
+	for _, row := range res.Rows {
+		ids = append(ids, row["id"])
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// TestIndexesMatchScans checks that every kind of index finds the rows a scan finds, for
+// comparisons of every column type with valid values, values in another form than the
+// stored one and invalid values
+func TestIndexesMatchScans(t *testing.T) {
+	indexes := map[string]func(col string) func(db *Database) error{
+		"hash": func(col string) func(db *Database) error {
+			return func(db *Database) error { return db.CreateIndex("t", col) }
+		},
+		"ordered": func(col string) func(db *Database) error {
+			return func(db *Database) error { return db.CreateIndex("t", col, Ordered()) }
+		},
+		"unique": func(col string) func(db *Database) error {
+			return func(db *Database) error { return db.CreateUniqueIndex("t", col) }
+		},
+	}
+	scan := indexTestDB(t, nil)
+	for col, values := range indexTestValues {
+		for kind, index := range indexes {
+			if kind == "unique" && (col == "b" || col == "s") {
+				continue // Rows hold true twice, and 3 and 3.0, which unique keys take for the same
+			}
+			indexed := indexTestDB(t, index(col))
+			for _, value := range values {
+				for _, op := range []string{"=", "!=", "<", "<=", ">", ">="} {
+					query := fmt.Sprintf("get from t where %s %s %s", col, op, value)
+					want := selectIDs(t, scan, query)
+					if got := selectIDs(t, indexed, query); !slices.Equal(got, want) {
+						t.Errorf("%s index on %s: %s returned rows %v, a scan returns %v", kind, col, query, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestPrimaryKeyMatchesScans checks that a primary key finds the rows a scan finds for
+// selects, updates and deletes
+func TestPrimaryKeyMatchesScans(t *testing.T) {
+	tests := []struct {
+		where string
+		want  int
+	}{
+		{"g = 3", 1},
+		{"g = 3.0", 1},
+		{"g = 03", 1},
+		{"g = 3.5", 0},
+		{"g = abc", 0},
+		{"g = 3.0 and g = 3", 1},
+	}
+	for _, primaryKey := range []bool{false, true} {
+		for _, tt := range tests {
+			db := NewDatabase("pk_test", WithStorage(&MemoryStorage{}))
+			if err := db.CreateTableWithSchema("t", []ColumnDef{{Name: "g", Type: Int, PrimaryKey: primaryKey}, {Name: "v"}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.InsertMany("t", []map[string]string{{"g": "3", "v": "a"}, {"g": "4", "v": "b"}}); err != nil {
+				t.Fatal(err)
+			}
+			res, err := db.Query("get from t where " + tt.where)
+			if err != nil || len(res.Rows) != tt.want {
+				t.Errorf("primary key %v: where %s selected %v (%v), want %d rows", primaryKey, tt.where, res, err, tt.want)
+			}
+			res, err = db.Query("update t set v = c where " + tt.where)
+			if err != nil || res.RowsAffected != tt.want {
+				t.Errorf("primary key %v: where %s updated %v (%v), want %d rows", primaryKey, tt.where, res, err, tt.want)
+			}
+			res, err = db.Query("delete from t where " + tt.where)
+			if err != nil || res.RowsAffected != tt.want {
+				t.Errorf("primary key %v: where %s deleted %v (%v), want %d rows", primaryKey, tt.where, res, err, tt.want)
+			}
+		}
+	}
+}
+
+// TestIndexedDeletesMatchScans checks that deletes finding their rows through an index
+// delete the rows a scan deletes, one after the other, after inserts and updates, and
+// while a snapshot shares the rows
+func TestIndexedDeletesMatchScans(t *testing.T) {
+	scan := indexTestDB(t, nil)
+	indexed := indexTestDB(t, func(db *Database) error { return db.CreateIndex("t", "i") })
+	var snap *Snapshot
+	var snapIDs []string
+	for _, query := range []string{
+		"delete from t where i = 3",
+		"insert into t (id, i) values (6, 10)",
+		"delete from t where i = 10 and id = 6",
+		"update t set i = 0 where i = -4",
+		"snapshot",
+		"delete from t where i = 0",
+		"insert into t (id, i) values (7, 10), (8, 11), (9, 10)",
+		"update t set i = 11 where id = 9",
+		"delete from t where i = 11",
+		"delete from t where i = 10",
+	} {
+		if query == "snapshot" {
+			snap, snapIDs = indexed.Snapshot(), selectIDs(t, indexed, "get from t")
+			continue
+		}
+		for _, db := range []*Database{scan, indexed} {
+			if _, err := db.Query(query); err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+		}
+		want := selectIDs(t, scan, "get from t")
+		if got := selectIDs(t, indexed, "get from t"); !slices.Equal(got, want) {
+			t.Errorf("after %s the indexed table holds rows %v, the scanned one %v", query, got, want)
+		}
+	}
+	res, err := snap.Query("get from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range res.Rows {
+		got = append(got, row["id"])
+	}
+	if !slices.Equal(got, snapIDs) {
+		t.Errorf("snapshot holds rows %v after the deletes, want %v", got, snapIDs)
+	}
+}
@@ -0,0 +1,132 @@
+package MyDb
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultSampleRows is the number of rows ImportCSV and ImportJSON read by default to
+// infer the column types of the tables they create
+const DefaultSampleRows = 1000
+
+// typeInference narrows down the type of a column from the values it is given, keeping
+// the types that every value so far is valid for
+type typeInference struct {
+	ruledOut  [Blob + 1]bool // Types some value is not valid for
+	seen      bool           // Whether a value that is not empty was given
+	documents bool           // Whether a JSON object or array was given
+}
+
+// inferredTypes are the types a column can be inferred to have, the narrowest first
+var inferredTypes = []ColumnType{Int, Float, Bool, Date, DateTime}
+
+// add narrows down the type with a value. Empty values are left out, as they are imported
+// as NULL into columns of every inferred type
+func (ti *typeInference) add(value string) {
+	if value == "" {
+		return
+	}
+	ti.seen = true
+	for _, t := range inferredTypes {
+		if !ti.ruledOut[t] && !looksLike(t, value) {
+			ti.ruledOut[t] = true
+		}
+	}
+}
+
+// addDocument narrows down the type with a JSON object or array
+func (ti *typeInference) addDocument() {
+	ti.documents = true
+}
+
+// columnType returns the narrowest type every value is valid for, String when there is
+// none or when no value was given. Columns of JSON objects and arrays are JSON, unless
+// they hold other values too
+func (ti *typeInference) columnType() ColumnType {
+	if ti.documents && !ti.seen {
+		return JSON
+	}
+	if ti.seen && !ti.documents {
+		for _, t := range inferredTypes {
+			if !ti.ruledOut[t] {
+				return t
+			}
+		}
+	}
+	return String
+}
+
+// looksLike reports whether a value reads as a value of a type. Numbers with leading
+// zeros, such as zip codes, are text, and so are 1 and 0 for booleans
+func looksLike(t ColumnType, value string) bool {
+	digits := strings.TrimPrefix(value, "-")
+	leadingZero := len(digits) > 1 && digits[0] == '0' && digits[1] != '.'
+	switch t {
+	case Int:
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && !leadingZero
+	case Float:
+		return digits != "" && (digits[0] >= '0' && digits[0] <= '9' || digits[0] == '.') && !leadingZero && isFinite(value)
+	case Bool:
+		_, err := strconv.ParseBool(value)
+		return err == nil && len(value) > 1
+	case Date:
+		_, ok := parseDate(value)
+		return ok
+	case DateTime:
+		_, ok := parseDateTime(value)
+		return ok
+	}
+	return true
+}
+
+// tableSample infers the columns of a table to create from the first rows of imported
+// data
+type tableSample struct {
+	names      []string // Columns of the data, in the order they were met
+	inferences []typeInference
+}
+
+// column returns the inference of a column of the data, adding the column when it is new
+func (s *tableSample) column(name string) *typeInference {
+	i := slices.Index(s.names, name)
+	if i < 0 {
+		i = len(s.names)
+		s.names = append(s.names, name)
+		s.inferences = append(s.inferences, typeInference{})
+	}
+	return &s.inferences[i]
+}
+
+// createSampledTable creates a table with the columns of sampled data, named as
+// sheetColumns names them and typed after their values unless the Types of the options
+// give their types. It returns the options with the columns of the data mapped to those
+// of the table
+func (db *Database) createSampledTable(tableName string, s *tableSample, opts ImportOptions) (ImportOptions, error) {
+	columns := sheetColumns(s.names, opts.Columns)
+	var defs []ColumnDef
+	for i, column := range columns {
+		if column == "" {
+			continue
+		}
+		def := ColumnDef{Name: column, Type: s.inferences[i].columnType()}
+		if t, ok := opts.Types[column]; ok {
+			def.Type = t
+		}
+		defs = append(defs, def)
+	}
+	if err := db.CreateTableWithSchema(tableName, defs); err != nil {
+		return opts, err
+	}
+	mapping := maps.Clone(opts.Columns)
+	if mapping == nil {
+		mapping = make(map[string]string, len(columns))
+	}
+	for i, name := range s.names {
+		mapping[name] = columns[i]
+	}
+	opts.Columns = mapping
+	return opts, nil
+}
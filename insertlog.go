@@ -0,0 +1,224 @@
+package MyDb
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// Records starting and ending a block of rows in an insert log. They have one more field
+// than the rows, so that no row can be taken for them
+const (
+	logBegin = "#begin" // Followed by the header of the table when the rows were appended
+	logEnd   = "#end"   // Followed by the number of rows of the block
+)
+
+// logStore is implemented by storages that can append rows to the data of a table, in an
+// insert log next to it
+type logStore interface {
+	appendLog(tableName string, data []byte) error
+	readLog(tableName string) ([]byte, error)
+	truncateLog(tableName string, size int64) error
+	removeLog(tableName string) error
+}
+
+// SetInsertLog makes Save append the rows inserted into a table since it was saved to an
+// insert log next to its CSV file, <table>.log, instead of rewriting the whole file, as
+// long as nothing else changed in the table. Load reads the rows of the insert log after
+// those of the file, and Compact merges the logs back into the files. It is used with a
+// DirStorage for CSV data that is neither compressed nor encrypted
+func (db *Database) SetInsertLog(enabled bool) {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+	db.insertLog = enabled
+}
+
+// Compact saves the database, rewriting the files of the tables whose insert log holds
+// rows so that their logs are merged into them and removed
+func (db *Database) Compact() error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+	db.markDirty(func(t *Table) bool { return t.logged })
+	return db.saveLocked(context.Background())
+}
+
+// canAppend reports whether Save can append inserted rows to insert logs
+func (db *Database) canAppend() bool {
+	_, ok := db.store().(logStore)
+	return ok && db.insertLog && db.format == CSV && db.codec == nil && db.crypter == nil
+}
+
+// appendInserted appends the rows inserted into a table since it was saved to its insert
+// log, and reports whether it did, which it does not when the table needs rewriting. The
+// db lock and the table lock must be held
+func (db *Database) appendInserted(tableName string, table *Table, walSeq int64) (bool, error) {
+	if !db.canAppend() || table.logToken == "" || table.savedRows > len(table.Rows) {
+		return false, nil
+	}
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(append([]string{logBegin}, table.header(walSeq)...))
+	rows := table.Rows[table.savedRows:]
+	for _, row := range rows {
+		fields, err := db.encodeRow(tableName, table, row, make(map[string]bool))
+		if err != nil {
+			return false, err
+		}
+		writer.Write(fields)
+	}
+	end := make([]string, len(table.Columns)+1)
+	end[0], end[1] = logEnd, strconv.Itoa(len(rows))
+	writer.Write(end)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return false, err
+	}
+
+	if err := db.store().(logStore).appendLog(tableName, buf.Bytes()); err != nil {
+		table.dirty = true // The log may end with part of the block, rewrite the table instead
+		return false, err
+	}
+	table.markSaved()
+	table.logged = true
+	return true, nil
+}
+
+// readInsertLog adds the rows of the insert log of a table loaded from its saved data to
+// it, unless the log belongs to older data. A block cut short by a crash while it was
+// appended is removed from the log, as its Save failed
+func (db *Database) readInsertLog(tableName string, table *Table) error {
+	store, ok := db.store().(logStore)
+	if !ok || table.logToken == "" {
+		return nil
+	}
+	data, err := store.readLog(tableName)
+	if data == nil || err != nil {
+		return err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	var block []map[string]string // Rows of the block being read, nil outside of blocks
+	var header *Table             // Header of the block being read
+	var complete int64            // Offset of the end of the last complete block
+	for {
+		record, err := reader.Read()
+		if err == io.EOF && block == nil {
+			return nil
+		}
+		if err == nil {
+			err = db.readLogRecord(tableName, table, record, &block, &header)
+		}
+		if errors.Is(err, errStaleLog) {
+			return nil // Older data was saved with the log, which its removal did not follow
+		}
+		if err != nil {
+			// Only the last block can be cut short
+			if bytes.Contains(data[complete:], []byte("\n"+logBegin+",")) {
+				return fmt.Errorf("block at offset %d is corrupt", complete)
+			}
+			return store.truncateLog(tableName, complete)
+		}
+		if block == nil && header != nil {
+			complete = reader.InputOffset()
+			header = nil
+		}
+	}
+}
+
+// errStaleLog tells that an insert log belongs to older saved data
+var errStaleLog = errors.New("stale insert log")
+
+// readLogRecord reads a record of an insert log into the block being read, adding the rows
+// of the block to the table once its end is read
+func (db *Database) readLogRecord(tableName string, table *Table, record []string, block *[]map[string]string, header **Table) error {
+	switch {
+	case len(record) == len(table.Columns)+1 && record[0] == logBegin:
+		if *header != nil {
+			return fmt.Errorf("block is not ended")
+		}
+		h, err := parseHeader(record[1:])
+		if err != nil {
+			return err
+		}
+		if h.logToken != table.logToken {
+			return errStaleLog
+		}
+		if !slices.Equal(h.Columns, table.Columns) {
+			return fmt.Errorf("columns of block differ from those of table %s", tableName)
+		}
+		*header, *block = h, []map[string]string{}
+	case len(record) == len(table.Columns)+1 && record[0] == logEnd:
+		if *header == nil || record[1] != strconv.Itoa(len(*block)) {
+			return fmt.Errorf("block end does not match its rows")
+		}
+		table.Rows = append(table.Rows, *block...)
+		table.walSeq = max(table.walSeq, (*header).walSeq)
+		table.lastID = max(table.lastID, (*header).lastID)
+		table.logged = true
+		*block = nil
+	case len(record) == len(table.Columns) && *header != nil:
+		row, err := db.decodeRow(tableName, table, record)
+		if err != nil {
+			return err
+		}
+		*block = append(*block, row)
+	default:
+		return fmt.Errorf("unexpected record")
+	}
+	return nil
+}
+
+// markSaved records that the saved data of a table holds all of its rows
+func (t *Table) markSaved() {
+	t.dirty, t.inserted = false, false
+	t.savedRows = len(t.Rows)
+}
+
+// newLogToken returns a random token for the saved data of a table
+func newLogToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logPath returns the path of the insert log of a table
+func (s DirStorage) logPath(tableName string) string {
+	return filepath.Join(s.Dir, tableName+".log")
+}
+
+// appendLog appends data to the insert log of a table and syncs it to disk
+func (s DirStorage) appendLog(tableName string, data []byte) error {
+	return appendFile(s.logPath(tableName), data)
+}
+
+// readLog reads the insert log of a table, returning nil when there is none
+func (s DirStorage) readLog(tableName string) ([]byte, error) {
+	data, err := os.ReadFile(s.logPath(tableName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// truncateLog cuts the insert log of a table to a size
+func (s DirStorage) truncateLog(tableName string, size int64) error {
+	return os.Truncate(s.logPath(tableName), size)
+}
+
+// removeLog removes the insert log of a table
+func (s DirStorage) removeLog(tableName string) error {
+	if err := os.Remove(s.logPath(tableName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package MyDb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JoinOn describes an equality join between a column of the left table and a column of the right table
+type JoinOn struct {
+	LeftColumn  string // Column of the left table
+	RightColumn string // Column of the right table
+}
+
+// joinType selects which unmatched rows a join keeps
+type joinType int
+
+const (
+	innerJoin joinType = iota // Only matching pairs
+	leftJoin                  // Also unmatched rows of the left side
+	rightJoin                 // Also unmatched rows of the right side
+)
+
+// joinClause is a parsed "JOIN table ON condition" clause
+type joinClause struct {
+	kind     joinType   // Inner, left or right join
+	table    string     // Joined table
+	alias    string     // Alias of the joined table, empty when there is none
+	on       *rowFilter // Join condition evaluated on combined rows
+	leftKey  string     // Row key compared by a hash join, empty when a nested loop is needed
+	rightKey string     // Row key of the joined table compared by a hash join
+}
+
+// Join returns every combination of a row of leftTable and a row of rightTable
+// whose join columns are equal. Columns are qualified as "table.column"
+func (db *Database) Join(leftTable, rightTable string, on JoinOn) ([]map[string]string, error) {
+	return db.joinTables(leftTable, rightTable, on, innerJoin)
+}
+
+// LeftJoin is like Join but also keeps the rows of leftTable without a match,
+// leaving the columns of rightTable NULL
+func (db *Database) LeftJoin(leftTable, rightTable string, on JoinOn) ([]map[string]string, error) {
+	return db.joinTables(leftTable, rightTable, on, leftJoin)
+}
+
+// RightJoin is like Join but also keeps the rows of rightTable without a match,
+// leaving the columns of leftTable NULL
+func (db *Database) RightJoin(leftTable, rightTable string, on JoinOn) ([]map[string]string, error) {
+	return db.joinTables(leftTable, rightTable, on, rightJoin)
+}
+
+// joinTables runs an equality join of two tables
+func (db *Database) joinTables(leftTable, rightTable string, on JoinOn, kind joinType) ([]map[string]string, error) {
+	if leftTable == rightTable {
+		return nil, fmt.Errorf("cannot join table %s with itself", leftTable)
+	}
+	left, err := db.qualifiedRows(leftTable, leftTable, on.LeftColumn)
+	if err != nil {
+		return nil, err
+	}
+	right, err := db.qualifiedRows(rightTable, rightTable, on.RightColumn)
+	if err != nil {
+		return nil, err
+	}
+	clause := &joinClause{
+		kind:     kind,
+		leftKey:  leftTable + "." + on.LeftColumn,
+		rightKey: rightTable + "." + on.RightColumn,
+	}
+	return joinRowSets(left, right, clause), nil
+}
+
+// parseJoins parses any number of "[INNER | LEFT [OUTER] | RIGHT [OUTER]] JOIN table [[AS] alias] ON condition" clauses
+func (p *parser) parseJoins(stmt *selectStmt) error {
+	for {
+		kind := innerJoin
+		switch {
+		case p.accept("inner"):
+		case p.accept("left"):
+			kind = leftJoin
+			p.accept("outer")
+		case p.accept("right"):
+			kind = rightJoin
+			p.accept("outer")
+		case !p.peek().is("join"):
+			return nil
+		}
+		if err := p.expect("join"); err != nil {
+			return err
+		}
+
+		table, err := p.parseName()
+		if err != nil {
+			return err
+		}
+		alias, err := p.parseAlias()
+		if err != nil {
+			return err
+		}
+		if err := p.addTable(table, alias); err != nil {
+			return err
+		}
+		if err := p.expect("on"); err != nil {
+			return err
+		}
+		start := p.peek().pos
+		on, err := p.parseOr()
+		if err != nil {
+			return err
+		}
+		text := strings.TrimSpace(p.input[start:p.peek().pos])
+		clause := &joinClause{kind: kind, table: table, alias: alias, on: &rowFilter{cond: on, text: text}}
+
+		// An equality between a column of the joined table and a column of the
+		// tables before it can be answered with a hash join
+		if cmp, ok := on.(*compareExpr); ok && cmp.op == "=" {
+			left, leftOK := cmp.left.(*columnExpr)
+			right, rightOK := cmp.right.(*columnExpr)
+			prefix := p.tables[len(p.tables)-1].qualifier() + "."
+			if leftOK && rightOK {
+				switch {
+				case strings.HasPrefix(right.name, prefix) && !strings.HasPrefix(left.name, prefix):
+					clause.leftKey, clause.rightKey = left.name, right.name
+				case strings.HasPrefix(left.name, prefix) && !strings.HasPrefix(right.name, prefix):
+					clause.leftKey, clause.rightKey = right.name, left.name
+				}
+			}
+		}
+		stmt.joins = append(stmt.joins, clause)
+	}
+}
+
+// joinRows builds the combined rows of a SELECT with JOIN clauses
+func (db *Database) joinRows(stmt *selectStmt) ([]map[string]string, error) {
+	rows, err := db.qualifiedRows(stmt.table, sourceTable{name: stmt.table, alias: stmt.alias}.qualifier())
+	if err != nil {
+		return nil, err
+	}
+	for _, join := range stmt.joins {
+		right, err := db.qualifiedRows(join.table, sourceTable{name: join.table, alias: join.alias}.qualifier())
+		if err != nil {
+			return nil, err
+		}
+		rows = joinRowSets(rows, right, join)
+		if join.on.err != nil {
+			return nil, join.on.err
+		}
+	}
+	return rows, nil
+}
+
+// qualifiedRows returns a copy of the rows of a table with keys qualified as
+// "qualifier.column", after checking that the required columns exist
+func (db *Database) qualifiedRows(tableName, qualifier string, required ...string) ([]map[string]string, error) {
+	var qualifiedRows []map[string]string
+	err := db.readRows(tableName, func(columns []string, rows []map[string]string) error {
+		if err := checkColumns(tableName, columns, required); err != nil {
+			return err
+		}
+		qualifiedRows = make([]map[string]string, len(rows))
+		for i, row := range rows {
+			qualified := make(map[string]string, len(row))
+			for col, value := range row {
+				qualified[qualifier+"."+col] = value
+			}
+			qualifiedRows[i] = qualified
+		}
+		return nil
+	})
+	return qualifiedRows, err
+}
+
+// joinRowSets combines the left and right rows according to a join clause. Equality
+// joins probe a hash table built on the right side, other conditions use a nested loop.
+// Outer joins leave the columns of the missing side NULL
+func joinRowSets(left, right []map[string]string, join *joinClause) []map[string]string {
+	var buckets map[string][]int
+	if join.leftKey != "" {
+		buckets = make(map[string][]int, len(right))
+		for i, row := range right {
+			value, ok := row[join.rightKey]
+			if !ok {
+				continue // NULL never equals anything
+			}
+			key := joinKey(value)
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	var results []map[string]string
+	matchedRight := make([]bool, len(right))
+	for _, row := range left {
+		matched := false
+		try := func(i int) {
+			merged := mergeRows(row, right[i])
+			if buckets == nil && !join.on.match(merged) {
+				return
+			}
+			results = append(results, merged)
+			matched = true
+			matchedRight[i] = true
+		}
+		if buckets != nil {
+			if value, ok := row[join.leftKey]; ok {
+				for _, i := range buckets[joinKey(value)] {
+					try(i)
+				}
+			}
+		} else {
+			for i := range right {
+				try(i)
+			}
+		}
+		if !matched && join.kind == leftJoin {
+			results = append(results, mergeRows(row, nil))
+		}
+	}
+
+	if join.kind == rightJoin {
+		for i, row := range right {
+			if !matchedRight[i] {
+				results = append(results, mergeRows(nil, row))
+			}
+		}
+	}
+	return results
+}
+
+// mergeRows returns a new row holding the values of both rows
+func mergeRows(left, right map[string]string) map[string]string {
+	merged := make(map[string]string, len(left)+len(right))
+	for col, value := range left {
+		merged[col] = value
+	}
+	for col, value := range right {
+		merged[col] = value
+	}
+	return merged
+}
+
+// joinKey normalizes a value for hashing so that numbers equal under compareValues share a bucket
+func joinKey(value string) string {
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return value
+}
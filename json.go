@@ -0,0 +1,123 @@
+package MyDb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// compactJSON checks that a value is a JSON document and returns it without insignificant space
+func compactJSON(value string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(value)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// funcJSONExtract returns the value at a path of a JSON document, e.g.
+// JSON_EXTRACT(meta, '$.address.country') or JSON_EXTRACT(tags, '$[0]'). Strings are
+// returned without quotes, objects and arrays as JSON, and missing values as NULL
+func funcJSONExtract(args ...string) (string, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return "", err
+	}
+	dec := json.NewDecoder(strings.NewReader(args[0]))
+	dec.UseNumber() // Keep numbers as written
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return "", fmt.Errorf("invalid JSON document: %w", err)
+	}
+	steps, err := parseJSONPath(args[1])
+	if err != nil {
+		return "", err
+	}
+	for _, step := range steps {
+		switch v := doc.(type) {
+		case map[string]any:
+			member, ok := v[step]
+			if !ok {
+				return Null, nil
+			}
+			doc = member
+		case []any:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(v) {
+				return Null, nil
+			}
+			doc = v[i]
+		default:
+			return Null, nil
+		}
+	}
+
+	switch v := doc.(type) {
+	case nil:
+		return Null, nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return boolString(v), nil
+	}
+	data, err := json.Marshal(doc)
+	return string(data), err
+}
+
+// parseJSONPath splits a path like "$.items[2].name" into its member names and
+// array indexes. Member names may be quoted, e.g. $."first name"
+func parseJSONPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid JSON path %q: must start with $", path)
+	}
+	var steps []string
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.Index(rest[1:], `"`)
+				if end < 0 {
+					return nil, fmt.Errorf("invalid JSON path %q: unterminated member name", path)
+				}
+				steps = append(steps, rest[1:end+1])
+				rest = rest[end+2:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: empty member name", path)
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: unterminated index", path)
+			}
+			if _, err := strconv.Atoi(rest[1:end]); err != nil {
+				return nil, fmt.Errorf("invalid JSON path %q: invalid index %q", path, rest[1:end])
+			}
+			steps = append(steps, rest[1:end])
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+	}
+	return steps, nil
+}
+
+// funcJSONValid reports whether a value is a JSON document
+func funcJSONValid(args ...string) (string, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return "", err
+	}
+	return boolString(json.Valid([]byte(args[0]))), nil
+}
@@ -0,0 +1,472 @@
+package MyDb
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// JSONFormat is how tables are written as JSON and read back
+type JSONFormat int
+
+const (
+	// JSONArray holds a table as an array of objects, and a database as an object of
+	// such arrays by table name
+	JSONArray JSONFormat = iota
+	// NDJSON holds a table as an object per line, and a database as a
+	// {"table": name, "row": object} object per line
+	NDJSON
+)
+
+// check returns an error if the format is unknown
+func (f JSONFormat) check() error {
+	if f != JSONArray && f != NDJSON {
+		return fmt.Errorf("unknown JSON format %d", f)
+	}
+	return nil
+}
+
+// ExportJSON writes the rows of a table to any writer as JSON objects with the columns in
+// order, values of int, float, decimal and bool columns as JSON numbers and booleans, json
+// columns as the documents they hold, NULL as null and BLOB values base64 encoded. The
+// rows are snapshotted first, so writes go on while the data is written
+func (db *Database) ExportJSON(tableName string, w io.Writer, format JSONFormat) error {
+	if err := format.check(); err != nil {
+		return err
+	}
+	tables, err := db.snapshotTables(tableName)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	writeJSONRows(bw, tables[tableName], format, nil)
+	if format == JSONArray {
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// ExportDatabaseJSON writes the rows of every table to any writer as ExportJSON does, the
+// tables being snapshotted at once so that the data is consistent across tables
+func (db *Database) ExportDatabaseJSON(w io.Writer, format JSONFormat) error {
+	if err := format.check(); err != nil {
+		return err
+	}
+	tables, err := db.snapshotTables()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(tables))
+	for tableName := range tables {
+		names = append(names, tableName)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	if format == JSONArray {
+		bw.WriteString("{")
+	}
+	for i, tableName := range names {
+		name := jsonString(tableName)
+		if format == NDJSON {
+			writeJSONRows(bw, tables[tableName], format, []byte(`{"table":`+name+`,"row":`))
+			continue
+		}
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n" + name + ": ")
+		writeJSONRows(bw, tables[tableName], format, nil)
+	}
+	if format == JSONArray {
+		bw.WriteString("\n}\n")
+	}
+	return bw.Flush()
+}
+
+// writeJSONRows writes the rows of a table as a JSON array, or as lines of objects each
+// wrapped in prefix and a closing brace when prefix is set
+func writeJSONRows(w *bufio.Writer, table *Table, format JSONFormat, prefix []byte) {
+	if format == JSONArray {
+		w.WriteString("[")
+	}
+	for i, row := range table.Rows {
+		switch {
+		case format == NDJSON && prefix != nil:
+			w.Write(prefix)
+			w.Write(table.jsonRow(row))
+			w.WriteString("}\n")
+		case format == NDJSON:
+			w.Write(table.jsonRow(row))
+			w.WriteString("\n")
+		default:
+			if i > 0 {
+				w.WriteString(",")
+			}
+			w.WriteString("\n")
+			w.Write(table.jsonRow(row))
+		}
+	}
+	if format == JSONArray {
+		w.WriteString("\n]")
+	}
+}
+
+// jsonRow encodes a row as a JSON object with the columns of the table in order
+func (t *Table) jsonRow(row map[string]string) []byte {
+	buf := []byte("{")
+	for i, col := range t.Columns {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, jsonString(col)...)
+		buf = append(buf, ':')
+		value, ok := row[col]
+		switch colType := t.columnDef(col).Type; {
+		case !ok:
+			buf = append(buf, "null"...)
+		case value != "" && (colType == Int || colType == Float || colType == Decimal || colType == Bool || colType == JSON) && json.Valid([]byte(value)):
+			buf = append(buf, value...)
+		case colType == Blob:
+			buf = append(buf, jsonString(encodeInlineBlob(value))...)
+		default:
+			buf = append(buf, jsonString(value)...)
+		}
+	}
+	return append(buf, '}')
+}
+
+// jsonString encodes a string as JSON, leaving <, > and & as they are
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// ImportJSON streams rows of JSON objects into an existing table as ImportCSV does, with
+// the columns mapping and the batches of the options. null values are NULL, numbers are
+// kept as written, objects and arrays become JSON documents and the values of BLOB
+// columns are decoded from base64. With NDJSON a line that is not an object is a bad
+// row, while a JSON array must be valid throughout, the rows before an error in it
+// being imported. With CreateTable a table that does not exist is created as ImportCSV
+// creates it, with the keys of the objects in the order they are met, and columns only
+// holding objects and arrays are of type JSON
+func (db *Database) ImportJSON(tableName string, r io.Reader, format JSONFormat, opts ImportOptions) (ImportReport, error) {
+	if err := format.check(); err != nil {
+		return ImportReport{}, err
+	}
+	ji, err := db.newJSONImport(tableName, opts)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	if format == NDJSON {
+		err = readJSONLines(r, func(line, number int, data []byte) error {
+			return ji.add(data, line, number)
+		})
+	} else {
+		err = readJSONArray(json.NewDecoder(r), func(number int, data []byte) error {
+			return ji.add(data, 0, number)
+		})
+	}
+	if flushErr := ji.flush(); err == nil { // The rows before an error are imported
+		err = flushErr
+	}
+	return ji.report(), err
+}
+
+// ImportDatabaseJSON streams the rows of tables written by ExportDatabaseJSON into
+// existing tables of the database, as ImportJSON does, and returns the report of each
+// table. The data must name existing tables, unless CreateTable is set, and be valid
+// throughout
+func (db *Database) ImportDatabaseJSON(r io.Reader, format JSONFormat, opts ImportOptions) (map[string]ImportReport, error) {
+	if err := format.check(); err != nil {
+		return nil, err
+	}
+	importers := make(map[string]*jsonImport)
+	tableImporter := func(tableName string) (*jsonImport, error) {
+		if ji, ok := importers[tableName]; ok {
+			return ji, nil
+		}
+		ji, err := db.newJSONImport(tableName, opts)
+		importers[tableName] = ji
+		return ji, err
+	}
+	var err error
+	if format == NDJSON {
+		err = readJSONLines(r, func(line, number int, data []byte) error {
+			var wrapped struct {
+				Table string          `json:"table"`
+				Row   json.RawMessage `json:"row"`
+			}
+			if err := json.Unmarshal(data, &wrapped); err != nil || wrapped.Row == nil {
+				return fmt.Errorf("line %d: expected {\"table\": name, \"row\": object}", line)
+			}
+			ji, err := tableImporter(wrapped.Table)
+			if err != nil {
+				return err
+			}
+			return ji.add(wrapped.Row, line, number)
+		})
+	} else {
+		dec := json.NewDecoder(r)
+		err = expectDelim(dec, '{')
+		for err == nil && dec.More() {
+			var token json.Token
+			if token, err = dec.Token(); err != nil {
+				break
+			}
+			var ji *jsonImport
+			if ji, err = tableImporter(token.(string)); err != nil {
+				break
+			}
+			if err = readJSONArray(dec, func(number int, data []byte) error {
+				return ji.add(data, 0, number)
+			}); err == nil {
+				err = ji.flush()
+			}
+		}
+		if err == nil {
+			err = expectDelim(dec, '}')
+		}
+	}
+	reports := make(map[string]ImportReport, len(importers))
+	for tableName, ji := range importers {
+		if ji == nil {
+			continue
+		}
+		if flushErr := ji.flush(); err == nil {
+			err = flushErr
+		}
+		reports[tableName] = ji.report()
+	}
+	return reports, err
+}
+
+// jsonImport imports JSON rows into a table. A table to create is created from the first
+// rows, which are held until then
+type jsonImport struct {
+	db        *Database
+	tableName string
+	opts      ImportOptions
+	im        *importer    // nil while sampling
+	sample    []jsonRecord // Rows read while sampling
+}
+
+// jsonRecord is a JSON row at a line and a number of the data
+type jsonRecord struct {
+	data         []byte
+	line, number int
+}
+
+// newJSONImport returns an import of JSON rows into a table, sampling them first when the
+// table is to be created
+func (db *Database) newJSONImport(tableName string, opts ImportOptions) (*jsonImport, error) {
+	ji := &jsonImport{db: db, tableName: tableName, opts: opts}
+	if _, err := db.tableColumns(tableName); err != nil && opts.CreateTable {
+		return ji, nil
+	}
+	var err error
+	ji.im, _, err = db.newImporter(tableName, opts)
+	return ji, err
+}
+
+// add adds a row, holding it while sampling until enough rows are read to create the
+// table
+func (ji *jsonImport) add(data []byte, line, number int) error {
+	if ji.im != nil {
+		return ji.im.addJSON(data, line, number)
+	}
+	ji.sample = append(ji.sample, jsonRecord{data, line, number})
+	if len(ji.sample) < cmp.Or(ji.opts.SampleRows, DefaultSampleRows) {
+		return nil
+	}
+	return ji.start()
+}
+
+// start creates the table from the sampled rows, then adds them. A sample without
+// columns creates no table
+func (ji *jsonImport) start() error {
+	s := &tableSample{}
+	for _, record := range ji.sample {
+		eachJSONMember(record.data, func(key string, raw json.RawMessage) {
+			ti := s.column(key)
+			switch raw[0] {
+			case 'n':
+			case '{', '[':
+				ti.addDocument()
+			case '"':
+				var value string
+				json.Unmarshal(raw, &value)
+				ti.add(value)
+			default:
+				ti.add(string(raw))
+			}
+		})
+	}
+	if len(s.names) == 0 {
+		return nil
+	}
+	opts, err := ji.db.createSampledTable(ji.tableName, s, ji.opts)
+	if err != nil {
+		return err
+	}
+	if ji.im, _, err = ji.db.newImporter(ji.tableName, opts); err != nil {
+		return err
+	}
+	sample := ji.sample
+	ji.sample = nil
+	for _, record := range sample {
+		if err := ji.im.addJSON(record.data, record.line, record.number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush inserts the rows read so far, creating the table first while sampling
+func (ji *jsonImport) flush() error {
+	if ji.im == nil {
+		if err := ji.start(); err != nil || ji.im == nil {
+			return err
+		}
+	}
+	return ji.im.flush()
+}
+
+// report returns the report of the import
+func (ji *jsonImport) report() ImportReport {
+	if ji.im == nil {
+		return ImportReport{}
+	}
+	return ji.im.report
+}
+
+// eachJSONMember calls fn with the key and the value of every member of a JSON object, in
+// order, doing nothing when the data is not an object
+func eachJSONMember(data []byte, fn func(key string, raw json.RawMessage)) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return
+		}
+		fn(token.(string), raw)
+	}
+}
+
+// readJSONLines calls add with the line, the number and the data of every line of NDJSON
+// data that is not blank
+func readJSONLines(r io.Reader, add func(line, number int, data []byte) error) error {
+	br := bufio.NewReader(r)
+	number := 0
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			number++
+			if err := add(line, number, data); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readJSONArray calls add with the number and the data of every element of a JSON array
+func readJSONArray(dec *json.Decoder, add func(number int, data []byte) error) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	for number := 1; dec.More(); number++ {
+		var data json.RawMessage
+		if err := dec.Decode(&data); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		if err := add(number, data); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads a delimiter of JSON data, failing when the next token is another one
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if token != delim {
+		return fmt.Errorf("invalid JSON: expected %s", delim)
+	}
+	return nil
+}
+
+// addJSON adds a row from a JSON object, rejecting it when it cannot be converted
+func (im *importer) addJSON(data []byte, line, number int) error {
+	row, err := im.jsonRow(data)
+	if err != nil {
+		return im.reject(ImportError{Line: line, Row: number, Err: err})
+	}
+	return im.add(row, line, number)
+}
+
+// jsonRow returns a row from a JSON object, with its keys mapped to the columns of the table
+func (im *importer) jsonRow(data []byte) (map[string]string, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return nil, fmt.Errorf("row is not a JSON object")
+	}
+	im.table.mu.RLock()
+	defer im.table.mu.RUnlock()
+
+	row := make(map[string]string, len(object))
+	for key, raw := range object {
+		column := key
+		if mapped, ok := im.opts.Columns[key]; ok {
+			column = mapped
+		}
+		if column == "" {
+			continue
+		}
+		raw = bytes.TrimSpace(raw)
+		switch raw[0] {
+		case 'n':
+			row[column] = Null
+		case '"':
+			var value string
+			json.Unmarshal(raw, &value)
+			if im.table.columnDef(column).Type == Blob {
+				decoded, err := decodeInlineBlob(value)
+				if err != nil {
+					return nil, fmt.Errorf("column %s: %w", column, err)
+				}
+				value = decoded
+			}
+			row[column] = value
+		default:
+			value, err := compactJSON(string(raw))
+			if err != nil {
+				return nil, err
+			}
+			row[column] = value
+		}
+	}
+	return row, nil
+}
@@ -0,0 +1,164 @@
+package MyDb
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tokenKind identifies the category of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota // End of input
+	tokenWord                    // Keywords, identifiers and bare values
+	tokenNumber                  // Numeric literals
+	tokenString                  // Quoted string literals
+	tokenSymbol                  // Operators and punctuation
+)
+
+// token is a single lexical unit of a command
+type token struct {
+	kind tokenKind // Category of the token
+	text string    // Token text, with quotes and escapes removed for strings
+	pos  int       // Byte offset of the token in the input
+}
+
+// is reports whether the token is the given keyword (case-insensitive) or symbol
+func (t token) is(text string) bool {
+	switch t.kind {
+	case tokenWord:
+		return strings.EqualFold(t.text, text)
+	case tokenSymbol:
+		return t.text == text
+	}
+	return false
+}
+
+// symbols lists the operators and punctuation, longest first
+var symbols = []string{"<=", ">=", "!=", "<>", "=", "<", ">", "(", ")", ",", "*", "+", "-", "/"}
+
+// tokenize splits a command into tokens
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	offsets := make([]int, len(runes)+1) // Byte offset of every rune
+	for i, n := 0, 0; i < len(runes); i++ {
+		offsets[i] = n
+		n += len(string(runes[i]))
+		offsets[i+1] = n
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			// Line comment
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case (r == 'x' || r == 'X') && i+1 < len(runes) && runes[i+1] == '\'':
+			// Hexadecimal literal of binary data, e.g. X'00ff'
+			start := i
+			i += 2
+			for i < len(runes) && runes[i] != '\'' {
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", offsets[start])
+			}
+			data, err := hex.DecodeString(string(runes[start+2 : i]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid hexadecimal literal at position %d", offsets[start])
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: string(data), pos: offsets[start]})
+
+		case r == '\'' || r == '"':
+			// Quoted literal: the quote is escaped by doubling it or with a backslash
+			var sb strings.Builder
+			start := i
+			i++
+			closed := false
+			for i < len(runes) {
+				c := runes[i]
+				if c == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if c == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						sb.WriteRune(r)
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteRune(c)
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string starting at position %d", offsets[start])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: offsets[start]})
+
+		case isWordStart(r):
+			start := i
+			for i < len(runes) && isWordPart(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			kind := tokenWord
+			if isNumber(text) {
+				kind = tokenNumber
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: offsets[start]})
+
+		default:
+			matched := false
+			for _, sym := range symbols {
+				if strings.HasPrefix(input[offsets[i]:], sym) {
+					tokens = append(tokens, token{kind: tokenSymbol, text: sym, pos: offsets[i]})
+					i += len(sym)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				// Leave it to the parser to reject characters it has no use for
+				tokens = append(tokens, token{kind: tokenSymbol, text: string(r), pos: offsets[i]})
+				i++
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(input)}), nil
+}
+
+// isWordStart reports whether r can start a word or number
+func isWordStart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// isWordPart reports whether r can continue a word. Dots, dashes, colons and
+// at signs are allowed so bare values like emails and dates stay one token
+func isWordPart(r rune) bool {
+	return isWordStart(r) || r == '.' || r == '-' || r == ':' || r == '@'
+}
+
+// isNumber reports whether a word is a numeric literal
+func isNumber(text string) bool {
+	if text == "" || !unicode.IsDigit(rune(text[0])) {
+		return false
+	}
+	_, err := strconv.ParseFloat(text, 64)
+	return err == nil
+}
@@ -0,0 +1,149 @@
+package MyDb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// writeKind is what a write does to its table, which tells the tables linked to it by
+// foreign keys that it must lock along with it
+type writeKind int
+
+const (
+	inserting writeKind = iota // The referenced tables are read to check the new rows
+	updating                   // The referenced and referencing tables are read
+	deleting                   // The referencing tables are changed by ON DELETE CASCADE, and theirs in turn
+)
+
+// tableLocks are the locks of a table written to and of the tables linked to it by
+// foreign keys. Writes hold them instead of the db lock, so that writes to unrelated
+// tables proceed in parallel
+type tableLocks struct {
+	tables   map[string]*Table // Locked tables by name
+	write    map[*Table]bool   // Whether each table is locked for writing rather than reading
+	strict   bool              // Strict mode of the database when the tables were locked
+	safeMode bool              // Safe mode of the database when the tables were locked
+	tx       *Tx               // Transaction of the write, nil outside of one
+	rowLocks *rowLocks         // Rows locked by transactions, which the write must respect
+	wal      *writeAheadLog    // Log recording the changes of the write
+	autoSave *autoSaver        // Counts the write as unsaved
+	pager    *pager            // Counts the inserted rows as held in memory
+}
+
+// lockTables locks a table for writing along with the tables linked to it that the write
+// reads or changes, for a transaction or nil. The db lock is only held while the tables
+// are resolved and locked. The database is saved first if the write-ahead log is full
+func (db *Database) lockTables(tx *Tx, tableName string, kind writeKind) (*Table, *tableLocks, error) {
+	if db.wal.full() {
+		if err := db.Save(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	l, err := db.linkedTables(tableName, kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	l.tx = tx
+	l.lock() // Lock tables second
+	return l.tables[tableName], l, nil
+}
+
+// linkedTables returns the locks, not yet taken, of a table and of the tables linked to
+// it that a write of the given kind reads or changes, loading those evicted from memory
+// back. The db lock must be held
+func (db *Database) linkedTables(tableName string, kind writeKind) (*tableLocks, error) {
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	l := &tableLocks{tables: make(map[string]*Table), write: make(map[*Table]bool), strict: db.strict, safeMode: db.safeMode, rowLocks: &db.rowLocks, wal: &db.wal, autoSave: &db.autoSave, pager: &db.pager}
+	l.add(tableName, table, true)
+	for _, fk := range table.foreignKeys {
+		l.add(fk.RefTable, db.Tables[fk.RefTable], false)
+	}
+	if kind != inserting {
+		var addReferencing func(name string)
+		addReferencing = func(name string) {
+			db.referencing(name, func(childName string, child *Table, fk ForeignKey) error {
+				if kind != deleting {
+					l.add(childName, child, false)
+				} else if !l.write[child] {
+					l.add(childName, child, true)
+					addReferencing(childName)
+				}
+				return nil
+			})
+		}
+		addReferencing(tableName)
+	}
+	for name, table := range l.tables {
+		if err := db.use(name, table); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// add adds a table to the locks, locked for writing if any write needs it
+func (l *tableLocks) add(name string, table *Table, write bool) {
+	l.tables[name] = table
+	l.write[table] = l.write[table] || write
+}
+
+// lock takes the locks in table name order, so that writes locking the same tables
+// cannot deadlock
+func (l *tableLocks) lock() {
+	for _, table := range l.ordered() {
+		if l.write[table] {
+			table.mu.Lock()
+		} else {
+			table.mu.RLock()
+		}
+	}
+}
+
+// unlock releases the locks
+func (l *tableLocks) unlock() {
+	ordered := l.ordered()
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if table := ordered[i]; l.write[table] {
+			table.mu.Unlock()
+		} else {
+			table.mu.RUnlock()
+		}
+	}
+}
+
+// ordered returns the locked tables in name order
+func (l *tableLocks) ordered() []*Table {
+	names := make([]string, 0, len(l.tables))
+	for name := range l.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tables := make([]*Table, len(names))
+	for i, name := range names {
+		tables[i] = l.tables[name]
+	}
+	return tables
+}
+
+// referencing calls fn for each foreign key referencing a table, with the locked table
+// holding it, like Database.referencing
+func (l *tableLocks) referencing(tableName string, fn func(childName string, child *Table, fk ForeignKey) error) error {
+	for childName, child := range l.tables {
+		for _, fk := range child.foreignKeys {
+			if fk.RefTable == tableName {
+				if err := fn(childName, child, fk); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
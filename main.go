@@ -1,263 +1,862 @@
 package MyDb
 
 import (
-	"encoding/csv"
+	"context"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
+// Row is a single row of data as a map of column names to values
+type Row = map[string]string
+
 // Table represents a table in the database
 type Table struct {
-	Columns []string             // Column names
-	Rows    []map[string]string  // Rows of data as a map of column names to values
-	mu      sync.Mutex           // Mutex for concurrent access
+	Columns     []string                   // Column names
+	Rows        []map[string]string        // Rows of data as a map of column names to values, nil while evicted from memory
+	defs        map[string]ColumnDef       // Definitions of the typed columns, keyed by name
+	primaryKey  *uniqueIndex               // Primary key index, nil when the table has no primary key
+	unique      []*uniqueIndex             // Indexes of the UNIQUE constraints
+	lastID      int64                      // Last value of the auto-increment column
+	foreignKeys []ForeignKey               // Foreign keys of the table referencing other tables
+	checks      []checkConstraint          // CHECK constraints of the table
+	generated   map[string]generatedColumn // Generated columns by name
+	indexes     []*secondaryIndex          // Indexes created with CreateIndex
+	stats       *TableStats                // Statistics gathered by Analyze, nil before
+	fullText    []*fullTextIndex           // Indexes created with CreateFullTextIndex
+	fuzzy       []*trigramIndex            // Indexes created with CreateFuzzyIndex
+	walSeq      int64                      // Last write-ahead log record held by the CSV file the table was loaded from
+	shared      atomic.Bool                // Whether a snapshot shares the Rows slice, which must then be copied before rows are replaced in it
+	dirty       bool                       // Whether the table changed since it was last saved or loaded
+	inserted    bool                       // Whether rows were inserted since the table was last saved or loaded, when it is not dirty
+	savedRows   int                        // Number of rows held by the saved data, the others being inserted since
+	logToken    string                     // Token of the saved data, which its insert log repeats, empty when it has no insert log
+	logged      bool                       // Whether the insert log of the saved data holds rows
+	dialect     CSVDialect                 // Dialect of the CSV data of the table
+	positions   *rowSlots                  // Positions of the rows by rowID, kept by rowPosition and gathered again once stale
+	evicted     atomic.Pointer[Database]   // Database reading the data the rows were evicted to, nil while they are in memory
+	used        atomic.Int64               // When the table was last used, on the clock of the pager
+	base        *Table                     // Table that a snapshot pinned for a statement was taken from, see pinTables
+	mu          sync.RWMutex               // Mutex for concurrent access, held for reading by reads
 }
 
 // Database represents a database with a collection of tables
 type Database struct {
-	Name   string             // Name of the database
-	Tables map[string]*Table  // Map of table names to tables
-	mu     sync.Mutex         // Mutex for concurrent access
+	Name      string                         // Name of the database
+	path      string                         // Directory of the files of the database, Name when empty
+	Tables    map[string]*Table              // Map of table names to tables
+	dropped   map[string]bool                // Tables whose CSV files are removed on the next Save
+	savedTo   string                         // Directory the tables were last saved to or loaded from, where Save skips the unchanged ones
+	safeMode  bool                           // Refuse updates and deletes without a condition
+	strict    bool                           // Refuse inserted rows leaving out columns without a default
+	funcs     map[string]scalarFunc          // Functions registered with RegisterFunction, keyed by lower case name
+	funcsMu   sync.RWMutex                   // Mutex for the functions, which writes look up without the db lock
+	progress  IndexProgress                  // Called while Load rebuilds indexes, nil when not set
+	stemmers  map[string]func(string) string // Stemmers registered with RegisterStemmer, keyed by lower case name
+	scans     map[string]*scanRecord         // Full scans recorded by the index advisor, nil when it is off
+	scansMu   sync.Mutex                     // Mutex for the scans, which reads record
+	isolation IsolationLevel                 // How reads behave while other goroutines write
+	rowLocks  rowLocks                       // Rows locked by transactions
+	storage   Storage                        // Where the tables are saved, nil for a DirStorage of the database directory
+	format    Format                         // How Save encodes the data of tables
+	codec     Codec                          // How Save compresses the data of tables, nil for no compression
+	crypter   *crypter                       // Encrypts the saved data, nil when it is not encrypted
+	insertLog bool                           // Append inserted rows to insert logs on Save instead of rewriting tables
+	wal       writeAheadLog                  // Journal of the writes since the last Save
+	autoSave  autoSaver                      // Saves the database after writes when set
+	pager     pager                          // Evicts tables from memory past the limit set by WithMemoryLimit
+	pinned    *pinned                        // Set on the databases holding the tables pinned for a statement, nil otherwise
+	mu        sync.RWMutex                   // Mutex for concurrent access, held for reading by reads
 }
 
-// NewDatabase creates a new database with the given name
-func NewDatabase(name string) *Database {
-	return &Database{
-		Name:   name,
-		Tables: make(map[string]*Table),
+// NewDatabase creates a new database with the given name, configured by options
+func NewDatabase(name string, options ...Option) *Database {
+	db := &Database{
+		Name:     name,
+		Tables:   make(map[string]*Table),
+		rowLocks: rowLocks{timeout: DefaultLockTimeout},
+		wal:      writeAheadLog{checkpointSize: DefaultCheckpointSize},
+	}
+	for _, option := range options {
+		option(db)
 	}
+	return db
 }
 
-// CreateTable creates a new table in the database
+// CreateTable creates a new table in the database whose columns hold strings
 func (db *Database) CreateTable(name string, columns []string) error {
-	db.mu.Lock() // Lock db first
-	defer db.mu.Unlock()
+	defs := make([]ColumnDef, len(columns))
+	for i, col := range columns {
+		defs[i] = ColumnDef{Name: col}
+	}
+	return db.CreateTableWithSchema(name, defs)
+}
 
-	// Validate table and column names
-	if !isValidName(name) {
-		return fmt.Errorf("invalid table name: %s", name)
+// InsertInto inserts a row of data into the specified table
+func (db *Database) InsertInto(tableName string, data map[string]string) error {
+	return db.InsertMany(tableName, []map[string]string{data})
+}
+
+// InsertReturningID inserts a row like InsertInto and returns the value assigned to
+// the auto-increment column of the table, or 0 when it has none
+func (db *Database) InsertReturningID(tableName string, data map[string]string) (int64, error) {
+	_, id, err := db.insertRows(tableName, []map[string]string{data}, false)
+	return id, err
+}
+
+// InsertMany inserts several rows into the specified table while taking the table
+// lock only once. If any row is invalid, none of them is inserted
+func (db *Database) InsertMany(tableName string, rows []map[string]string) error {
+	_, _, err := db.insertRows(tableName, rows, false)
+	return err
+}
+
+// insertRows inserts rows and returns a copy of each stored row along with the last
+// auto-increment value assigned, 0 when none was. Restored rows keep the values they give
+// to the timestamp columns
+func (db *Database) insertRows(tableName string, rows []map[string]string, restoring bool) (inserted []map[string]string, lastID int64, err error) {
+	defer db.autoSaveAfter(&err) // Once the tables are unlocked
+
+	// Lock the table and the tables it references
+	table, l, err := db.lockTables(nil, tableName, inserting)
+	if err != nil {
+		return nil, 0, err
 	}
-	for _, col := range columns {
-		if !isValidName(col) {
-			return fmt.Errorf("invalid column name: %s", col)
+	defer l.unlock()
+
+	// Validate the data columns and values and fill in the defaults
+	normalized := make([]map[string]string, len(rows))
+	for i, data := range rows {
+		var times map[string]string
+		if restoring {
+			if data, times, err = table.splitTimestamps(tableName, data); err != nil {
+				return nil, 0, err
+			}
+		}
+		if err := table.checkWritable(tableName, data); err != nil {
+			return nil, 0, err
+		}
+		row, err := table.normalizeRow(tableName, data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if l.strict {
+			if err := table.checkComplete(tableName, row); err != nil {
+				return nil, 0, err
+			}
+		}
+		id, err := db.applyDefaults(tableName, table, row)
+		if err != nil {
+			return nil, 0, err
 		}
+		maps.Copy(row, times)
+		if err := table.computeGenerated(tableName, row); err != nil {
+			return nil, 0, err
+		}
+		if id != 0 {
+			lastID = id
+		}
+		normalized[i] = removeNulls(row) // NULL columns are left out
 	}
 
-	// Check if the table already exists
-	if _, exists := db.Tables[name]; exists {
-		return fmt.Errorf("table %s already exists", name)
+	// Check the constraints and insert the rows
+	if err := table.checkRows(tableName, normalized, nil); err != nil {
+		return nil, 0, err
 	}
-
-	// Create the table and initialize Rows
-	db.Tables[name] = &Table{
-		Columns: columns,
-		Rows:    []map[string]string{}, // Initialize Rows
+	if err := l.checkReferences(tableName, table, normalized); err != nil {
+		return nil, 0, err
 	}
-	return nil
-}
 
-// InsertInto inserts a row of data into the specified table
-func (db *Database) InsertInto(tableName string, data map[string]string) error {
-	db.mu.Lock() // Lock db first
-	defer db.mu.Unlock()
-
-	// Check if the table exists
-	table, exists := db.Tables[tableName]
-	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+	// Append the new rows once they are logged
+	if err := l.log(walChange{Table: tableName, Insert: normalized}); err != nil {
+		return nil, 0, err
 	}
+	table.Rows = append(table.Rows, normalized...)
+	table.indexRows(normalized)
+	inserted = make([]map[string]string, len(normalized))
+	for i, row := range normalized {
+		inserted[i] = copyRow(row)
+	}
+	return inserted, lastID, nil
+}
 
-	// Validate the data columns
-	for key := range data {
-		if !contains(table.Columns, key) {
-			return fmt.Errorf("column %s does not exist in table %s", key, tableName)
+// Delete removes rows from the specified table that match all the given conditions.
+// Empty conditions match every row
+func (db *Database) Delete(tableName string, conditions map[string]string) error {
+	var condition func(row map[string]string) bool
+	if len(conditions) > 0 {
+		condition = func(row map[string]string) bool {
+			return matchConditions(row, conditions)
 		}
 	}
+	_, err := db.deleteRows(context.Background(), nil, tableName, conditions, condition, false)
+	return err
+}
 
-	// Lock the table and insert the row
-	table.mu.Lock() // Lock table second
-	defer table.mu.Unlock()
-
-	// Append the new row
-	table.Rows = append(table.Rows, data)
-	return nil
+// DeleteRows removes the rows of a table matching the condition and returns how many
+// were removed. A nil condition matches every row
+func (db *Database) DeleteRows(tableName string, condition func(row map[string]string) bool) (int, error) {
+	deleted, err := db.deleteRows(context.Background(), nil, tableName, nil, condition, false)
+	return len(deleted), err
 }
 
-// Delete removes rows from the specified table that match all the given conditions
-func (db *Database) Delete(tableName string, conditions map[string]string) error {
-	db.mu.Lock() // Lock db first
-	defer db.mu.Unlock()
+// deleteRows removes the rows matching the condition and returns them, force allows
+// a nil condition in safe mode. key holds values that the condition requires columns
+// to equal, which find the rows through a unique index when they cover one. The rows
+// are locked for tx, which is nil outside of a transaction
+func (db *Database) deleteRows(ctx context.Context, tx *Tx, tableName string, key map[string]string, condition func(row map[string]string) bool, force bool) ([]map[string]string, error) {
+	var deleted []map[string]string
+	err := db.retryLocked(ctx, tx, func() (err error) {
+		deleted, err = db.tryDeleteRows(ctx, tx, tableName, key, condition, force)
+		return err
+	})
+	return deleted, err
+}
 
-	// Check if the table exists
-	table, exists := db.Tables[tableName]
-	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+// tryDeleteRows is deleteRows without waiting for rows locked by other transactions,
+// for which it returns a *rowWait error
+func (db *Database) tryDeleteRows(ctx context.Context, tx *Tx, tableName string, key map[string]string, condition func(row map[string]string) bool, force bool) ([]map[string]string, error) {
+	// Lock the table and the tables a cascade deletes from
+	table, l, err := db.lockTables(tx, tableName, deleting)
+	if err != nil {
+		return nil, err
+	}
+	defer l.unlock()
+	condition, err = l.checkSafe("delete", tableName, condition, force)
+	if err != nil {
+		return nil, err
 	}
 
-	// Lock the table to ensure thread safety
-	table.mu.Lock() // Lock table second
-	defer table.mu.Unlock()
-
-	// Filter rows that do not match the conditions
-	var remainingRows []map[string]string
-	for _, row := range table.Rows {
-		match := true
-		for col, val := range conditions {
-			if row[col] != val {
-				match = false
-				break
+	// Find the rows matching the condition, only testing the candidates of an index when there is one
+	matched := make(map[int]bool)
+	if candidates, access := table.lookup(key); access != nil {
+		var found []map[string]string
+		for i, row := range candidates {
+			if i%cancelCheckRows == 0 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if condition(row) {
+				found = append(found, row)
 			}
 		}
-		if !match {
-			remainingRows = append(remainingRows, row)
+		matched = table.rowPositions(found)
+	} else {
+		for i, row := range table.Rows {
+			if i%cancelCheckRows == 0 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if condition(row) {
+				matched[i] = true
+			}
 		}
 	}
 
-	// Update the table with remaining rows
-	table.Rows = remainingRows
-	return nil
+	// Delete them along with the rows referencing them
+	return l.deleteCascading(tableName, table, matched)
 }
 
 // UpdateData updates rows in the specified table based on a condition
 func (db *Database) UpdateData(tableName string, condition func(row map[string]string) bool, data map[string]string) error {
-	db.mu.Lock() // Lock db first
-	defer db.mu.Unlock()
+	_, err := db.UpdateRows(tableName, condition, data)
+	return err
+}
 
-	// Check if the table exists
-	table, exists := db.Tables[tableName]
-	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+// UpdateDataCtx is UpdateData stopping with the error of the context once it is done,
+// before changing any row
+func (db *Database) UpdateDataCtx(ctx context.Context, tableName string, condition func(row map[string]string) bool, data map[string]string) error {
+	_, err := db.updateRows(ctx, nil, tableName, nil, condition, data, false)
+	return err
+}
+
+// UpdateRows updates the rows of a table matching the condition and returns how many
+// were updated. A nil condition matches every row
+func (db *Database) UpdateRows(tableName string, condition func(row map[string]string) bool, data map[string]string) (int, error) {
+	updated, err := db.updateRows(context.Background(), nil, tableName, nil, condition, data, false)
+	return len(updated), err
+}
+
+// updateRows updates the rows matching the condition and returns a copy of each
+// updated row, force allows a nil condition in safe mode. key holds values that the
+// condition requires columns to equal, which find the rows through a unique index
+// when they cover one. The rows are locked for tx, which is nil outside of a transaction
+func (db *Database) updateRows(ctx context.Context, tx *Tx, tableName string, key map[string]string, condition func(row map[string]string) bool, data map[string]string, force bool) ([]map[string]string, error) {
+	var updated []map[string]string
+	err := db.retryLocked(ctx, tx, func() (err error) {
+		updated, err = db.tryUpdateRows(ctx, tx, tableName, key, condition, data, force)
+		return err
+	})
+	return updated, err
+}
+
+// tryUpdateRows is updateRows without waiting for rows locked by other transactions,
+// for which it returns a *rowWait error
+func (db *Database) tryUpdateRows(ctx context.Context, tx *Tx, tableName string, key map[string]string, condition func(row map[string]string) bool, data map[string]string, force bool) ([]map[string]string, error) {
+	// Lock the table and the tables referenced by it or referencing it
+	table, l, err := db.lockTables(tx, tableName, updating)
+	if err != nil {
+		return nil, err
+	}
+	defer l.unlock()
+	condition, err = l.checkSafe("update", tableName, condition, force)
+	if err != nil {
+		return nil, err
 	}
 
-	// Validate that the data map matches the table columns
-	for key := range data {
-		if !contains(table.Columns, key) {
-			return fmt.Errorf("column %s does not exist in table %s", key, tableName)
-		}
+	// Validate that the data map matches the table columns and types
+	if err := table.checkWritable(tableName, data); err != nil {
+		return nil, err
+	}
+	data, err = table.normalizeRow(tableName, data)
+	if err != nil {
+		return nil, err
 	}
 
-	// Lock the table and update matching rows
-	table.mu.Lock() // Lock table second
-	defer table.mu.Unlock()
-	for i, row := range table.Rows {
+	// Find the matching rows
+	rows := table.Rows
+	if candidates, access := table.lookup(key); access != nil {
+		rows = candidates // Only rows found through the index can match
+	}
+	var matched, updated []map[string]string
+	now := timestampNow()
+	for i, row := range rows {
+		if i%cancelCheckRows == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		if condition(row) {
-			// Update the row with the new data
-			for key, value := range data {
-				row[key] = value
+			newRow := copyRow(row)
+			applyChanges(newRow, data)
+			table.touch(newRow, now)
+			if err := table.computeGenerated(tableName, newRow); err != nil {
+				return nil, err
 			}
-			table.Rows[i] = row
+			matched = append(matched, row)
+			updated = append(updated, removeNulls(newRow))
 		}
 	}
-	return nil
+	if err := l.lockRows(tableName, table, matched); err != nil {
+		return nil, err
+	}
+	if err := table.checkRows(tableName, updated, matched); err != nil {
+		return nil, err
+	}
+	if err := l.checkReferences(tableName, table, updated); err != nil {
+		return nil, err
+	}
+	if err := l.checkReferenced(tableName, matched, updated); err != nil {
+		return nil, err
+	}
+
+	// Replace the rows by their new versions once they are logged, leaving the old ones to
+	// the snapshots reading them
+	change := walChange{Table: tableName, Update: make([][2]map[string]string, len(matched))}
+	for i, row := range matched {
+		change.Update[i] = [2]map[string]string{row, updated[i]}
+	}
+	if err := l.log(change); err != nil {
+		return nil, err
+	}
+	table.replaceRows(matched, updated)
+	returned := make([]map[string]string, len(updated))
+	for i, row := range updated {
+		returned[i] = copyRow(row)
+	}
+	return returned, nil
 }
 
+// cancelCheckRows is how many rows scans go through between checks of their context
+const cancelCheckRows = 1024
+
 // SearchRows searches for rows in the specified table based on a condition
 func (db *Database) SearchRows(tableName string, condition func(row map[string]string) bool) ([]map[string]string, error) {
-	db.mu.Lock() // Lock db first
-	defer db.mu.Unlock()
-
-	// Check if the table exists
-	table, exists := db.Tables[tableName]
-	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", tableName)
-	}
+	return db.SearchRowsCtx(context.Background(), tableName, condition)
+}
 
-	// Lock the table and search for rows matching the condition
-	table.mu.Lock() // Lock table second
-	defer table.mu.Unlock()
+// SearchRowsCtx is SearchRows stopping with the error of the context once it is done
+func (db *Database) SearchRowsCtx(ctx context.Context, tableName string, condition func(row map[string]string) bool) ([]map[string]string, error) {
+	var results []map[string]string
+	err := db.readRows(tableName, func(columns []string, rows []map[string]string) error {
+		for i, row := range rows {
+			if i%cancelCheckRows == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if condition(row) {
+				results = append(results, row)
+			}
+		}
+		return nil
+	})
+	return results, err
+}
 
+// SearchRowsPaged searches for rows matching the condition, skipping the first offset matches
+// and returning at most limit rows (a negative limit returns all remaining matches)
+func (db *Database) SearchRowsPaged(tableName string, condition func(row map[string]string) bool, offset, limit int) ([]map[string]string, error) {
+	// Collect only the requested page of matches
 	var results []map[string]string
-	for _, row := range table.Rows {
-		if condition(row) {
+	err := db.readRows(tableName, func(columns []string, rows []map[string]string) error {
+		for _, row := range rows {
+			if limit >= 0 && len(results) >= limit {
+				break
+			}
+			if !condition(row) {
+				continue
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
 			results = append(results, row)
 		}
-	}
-	return results, nil
+		return nil
+	})
+	return results, err
 }
 
-// SelectTable selects a table from a CSV file
+// SelectTable reads a table from its CSV or Gob data in the storage of the database
 func (db *Database) SelectTable(tableName string) (*Table, error) {
-	// Open the table's CSV file
-	file, err := os.Open(fmt.Sprintf("%s/%s.csv", db.Name, tableName))
+	schema, err := db.readSchema()
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return db.selectTable(tableName, schema.dialect(tableName))
+}
+
+// selectTable reads a table from its data, in a dialect when it is CSV
+func (db *Database) selectTable(tableName string, dialect CSVDialect) (*Table, error) {
+	return db.readTable(tableName, dialect, true)
+}
 
-	// Read the CSV file
-	reader := csv.NewReader(file)
-	columns, err := reader.Read()
+// readTable reads a table from its data like selectTable, with its rows when withRows is
+// set or else with its header only
+func (db *Database) readTable(tableName string, dialect CSVDialect, withRows bool) (*Table, error) {
+	// Open the table's data
+	file, err := db.store().LoadTable(tableName)
 	if err != nil {
 		return nil, err
 	}
-
-	table := &Table{
-		Columns: columns,
+	defer file.Close()
+	plain, err := db.unsealed(file, "table "+tableName)
+	if err != nil {
+		return nil, err
 	}
+	data, err := db.decompress(plain)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
 
-	rows, err := reader.ReadAll()
+	// Read the CSV data, or the Gob data
+	reader := newTableReader(data, dialect)
+	header, err := reader.Read()
 	if err != nil {
 		return nil, err
 	}
+	table, err := parseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	table.dialect = dialect
+	if !withRows {
+		return table, nil
+	}
+
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
 
 	// Convert rows to map[string]string
 	var mappedRows []map[string]string
 	for _, row := range rows {
-		mappedRow := make(map[string]string)
-		for i, col := range columns {
-			mappedRow[col] = row[i]
+		mappedRow, err := db.decodeRow(tableName, table, row)
+		if err != nil {
+			return nil, err
 		}
 		mappedRows = append(mappedRows, mappedRow)
 	}
 
 	table.Rows = mappedRows
 
+	// Add the rows appended to the insert log since the data was saved
+	if err := db.readInsertLog(tableName, table); err != nil {
+		return nil, fmt.Errorf("invalid insert log: %w", err)
+	}
 	return table, nil
 }
 
-// Save saves the database to a directory and creates a CSV file for each table
+// decodeRow returns a row from its saved fields, reading BLOB values from their files or base64
+func (db *Database) decodeRow(tableName string, table *Table, fields []string) (map[string]string, error) {
+	store, separate := db.blobStore()
+	row := make(map[string]string)
+	for i, col := range table.Columns {
+		decodeCSVValue(row, col, fields[i])
+		if value, ok := row[col]; ok && value != "" && table.columnDef(col).Type == Blob {
+			var err error
+			if separate {
+				row[col], err = store.readBlob(tableName, value)
+			} else {
+				row[col], err = decodeInlineBlob(value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("column %s of table %s: %w", col, tableName, err)
+			}
+		}
+	}
+	return row, nil
+}
+
+// encodeRow returns the fields of a row as saved, with BLOB values replaced by the hash of
+// their file, which it adds to blobs, or base64 encoded
+func (db *Database) encodeRow(tableName string, table *Table, row map[string]string, blobs map[string]bool) ([]string, error) {
+	store, separate := db.blobStore()
+	fields := make([]string, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		field := encodeCSVValue(row, col)
+		if value, ok := row[col]; ok && value != "" && table.columnDef(col).Type == Blob {
+			if !separate {
+				fields = append(fields, encodeInlineBlob(value))
+				continue
+			}
+			var err error
+			if field, err = store.writeBlob(tableName, value); err != nil {
+				return nil, err
+			}
+			blobs[field] = true
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Save saves the database to a directory and creates a CSV file for each table, or a Gob
+// file as set by SetFormat, along with a _schema.json file describing their columns and
+// constraints. Each file is written to a temporary file first and renamed over the old
+// one once complete, so that a crash while saving never leaves a partial file behind.
+// Only the files of the tables changed since the last Save or Load to the same directory are rewritten
 func (db *Database) Save() error {
+	return db.SaveCtx(context.Background())
+}
+
+// SaveCtx is Save stopping with the error of the context once it is done. It checks
+// the context before writing each file, so that every file written is complete
+func (db *Database) SaveCtx(ctx context.Context) error {
 	db.mu.Lock() // Lock db first
 	defer db.mu.Unlock()
+	return db.saveLocked(ctx)
+}
 
-	// Ensure the database directory exists
-	if err := os.MkdirAll(db.Name, os.ModePerm); err != nil {
-		return err
-	}
-
-	// Save each table as a CSV file
+// saveLocked saves the database and empties the write-ahead log. The db lock must be
+// held, but no table lock
+func (db *Database) saveLocked(ctx context.Context) error {
+	// Evicted tables to rewrite are loaded back first
 	for tableName, table := range db.Tables {
-		file, err := os.Create(fmt.Sprintf("%s/%s.csv", db.Name, tableName))
+		if table.evicted.Load() == nil || !table.dirty && db.savedTo == db.dir() {
+			continue
+		}
+		loaded, err := db.loadEvicted(tableName, table)
 		if err != nil {
 			return err
 		}
+		db.pager.grow(loaded)
+	}
 
-		writer := csv.NewWriter(file)
-		// Write column headers
-		if err := writer.Write(table.Columns); err != nil {
-			file.Close()
+	// Writes wait until every file is written and the log emptied
+	l := &tableLocks{tables: maps.Clone(db.Tables), write: make(map[*Table]bool)}
+	l.lock() // Lock tables second
+	defer l.unlock()
+	walSeq := db.wal.lastSeq()
+
+	// Save each changed table
+	for tableName, table := range db.Tables {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-
-		// Write rows
-		for _, row := range table.Rows {
-			var rowData []string
-			for _, col := range table.Columns {
-				rowData = append(rowData, row[col])
+		if !table.dirty && db.savedTo == db.dir() {
+			if !table.inserted {
+				continue
 			}
-			if err := writer.Write(rowData); err != nil {
-				file.Close()
+			appended, err := db.appendInserted(tableName, table, walSeq)
+			if err != nil {
 				return err
 			}
+			if appended {
+				continue
+			}
+		}
+		if err := db.saveTableFiles(tableName, table, walSeq); err != nil {
+			return err
 		}
+	}
+
+	// Remove the files of dropped tables
+	for tableName := range db.dropped {
+		if err := db.store().DeleteTable(tableName); err != nil {
+			return err
+		}
+	}
+	db.dropped = nil
+
+	// Describe the tables in the schema file
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := db.saveSchema(); err != nil {
+		return err
+	}
+	if err := db.wal.reset(db.walPath()); err != nil {
+		return err
+	}
+	db.autoSave.pending.Store(0)
+	db.savedTo = db.dir()
+	return nil
+}
+
+// SaveTable saves a single table, writing its CSV file and its description in the schema
+// file while leaving the files of the other tables as they are. The tables it references
+// through foreign keys must have been saved for Load to restore them
+func (db *Database) SaveTable(tableName string) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
 
-		writer.Flush()
-		file.Close()
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	schema, err := db.readSchema()
+	if err != nil {
+		return err
 	}
+	if schema == nil {
+		schema = &savedSchema{Tables: make(map[string]savedTable)}
+	}
+	if err := db.use(tableName, table); err != nil {
+		return err
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	if err := db.saveTableFiles(tableName, table, db.wal.lastSeq()); err != nil {
+		return err
+	}
+	schema.Strict = db.strict
+	schema.Tables[tableName] = table.schema()
+	return db.writeSchema(*schema)
+}
 
+// saveTableFiles saves the CSV data and BLOB values of a table, holding the write-ahead
+// log up to walSeq, removes its insert log and marks the table as saved. The db lock and
+// the table lock must be held
+func (db *Database) saveTableFiles(tableName string, table *Table, walSeq int64) error {
+	table.logToken = ""
+	if db.canAppend() {
+		table.logToken = newLogToken() // Tells the insert log of the new data from an old one
+	}
+	blobs, err := db.saveTable(tableName, table, walSeq)
+	if err != nil {
+		return err
+	}
+	if store, ok := db.store().(blobStore); ok {
+		if err := store.removeUnusedBlobs(tableName, blobs); err != nil {
+			return err
+		}
+	}
+	if store, ok := db.store().(logStore); ok {
+		if err := store.removeLog(tableName); err != nil {
+			return err
+		}
+	}
+	table.markSaved()
+	table.logged = false
+	return nil
+}
+
+// saveTable saves the data of a table in the format and with the codec of the database,
+// holding the write-ahead log up to walSeq, and returns the hashes of its BLOB values
+// when the storage keeps them apart, which it saves too. The table lock must be held
+func (db *Database) saveTable(tableName string, table *Table, walSeq int64) (map[string]bool, error) {
+	blobs := make(map[string]bool)
+	err := db.storeTable(tableName, func(w io.Writer) error {
+		return db.writeTable(w, tableName, table, db.format, walSeq, blobs)
+	})
+	return blobs, err
+}
+
+// writeTable writes the data of a table in a format, holding the write-ahead log up to
+// walSeq, and adds the hashes of its BLOB values to blobs when the storage keeps them
+// apart, which it saves too. The table lock must be held
+func (db *Database) writeTable(w io.Writer, tableName string, table *Table, format Format, walSeq int64, blobs map[string]bool) error {
+	writer, err := newTableWriter(w, format, table.dialect)
+	if err != nil {
+		return err
+	}
+	// Write column headers
+	if err := writer.Write(table.header(walSeq)); err != nil {
+		return err
+	}
+
+	// Write rows, with BLOB values replaced by the hash of their file or base64 encoded
+	for _, row := range table.Rows {
+		rowData, err := db.encodeRow(tableName, table, row, blobs)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(rowData); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// writeAtomic writes a file through a temporary file next to it, which is synced to
+// disk and then renamed over the file, so that the file is either old or new but never
+// partly written
+func writeAtomic(path string, write func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = write(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// appendFile appends data to a file, which it creates if needed, and syncs it to disk
+// along with its directory
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	syncDir(filepath.Dir(path))
+	return err
+}
+
+// syncDir syncs a directory to disk, so that the files renamed into it survive a
+// crash. It is best effort, as some platforms cannot sync directories
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// LoadDatabase reconstructs a database from the directory written by Save
+func LoadDatabase(name string, options ...Option) (*Database, error) {
+	db := NewDatabase(name, options...)
+	if err := db.Load(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Load reads every table from the storage of the database, CSV or Gob files in the database
+// directory by default, and rebuilds the tables with the column definitions and
+// constraints described by its schema, the _schema.json file by default. With a memory
+// limit, see WithMemoryLimit, it reads the header of each table only
+func (db *Database) Load() error {
+	return db.load(true)
+}
+
+// load loads the database, replaying the write-ahead log if asked to
+func (db *Database) load(replay bool) error {
+	names, err := db.store().ListTables()
+	if err != nil {
+		return err
+	}
+	schema, err := db.readSchema() // First, for the dialects of the tables
+	if err != nil {
+		return err
+	}
+
+	// Read each table from its data, or its header when tables are loaded once used
+	lazy := db.pager.limit.Rows > 0
+	tables := make(map[string]*Table)
+	for _, tableName := range names {
+		if !isValidName(tableName) {
+			continue
+		}
+		table, err := db.readTable(tableName, schema.dialect(tableName), !lazy)
+		if err != nil {
+			return fmt.Errorf("failed to load table %s: %w", tableName, err)
+		}
+		if table.Rows == nil {
+			table.Rows = []map[string]string{} // Initialize Rows
+		}
+		tables[tableName] = table
+	}
+
+	// Restore the definitions and constraints of the tables from the schema file
+	walSeqs := make(map[string]int64, len(tables))
+	for tableName, table := range tables {
+		walSeqs[tableName] = table.walSeq
+	}
+	if schema != nil {
+		if tables, err = db.applySchema(schema, tables); err != nil {
+			return err
+		}
+	}
+
+	// Replay the writes recorded in the write-ahead log since the files were saved, which
+	// loads the tables they change
+	source := db.source()
+	for _, table := range tables {
+		table.markSaved()
+		if lazy {
+			table.dropRows()
+			table.evicted.Store(source)
+		}
+	}
+	if replay {
+		if err := db.replayWAL(tables, walSeqs); err != nil {
+			return err
+		}
+	}
+
+	// Replace the in-memory tables with the loaded ones
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.Tables = tables
+	db.strict = schema != nil && schema.Strict
+	db.dropped = nil
+	var rows int
+	for _, table := range tables {
+		rows += len(table.Rows) // None for the tables left evicted
+	}
+	db.pager.rows.Store(int64(rows))
+	db.savedTo = db.dir()
+	db.autoSave.pending.Store(0)
 	return nil
 }
 
@@ -277,100 +876,116 @@ func contains(slice []string, str string) bool {
 	return false
 }
 
-// Command executes SQL-like commands for the database
+// Result holds the outcome of a command executed with Query
+type Result struct {
+	Columns      []string            // Column order of the returned rows
+	Rows         []map[string]string // Rows returned by a GET command
+	RowsAffected int                 // Number of rows inserted, updated or deleted
+	LastInsertID int64               // Last value assigned to an auto-increment column by an INSERT, 0 when none was
+}
+
+// Command executes SQL-like commands for the database and returns the matched rows
 func (db *Database) Command(command string) ([]map[string]string, error) {
-	command = strings.TrimSpace(strings.ToLower(command))
+	return db.CommandCtx(context.Background(), command)
+}
 
-	if strings.HasPrefix(command, "create table") {
+// CommandCtx is Command stopping with the error of the context once it is done
+func (db *Database) CommandCtx(ctx context.Context, command string) ([]map[string]string, error) {
+	result, err := db.QueryCtx(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	return result.Rows, nil
+}
+
+// Query executes SQL-like commands for the database and returns a Result
+func (db *Database) Query(command string) (*Result, error) {
+	return db.QueryCtx(context.Background(), command)
+}
+
+// QueryCtx is Query stopping with the error of the context once it is done. Scans
+// check the context every few rows, and UPDATE and DELETE stop before changing any row
+func (db *Database) QueryCtx(ctx context.Context, command string) (*Result, error) {
+	command = strings.TrimSpace(command)
+
+	// Keywords are matched case-insensitively by the parser, names and values keep their case
+	p, err := newParser(db, command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command: %w", err)
+	}
+	p.ctx = ctx
+	return db.exec(p)
+}
+
+// exec executes the command of a parser
+func (db *Database) exec(p *parser) (*Result, error) {
+	if p.peek().is("create") && !p.tokens[p.pos+1].is("table") {
+		// Handle CREATE INDEX
+		return db.queryCreateIndex(p)
+
+	} else if p.peek().is("create") {
 		// Handle CREATE TABLE with "HAS"
-		matches := regexp.MustCompile(`create table (\w+) has (.+)`).FindStringSubmatch(command)
-		if len(matches) != 3 {
-			return nil, fmt.Errorf("invalid CREATE TABLE command: %s", command)
-		}
-		tableName := matches[1]
-		columns := strings.Split(matches[2], ",")
-		for i := range columns {
-			columns[i] = strings.TrimSpace(columns[i])
-		}
-		return nil, db.CreateTable(tableName, columns)
+		return db.queryCreateTable(p)
 
-	} else if strings.HasPrefix(command, "insert to") {
-		// Handle INSERT
-		matches := regexp.MustCompile(`insert to (\w+) (.+)`).FindStringSubmatch(command)
-		if len(matches) != 3 {
-			return nil, fmt.Errorf("invalid INSERT command: %s", command)
-		}
-		tableName := matches[1]
-		values := strings.Split(matches[2], ",")
-		table, exists := db.Tables[tableName]
-		if !exists {
-			return nil, fmt.Errorf("table %s does not exist", tableName)
-		}
-		columns := table.Columns
-		if len(values) != len(columns) {
-			return nil, fmt.Errorf("mismatch between columns and values in table %s", tableName)
-		}
-		data := make(map[string]string)
-		for i, col := range columns {
-			data[col] = strings.TrimSpace(values[i])
-		}
-		return nil, db.InsertInto(tableName, data)
+	} else if p.peek().is("insert") || p.peek().is("upsert") {
+		// Handle INSERT and UPSERT
+		return db.queryInsert(p)
 
-	} else if strings.HasPrefix(command, "update") {
+	} else if p.peek().is("update") {
 		// Handle UPDATE
-		matches := regexp.MustCompile(`update (\w+) set (.+) where (.+)`).FindStringSubmatch(command)
-		if len(matches) != 4 {
-			return nil, fmt.Errorf("invalid UPDATE command: %s", command)
-		}
-		tableName := matches[1]
-		data := parseConditions(matches[2])
-		conditions := parseConditions(matches[3])
-		return nil, db.UpdateData(tableName, func(row map[string]string) bool {
-			return matchConditions(row, conditions)
-		}, data)
+		return db.queryUpdate(p)
 
-	} else if strings.HasPrefix(command, "get from") {
-		// Handle GET
-		matches := regexp.MustCompile(`get from (\w+) where (.+)`).FindStringSubmatch(command)
-		if len(matches) != 3 {
-			return nil, fmt.Errorf("invalid GET command: %s", command)
-		}
-		tableName := matches[1]
-		conditions := parseConditions(matches[2])
-		rows, err := db.SearchRows(tableName, func(row map[string]string) bool {
-			return matchConditions(row, conditions)
-		})
-		if err != nil {
-			return nil, err
-		}
-		return rows, nil
+	} else if p.peek().is("get") || p.peek().is("select") {
+		// Handle GET and SELECT
+		return db.querySelect(p)
 
-	} else if strings.HasPrefix(command, "delete from") {
+	} else if p.peek().is("delete") {
 		// Handle DELETE
-		matches := regexp.MustCompile(`delete from (\w+) where (.+)`).FindStringSubmatch(command)
-		if len(matches) != 3 {
-			return nil, fmt.Errorf("invalid DELETE command: %s", command)
-		}
-		tableName := matches[1]
-		conditions := parseConditions(matches[2])
-		return nil, db.Delete(tableName, conditions)
+		return db.queryDelete(p)
+
+	} else if p.peek().is("drop") {
+		// Handle DROP TABLE
+		return db.queryDropTable(p)
+
+	} else if p.peek().is("truncate") {
+		// Handle TRUNCATE TABLE
+		return db.queryTruncate(p)
+
+	} else if p.peek().is("alter") {
+		// Handle ALTER TABLE
+		return db.queryAlterTable(p)
+
+	} else if p.peek().is("explain") {
+		// Handle EXPLAIN
+		return db.queryExplain(p)
+
+	} else if p.peek().is("show") {
+		// Handle SHOW TABLES
+		return db.queryShowTables(p)
+
+	} else if p.peek().is("describe") || p.peek().is("desc") {
+		// Handle DESCRIBE
+		return db.queryDescribe(p)
+
+	} else if p.peek().is("analyze") {
+		// Handle ANALYZE
+		return db.queryAnalyze(p)
 
 	} else {
-		return nil, fmt.Errorf("unknown command: %s", command)
+		return nil, fmt.Errorf("unknown command: %s", p.input)
 	}
 }
 
-func parseConditions(input string) map[string]string {
-	conditions := make(map[string]string)
-	parts := strings.Split(input, ",")
-	for _, part := range parts {
-		condParts := strings.Split(part, "=")
-		if len(condParts) != 2 {
-			continue
-		}
-		conditions[strings.TrimSpace(condParts[0])] = strings.TrimSpace(condParts[1])
+// tableColumns returns a copy of the column names of the specified table
+func (db *Database) tableColumns(tableName string) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
 	}
-	return conditions
+	return append([]string(nil), table.Columns...), nil
 }
 
 func matchConditions(row map[string]string, conditions map[string]string) bool {
@@ -381,3 +996,12 @@ func matchConditions(row map[string]string, conditions map[string]string) bool {
 	}
 	return true
 }
+
+// copyRow returns a copy of a row
+func copyRow(row map[string]string) map[string]string {
+	copied := make(map[string]string, len(row))
+	for col, value := range row {
+		copied[col] = value
+	}
+	return copied
+}
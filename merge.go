@@ -0,0 +1,292 @@
+package MyDb
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// MergePolicy tells Merge what to do with a table or a row of the merged database that
+// the database already holds
+type MergePolicy int
+
+const (
+	MergeError     MergePolicy = iota // Stop the merge with an error
+	MergeSkip                         // Keep the table or the row of the database
+	MergeOverwrite                    // Replace the table or the row of the database by the merged one
+	MergeRows                         // Insert the rows of the merged table into the table of the same name, for tables only
+)
+
+// MergeOptions tells Merge which tables to merge and how to resolve conflicts
+type MergeOptions struct {
+	Tables         []string    // Tables of the other database to merge, every table when empty
+	ExistingTables MergePolicy // What to do with the tables the database already holds, MergeError by default
+	DuplicateKeys  MergePolicy // What to do with merged rows whose primary key a row of the table holds, with MergeRows, MergeError by default
+}
+
+// tableCopy is the schema and the rows of a table, from which to create a copy of it
+type tableCopy struct {
+	schema savedTable
+	rows   []map[string]string
+}
+
+// Merge copies tables and their rows from another database, e.g. to consolidate the
+// databases of several tenants. The tables the database does not hold are created with
+// the columns, constraints, indexes and foreign keys they have in the other database.
+// ExistingTables tells what to do with the others: stop, keep them, replace them, or
+// insert the merged rows into them, DuplicateKeys then telling what to do with the rows
+// whose primary key is taken. Inserted rows keep the values of their timestamp columns,
+// and generated columns are computed again. The other database is snapshotted first,
+// and the tables merged before an error are kept
+func (db *Database) Merge(other *Database, opts MergeOptions) error {
+	if opts.ExistingTables < MergeError || opts.ExistingTables > MergeRows {
+		return fmt.Errorf("unknown merge policy %d", opts.ExistingTables)
+	}
+	if opts.DuplicateKeys < MergeError || opts.DuplicateKeys > MergeOverwrite {
+		return fmt.Errorf("unknown merge policy %d for duplicate keys", opts.DuplicateKeys)
+	}
+	copies, err := other.copyTables(opts.Tables...)
+	if err != nil {
+		return err
+	}
+	order := referencedFirst(copies)
+
+	// Sort out the tables to create and those to insert rows into
+	var merged []string
+	db.mu.RLock()
+	for _, tableName := range order {
+		if _, exists := db.Tables[tableName]; !exists {
+			continue
+		}
+		switch opts.ExistingTables {
+		case MergeError:
+			db.mu.RUnlock()
+			return fmt.Errorf("table %s already exists", tableName)
+		case MergeSkip:
+			delete(copies, tableName)
+		case MergeRows:
+			merged = append(merged, tableName)
+		}
+	}
+	db.mu.RUnlock()
+	rows := make(map[string][]map[string]string, len(merged))
+	for _, tableName := range merged {
+		rows[tableName] = copies[tableName].rows
+		delete(copies, tableName)
+	}
+
+	// Foreign keys to tables that are not created are added once the rows are merged, or
+	// failed to be
+	foreignKeys, err := db.createCopies(copies, opts.ExistingTables == MergeOverwrite)
+	if err != nil {
+		return err
+	}
+	for _, tableName := range merged {
+		if err = db.mergeRows(tableName, rows[tableName], opts.DuplicateKeys); err != nil {
+			break
+		}
+	}
+	if fkErr := db.addForeignKeys(foreignKeys); err == nil {
+		err = fkErr
+	}
+	return err
+}
+
+// copyTables snapshots the schemas and the rows of tables at once, every table when no
+// name is given, which copies no rows
+func (db *Database) copyTables(names ...string) (map[string]tableCopy, error) {
+	copies := make(map[string]tableCopy)
+	err := db.readTables(names, func(tableName string, table *Table) {
+		copies[tableName] = tableCopy{schema: table.schema(), rows: table.snapshot()}
+	})
+	return copies, err
+}
+
+// referencedFirst returns the names of copied tables ordered so that the tables their
+// foreign keys reference come first, as far as cycles allow, and by name otherwise
+func referencedFirst(copies map[string]tableCopy) []string {
+	names := slices.Sorted(maps.Keys(copies))
+	order := make([]string, 0, len(names))
+	done := make(map[string]bool, len(names))
+	var visit func(tableName string)
+	visit = func(tableName string) {
+		if done[tableName] {
+			return
+		}
+		done[tableName] = true // Before the referenced tables, which breaks cycles
+		for _, fk := range copies[tableName].schema.ForeignKeys {
+			if _, copied := copies[fk.RefTable]; copied {
+				visit(fk.RefTable)
+			}
+		}
+		order = append(order, tableName)
+	}
+	for _, tableName := range names {
+		visit(tableName)
+	}
+	return order
+}
+
+// tableForeignKey is a foreign key of a table
+type tableForeignKey struct {
+	tableName string
+	fk        ForeignKey
+}
+
+// createCopies creates tables with the schemas and the rows of copies, replacing the
+// tables of the same names when replace is set. It returns the foreign keys of the
+// copies referencing tables that are not copied, which are left to add with
+// addForeignKeys
+func (db *Database) createCopies(copies map[string]tableCopy, replace bool) ([]tableForeignKey, error) {
+	if len(copies) == 0 {
+		return nil, nil
+	}
+	var outside []tableForeignKey
+	schema := &savedSchema{Tables: make(map[string]savedTable, len(copies))}
+	loaded := make(map[string]*Table, len(copies))
+	for tableName, c := range copies {
+		saved := c.schema
+		saved.ForeignKeys = nil
+		for _, fk := range c.schema.ForeignKeys {
+			if _, copied := copies[fk.RefTable]; copied {
+				saved.ForeignKeys = append(saved.ForeignKeys, fk)
+			} else {
+				outside = append(outside, tableForeignKey{tableName, fk})
+			}
+		}
+		schema.Tables[tableName] = saved
+		// The rows slice is cloned so that replacing rows of the copy leaves the original alone
+		loaded[tableName] = &Table{Rows: slices.Clone(c.rows)}
+	}
+	tables, err := db.applySchema(schema, loaded)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	for _, tableName := range slices.Sorted(maps.Keys(tables)) {
+		if _, exists := db.Tables[tableName]; exists {
+			if !replace {
+				err = fmt.Errorf("table %s already exists", tableName)
+			} else {
+				err = db.dropTable(tableName)
+			}
+			if err != nil {
+				break
+			}
+		}
+		delete(db.dropped, tableName)
+		db.Tables[tableName] = tables[tableName]
+	}
+	if ddlErr := db.checkpointDDL(); err == nil {
+		err = ddlErr
+	}
+	db.mu.Unlock()
+	return outside, err
+}
+
+// addForeignKeys adds foreign keys to tables, stopping at the first that fails
+func (db *Database) addForeignKeys(foreignKeys []tableForeignKey) error {
+	for _, key := range foreignKeys {
+		if err := db.AddForeignKey(key.tableName, key.fk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeRows inserts merged rows into a table batch by batch, resolving the rows whose
+// primary key a row of the table holds as the policy tells
+func (db *Database) mergeRows(tableName string, rows []map[string]string, policy MergePolicy) error {
+	for len(rows) > 0 {
+		batch := rows[:min(DefaultImportBatch, len(rows))]
+		rows = rows[len(batch):]
+		fresh, taken, err := db.sortMerged(tableName, batch, policy)
+		if err != nil {
+			return err
+		}
+		if len(fresh) > 0 {
+			if _, _, err := db.insertRows(tableName, fresh, true); err != nil {
+				return err
+			}
+		}
+		for _, t := range taken {
+			condition := func(row map[string]string) bool {
+				return matchConditions(row, t.key)
+			}
+			if _, err := db.updateRows(context.Background(), nil, tableName, t.key, condition, t.data, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// takenRow is a merged row whose primary key a row of the table holds, with the values
+// of the key and the changes that overwrite the row
+type takenRow struct {
+	key  map[string]string
+	data map[string]string
+}
+
+// sortMerged prepares merged rows for a table, leaving out its generated columns, and
+// returns the rows whose primary key is free and, with MergeOverwrite, those whose key a
+// row of the table holds. With MergeError such a row is an error, with MergeSkip it is
+// left out
+func (db *Database) sortMerged(tableName string, rows []map[string]string, policy MergePolicy) ([]map[string]string, []takenRow, error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		return nil, nil, err
+	}
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+
+	var fresh []map[string]string
+	var taken []takenRow
+	for _, row := range rows {
+		if len(table.generated) > 0 {
+			row = copyRow(row)
+			for col := range table.generated {
+				delete(row, col)
+			}
+		}
+		var existing map[string]string
+		if table.primaryKey != nil {
+			if key, ok := table.primaryKey.key(row); ok {
+				existing = table.primaryKey.rows[key]
+			}
+		}
+		switch {
+		case existing == nil:
+			fresh = append(fresh, row)
+		case policy == MergeError:
+			return nil, nil, fmt.Errorf("table %s already holds a row with %s", tableName, table.primaryKey.describe(row))
+		case policy == MergeOverwrite:
+			// Columns the merged row does not set become NULL, timestamps are kept up to date
+			t := takenRow{key: make(map[string]string), data: make(map[string]string)}
+			for _, col := range table.primaryKey.columns {
+				t.key[col] = existing[col]
+			}
+			for _, col := range table.Columns {
+				def := table.columnDef(col)
+				if _, generated := table.generated[col]; generated || def.CreatedAt || def.UpdatedAt {
+					continue
+				}
+				t.data[col] = Null
+			}
+			for col, value := range row {
+				if def := table.columnDef(col); !def.CreatedAt && !def.UpdatedAt {
+					t.data[col] = value
+				}
+			}
+			taken = append(taken, t)
+		}
+	}
+	return fresh, taken, nil
+}
@@ -0,0 +1,92 @@
+package MyDb
+
+import (
+	"strings"
+)
+
+// Null is the value that stands for NULL in the row maps given to InsertInto,
+// UpdateData and the other write methods. Stored rows have no key for their NULL
+// columns, so row[col] reads as "" and "_, ok := row[col]" tells NULL apart from
+// an empty string
+const Null = "\x00NULL"
+
+// csvNull marks a NULL value in a CSV file
+const csvNull = `\N`
+
+// applyChanges sets the changed values of a row, removing the columns set to Null
+func applyChanges(row, changes map[string]string) {
+	for col, value := range changes {
+		if value == Null {
+			delete(row, col)
+		} else {
+			row[col] = value
+		}
+	}
+}
+
+// removeNulls deletes the columns of a row that are set to Null
+func removeNulls(row map[string]string) map[string]string {
+	for col, value := range row {
+		if value == Null {
+			delete(row, col)
+		}
+	}
+	return row
+}
+
+// encodeCSVValue returns the CSV field of a column of a row. NULL is written as \N
+// and a leading backslash of a value is doubled so that values never read back as NULL
+func encodeCSVValue(row map[string]string, col string) string {
+	value, ok := row[col]
+	if !ok {
+		return csvNull
+	}
+	if strings.HasPrefix(value, `\`) {
+		return `\` + value
+	}
+	return value
+}
+
+// decodeCSVValue sets a column of a row from a CSV field written by encodeCSVValue
+func decodeCSVValue(row map[string]string, col, field string) {
+	switch {
+	case field == csvNull:
+		// NULL columns have no key
+	case strings.HasPrefix(field, `\`):
+		row[col] = field[1:]
+	default:
+		row[col] = field
+	}
+}
+
+// isNullExpr tests whether a value is NULL
+type isNullExpr struct {
+	inner expr
+	not   bool
+}
+
+func (e *isNullExpr) eval(row map[string]string) (string, error) {
+	value, err := e.inner.eval(row)
+	if err != nil {
+		return "", err
+	}
+	return boolString((value == Null) != e.not), nil
+}
+
+// coalesceExpr returns the first of its arguments that is not NULL
+type coalesceExpr struct {
+	args []expr
+}
+
+func (e *coalesceExpr) eval(row map[string]string) (string, error) {
+	for _, arg := range e.args {
+		value, err := arg.eval(row)
+		if err != nil {
+			return "", err
+		}
+		if value != Null {
+			return value, nil
+		}
+	}
+	return Null, nil
+}
@@ -0,0 +1,20 @@
+package MyDb
+
+// Option configures a database created by NewDatabase or LoadDatabase
+type Option func(db *Database)
+
+// WithPath sets the directory where the database saves its files and writes its
+// write-ahead log, which is otherwise the name of the database
+func WithPath(path string) Option {
+	return func(db *Database) {
+		db.path = path
+	}
+}
+
+// WithStorage sets where the database saves its tables and loads them from, such as an
+// S3Storage, which is otherwise a DirStorage of the database directory
+func WithStorage(storage Storage) Option {
+	return func(db *Database) {
+		db.storage = storage
+	}
+}
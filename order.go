@@ -0,0 +1,83 @@
+package MyDb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortKey describes one column of an ORDER BY clause
+type SortKey struct {
+	Column string // Column to sort by
+	Desc   bool   // Sort in descending order
+}
+
+// SearchRowsSorted searches for rows matching the condition and returns them ordered by the given keys
+func (db *Database) SearchRowsSorted(tableName string, condition func(row map[string]string) bool, keys []SortKey) ([]map[string]string, error) {
+	columns, err := db.tableColumns(tableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if !contains(columns, key.Column) {
+			return nil, fmt.Errorf("column %s does not exist in table %s", key.Column, tableName)
+		}
+	}
+
+	rows, err := db.SearchRows(tableName, condition)
+	if err != nil {
+		return nil, err
+	}
+	SortRows(rows, keys)
+	return rows, nil
+}
+
+// SortRows sorts rows in place by the given keys, comparing numerically when both values are numbers
+func SortRows(rows []map[string]string, keys []SortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, key := range keys {
+			cmp := compareValues(rows[i][key.Column], rows[j][key.Column])
+			if cmp == 0 {
+				continue
+			}
+			if key.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// pageRows returns the rows between offset and offset+limit (a negative limit keeps all remaining rows)
+func pageRows(rows []map[string]string, offset, limit int) []map[string]string {
+	if offset >= len(rows) {
+		return nil
+	}
+	rows = rows[offset:]
+	if limit >= 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// compareValues compares two values numerically when both parse as numbers and lexicographically otherwise
+func compareValues(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
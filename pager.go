@@ -0,0 +1,207 @@
+package MyDb
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// MemoryLimit bounds the rows that a database holds in memory, see WithMemoryLimit
+type MemoryLimit struct {
+	Rows    int             // Most rows held in memory across the tables, 0 for no limit
+	OnError func(err error) // Called with the errors of the evictions, which no read or write returns
+}
+
+// pager evicts the tables used the least recently from memory once the database holds
+// more rows than its limit, and loads them back from the storage when they are used
+type pager struct {
+	limit   MemoryLimit
+	evict   func() error   // Evicts tables past the limit, set by WithMemoryLimit
+	clock   atomic.Int64   // Ticks on each use of a table, ordering the uses
+	rows    atomic.Int64   // Rows in memory as last counted, plus those loaded and inserted since
+	running atomic.Bool    // Whether an eviction is running
+	done    sync.WaitGroup // Waits for the running eviction
+}
+
+// WithMemoryLimit makes the database hold at most limit.Rows rows in memory, so that its
+// tables together may hold more data than fits in RAM. Load reads the header of each
+// table only, and a table is loaded from the storage the first time a read or a write
+// uses it. Once the tables in memory hold more rows than the limit, a goroutine evicts
+// those used the least recently, dropping their rows and the entries of their indexes,
+// until the others hold no more than the limit. The table used last is kept even when it
+// holds more on its own, as tables are loaded and evicted whole: each table must fit in
+// memory by itself. Evicting a table changed since the last save saves the database
+// first, as Save does. Operations reading every table, such as Snapshot, Backup, Dump and
+// Vacuum, load the evicted tables back until the next eviction. Rows of an evicted table
+// are nil, so its rows must be read through the database rather than its Rows field
+func WithMemoryLimit(limit MemoryLimit) Option {
+	return func(db *Database) {
+		db.pager.limit = limit
+		db.pager.evict = db.evictTables
+	}
+}
+
+// use marks a table as used and loads its rows back if they were evicted. The db lock
+// must be held, for reading at least, but not the table lock: the rows stay in memory
+// until the db lock is released, as evictions hold it for writing
+func (db *Database) use(tableName string, table *Table) error {
+	table.used.Store(db.pager.clock.Add(1))
+	loaded, err := db.loadEvicted(tableName, table)
+	if err != nil {
+		return err
+	}
+	db.pager.grow(loaded)
+	return nil
+}
+
+// useAll loads every evicted table back, for the operations reading every table. The db
+// lock must be held, for reading at least, but no table lock
+func (db *Database) useAll() error {
+	for tableName, table := range db.Tables {
+		loaded, err := db.loadEvicted(tableName, table)
+		if err != nil {
+			return err
+		}
+		db.pager.grow(loaded)
+	}
+	return nil
+}
+
+// loadEvicted loads the rows of an evicted table back from the data it was evicted to,
+// rebuilding its indexes, and returns how many it loaded. The table lock must not be held
+func (db *Database) loadEvicted(tableName string, table *Table) (int, error) {
+	if table.evicted.Load() == nil {
+		return 0, nil
+	}
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	source := table.evicted.Load()
+	if source == nil {
+		return 0, nil // Loaded meanwhile
+	}
+
+	loaded, err := source.selectTable(tableName, table.dialect)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load table %s: %w", tableName, err)
+	}
+	table.Rows = loaded.Rows
+	if table.Rows == nil {
+		table.Rows = []map[string]string{}
+	}
+	if err := table.rebuildIndexes(tableName); err != nil {
+		table.dropRows()
+		return 0, fmt.Errorf("failed to load table %s: %w", tableName, err)
+	}
+	dirty := table.dirty
+	table.markSaved()
+	table.dirty = dirty // Still to be rewritten if marked so while evicted
+	table.walSeq, table.logToken, table.logged = loaded.walSeq, loaded.logToken, loaded.logged
+	table.evicted.Store(nil)
+	return len(table.Rows), nil
+}
+
+// grow counts rows added to memory, starting an eviction once they pass the limit
+func (p *pager) grow(rows int) {
+	if p.limit.Rows == 0 || rows <= 0 || p.rows.Add(int64(rows)) <= int64(p.limit.Rows) {
+		return
+	}
+	if !p.running.CompareAndSwap(false, true) {
+		return
+	}
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+		defer p.running.Store(false)
+		if err := p.evict(); err != nil && p.limit.OnError != nil {
+			p.limit.OnError(err)
+		}
+	}()
+}
+
+// evictTables evicts the tables used the least recently until the others hold no more
+// rows than the limit, keeping the table used last. When one of them changed since the
+// last save, the database is saved first
+func (db *Database) evictTables() error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	type resident struct {
+		name    string
+		table   *Table
+		rows    int
+		changed bool
+	}
+	var tables []resident
+	var total int
+	for tableName, table := range db.Tables {
+		if table.evicted.Load() != nil {
+			continue
+		}
+		table.mu.RLock() // Lock table second, once the writes holding it are done
+		tables = append(tables, resident{tableName, table, len(table.Rows), table.dirty || table.inserted})
+		table.mu.RUnlock()
+		total += tables[len(tables)-1].rows
+	}
+	db.pager.rows.Store(int64(total))
+	slices.SortFunc(tables, func(a, b resident) int {
+		return cmp.Compare(a.table.used.Load(), b.table.used.Load())
+	})
+
+	var victims []resident
+	changed := db.savedTo != db.dir()
+	for _, r := range tables[:max(len(tables)-1, 0)] {
+		if total <= db.pager.limit.Rows {
+			break
+		}
+		victims = append(victims, r)
+		total -= r.rows
+		changed = changed || r.changed
+	}
+	if len(victims) == 0 {
+		return nil
+	}
+	if changed {
+		if err := db.saveLocked(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	source := db.source()
+	for _, r := range victims {
+		r.table.mu.Lock()
+		r.table.dropRows()
+		r.table.evicted.Store(source)
+		r.table.mu.Unlock()
+		db.pager.rows.Add(-int64(r.rows))
+	}
+	return nil
+}
+
+// dropRows drops the rows of the table and the entries of its indexes. The table lock
+// must be held
+func (t *Table) dropRows() {
+	t.Rows, t.positions = nil, nil
+	t.shared.Store(false)
+	for _, ix := range t.uniqueIndexes() {
+		ix.rows = make(map[string]map[string]string)
+	}
+	for _, ix := range t.indexes {
+		ix.build(nil, nil)
+	}
+	for _, ix := range t.fullText {
+		ix.build(nil)
+	}
+	for _, ix := range t.fuzzy {
+		ix.build(nil)
+	}
+}
+
+// source returns a database reading the saved data of this one, with its storage and the
+// settings decoding the data, which evicted tables are loaded back from. The db lock must
+// be held, or Load running
+func (db *Database) source() *Database {
+	return &Database{Name: db.Name, path: db.path, storage: db.store(), codec: db.codec, crypter: db.crypter}
+}
@@ -0,0 +1,246 @@
+package MyDb
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pagerTestDB returns a database in a temporary directory holding the tables a, b and c
+// of 100 rows each, with an index, created and filled in that order
+func pagerTestDB(t *testing.T, options ...Option) *Database {
+	t.Helper()
+	db := NewDatabase("pager_test", append([]Option{WithPath(t.TempDir())}, options...)...)
+	for _, name := range []string{"a", "b", "c"} {
+		values := make([]string, 100)
+		for i := range values {
+			values[i] = fmt.Sprintf("(%d, '%s%d', %d)", i, name, i, i%10)
+		}
+		for _, command := range []string{
+			fmt.Sprintf("create table %s (id int primary key, name, grp int)", name),
+			fmt.Sprintf("create index on %s (grp)", name),
+			fmt.Sprintf("insert into %s values %s", name, strings.Join(values, ", ")),
+		} {
+			if _, err := db.Query(command); err != nil {
+				t.Fatalf("%s: %v", command, err)
+			}
+		}
+	}
+	db.pager.done.Wait()
+	return db
+}
+
+// evictedTables returns the names of the tables of a database evicted from memory, once
+// the running eviction is done
+func evictedTables(db *Database) []string {
+	db.pager.done.Wait()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var names []string
+	for name, table := range db.Tables {
+		if table.evicted.Load() != nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// pagerTestQuery runs queries and returns their rows
+func pagerTestQuery(t *testing.T, db *Database, queries ...string) [][]map[string]string {
+	t.Helper()
+	var rows [][]map[string]string
+	for _, query := range queries {
+		res, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		rows = append(rows, res.Rows)
+	}
+	return rows
+}
+
+// TestMemoryLimit checks that the tables used the least recently are evicted once the
+// rows in memory pass the limit, and that they are loaded back with their indexes and
+// their changes when used again
+func TestMemoryLimit(t *testing.T) {
+	var errs []error
+	db := pagerTestDB(t, WithMemoryLimit(MemoryLimit{Rows: 150, OnError: func(err error) { errs = append(errs, err) }}))
+	unlimited := pagerTestDB(t)
+
+	if got, want := evictedTables(db), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("evicted tables %v, want %v", got, want)
+	}
+	if rows := db.Tables["a"].Rows; rows != nil {
+		t.Errorf("evicted table holds %d rows", len(rows))
+	}
+
+	steps := []struct {
+		command string
+		evicted []string
+	}{
+		{"get from a where grp = 3", []string{"b", "c"}},
+		{"update b set name = 'changed' where id < 50", []string{"a", "c"}},
+		{"delete from c where grp = 1", []string{"a", "b"}},
+		{"insert into a values (100, 'new', 0)", []string{"b", "c"}},
+		{"get from b where id = 7", []string{"a", "c"}},
+	}
+	queries := []string{
+		"get from a where grp = 0 order by id",
+		"get from b where name = 'changed' order by id",
+		"get from c order by id",
+		"get from a where id = 100",
+	}
+	for _, step := range steps {
+		got := pagerTestQuery(t, db, step.command)
+		want := pagerTestQuery(t, unlimited, step.command)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s returned %v, want %v", step.command, got, want)
+		}
+		if got := evictedTables(db); !reflect.DeepEqual(got, step.evicted) {
+			t.Errorf("after %s evicted tables %v, want %v", step.command, got, step.evicted)
+		}
+	}
+	for _, query := range queries {
+		if got, want := pagerTestQuery(t, db, query), pagerTestQuery(t, unlimited, query); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s returned %v, want %v", query, got, want)
+		}
+	}
+	if explain := pagerTestQuery(t, db, "explain get from a where id = 5")[0]; !strings.Contains(fmt.Sprint(explain), "primary key") {
+		t.Errorf("a loaded back is not read through its primary key: %v", explain)
+	}
+	if errs != nil {
+		t.Errorf("evictions failed: %v", errs)
+	}
+}
+
+// TestMemoryLimitLoad checks that Load with a memory limit reads no rows, that the tables
+// are loaded once used, and that the write-ahead log is replayed into the tables it changes
+func TestMemoryLimitLoad(t *testing.T) {
+	db := pagerTestDB(t)
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetWAL(true); err != nil {
+		t.Fatal(err)
+	}
+	defer db.SetWAL(false)
+	pagerTestQuery(t, db, "update c set name = 'logged' where grp = 2")
+
+	loaded, err := LoadDatabase("pager_test", WithPath(db.dir()), WithMemoryLimit(MemoryLimit{Rows: 150}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := evictedTables(loaded), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("evicted tables after Load %v, want %v", got, want)
+	}
+	for _, query := range []string{
+		"get from c where name = 'logged' order by id",
+		"get from b where grp = 4 order by id",
+		"get from a order by id",
+	} {
+		if got, want := pagerTestQuery(t, loaded, query), pagerTestQuery(t, db, query); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s returned %v, want %v", query, got, want)
+		}
+	}
+	if got, want := evictedTables(loaded), []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("evicted tables after the reads %v, want %v", got, want)
+	}
+}
+
+// TestMemoryLimitWholeDatabase checks that the operations reading or rewriting every
+// table see the rows of the evicted ones
+func TestMemoryLimitWholeDatabase(t *testing.T) {
+	db := pagerTestDB(t, WithMemoryLimit(MemoryLimit{Rows: 150}))
+	unlimited := pagerTestDB(t)
+	queries := []string{"get from a order by id", "get from b order by id", "get from c order by id"}
+
+	var got, want bytes.Buffer
+	if err := db.Dump(&got); err != nil {
+		t.Fatal(err)
+	}
+	if err := unlimited.Dump(&want); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("dump of evicted tables differs:\n%s\nwant\n%s", got.String(), want.String())
+	}
+
+	evictedTables(db)
+	snap := db.Snapshot()
+	pagerTestQuery(t, db, "delete from a", "delete from b", "delete from c")
+	for _, query := range queries {
+		res, err := snap.Query(query)
+		if err != nil {
+			t.Fatalf("snapshot: %s: %v", query, err)
+		}
+		if want := pagerTestQuery(t, unlimited, query)[0]; !reflect.DeepEqual(res.Rows, want) {
+			t.Errorf("snapshot: %s returned %d rows, want %d", query, len(res.Rows), len(want))
+		}
+	}
+
+	// Changing the format rewrites the evicted tables, which are loaded back to be saved
+	db = pagerTestDB(t, WithMemoryLimit(MemoryLimit{Rows: 150}))
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	evictedTables(db)
+	if err := db.SetFormat(Gob); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RenameTable("a", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDatabase("pager_test", WithPath(db.dir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{"get from renamed order by id", "get from b order by id", "get from c order by id"} {
+		wantQuery := strings.Replace(query, "renamed", "a", 1)
+		if got, want := pagerTestQuery(t, loaded, query), pagerTestQuery(t, unlimited, wantQuery); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s after a save in Gob returned %d rows, want %d", query, len(got[0]), len(want[0]))
+		}
+	}
+}
+
+// TestMemoryLimitConcurrent checks that reads and writes running while tables are
+// evicted and loaded back lose no row
+func TestMemoryLimitConcurrent(t *testing.T) {
+	db := pagerTestDB(t, WithMemoryLimit(MemoryLimit{Rows: 150}))
+	done := make(chan error)
+	for _, name := range []string{"a", "b", "c"} {
+		go func() {
+			for i := 100; i < 150; i++ {
+				if _, err := db.Query(fmt.Sprintf("insert into %s values (%d, 'x', %d)", name, i, i%10)); err != nil {
+					done <- err
+					return
+				}
+				res, err := db.Query(fmt.Sprintf("get from %s where grp = %d", name, i%10))
+				if err == nil && len(res.Rows) != 10+(i-100)/10+1 {
+					err = fmt.Errorf("%s has %d rows in group %d after %d inserts", name, len(res.Rows), i%10, i-99)
+				}
+				if err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for range 3 {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if rows := pagerTestQuery(t, db, "get from "+name)[0]; len(rows) != 150 {
+			t.Errorf("%s holds %d rows, want 150", name, len(rows))
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package MyDb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parser is a recursive descent parser over the tokens of a command
+type parser struct {
+	input      string // Command being parsed
+	tokens     []token
+	pos        int
+	db         *Database             // Database used to resolve table columns
+	tables     []sourceTable         // Tables the command reads from
+	columns    map[string]string     // Visible column names mapped to row keys, "" when ambiguous
+	types      map[string]ColumnType // Types of the visible columns by row key
+	subqueries []*inExpr             // Subqueries of the statement being parsed
+	tx         *Tx                   // Transaction the command runs in, nil outside of one
+	ctx        context.Context       // Context of the command, whose scans stop once it is done
+	restoring  bool                  // Whether the command is run by Restore, whose inserts set timestamp columns
+	aggregates *[]*aggregateExpr     // Aggregates of the SELECT column list being parsed, nil where aggregates are not allowed
+}
+
+// sourceTable is a table referenced by a command
+type sourceTable struct {
+	name    string      // Table name
+	alias   string      // Name given to the table in the command, empty when there is none
+	columns []ColumnDef // Columns of the table
+}
+
+// qualifier returns the name that qualifies the columns of the table
+func (t sourceTable) qualifier() string {
+	if t.alias != "" {
+		return t.alias
+	}
+	return t.name
+}
+
+// reservedWords are keywords that can follow a table or column and are never taken as an alias
+var reservedWords = map[string]bool{
+	"from": true, "where": true, "join": true, "inner": true, "left": true, "right": true,
+	"outer": true, "on": true, "order": true, "limit": true, "offset": true, "union": true,
+	"set": true, "returning": true, "as": true, "and": true, "or": true, "not": true,
+	"for": true, "group": true,
+}
+
+// newParser tokenizes a command and returns a parser positioned at its first token
+func newParser(db *Database, command string) (*parser, error) {
+	tokens, err := tokenize(command)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{input: command, tokens: tokens, db: db, ctx: context.Background()}, nil
+}
+
+// peek returns the current token without consuming it
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the current token
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the current token if it is the given keyword or symbol
+func (p *parser) accept(text string) bool {
+	if p.peek().is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expect consumes the given keyword or symbol or returns an error
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+// expectEOF returns an error if any tokens are left
+func (p *parser) expectEOF() error {
+	if p.peek().kind != tokenEOF {
+		return p.unexpected()
+	}
+	return nil
+}
+
+// unexpected returns an error describing the current token
+func (p *parser) unexpected() error {
+	tok := p.peek()
+	if tok.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of input")
+	}
+	return fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// skipTo advances to the next occurrence of a keyword outside parentheses
+func (p *parser) skipTo(keyword string) error {
+	depth := 0
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokenEOF:
+			return fmt.Errorf("missing %s", strings.ToUpper(keyword))
+		case depth == 0 && tok.is(keyword):
+			return nil
+		case tok.is("("):
+			depth++
+		case tok.is(")"):
+			depth--
+		}
+		p.next()
+	}
+}
+
+// parseName parses a table or column name
+func (p *parser) parseName() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokenWord {
+		return "", p.unexpected()
+	}
+	p.next()
+	return tok.text, nil
+}
+
+// parseNameList parses a parenthesized list of distinct names
+func (p *parser) parseNameList() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		if contains(names, name) {
+			return nil, fmt.Errorf("column %s is listed more than once", name)
+		}
+		names = append(names, name)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return names, p.expect(")")
+}
+
+// parseParenthesized parses a parenthesized expression without interpreting it and
+// returns its source text, e.g. the condition of CHECK (age > 0)
+func (p *parser) parseParenthesized() (string, error) {
+	if err := p.expect("("); err != nil {
+		return "", err
+	}
+	start := p.peek().pos
+	for depth := 0; ; p.next() {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokenEOF:
+			return "", p.unexpected()
+		case tok.is("("):
+			depth++
+		case tok.is(")") && depth > 0:
+			depth--
+		case tok.is(")"):
+			text := strings.TrimSpace(p.input[start:tok.pos])
+			p.next()
+			if text == "" {
+				return "", fmt.Errorf("empty expression at position %d", tok.pos)
+			}
+			return text, nil
+		}
+	}
+}
+
+// parseInt parses a non-negative integer literal
+func (p *parser) parseInt() (int, error) {
+	tok := p.peek()
+	n, err := strconv.Atoi(tok.text)
+	if tok.kind != tokenNumber || err != nil || n < 0 {
+		return 0, p.unexpected()
+	}
+	p.next()
+	return n, nil
+}
+
+// parseAlias parses an optional "[AS] alias" following a table or column and
+// returns the alias, or an empty string when there is none
+func (p *parser) parseAlias() (string, error) {
+	if p.accept("as") {
+		return p.parseName()
+	}
+	tok := p.peek()
+	if tok.kind == tokenWord && !reservedWords[strings.ToLower(tok.text)] {
+		p.next()
+		return tok.text, nil
+	}
+	return "", nil
+}
+
+// useTable resolves bare words in expressions against the columns of the specified
+// table, which can be given an alias
+func (p *parser) useTable(tableName, alias string) error {
+	p.tables = nil
+	return p.addTable(tableName, alias)
+}
+
+// addTable makes the columns of another table visible to expressions. Once several
+// tables are in use, row keys are qualified as "table.column", or "alias.column"
+// for a table with an alias
+func (p *parser) addTable(tableName, alias string) error {
+	columns, err := p.db.tableDefs(tableName)
+	if err != nil {
+		return err
+	}
+	return p.addSource(sourceTable{name: tableName, alias: alias, columns: columns})
+}
+
+// useColumns is like useTable for a table with the given columns, which need not exist yet
+func (p *parser) useColumns(tableName string, columns []ColumnDef) error {
+	p.tables = nil
+	return p.addSource(sourceTable{name: tableName, columns: columns})
+}
+
+// addSource makes the columns of a table visible to expressions, see addTable
+func (p *parser) addSource(table sourceTable) error {
+	for _, t := range p.tables {
+		if t.qualifier() == table.qualifier() {
+			return fmt.Errorf("table %s is referenced more than once", table.qualifier())
+		}
+	}
+	p.tables = append(p.tables, table)
+
+	p.columns = make(map[string]string)
+	p.types = make(map[string]ColumnType)
+	qualified := len(p.tables) > 1
+	for _, t := range p.tables {
+		for _, def := range t.columns {
+			col := def.Name
+			key := col
+			if qualified {
+				key = t.qualifier() + "." + col
+			}
+			p.types[key] = def.Type
+			p.columns[t.qualifier()+"."+col] = key
+			if existing, ok := p.columns[col]; ok && existing != key {
+				p.columns[col] = "" // Ambiguous between tables
+			} else {
+				p.columns[col] = key
+			}
+		}
+	}
+	return nil
+}
+
+// sourceColumns returns the row keys of every column visible to the command, in table order
+func (p *parser) sourceColumns() []string {
+	var columns []string
+	for _, t := range p.tables {
+		for _, def := range t.columns {
+			columns = append(columns, p.columns[t.qualifier()+"."+def.Name])
+		}
+	}
+	return columns
+}
+
+// lookupColumn returns the row key of a column name, reporting whether the name is a known column
+func (p *parser) lookupColumn(name string) (string, bool, error) {
+	if p.columns == nil {
+		return name, true, nil
+	}
+	key, ok := p.columns[name]
+	if !ok {
+		return "", false, nil
+	}
+	if key == "" {
+		return "", false, fmt.Errorf("column name %s is ambiguous", name)
+	}
+	return key, true, nil
+}
+
+// parseColumn parses a name that must refer to a known column and returns its row key
+func (p *parser) parseColumn() (string, error) {
+	tok := p.peek()
+	name, err := p.parseName()
+	if err != nil {
+		return "", err
+	}
+	key, found, err := p.lookupColumn(name)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("unknown column %s at position %d", name, tok.pos)
+	}
+	return key, nil
+}
@@ -0,0 +1,67 @@
+package MyDb
+
+import "context"
+
+// returningClause is a parsed "RETURNING col, ..." or "RETURNING *" clause
+type returningClause struct {
+	columns []string // Returned columns, nil for every column of the table
+}
+
+// DeleteReturning removes the rows of a table matching the condition and returns them.
+// A nil condition matches every row
+func (db *Database) DeleteReturning(tableName string, condition func(row map[string]string) bool) ([]Row, error) {
+	return db.deleteRows(context.Background(), nil, tableName, nil, condition, false)
+}
+
+// UpdateReturning updates the rows of a table matching the condition and returns a
+// copy of each updated row. A nil condition matches every row
+func (db *Database) UpdateReturning(tableName string, condition func(row map[string]string) bool, data map[string]string) ([]Row, error) {
+	return db.updateRows(context.Background(), nil, tableName, nil, condition, data, false)
+}
+
+// parseReturning parses an optional RETURNING clause
+func (p *parser) parseReturning() (*returningClause, error) {
+	if !p.accept("returning") {
+		return nil, nil
+	}
+	clause := &returningClause{}
+	if p.accept("*") {
+		return clause, nil
+	}
+	for {
+		col, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		clause.columns = append(clause.columns, col)
+		if !p.accept(",") {
+			return clause, nil
+		}
+	}
+}
+
+// returningColumns returns the columns returned by a RETURNING clause, checking that they exist
+func (db *Database) returningColumns(tableName string, clause *returningClause) ([]string, error) {
+	if clause == nil {
+		return nil, nil
+	}
+	tableColumns, err := db.tableColumns(tableName)
+	if err != nil {
+		return nil, err
+	}
+	return clause.resolve(tableName, tableColumns)
+}
+
+// resolve returns the returned columns of a table, or nil for a nil clause
+func (c *returningClause) resolve(tableName string, tableColumns []string) ([]string, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.columns == nil {
+		return tableColumns, nil
+	}
+	if err := checkColumns(tableName, tableColumns, c.columns); err != nil {
+		return nil, err
+	}
+	return c.columns, nil
+}
@@ -0,0 +1,235 @@
+package MyDb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// S3Config describes a bucket of an S3-compatible object store, such as Amazon S3, Google
+// Cloud Storage through its XML API with HMAC keys, or MinIO
+type S3Config struct {
+	Endpoint     string       // URL of the service, e.g. "https://s3.eu-west-1.amazonaws.com" or "https://storage.googleapis.com"
+	Region       string       // Region of the bucket, "us-east-1" when empty, which GCS and MinIO accept
+	Bucket       string       // Name of the bucket
+	Prefix       string       // Prefix of the keys of the objects, e.g. "myapp/db/"
+	AccessKey    string       // Access key id
+	SecretKey    string       // Secret access key
+	SessionToken string       // Token of temporary credentials, empty for long-term ones
+	Client       *http.Client // Client making the requests, http.DefaultClient when nil
+}
+
+// S3Storage stores the database in a bucket of an S3-compatible object store, the schema
+// in the object <prefix>_schema.json and each table in the object <prefix>tables/<name>,
+// so that containers without durable disks can keep their databases. Each save of a
+// table replaces its object at once, as objects are never partly written
+type S3Storage struct {
+	config S3Config
+}
+
+// NewS3Storage returns a storage of a bucket of an S3-compatible object store
+func NewS3Storage(config S3Config) *S3Storage {
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &S3Storage{config: config}
+}
+
+// ListTables returns the names of the table objects of the bucket
+func (s *S3Storage) ListTables() ([]string, error) {
+	prefix := s.config.Prefix + "tables/"
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		body, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := xml.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("invalid object list of bucket %s: %w", s.config.Bucket, err)
+		}
+		for _, object := range list.Contents {
+			if name := strings.TrimPrefix(object.Key, prefix); !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+		if !list.IsTruncated {
+			return names, nil
+		}
+		token = list.NextContinuationToken
+	}
+}
+
+// LoadTable downloads the object of a table
+func (s *S3Storage) LoadTable(name string) (io.ReadCloser, error) {
+	return s.get("tables/" + name)
+}
+
+// SaveTable uploads the object of a table
+func (s *S3Storage) SaveTable(name string, write func(w io.Writer) error) error {
+	return s.put("tables/"+name, write)
+}
+
+// DeleteTable deletes the object of a table
+func (s *S3Storage) DeleteTable(name string) error {
+	_, err := s.do(http.MethodDelete, s.config.Prefix+"tables/"+name, nil, nil)
+	return err
+}
+
+// LoadSchema downloads the schema object
+func (s *S3Storage) LoadSchema() (io.ReadCloser, error) {
+	return s.get(schemaFile)
+}
+
+// SaveSchema uploads the schema object
+func (s *S3Storage) SaveSchema(write func(w io.Writer) error) error {
+	return s.put(schemaFile, write)
+}
+
+// get downloads an object, failing with fs.ErrNotExist when there is none
+func (s *S3Storage) get(key string) (io.ReadCloser, error) {
+	body, err := s.do(http.MethodGet, s.config.Prefix+key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(body)), nil
+}
+
+// put uploads an object with the data that write writes
+func (s *S3Storage) put(key string, write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	_, err := s.do(http.MethodPut, s.config.Prefix+key, nil, buf.Bytes())
+	return err
+}
+
+// do sends a signed request for an object of the bucket, or for the bucket when key is
+// empty, and returns the body of the response
+func (s *S3Storage) do(method, key string, query url.Values, payload []byte) ([]byte, error) {
+	target := s.config.Endpoint + "/" + s.config.Bucket
+	if key != "" {
+		target += "/" + key
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	u.RawPath, u.RawQuery = s3EscapePath(u.Path), query.Encode() // Sent as signed
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, payload, time.Now().UTC())
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet && key != "" {
+		return nil, fmt.Errorf("object %s of bucket %s: %w", key, s.config.Bucket, fs.ErrNotExist)
+	}
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Code    string
+			Message string
+		}
+		xml.Unmarshal(body, &failure)
+		return nil, fmt.Errorf("%s %s failed: %s %s %s", method, path.Join(s.config.Bucket, key), resp.Status, failure.Code, failure.Message)
+	}
+	return body, nil
+}
+
+// sign signs a request with AWS Signature Version 4
+func (s *S3Storage) sign(req *http.Request, payload []byte, now time.Time) {
+	payloadHash := sha256.Sum256(payload)
+	date, stamp := now.Format("20060102"), now.Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", stamp)
+	req.Header.Set("x-amz-content-sha256", hex.EncodeToString(payloadHash[:]))
+	if s.config.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.config.SessionToken)
+	}
+
+	// Canonical request, with the headers sorted by name
+	headers := []string{"host"}
+	for name := range req.Header {
+		headers = append(headers, strings.ToLower(name))
+	}
+	slices.Sort(headers)
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+	canonical := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	key := []byte("AWS4" + s.config.SecretKey)
+	for _, part := range []string{date, s.config.Region, "s3", "aws4_request", toSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, hex.EncodeToString(key)))
+}
+
+// s3EscapePath escapes a path as in canonical requests, every byte but the unreserved
+// characters and slashes being percent-encoded
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
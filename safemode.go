@@ -0,0 +1,40 @@
+package MyDb
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetSafeMode turns safe mode on or off. In safe mode updates and deletes without a
+// condition are refused, unless they go through UpdateAll and DeleteAll or the
+// command says ALL, e.g. "DELETE ALL FROM users"
+func (db *Database) SetSafeMode(enabled bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.safeMode = enabled
+}
+
+// DeleteAll removes every row of a table, even in safe mode, and returns how many were removed
+func (db *Database) DeleteAll(tableName string) (int, error) {
+	deleted, err := db.deleteRows(context.Background(), nil, tableName, nil, nil, true)
+	return len(deleted), err
+}
+
+// UpdateAll updates every row of a table, even in safe mode, and returns how many were updated
+func (db *Database) UpdateAll(tableName string, data map[string]string) (int, error) {
+	updated, err := db.updateRows(context.Background(), nil, tableName, nil, nil, data, true)
+	return len(updated), err
+}
+
+// checkSafe returns the condition to apply for an update or delete, replacing a nil
+// condition with one matching every row, in the safe mode of the database when the
+// tables were locked
+func (l *tableLocks) checkSafe(action, tableName string, condition func(row map[string]string) bool, force bool) (func(row map[string]string) bool, error) {
+	if condition != nil {
+		return condition, nil
+	}
+	if l.safeMode && !force {
+		return nil, fmt.Errorf("safe mode refuses to %s every row of table %s without a condition", action, tableName)
+	}
+	return func(row map[string]string) bool { return true }, nil
+}
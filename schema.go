@@ -0,0 +1,250 @@
+package MyDb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"sort"
+)
+
+// schemaFile is the name of the file describing the tables in the database directory
+const schemaFile = "_schema.json"
+
+// savedSchema is the content of the schema file
+type savedSchema struct {
+	Strict bool                  `json:"strict,omitempty"` // Whether the database is in strict mode
+	Tables map[string]savedTable `json:"tables"`
+}
+
+// savedTable describes a table in the schema file
+type savedTable struct {
+	Columns     []ColumnDef  `json:"columns"`                // Columns in order
+	Unique      [][]string   `json:"unique,omitempty"`       // Columns of the UNIQUE constraints on several columns
+	ForeignKeys []ForeignKey `json:"foreign_keys,omitempty"` // Foreign keys referencing other tables
+	Checks      []string     `json:"checks,omitempty"`       // Conditions of the CHECK constraints
+	LastID      int64        `json:"last_id,omitempty"`      // Last value of the auto-increment column
+	Indexes     []savedIndex `json:"indexes,omitempty"`      // Indexes created with CreateIndex and CreateCompositeIndex
+	FullText    []savedIndex `json:"full_text,omitempty"`    // Indexes created with CreateFullTextIndex
+	Fuzzy       []savedIndex `json:"fuzzy,omitempty"`        // Indexes created with CreateFuzzyIndex
+	CSV         *CSVDialect  `json:"csv,omitempty"`          // Dialect of the CSV data, nil for the default one
+}
+
+// savedIndex describes an index in the schema file. Only its definition is saved, and
+// Load rebuilds it from the rows
+type savedIndex struct {
+	Name       string   `json:"name"`                 // Index name
+	Columns    []string `json:"columns"`              // Indexed columns
+	Ordered    bool     `json:"ordered,omitempty"`    // Whether the index keeps its rows sorted
+	Stemmer    string   `json:"stemmer,omitempty"`    // Stemmer of a full-text index
+	Filter     string   `json:"filter,omitempty"`     // Condition of the rows of a partial index
+	Expression string   `json:"expression,omitempty"` // Indexed expression of an expression index, which replaces its columns
+}
+
+// IndexProgress reports how many rows of a table Load has added to an index so far
+type IndexProgress func(tableName, indexName string, done, total int)
+
+// SetIndexProgress sets a function that Load calls while it rebuilds the indexes saved
+// in the schema file, every 10000 rows and once each index is complete, e.g. to show
+// progress for large tables. nil turns reporting off
+func (db *Database) SetIndexProgress(progress IndexProgress) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.progress = progress
+}
+
+// schema returns the description of the table saved in the schema file
+func (t *Table) schema() savedTable {
+	saved := savedTable{Columns: make([]ColumnDef, len(t.Columns)), ForeignKeys: t.foreignKeys, LastID: t.lastID}
+	if t.dialect != (CSVDialect{}) {
+		dialect := t.dialect
+		saved.CSV = &dialect
+	}
+	for i, col := range t.Columns {
+		saved.Columns[i] = t.columnDef(col)
+	}
+	for _, ix := range t.unique {
+		// Single-column constraints are saved as Unique columns
+		if len(ix.columns) > 1 {
+			saved.Unique = append(saved.Unique, ix.columns)
+		}
+	}
+	for _, check := range t.checks {
+		saved.Checks = append(saved.Checks, check.text)
+	}
+	for _, ix := range t.indexes {
+		index := savedIndex{Name: ix.name, Columns: ix.columns, Ordered: ix.ordered, Filter: ix.filter}
+		if ix.expression != nil {
+			index.Columns, index.Expression = ix.exprColumns, ix.columns[0]
+		}
+		saved.Indexes = append(saved.Indexes, index)
+	}
+	for _, ix := range t.fullText {
+		saved.FullText = append(saved.FullText, savedIndex{Name: ix.name, Columns: []string{ix.column}, Stemmer: ix.stemmer})
+	}
+	for _, ix := range t.fuzzy {
+		saved.Fuzzy = append(saved.Fuzzy, savedIndex{Name: ix.name, Columns: []string{ix.column}})
+	}
+	return saved
+}
+
+// saveSchema writes the schema file of the database. The db lock and the table locks must be held
+func (db *Database) saveSchema() error {
+	schema := savedSchema{Strict: db.strict, Tables: make(map[string]savedTable, len(db.Tables))}
+	for tableName, table := range db.Tables {
+		schema.Tables[tableName] = table.schema()
+	}
+	return db.writeSchema(schema)
+}
+
+// writeSchema writes a schema to the schema file
+func (db *Database) writeSchema(schema savedSchema) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // Keep conditions such as "age >= 0" readable
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(schema); err != nil {
+		return err
+	}
+	return db.store().SaveSchema(db.sealed(schemaFile, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}))
+}
+
+// dialect returns the dialect of the CSV data of a table described by the schema, which
+// may be nil
+func (s *savedSchema) dialect(tableName string) CSVDialect {
+	if s == nil || s.Tables[tableName].CSV == nil {
+		return CSVDialect{}
+	}
+	return *s.Tables[tableName].CSV
+}
+
+// readSchema reads the schema file of the database, returning nil when there is none
+func (db *Database) readSchema() (*savedSchema, error) {
+	data, err := readAll(db.store().LoadSchema)
+	if data == nil || err != nil {
+		return nil, err
+	}
+	plain, err := db.unsealed(bytes.NewReader(data), schemaFile)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = io.ReadAll(plain); err != nil {
+		return nil, err
+	}
+	var schema savedSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", schemaFile, err)
+	}
+	return &schema, nil
+}
+
+// applySchema rebuilds tables read from their CSV files with the column definitions and
+// constraints of the schema file. Constraints are checked against the loaded rows, and
+// tables missing from the schema keep the definitions of their CSV header
+func (db *Database) applySchema(schema *savedSchema, loaded map[string]*Table) (map[string]*Table, error) {
+	db.mu.Lock()
+	staging := &Database{Name: db.Name, Tables: make(map[string]*Table), stemmers: maps.Clone(db.stemmers)}
+	progress := db.progress
+	db.mu.Unlock()
+	db.funcsMu.RLock()
+	staging.funcs = maps.Clone(db.funcs)
+	db.funcsMu.RUnlock()
+
+	names := make([]string, 0, len(schema.Tables))
+	for tableName := range schema.Tables {
+		names = append(names, tableName)
+	}
+	sort.Strings(names)
+
+	for _, tableName := range names {
+		saved := schema.Tables[tableName]
+		rows, exists := loaded[tableName]
+		if !exists {
+			return nil, fmt.Errorf("table %s of %s has no CSV file", tableName, schemaFile)
+		}
+		if err := staging.CreateTableWithSchema(tableName, saved.Columns); err != nil {
+			return nil, fmt.Errorf("failed to load table %s: %w", tableName, err)
+		}
+		table := staging.Tables[tableName]
+		table.Rows = rows.Rows
+		table.lastID = saved.LastID
+		table.logToken, table.logged = rows.logToken, rows.logged
+		if saved.CSV != nil {
+			table.dialect = *saved.CSV
+		}
+		if err := table.rebuildIndexes(tableName); err != nil {
+			return nil, fmt.Errorf("failed to load table %s: %w", tableName, err)
+		}
+		for _, columns := range saved.Unique {
+			if err := staging.AddUnique(tableName, columns...); err != nil {
+				return nil, fmt.Errorf("failed to load table %s: %w", tableName, err)
+			}
+		}
+		for _, check := range saved.Checks {
+			if err := staging.AddCheck(tableName, check); err != nil {
+				return nil, fmt.Errorf("failed to load table %s: %w", tableName, err)
+			}
+		}
+		for _, saved := range saved.Indexes {
+			ix := &secondaryIndex{name: saved.Name, columns: saved.Columns, ordered: saved.Ordered, filter: saved.Filter}
+			err := checkColumns(tableName, table.Columns, ix.columns)
+			if err == nil && saved.Expression != "" {
+				ix.columns = []string{saved.Expression}
+				err = staging.parseExpression(tableName, ix)
+			}
+			if err == nil {
+				err = staging.parseFilter(tableName, ix)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to load index %s of table %s: %w", saved.Name, tableName, err)
+			}
+			var report func(done, total int)
+			if progress != nil {
+				report = func(done, total int) { progress(tableName, ix.name, done, total) }
+			}
+			table.addIndex(ix, report)
+		}
+		for _, saved := range saved.FullText {
+			if len(saved.Columns) != 1 {
+				return nil, fmt.Errorf("full-text index %s of table %s must have one column", saved.Name, tableName)
+			}
+			ix := &fullTextIndex{name: saved.Name, column: saved.Columns[0], stemmer: saved.Stemmer}
+			err := checkColumns(tableName, table.Columns, saved.Columns)
+			if err == nil {
+				err = table.addFullText(staging, ix)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to load index %s of table %s: %w", saved.Name, tableName, err)
+			}
+		}
+		for _, saved := range saved.Fuzzy {
+			if len(saved.Columns) != 1 {
+				return nil, fmt.Errorf("fuzzy index %s of table %s must have one column", saved.Name, tableName)
+			}
+			if err := checkColumns(tableName, table.Columns, saved.Columns); err != nil {
+				return nil, fmt.Errorf("failed to load index %s of table %s: %w", saved.Name, tableName, err)
+			}
+			table.addFuzzy(&trigramIndex{name: saved.Name, column: saved.Columns[0]})
+		}
+	}
+
+	// Foreign keys are added once every table they may reference exists
+	for _, tableName := range names {
+		for _, fk := range schema.Tables[tableName].ForeignKeys {
+			if err := staging.AddForeignKey(tableName, fk); err != nil {
+				return nil, fmt.Errorf("failed to load table %s: %w", tableName, err)
+			}
+		}
+	}
+
+	for tableName, table := range loaded {
+		if _, exists := staging.Tables[tableName]; !exists {
+			staging.Tables[tableName] = table
+		}
+	}
+	return staging.Tables, nil
+}
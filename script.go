@@ -0,0 +1,64 @@
+package MyDb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ScriptError reports which statement of a script failed
+type ScriptError struct {
+	Index     int    // Position of the failed statement in the script, starting at 1
+	Statement string // Text of the failed statement
+	Err       error  // Error returned by the statement
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("statement %d (%s) failed: %v", e.Index, e.Statement, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// ExecScript runs the semicolon-separated statements of a script in order and
+// returns their results. Semicolons inside quoted strings and "--" comments do
+// not end a statement. Execution stops at the first failing statement, which is
+// reported as a *ScriptError; the results of the statements before it are returned
+func (db *Database) ExecScript(script string) ([]*Result, error) {
+	statements, err := splitStatements(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*Result
+	for i, statement := range statements {
+		result, err := db.Query(statement)
+		if err != nil {
+			return results, &ScriptError{Index: i + 1, Statement: statement, Err: err}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// splitStatements splits a script on semicolons outside quoted strings and drops empty statements
+func splitStatements(script string) ([]string, error) {
+	tokens, err := tokenize(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []string
+	start, count := 0, 0 // Byte offset and token count of the current statement
+	for _, tok := range tokens {
+		if tok.kind != tokenEOF && !tok.is(";") {
+			count++
+			continue
+		}
+		if count > 0 {
+			statements = append(statements, strings.TrimSpace(script[start:tok.pos]))
+		}
+		start, count = tok.pos+1, 0
+	}
+	return statements, nil
+}
@@ -0,0 +1,490 @@
+package MyDb
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// secondaryIndex maps the values of a set of columns to the rows holding them, so that
+// rows can be found without scanning the table. Rows with a NULL in one of the columns
+// are not in the map, and partial indexes leave out the rows not satisfying their filter
+type secondaryIndex struct {
+	name          string                         // Name of the index, unique within its table
+	columns       []string                       // Indexed columns
+	rows          map[string][]map[string]string // Rows by key
+	ordered       bool                           // Whether the index also keeps its rows sorted
+	types         []ColumnType                   // Types of the indexed columns, which order the rows
+	sorted        []map[string]string            // All indexed rows sorted by the indexed columns, for ordered indexes
+	filter        string                         // Condition of the indexed rows of a partial index, empty to index every row
+	where         expr                           // Parsed filter, nil when there is none
+	filterColumns []string                       // Columns the filter reads
+	expression    expr                           // Indexed expression of an expression index, whose text is its only column
+	exprColumns   []string                       // Columns the expression reads
+}
+
+// IndexOption configures an index created with CreateIndex or CreateCompositeIndex
+type IndexOption func(ix *secondaryIndex)
+
+// Ordered makes CreateIndex build an ordered index, which also answers range conditions
+// on its column such as "age > 30" or "born BETWEEN '1990-01-01' AND '1999-12-31'",
+// and ORDER BY on int, float, bool and date columns
+func Ordered() IndexOption {
+	return func(ix *secondaryIndex) {
+		ix.ordered = true
+	}
+}
+
+// WithFilter makes CreateIndex build a partial index holding only the rows satisfying
+// a condition, e.g. "status = 'open'", which uses the syntax of WHERE clauses without
+// subqueries. The index is smaller and cheaper to maintain, and answers the WHERE clauses
+// that require each condition of the filter joined by AND
+func WithFilter(condition string) IndexOption {
+	return func(ix *secondaryIndex) {
+		ix.filter = strings.TrimSpace(condition)
+	}
+}
+
+// CreateIndex creates an index named "<table>_<column>_idx" on a column of a table.
+// Conditions requiring the column to equal a value, in WHERE clauses and in SearchByKey,
+// UpdateByKey, DeleteByKey and Delete, then find the rows through the index instead of
+// scanning the table. The index is kept up to date as rows change
+func (db *Database) CreateIndex(tableName, column string, options ...IndexOption) error {
+	return db.CreateCompositeIndex(tableName, []string{column}, options...)
+}
+
+// CreateCompositeIndex creates an index named "<table>_<col1>_<col2>_idx" on several
+// columns of a table, e.g. (tenant_id, created_at). Indexes on several columns are always
+// ordered: besides conditions on all the columns, they answer conditions requiring a
+// prefix of the columns to equal values, optionally with a range on the next column,
+// such as "tenant_id = 7 AND created_at >= '2025-01-01'"
+func (db *Database) CreateCompositeIndex(tableName string, columns []string, options ...IndexOption) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("index needs at least one column")
+	}
+	name := tableName + "_" + strings.Join(columns, "_") + "_idx"
+	ix := &secondaryIndex{name: name, columns: append([]string(nil), columns...), ordered: len(columns) > 1}
+	for _, option := range options {
+		option(ix)
+	}
+	if err := db.parseFilter(tableName, ix); err != nil {
+		return err
+	}
+	return db.alterTable(tableName, func(table *Table) error {
+		if err := checkColumns(tableName, table.Columns, columns); err != nil {
+			return err
+		}
+		if table.findIndex(name) != nil {
+			return fmt.Errorf("index %s already exists on table %s", name, tableName)
+		}
+		table.addIndex(ix, nil)
+		return nil
+	})
+}
+
+// parseFilter parses the filter of a partial index on a table, if it has one
+func (db *Database) parseFilter(tableName string, ix *secondaryIndex) error {
+	if ix.filter == "" {
+		return nil
+	}
+	where, columns, err := db.parseRowCondition(tableName, ix.filter, "index filter")
+	if err != nil {
+		return err
+	}
+	ix.where, ix.filterColumns = where, columns
+	return nil
+}
+
+// holds reports whether the index holds a row, which must satisfy the filter of a
+// partial index. Rows for which the filter is NULL or fails are left out
+func (ix *secondaryIndex) holds(row map[string]string) bool {
+	if ix.where == nil {
+		return true
+	}
+	value, err := ix.where.eval(row)
+	return err == nil && value != Null && truthy(value)
+}
+
+// covers reports whether the index holds every row satisfying a condition, which is
+// always the case for a full index. For a partial index, each condition of its filter
+// joined by AND must also be required by the condition, or be a comparison "col = value"
+// of a column that values requires to equal the same value
+func (ix *secondaryIndex) covers(cond expr, values map[string]string) bool {
+	if ix.where == nil {
+		return true
+	}
+	required := conjuncts(cond)
+	for _, c := range conjuncts(ix.where) {
+		if slices.ContainsFunc(required, func(e expr) bool { return sameExpr(e, c) }) {
+			continue
+		}
+		equal := equalities(c)
+		if len(equal) == 0 {
+			return false
+		}
+		for col, value := range equal {
+			if held, ok := values[col]; !ok || compareValues(held, value) != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// conjuncts returns the conditions joined by AND that make up a condition
+func conjuncts(cond expr) []expr {
+	switch e := cond.(type) {
+	case nil:
+		return nil
+	case *logicalExpr:
+		if !e.or {
+			return append(conjuncts(e.left), conjuncts(e.right)...)
+		}
+	}
+	return []expr{cond}
+}
+
+// addIndex fills a new index from the rows of the table and adds it to the table,
+// reporting progress like build. The table lock must be held
+func (t *Table) addIndex(ix *secondaryIndex, progress func(done, total int)) {
+	ix.types = nil
+	for _, col := range ix.columns {
+		ix.types = append(ix.types, t.columnDef(col).Type)
+	}
+	ix.build(t.Rows, progress)
+	t.indexes = append(t.indexes, ix)
+}
+
+// DropIndex drops an index of a table, given its name as listed by ListIndexes. Unique
+// indexes, including UNIQUE constraints, can be dropped unless a foreign key needs them,
+// while the primary key cannot
+func (db *Database) DropIndex(tableName, name string) error {
+	return db.alterTable(tableName, func(table *Table) error {
+		for i, ix := range table.indexes {
+			if ix.name == name {
+				table.indexes = append(table.indexes[:i:i], table.indexes[i+1:]...)
+				return nil
+			}
+		}
+		for i, ix := range table.fullText {
+			if ix.name == name {
+				table.fullText = append(table.fullText[:i:i], table.fullText[i+1:]...)
+				return nil
+			}
+		}
+		for i, ix := range table.fuzzy {
+			if ix.name == name {
+				table.fuzzy = append(table.fuzzy[:i:i], table.fuzzy[i+1:]...)
+				return nil
+			}
+		}
+		ix := table.findUniqueIndex(tableName, name)
+		switch {
+		case ix == nil:
+			return fmt.Errorf("index %s does not exist on table %s", name, tableName)
+		case ix == table.primaryKey:
+			return fmt.Errorf("cannot drop the primary key of table %s", tableName)
+		}
+		i := slices.Index(table.unique, ix)
+		table.unique = append(table.unique[:i:i], table.unique[i+1:]...)
+		if err := db.referencing(tableName, func(childName string, child *Table, fk ForeignKey) error {
+			if table.findUnique(fk.RefColumns) == nil {
+				return fmt.Errorf("cannot drop index %s: it is needed by %s", name, fk.describe(childName))
+			}
+			return nil
+		}); err != nil {
+			table.unique = slices.Insert(table.unique, i, ix)
+			return err
+		}
+		if len(ix.columns) == 1 && table.findUnique(ix.columns) == nil {
+			def := table.columnDef(ix.columns[0])
+			def.Unique = false
+			table.setColumnDef(def)
+		}
+		return nil
+	})
+}
+
+// findIndex returns the secondary index of the table with the given name, or nil
+func (t *Table) findIndex(name string) *secondaryIndex {
+	for _, ix := range t.indexes {
+		if ix.name == name {
+			return ix
+		}
+	}
+	return nil
+}
+
+// describe formats the index for EXPLAIN
+func (ix *secondaryIndex) describe() string {
+	description := "index " + ix.name + " (" + strings.Join(ix.columns, ", ") + ")"
+	if ix.filter != "" {
+		description += " where " + ix.filter
+	}
+	return description
+}
+
+// progressRows is how many rows build indexes between two progress reports
+const progressRows = 10000
+
+// build fills the index from the rows of its table. When progress is not nil, it is
+// called every progressRows rows and once the index is complete
+func (ix *secondaryIndex) build(rows []map[string]string, progress func(done, total int)) {
+	ix.rows = make(map[string][]map[string]string)
+	ix.sorted = nil
+	for i, row := range rows {
+		if ix.holds(row) {
+			if key, ok := ix.key(row); ok {
+				ix.rows[key] = append(ix.rows[key], row)
+			}
+			if ix.ordered {
+				ix.sorted = append(ix.sorted, row)
+			}
+		}
+		if progress != nil && (i+1)%progressRows == 0 && i+1 < len(rows) {
+			progress(i+1, len(rows))
+		}
+	}
+	if ix.ordered {
+		sort.SliceStable(ix.sorted, func(i, j int) bool {
+			return ix.compareRows(ix.sorted[i], ix.sorted[j]) < 0
+		})
+	}
+	if progress != nil {
+		progress(len(rows), len(rows))
+	}
+}
+
+// add adds rows to the index
+func (ix *secondaryIndex) add(rows []map[string]string) {
+	for _, row := range rows {
+		if !ix.holds(row) {
+			continue
+		}
+		if key, ok := ix.key(row); ok {
+			ix.rows[key] = append(ix.rows[key], row)
+		}
+		if ix.ordered {
+			// Insert after the rows with the same values
+			i := ix.search(func(indexed map[string]string) bool { return ix.compareRows(indexed, row) > 0 })
+			ix.sorted = append(ix.sorted[:i], append([]map[string]string{row}, ix.sorted[i:]...)...)
+		}
+	}
+}
+
+// remove removes rows from the index
+func (ix *secondaryIndex) remove(rows []map[string]string) {
+	for _, row := range rows {
+		if !ix.holds(row) {
+			continue
+		}
+		if key, ok := ix.key(row); ok {
+			bucket := ix.rows[key]
+			for i, indexed := range bucket {
+				if sameRow(indexed, row) {
+					bucket = append(bucket[:i:i], bucket[i+1:]...)
+					break
+				}
+			}
+			if len(bucket) == 0 {
+				delete(ix.rows, key)
+			} else {
+				ix.rows[key] = bucket
+			}
+		}
+		if ix.ordered {
+			i := ix.search(func(indexed map[string]string) bool { return ix.compareRows(indexed, row) >= 0 })
+			for ; i < len(ix.sorted) && ix.compareRows(ix.sorted[i], row) == 0; i++ {
+				if sameRow(ix.sorted[i], row) {
+					ix.sorted = append(ix.sorted[:i], ix.sorted[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+// search returns the position of the first sorted row satisfying f, which must be false
+// and then true along the sorted rows
+func (ix *secondaryIndex) search(f func(row map[string]string) bool) int {
+	return sort.Search(len(ix.sorted), func(i int) bool {
+		return f(ix.sorted[i])
+	})
+}
+
+// compare compares two values of the i-th indexed column in the order of the index.
+// NULL comes first. Values of typed columns are compared by type and others as text,
+// since mixing numeric and text comparisons would not give a consistent order
+func (ix *secondaryIndex) compare(i int, a, b string) int {
+	switch {
+	case a == Null && b == Null:
+		return 0
+	case a == Null:
+		return -1
+	case b == Null:
+		return 1
+	}
+	switch typ := ix.types[i]; typ {
+	case Int, Float, Bool, Date, DateTime, Decimal:
+		return typ.compare(a, b)
+	}
+	return strings.Compare(a, b)
+}
+
+// compareRows compares two rows by their indexed columns in the order of the index
+func (ix *secondaryIndex) compareRows(a, b map[string]string) int {
+	for i := range ix.columns {
+		if c := ix.compare(i, ix.value(a, i), ix.value(b, i)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareTo compares the first indexed columns of a row with values of these columns
+func (ix *secondaryIndex) compareTo(row map[string]string, values []string) int {
+	for i, value := range values {
+		if c := ix.compare(i, ix.value(row, i), value); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// value returns the i-th indexed value of a row, the value of the i-th column or the
+// result of the expression of an expression index, or Null when there is none
+func (ix *secondaryIndex) value(row map[string]string, i int) string {
+	if ix.expression == nil {
+		return storedValue(row, ix.columns[i])
+	}
+	value, err := ix.expression.eval(row)
+	if err != nil {
+		return Null
+	}
+	return value
+}
+
+// key returns the key of a row in the index, reporting false when an indexed value is NULL
+func (ix *secondaryIndex) key(row map[string]string) (string, bool) {
+	if ix.expression == nil {
+		return indexKey(row, ix.columns)
+	}
+	return indexKey(map[string]string{ix.columns[0]: ix.value(row, 0)}, ix.columns)
+}
+
+// storedValue returns the value of a column of a row, or Null when the row has none
+func storedValue(row map[string]string, col string) string {
+	if value, ok := row[col]; ok {
+		return value
+	}
+	return Null
+}
+
+// usable returns the bounds of the i-th indexed column that the index can answer. Bounds
+// of typed columns must be valid values of the type, and bounds of text columns must not
+// be numbers, which WHERE clauses compare numerically
+func (ix *secondaryIndex) usable(i int, bounds []bound) []bound {
+	var usable []bound
+	for _, b := range bounds {
+		switch typ := ix.types[i]; typ {
+		case Int, Float, Bool, Date, DateTime, Decimal:
+			if _, err := typ.normalize(b.value); err != nil || b.value == "" {
+				continue
+			}
+		default:
+			if _, err := strconv.ParseFloat(b.value, 64); err == nil {
+				continue
+			}
+		}
+		usable = append(usable, b)
+	}
+	return usable
+}
+
+// match returns the values that the bounds require the longest possible prefix of the
+// indexed columns to equal, and the usable bounds of the column after the prefix
+func (ix *secondaryIndex) match(ranges map[string][]bound) ([]string, []bound) {
+	var prefix []string
+	for i, col := range ix.columns {
+		usable := ix.usable(i, ranges[col])
+		j := slices.IndexFunc(usable, func(b bound) bool { return b.op == "=" })
+		if j < 0 {
+			return prefix, usable
+		}
+		prefix = append(prefix, usable[j].value)
+	}
+	return prefix, nil
+}
+
+// span returns the positions of the sorted rows whose first indexed columns equal the
+// prefix values and whose next column satisfies all the bounds
+func (ix *secondaryIndex) span(prefix []string, bounds []bound) (int, int) {
+	lo := ix.search(func(row map[string]string) bool { return ix.compareTo(row, prefix) >= 0 })
+	hi := ix.search(func(row map[string]string) bool { return ix.compareTo(row, prefix) > 0 })
+	for _, b := range bounds {
+		values := append(prefix[:len(prefix):len(prefix)], b.value)
+		after := func(row map[string]string) bool { return ix.compareTo(row, values) > 0 }
+		from := func(row map[string]string) bool { return ix.compareTo(row, values) >= 0 }
+		switch b.op {
+		case ">":
+			lo = max(lo, ix.search(after))
+		case ">=":
+			lo = max(lo, ix.search(from))
+		case "<":
+			hi = min(hi, ix.search(from))
+		case "<=":
+			hi = min(hi, ix.search(after))
+		case "=":
+			lo = max(lo, ix.search(from))
+			hi = min(hi, ix.search(after))
+		}
+	}
+	return lo, max(lo, hi)
+}
+
+// ordersBy reports whether rows whose first columns equal prefix values come from the
+// index in the order of an ORDER BY clause. The clause must list the indexed columns
+// after some of the prefix in the same direction, on int, float, bool or date columns
+// whose order is the order of ORDER BY, which compares numbers numerically and other
+// values as text
+func (ix *secondaryIndex) ordersBy(orderBy []SortKey, prefix int) bool {
+	if !ix.ordered || len(orderBy) == 0 {
+		return false
+	}
+	for i, typ := range ix.types {
+		if i >= prefix && typ != Int && typ != Float && typ != Bool && typ != Date {
+			return false
+		}
+	}
+	for skipped := 0; skipped <= prefix; skipped++ {
+		columns := ix.columns[skipped:]
+		if len(orderBy) != len(columns) {
+			continue
+		}
+		same := true
+		for i, key := range orderBy {
+			same = same && key.Column == columns[i] && key.Desc == orderBy[0].Desc
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
+
+// descending returns rows in index order reversed, except that rows with the same values
+// keep their order like in a stable sort
+func (ix *secondaryIndex) descending(rows []map[string]string) []map[string]string {
+	reversed := make([]map[string]string, 0, len(rows))
+	for end := len(rows); end > 0; {
+		start := end - 1
+		for start > 0 && ix.compareRows(rows[start-1], rows[end-1]) == 0 {
+			start--
+		}
+		reversed = append(reversed, rows[start:end]...)
+		end = start
+	}
+	return reversed
+}
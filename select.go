@@ -0,0 +1,538 @@
+package MyDb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// selectStmt is a parsed SELECT or GET command
+type selectStmt struct {
+	distinct   bool             // Remove duplicate result rows
+	fields     []selectField    // Projected values, nil selects every column
+	table      string           // Table to read from
+	alias      string           // Alias of the table, empty when there is none
+	joins      []*joinClause    // Tables joined to the first one
+	columns    []string         // Row keys of every source column, qualified when joining
+	where      *rowFilter       // Row filter from the WHERE clause
+	groupBy    []string         // Row keys of the GROUP BY columns
+	aggregates []*aggregateExpr // Aggregates of the column list, computed for each group
+	unions     []*unionPart     // Statements combined with this one by UNION
+	orderBy    []SortKey        // Sort keys from the ORDER BY clause
+	limit      int              // Maximum number of rows, -1 for no limit
+	offset     int              // Number of matching rows to skip
+	forUpdate  bool             // Lock the matching rows for the transaction, from FOR UPDATE
+}
+
+// selectField is one entry of the SELECT column list
+type selectField struct {
+	name  string // Column name in the result
+	value expr   // Expression producing the value
+}
+
+// unionPart is a statement appended to a SELECT with UNION or UNION ALL
+type unionPart struct {
+	all  bool        // Keep duplicate rows
+	stmt *selectStmt // Statement whose rows are appended
+}
+
+// parseSelect parses "SELECT [DISTINCT] cols FROM table [JOIN ...] [WHERE cond] [GROUP BY cols]
+// [UNION [ALL] SELECT ...] [ORDER BY keys] [LIMIT n] [OFFSET m] [FOR UPDATE]" and the equivalent
+// "GET FROM table ..." shorthand, which selects every column. With UNION, ORDER BY and LIMIT apply
+// to the combined rows, and with GROUP BY or aggregates to the rows of the groups
+func (p *parser) parseSelect() (*selectStmt, error) {
+	stmt, err := p.parseSelectCore()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("union") {
+		part := &unionPart{all: p.accept("all")}
+		if part.stmt, err = p.parseSelectCore(); err != nil {
+			return nil, err
+		}
+		stmt.unions = append(stmt.unions, part)
+	}
+	if len(stmt.unions) > 0 || stmt.grouped() {
+		// Sort keys of a union or of groups refer to its result columns
+		p.tables = nil
+		p.columns = make(map[string]string)
+		for _, col := range stmt.resultColumns() {
+			p.columns[col] = col
+		}
+	} else {
+		// Sort keys can also refer to the names of the selected columns
+		for _, field := range stmt.fields {
+			if col, ok := field.value.(*columnExpr); ok {
+				p.columns[field.name] = col.name
+			}
+		}
+	}
+
+	if p.accept("order") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		if stmt.orderBy, err = p.parseSortKeys(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("limit") {
+		if stmt.limit, err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("offset") {
+		if stmt.offset, err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("for") {
+		if err := p.expect("update"); err != nil {
+			return nil, err
+		}
+		if len(stmt.unions) > 0 || len(stmt.joins) > 0 || stmt.grouped() {
+			return nil, fmt.Errorf("FOR UPDATE cannot lock the rows of a UNION, JOIN or GROUP BY")
+		}
+		stmt.forUpdate = true
+	}
+	return stmt, nil
+}
+
+// parseSelectCore parses a SELECT or GET command up to its GROUP BY clause
+func (p *parser) parseSelectCore() (*selectStmt, error) {
+	stmt := &selectStmt{where: &rowFilter{ctx: p.ctx}, limit: -1}
+	outerSubqueries, outerAggregates := p.subqueries, p.aggregates
+	p.subqueries, p.aggregates = nil, nil
+	defer func() {
+		// Subqueries and aggregates belong to this statement, not to an enclosing one
+		stmt.where.subqueries = p.subqueries
+		p.subqueries, p.aggregates = outerSubqueries, outerAggregates
+	}()
+
+	fieldsPos := -1
+	if !p.accept("get") {
+		if err := p.expect("select"); err != nil {
+			return nil, err
+		}
+		stmt.distinct = p.accept("distinct")
+		if !p.accept("*") {
+			// The column list can only be resolved once the FROM clause is known
+			fieldsPos = p.pos
+			if err := p.skipTo("from"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	table, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.table = table
+	if stmt.alias, err = p.parseAlias(); err != nil {
+		return nil, err
+	}
+	if err := p.useTable(table, stmt.alias); err != nil {
+		return nil, err
+	}
+	if err := p.parseJoins(stmt); err != nil {
+		return nil, err
+	}
+	stmt.columns = p.sourceColumns()
+
+	if fieldsPos >= 0 {
+		end := p.pos
+		p.pos = fieldsPos
+		p.aggregates = &stmt.aggregates
+		stmt.fields, err = p.parseFields()
+		p.aggregates = nil
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek().is("from") {
+			return nil, p.unexpected()
+		}
+		p.pos = end
+	}
+
+	if p.accept("where") {
+		start := p.peek().pos
+		cond, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		stmt.where.cond = cond
+		stmt.where.text = strings.TrimSpace(p.input[start:p.peek().pos])
+	}
+	if p.accept("group") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		for {
+			col, err := p.parseColumn()
+			if err != nil {
+				return nil, err
+			}
+			stmt.groupBy = append(stmt.groupBy, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	return stmt, nil
+}
+
+// grouped reports whether the statement returns a row for each group of rows rather
+// than the rows themselves, having a GROUP BY clause or aggregates
+func (stmt *selectStmt) grouped() bool {
+	return len(stmt.groupBy) > 0 || len(stmt.aggregates) > 0
+}
+
+// resultColumns returns the column names of the rows produced by the statement
+func (stmt *selectStmt) resultColumns() []string {
+	if stmt.fields == nil {
+		return stmt.columns
+	}
+	columns := make([]string, len(stmt.fields))
+	for i, field := range stmt.fields {
+		columns[i] = field.name
+	}
+	return columns
+}
+
+// parseFields parses the column list of a SELECT command. Columns keep their name
+// in the result, other expressions are named after their text. A field given an
+// alias with "expr AS name" or "expr name" is returned under that name
+func (p *parser) parseFields() ([]selectField, error) {
+	var fields []selectField
+	for {
+		start := p.peek()
+		value, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(*literalExpr); ok && start.kind == tokenWord {
+			return nil, fmt.Errorf("unknown column %s at position %d", start.text, start.pos)
+		}
+		name := strings.TrimSpace(p.input[start.pos:p.peek().pos])
+		if _, ok := value.(*columnExpr); ok && start.kind == tokenWord {
+			name = start.text
+		}
+		alias, err := p.parseAlias()
+		if err != nil {
+			return nil, err
+		}
+		if alias != "" {
+			name = alias
+		}
+		fields = append(fields, selectField{name: name, value: value})
+		if !p.accept(",") {
+			return fields, nil
+		}
+	}
+}
+
+// parseSortKeys parses the column list of an ORDER BY clause, e.g. "name desc, age"
+func (p *parser) parseSortKeys() ([]SortKey, error) {
+	var keys []SortKey
+	for {
+		col, err := p.parseColumn()
+		if err != nil {
+			return nil, err
+		}
+		key := SortKey{Column: col}
+		if p.accept("desc") {
+			key.Desc = true
+		} else {
+			p.accept("asc")
+		}
+		keys = append(keys, key)
+		if !p.accept(",") {
+			return keys, nil
+		}
+	}
+}
+
+// querySelect parses and executes a SELECT or GET command
+func (db *Database) querySelect(p *parser) (*Result, error) {
+	stmt, err := p.parseSelect()
+	if err == nil {
+		err = p.expectEOF()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid SELECT command: %w", err)
+	}
+	if stmt.forUpdate {
+		// The rows are locked before they are read, so that they hold their latest values
+		if p.tx == nil {
+			return nil, fmt.Errorf("FOR UPDATE requires a transaction, see Begin")
+		}
+		if err := stmt.where.prepare(db); err != nil {
+			return nil, err
+		}
+		if err := db.lockWhere(p.ctx, p.tx, stmt.table, stmt.where.match); err != nil {
+			return nil, err
+		}
+	}
+	return db.execSelect(stmt)
+}
+
+// execSelect runs a parsed SELECT statement
+func (db *Database) execSelect(stmt *selectStmt) (*Result, error) {
+	if db.pinned == nil && stmt.readsSeveral() {
+		return db.execPinned(stmt)
+	}
+	if len(stmt.unions) == 0 {
+		return db.runSelect(stmt, stmt.orderBy, stmt.offset, stmt.limit)
+	}
+
+	// Run every part of the union and rename their columns after the first one
+	result, err := db.runSelect(stmt, nil, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	distinct := false
+	for _, part := range stmt.unions {
+		partResult, err := db.runSelect(part.stmt, nil, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		if len(partResult.Columns) != len(result.Columns) {
+			return nil, fmt.Errorf("UNION requires the same number of columns, got %d and %d", len(result.Columns), len(partResult.Columns))
+		}
+		for _, row := range partResult.Rows {
+			renamed := make(map[string]string, len(result.Columns))
+			for i, col := range result.Columns {
+				if value, ok := row[partResult.Columns[i]]; ok {
+					renamed[col] = value
+				}
+			}
+			result.Rows = append(result.Rows, renamed)
+		}
+		distinct = distinct || !part.all
+	}
+
+	if distinct {
+		result.Rows = distinctRows(result.Rows, result.Columns)
+	}
+	SortRows(result.Rows, stmt.orderBy)
+	result.Rows = pageRows(result.Rows, stmt.offset, stmt.limit)
+	return result, nil
+}
+
+// runSelect runs a single SELECT statement with the given ordering and paging
+func (db *Database) runSelect(stmt *selectStmt, orderBy []SortKey, offset, limit int) (*Result, error) {
+	if err := stmt.where.prepare(db); err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]string
+	var err error
+	var groupOrder []SortKey
+	if stmt.grouped() {
+		// Groups are sorted and paged once every matching row is in one
+		groupOrder, orderBy = orderBy, nil
+	}
+	needAll := len(orderBy) > 0 || stmt.distinct || stmt.grouped()
+	var access *indexAccess
+	if len(stmt.joins) == 0 {
+		// Equalities and ranges on indexed columns are answered by the index
+		rows, access, err = db.lookupWhere(stmt.table, stmt.where.cond, orderBy)
+		if err == nil && access == nil {
+			db.recordScan(stmt.table, stmt.where.cond)
+		}
+	}
+	switch {
+	case err != nil:
+	case access != nil:
+		rows = filterRows(rows, stmt.where.match)
+		if !access.sorted {
+			SortRows(rows, orderBy)
+		}
+		needAll = true
+	case len(stmt.joins) > 0:
+		rows, err = db.joinRows(stmt)
+		if err == nil {
+			rows = filterRows(rows, stmt.where.match)
+			SortRows(rows, orderBy)
+		}
+		needAll = true
+	case needAll:
+		// Sorting and de-duplication need every match before the page can be cut
+		rows, err = db.SearchRowsSorted(stmt.table, stmt.where.match, orderBy)
+	default:
+		rows, err = db.SearchRowsPaged(stmt.table, stmt.where.match, offset, limit)
+	}
+	if err == nil {
+		err = stmt.where.err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.grouped() {
+		if rows, err = stmt.aggregate(rows); err != nil {
+			return nil, err
+		}
+	}
+	columns := stmt.resultColumns()
+	if stmt.fields != nil {
+		if rows, err = projectFields(rows, stmt.fields); err != nil {
+			return nil, err
+		}
+	}
+	if stmt.distinct {
+		rows = distinctRows(rows, columns)
+	}
+	SortRows(rows, groupOrder)
+	if needAll {
+		rows = pageRows(rows, offset, limit)
+	}
+	return &Result{Columns: columns, Rows: rows}, nil
+}
+
+// projectFields builds the result rows of a SELECT column list
+func projectFields(rows []map[string]string, fields []selectField) ([]map[string]string, error) {
+	projected := make([]map[string]string, 0, len(rows))
+	for _, row := range rows {
+		newRow := make(map[string]string, len(fields))
+		for _, field := range fields {
+			value, err := field.value.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			if value != Null {
+				newRow[field.name] = value
+			}
+		}
+		projected = append(projected, newRow)
+	}
+	return projected, nil
+}
+
+// filterRows returns the rows matching the condition
+func filterRows(rows []map[string]string, condition func(row map[string]string) bool) []map[string]string {
+	var results []map[string]string
+	for _, row := range rows {
+		if condition(row) {
+			results = append(results, row)
+		}
+	}
+	return results
+}
+
+// SelectColumns searches for rows matching the condition and returns only the requested columns
+func (db *Database) SelectColumns(tableName string, columns []string, condition func(row map[string]string) bool) ([]map[string]string, error) {
+	tableColumns, err := db.tableColumns(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkColumns(tableName, tableColumns, columns); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.SearchRows(tableName, condition)
+	if err != nil {
+		return nil, err
+	}
+	return projectRows(rows, columns), nil
+}
+
+// Distinct returns the distinct combinations of values of the given columns, in order of first appearance
+func (db *Database) Distinct(tableName string, columns []string) ([]map[string]string, error) {
+	rows, err := db.SelectColumns(tableName, columns, func(row map[string]string) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	return distinctRows(rows, columns), nil
+}
+
+// UnionRows appends the rows of b to the rows of a. When distinct is true, rows
+// holding exactly the same columns and values as an earlier row are dropped
+func UnionRows(a, b []Row, distinct bool) []Row {
+	rows := make([]Row, 0, len(a)+len(b))
+	rows = append(rows, a...)
+	rows = append(rows, b...)
+	if !distinct {
+		return rows
+	}
+
+	seen := make(map[string]bool, len(rows))
+	unique := rows[:0]
+	for _, row := range rows {
+		columns := make([]string, 0, len(row))
+		for col := range row {
+			columns = append(columns, col)
+		}
+		sort.Strings(columns)
+		// Include the column names so rows with different columns never collide
+		key := rowKey(row, columns) + "|" + strings.Join(columns, ",")
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, row)
+		}
+	}
+	return unique
+}
+
+// distinctRows removes rows whose values for the given columns were already seen
+func distinctRows(rows []map[string]string, columns []string) []map[string]string {
+	seen := make(map[string]bool, len(rows))
+	var unique []map[string]string
+	for _, row := range rows {
+		key := rowKey(row, columns)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, row)
+	}
+	return unique
+}
+
+// rowKey encodes the values of the given columns into a string usable as a map key
+func rowKey(row map[string]string, columns []string) string {
+	var sb strings.Builder
+	for _, col := range columns {
+		value, ok := row[col]
+		if !ok {
+			// NULL has no length, which keeps it apart from every value
+			sb.WriteByte(';')
+			continue
+		}
+		// Length-prefix each value so different splits can never collide
+		sb.WriteString(strconv.Itoa(len(value)))
+		sb.WriteByte(':')
+		sb.WriteString(value)
+	}
+	return sb.String()
+}
+
+// projectRows copies rows keeping only the given columns
+func projectRows(rows []map[string]string, columns []string) []map[string]string {
+	projected := make([]map[string]string, 0, len(rows))
+	for _, row := range rows {
+		newRow := make(map[string]string, len(columns))
+		for _, col := range columns {
+			if value, ok := row[col]; ok {
+				newRow[col] = value
+			}
+		}
+		projected = append(projected, newRow)
+	}
+	return projected
+}
+
+// checkColumns returns an error if any of the requested columns is missing from the table
+func checkColumns(tableName string, tableColumns, columns []string) error {
+	for _, col := range columns {
+		if !contains(tableColumns, col) {
+			return fmt.Errorf("column %s does not exist in table %s", col, tableName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package MyDb
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// IsolationLevel controls how reads behave while other goroutines write
+type IsolationLevel int
+
+const (
+	// ReadCommitted makes each read scan a snapshot of the rows committed when it
+	// starts, taken at the same moment for every table of a statement with joins,
+	// subqueries or unions. Writers proceed while it runs, and it never sees a write
+	// half applied
+	ReadCommitted IsolationLevel = iota
+	// Serializable makes each read hold the locks of its tables until it is done, those
+	// of every table of a statement together, so that writers wait for it
+	Serializable
+)
+
+// SetIsolationLevel sets how reads behave while other goroutines write. The default is
+// ReadCommitted. Snapshot gives repeatable reads over several statements
+func (db *Database) SetIsolationLevel(level IsolationLevel) error {
+	if level != ReadCommitted && level != Serializable {
+		return fmt.Errorf("unknown isolation level %d", level)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.isolation = level
+	return nil
+}
+
+// snapshot returns the rows of the table as they are now. Rows are never changed in
+// place: writers replace them with new versions and copy the rows slice before
+// replacing rows in it, so the snapshot stays as it is. The table lock must be held
+func (t *Table) snapshot() []map[string]string {
+	t.shared.Store(true)
+	return t.Rows[:len(t.Rows):len(t.Rows)]
+}
+
+// ownRows copies the rows slice of the table when a snapshot shares it, before rows
+// are replaced in it. Rows appended to the slice are not seen by snapshots, whose
+// capacity ends with their rows. The table lock must be held
+func (t *Table) ownRows() {
+	if t.shared.Load() {
+		t.Rows = slices.Clone(t.Rows)
+		t.shared.Store(false)
+	}
+}
+
+// replaceRows replaces rows of the table by new versions at the same positions, found
+// through rowPosition, and updates the indexes. The table lock must be held
+func (t *Table) replaceRows(oldRows, newRows []map[string]string) {
+	if len(oldRows) == 0 {
+		return
+	}
+	t.unindexRows(oldRows)
+	t.ownRows()
+	for i, row := range oldRows {
+		if j, ok := t.rowPosition(row); ok {
+			t.Rows[j] = newRows[i]
+			t.positions.replace(row, newRows[i])
+		}
+	}
+	t.indexRows(newRows)
+}
+
+// rewriteRows replaces every row of the table by a copy changed by change, e.g. to add
+// a column, and rebuilds the indexes. The table lock must be held
+func (t *Table) rewriteRows(tableName string, change func(row map[string]string)) error {
+	rows := make([]map[string]string, len(t.Rows))
+	for i, row := range t.Rows {
+		rows[i] = copyRow(row)
+		change(rows[i])
+	}
+	t.Rows = rows
+	t.shared.Store(false)
+	return t.rebuildIndexes(tableName)
+}
+
+// readRows calls read with the columns and rows of a table. Under ReadCommitted the
+// rows are a snapshot that read scans without holding any lock, under Serializable
+// read runs while the locks are held
+func (db *Database) readRows(tableName string, read func(columns []string, rows []map[string]string) error) error {
+	db.mu.RLock() // Lock db first
+	table, exists := db.Tables[tableName]
+	if !exists {
+		db.mu.RUnlock()
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		db.mu.RUnlock()
+		return err
+	}
+
+	table.mu.RLock() // Lock table second
+	if db.isolation == Serializable {
+		defer db.mu.RUnlock()
+		defer table.mu.RUnlock()
+		return read(table.Columns, table.Rows)
+	}
+	columns, rows := table.Columns, table.snapshot()
+	table.mu.RUnlock()
+	db.mu.RUnlock()
+	return read(columns, rows)
+}
+
+// pinned describes a database holding the snapshots of the tables that a statement
+// reads, see pinTables
+type pinned struct {
+	from   *Database  // Database the tables were pinned from
+	locked bool       // Whether the locks of the tables of from stay held, under Serializable
+	scans  []scanSeen // Full scans of the statement, recorded by from once it is done
+}
+
+// scanSeen is a full scan of a table for the index advisor
+type scanSeen struct {
+	table string
+	cond  expr
+}
+
+// readsSeveral reports whether the statement reads several tables, or a table several
+// times, through joins, subqueries or unions
+func (stmt *selectStmt) readsSeveral() bool {
+	return len(stmt.joins) > 0 || len(stmt.where.subqueries) > 0 || len(stmt.unions) > 0
+}
+
+// tableNames adds the names of the tables that the statement reads to names, with those
+// of its joins, subqueries and unions
+func (stmt *selectStmt) tableNames(names map[string]bool) {
+	names[stmt.table] = true
+	for _, join := range stmt.joins {
+		names[join.table] = true
+	}
+	for _, in := range stmt.where.subqueries {
+		in.subquery.tableNames(names)
+	}
+	for _, part := range stmt.unions {
+		part.stmt.tableNames(names)
+	}
+}
+
+// execPinned runs a statement reading several tables on snapshots of them taken at the
+// same moment, so that it sees every write to them or none
+func (db *Database) execPinned(stmt *selectStmt) (*Result, error) {
+	names := make(map[string]bool)
+	stmt.tableNames(names)
+	view, release, err := db.pinTables(slices.Sorted(maps.Keys(names)))
+	if err != nil {
+		return nil, err
+	}
+	result, err := view.execSelect(stmt)
+	release()
+	for _, scan := range view.pinned.scans {
+		db.recordScan(scan.table, scan.cond)
+	}
+	return result, err
+}
+
+// pinTables returns a database holding snapshots of the tables, taken while the locks
+// of every table are held, in name order like writes take them. Under Serializable the
+// locks stay held until release is called, so that writers wait for the statement
+func (db *Database) pinTables(names []string) (view *Database, release func(), err error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	view = &Database{Name: db.Name, Tables: make(map[string]*Table, len(names)), stemmers: maps.Clone(db.stemmers), strict: db.strict}
+	view.pinned = &pinned{from: db, locked: db.isolation == Serializable}
+	db.funcsMu.RLock()
+	view.funcs = maps.Clone(db.funcs)
+	db.funcsMu.RUnlock()
+	l := &tableLocks{tables: make(map[string]*Table), write: make(map[*Table]bool)}
+	for _, tableName := range names {
+		table, exists := db.Tables[tableName]
+		if !exists {
+			return nil, nil, fmt.Errorf("table %s does not exist", tableName)
+		}
+		if err := db.use(tableName, table); err != nil {
+			return nil, nil, err
+		}
+		l.add(tableName, table, false)
+	}
+
+	l.lock() // Lock tables second
+	for tableName, table := range l.tables {
+		view.Tables[tableName] = &Table{
+			Columns:   table.Columns,
+			Rows:      table.snapshot(),
+			defs:      table.defs,
+			generated: table.generated,
+			dialect:   table.dialect,
+			base:      table,
+		}
+	}
+	if view.pinned.locked {
+		return view, l.unlock, nil
+	}
+	l.unlock()
+	return view, func() {}, nil
+}
+
+// indexed calls fn with the table whose indexes find the rows of a table: the table
+// itself, or the table that a snapshot pinned for a statement was taken from while it
+// holds the same rows. The table lock must be held
+func (db *Database) indexed(table *Table, fn func(indexed *Table)) {
+	base := table.base
+	if base == nil {
+		fn(table)
+		return
+	}
+	if !db.pinned.locked {
+		base.mu.RLock()
+		defer base.mu.RUnlock()
+	}
+	if base.holds(table.Rows) {
+		fn(base)
+	} else {
+		fn(table) // Without indexes, the rows are scanned
+	}
+}
+
+// holds reports whether the table holds the rows of a snapshot of it. Rows are never
+// replaced in a slice that snapshots share, so the same slice holds the same rows
+func (t *Table) holds(rows []map[string]string) bool {
+	return len(t.Rows) == len(rows) && (len(rows) == 0 || &t.Rows[0] == &rows[0])
+}
+
+// Snapshot is a read-only view of a database as it was when Snapshot was called. Its
+// reads all see the same rows, whatever is written to the database meanwhile
+type Snapshot struct {
+	db *Database // Database holding the snapshots of the tables, without indexes
+}
+
+// Snapshot returns a read-only view of every table of the database as it is now,
+// consistent across tables, for several reads that must agree with each other
+// (repeatable reads). Taking it copies no rows
+func (db *Database) Snapshot() *Snapshot {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	snap := &Database{Name: db.Name, Tables: make(map[string]*Table, len(db.Tables)), stemmers: maps.Clone(db.stemmers), strict: db.strict}
+	db.funcsMu.RLock()
+	snap.funcs = maps.Clone(db.funcs)
+	db.funcsMu.RUnlock()
+	db.useAll() // A table failing to load back stays evicted, and the reads of the snapshot load it
+	for tableName, table := range db.Tables {
+		table.mu.RLock() // Lock table second
+		snap.Tables[tableName] = &Table{
+			Columns:   table.Columns,
+			Rows:      table.snapshot(),
+			defs:      maps.Clone(table.defs),
+			generated: maps.Clone(table.generated),
+			dialect:   table.dialect,
+		}
+		snap.Tables[tableName].evicted.Store(table.evicted.Load())
+		table.mu.RUnlock()
+	}
+	return &Snapshot{db: snap}
+}
+
+// Query runs a SELECT, GET or EXPLAIN statement on the snapshot
+func (s *Snapshot) Query(command string) (*Result, error) {
+	p, err := newParser(s.db, command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command: %w", err)
+	}
+	if !p.peek().is("select") && !p.peek().is("get") && !p.peek().is("explain") {
+		return nil, fmt.Errorf("snapshot is read-only: %s", command)
+	}
+	return s.db.Query(command)
+}
+
+// SearchRows returns the rows of a table of the snapshot matching the condition
+func (s *Snapshot) SearchRows(tableName string, condition func(row map[string]string) bool) ([]map[string]string, error) {
+	return s.db.SearchRows(tableName, condition)
+}
+
+// ListTables returns the names of the tables of the snapshot in alphabetical order
+func (s *Snapshot) ListTables() []string {
+	return s.db.ListTables()
+}
@@ -0,0 +1,124 @@
+package MyDb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestStatementConsistent checks that a statement reading several tables sees every
+// write to them or none while a writer inserts users with orders and deletes them along
+// with their orders, under both isolation levels
+func TestStatementConsistent(t *testing.T) {
+	queries := []string{
+		"select count(*) as n from orders where user_id not in (select id from users)",
+		"select count(*) as n from orders left join users on orders.user_id = users.id where users.id is null",
+	}
+	for _, level := range []IsolationLevel{ReadCommitted, Serializable} {
+		db := NewDatabase("snapshot_test")
+		for _, command := range []string{
+			"create table users (id int primary key, name)",
+			"create table orders (id int primary key, user_id int references users (id) on delete cascade)",
+		} {
+			if _, err := db.Query(command); err != nil {
+				t.Fatalf("%s: %v", command, err)
+			}
+		}
+		if err := db.SetIsolationLevel(level); err != nil {
+			t.Fatal(err)
+		}
+
+		stop := make(chan struct{})
+		var writer sync.WaitGroup
+		writer.Add(1)
+		go func() {
+			defer writer.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, command := range []string{
+					fmt.Sprintf("insert into users values (%d, u%d)", i, i),
+					fmt.Sprintf("insert into orders values (%d, %d), (%d, %d)", 2*i, i, 2*i+1, i),
+					fmt.Sprintf("delete from users where id = %d", i-1),
+				} {
+					if _, err := db.Query(command); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}()
+
+		var readers sync.WaitGroup
+		for _, query := range queries {
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				for range 300 {
+					res, err := db.Query(query)
+					if err != nil {
+						t.Errorf("%s: %v", query, err)
+						return
+					}
+					if n := res.Rows[0]["n"]; n != "0" {
+						t.Errorf("isolation level %d: %s found %s orders without their user", level, query, n)
+						return
+					}
+				}
+			}()
+		}
+		readers.Wait()
+		close(stop)
+		writer.Wait()
+	}
+}
+
+// BenchmarkConcurrentSelect runs the same indexed and scanning selects from parallel
+// goroutines, either together as reads only take shared locks, or one at a time as
+// when every read took the database lock
+func BenchmarkConcurrentSelect(b *testing.B) {
+	db := NewDatabase("snapshot_test")
+	if _, err := db.Query("create table users (id int primary key, name, age int)"); err != nil {
+		b.Fatal(err)
+	}
+	values := make([]string, 10000)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d, u%d, %d)", i, i, i%90)
+	}
+	if _, err := db.Query("insert into users values " + strings.Join(values, ", ")); err != nil {
+		b.Fatal(err)
+	}
+	queries := []string{
+		"select name from users where id = 4321",
+		"select count(*) as n from users where age = 42",
+	}
+
+	for _, serialized := range []bool{false, true} {
+		name := "parallel"
+		if serialized {
+			name = "serialized"
+		}
+		b.Run(name, func(b *testing.B) {
+			var mu sync.Mutex
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if serialized {
+						mu.Lock()
+					}
+					_, err := db.Query(queries[i%len(queries)])
+					if serialized {
+						mu.Unlock()
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,1425 @@
+package MyDb
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sqliteMagic starts every SQLite database file
+const sqliteMagic = "SQLite format 3\x00"
+
+// sqliteHeaderSize is the size of the file header, which the first page starts with
+const sqliteHeaderSize = 100
+
+// sqlitePageSize is the page size of the files ExportSQLite writes
+const sqlitePageSize = 4096
+
+// sqliteLockPage is the page SQLite leaves unused in files of more than 1 GiB, as it
+// holds the bytes SQLite locks
+const sqliteLockPage = 1<<30/sqlitePageSize + 1
+
+// Kinds of the pages of SQLite b-trees
+const (
+	sqliteIndexInterior = 0x02
+	sqliteTableInterior = 0x05
+	sqliteIndexLeaf     = 0x0a
+	sqliteTableLeaf     = 0x0d
+)
+
+// sqliteTypes are the declared types of the columns of exported tables by column type,
+// which SQLite tools know and ImportSQLite reads back
+var sqliteTypes = [...]string{"TEXT", "INTEGER", "REAL", "BOOLEAN", "DATE", "DATETIME", "JSON", "DECIMAL", "BLOB"}
+
+// ExportSQLite writes tables to a new SQLite database file, every table when no name is
+// given. The file holds the columns with their types, NOT NULL, defaults that are values
+// and foreign keys, the rows, and the primary key, the UNIQUE constraints and the indexes
+// on columns without a filter as indexes. A primary key on one Int column becomes the
+// INTEGER PRIMARY KEY of its table. Bool values are stored as 0 and 1, numbers as
+// numbers and dates as ISO 8601 text. The tables are snapshotted at once, so writes go on
+// while the file is written. The file must not exist
+func (db *Database) ExportSQLite(path string, tableNames ...string) error {
+	tables, err := db.dumpTables()
+	if err != nil {
+		return err
+	}
+	names := tableNames
+	if len(names) == 0 {
+		for tableName := range tables {
+			names = append(names, tableName)
+		}
+		sort.Strings(names)
+	}
+	for _, tableName := range names {
+		if _, exists := tables[tableName]; !exists {
+			return fmt.Errorf("table %s does not exist", tableName)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := &sqliteWriter{file: file, pages: 1, d: &dumper{flavor: DumpSQLite, tables: tables}}
+	err = w.write(names)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// sqliteWriter writes a SQLite database file page by page
+type sqliteWriter struct {
+	file  *os.File
+	pages uint32  // Number of pages taken, the first one holding the schema
+	d     *dumper // Quotes names and writes literals in the SQLite flavor
+}
+
+// sqliteCell is a cell of a b-tree page as stored, with its rowid in table b-trees
+type sqliteCell struct {
+	data  []byte
+	rowid int64
+}
+
+// sqliteIndex is an index of an exported table
+type sqliteIndex struct {
+	name    string
+	columns []string
+	unique  bool
+}
+
+// write writes the tables, then the schema and the file header on the first page
+func (w *sqliteWriter) write(names []string) error {
+	var schema []sqliteCell
+	for _, tableName := range names {
+		entries, err := w.writeTable(tableName)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			cell, err := w.cell(int64(len(schema)+1), sqliteRecord(entry), false)
+			if err != nil {
+				return err
+			}
+			schema = append(schema, cell)
+		}
+	}
+	if _, err := w.writeTableTree(schema, 1); err != nil {
+		return err
+	}
+
+	header := make([]byte, sqliteHeaderSize)
+	copy(header, sqliteMagic)
+	binary.BigEndian.PutUint16(header[16:], sqlitePageSize)
+	header[18], header[19] = 1, 1                   // Rollback journal
+	header[21], header[22], header[23] = 64, 32, 32 // Payload fractions
+	binary.BigEndian.PutUint32(header[24:], 1)      // File change counter
+	binary.BigEndian.PutUint32(header[28:], w.pages)
+	binary.BigEndian.PutUint32(header[40:], 1) // Schema cookie
+	binary.BigEndian.PutUint32(header[44:], 4) // Schema format
+	binary.BigEndian.PutUint32(header[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(header[92:], 1) // Change counter the page count is valid for
+	binary.BigEndian.PutUint32(header[96:], 3045000)
+	_, err := w.file.WriteAt(header, 0)
+	return err
+}
+
+// writeTable writes the b-trees of a table and of its indexes, and returns their entries
+// in the schema
+func (w *sqliteWriter) writeTable(tableName string) ([][]any, error) {
+	table := w.d.tables[tableName]
+	columns := table.schema.Columns
+	var key []string
+	for _, def := range columns {
+		if def.PrimaryKey {
+			key = append(key, def.Name)
+		}
+	}
+
+	// A key on one Int column holds the rowids, so the rows go in its order
+	alias := -1
+	if len(key) == 1 {
+		alias = slices.IndexFunc(columns, func(def ColumnDef) bool { return def.Name == key[0] })
+		if columns[alias].Type != Int {
+			alias = -1
+		}
+	}
+	rowids := make([]int64, len(table.rows))
+	records := make([][]any, len(table.rows))
+	for i, row := range table.rows {
+		rowids[i] = int64(i + 1)
+		records[i] = make([]any, len(columns))
+		for j, def := range columns {
+			value, ok := row[def.Name]
+			records[i][j] = sqliteValue(value, ok, def.Type)
+		}
+		if alias >= 0 {
+			id, ok := records[i][alias].(int64)
+			if !ok {
+				return nil, fmt.Errorf("table %s: key %s holds %q, which is not a rowid", tableName, key[0], row[key[0]])
+			}
+			rowids[i] = id
+		}
+	}
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+	if alias >= 0 {
+		sort.Slice(order, func(a, b int) bool { return rowids[order[a]] < rowids[order[b]] })
+	}
+
+	cells := make([]sqliteCell, len(order))
+	for i, r := range order {
+		record := records[r]
+		if alias >= 0 {
+			record = slices.Clone(record)
+			record[alias] = nil // Read from the rowid
+		}
+		cell, err := w.cell(rowids[r], sqliteRecord(record), false)
+		if err != nil {
+			return nil, err
+		}
+		cells[i] = cell
+	}
+	root, err := w.writeTableTree(cells, 0)
+	if err != nil {
+		return nil, err
+	}
+	entries := [][]any{{"table", tableName, tableName, int64(root), w.createTable(tableName, alias)}}
+
+	for _, ix := range w.indexes(tableName, key, alias >= 0) {
+		positions := make([]int, len(ix.columns))
+		for i, column := range ix.columns {
+			positions[i] = slices.IndexFunc(columns, func(def ColumnDef) bool { return def.Name == column })
+		}
+		keys := make([][]any, len(records))
+		for i, record := range records {
+			keys[i] = make([]any, len(positions)+1)
+			for j, p := range positions {
+				keys[i][j] = record[p]
+			}
+			keys[i][len(positions)] = rowids[i]
+		}
+		slices.SortFunc(keys, sqliteCompareRecords)
+		cells := make([]sqliteCell, len(keys))
+		for i, k := range keys {
+			if cells[i], err = w.cell(0, sqliteRecord(k), true); err != nil {
+				return nil, err
+			}
+		}
+		root, err := w.writeIndexTree(cells)
+		if err != nil {
+			return nil, err
+		}
+		create := "CREATE INDEX "
+		if ix.unique {
+			create = "CREATE UNIQUE INDEX "
+		}
+		sql := create + w.d.name(ix.name) + " ON " + w.d.name(tableName) + " " + w.d.names(ix.columns)
+		entries = append(entries, []any{"index", ix.name, tableName, int64(root), sql})
+	}
+	return entries, nil
+}
+
+// createTable returns the CREATE TABLE statement of a table, whose keys and UNIQUE
+// constraints are left to its indexes but for the INTEGER PRIMARY KEY
+func (w *sqliteWriter) createTable(tableName string, alias int) string {
+	schema := w.d.tables[tableName].schema
+	var lines []string
+	for i, def := range schema.Columns {
+		parts := []string{w.d.name(def.Name), sqliteTypes[def.Type]}
+		if i == alias {
+			parts = append(parts, "PRIMARY KEY")
+		}
+		if def.NotNull || def.PrimaryKey && i != alias {
+			parts = append(parts, "NOT NULL")
+		}
+		if def.Default != "" && def.DefaultFunc == "" {
+			parts = append(parts, "DEFAULT "+w.d.literal(def.Default, true, def.Type))
+		}
+		lines = append(lines, strings.Join(parts, " "))
+	}
+	for _, fk := range schema.ForeignKeys {
+		lines = append(lines, w.d.foreignKey(fk))
+	}
+	return "CREATE TABLE " + w.d.name(tableName) + " (" + strings.Join(lines, ", ") + ")"
+}
+
+// indexes returns the indexes of a table in the file: its primary key unless its rowids
+// hold it, its UNIQUE constraints and its indexes on columns without a filter
+func (w *sqliteWriter) indexes(tableName string, key []string, rowidKey bool) []sqliteIndex {
+	schema := w.d.tables[tableName].schema
+	var indexes []sqliteIndex
+	if len(key) > 0 && !rowidKey {
+		indexes = append(indexes, sqliteIndex{tableName + "_pkey", key, true})
+	}
+	unique := slices.Clone(schema.Unique)
+	for _, def := range schema.Columns {
+		if def.Unique {
+			unique = append(unique, []string{def.Name})
+		}
+	}
+	for _, columns := range unique {
+		indexes = append(indexes, sqliteIndex{tableName + "_" + strings.Join(columns, "_") + "_key", columns, true})
+	}
+	for _, ix := range schema.Indexes {
+		if ix.Expression == "" && ix.Filter == "" {
+			indexes = append(indexes, sqliteIndex{ix.Name, ix.Columns, false})
+		}
+	}
+	return indexes
+}
+
+// sqliteValue returns a value of a column type as stored by SQLite: nil for NULL, int64,
+// float64, string for text and []byte for blobs
+func sqliteValue(value string, ok bool, typ ColumnType) any {
+	switch {
+	case !ok || value == Null:
+		return nil
+	case typ == Blob:
+		return []byte(value)
+	case typ == Int || typ == Decimal:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+		if typ == Decimal && isFinite(value) {
+			// Kept as text when the float would lose digits
+			f, _ := strconv.ParseFloat(value, 64)
+			if back, err := Decimal.normalize(strconv.FormatFloat(f, 'g', -1, 64)); err == nil && back == value {
+				return f
+			}
+		}
+	case typ == Float && isFinite(value):
+		f, _ := strconv.ParseFloat(value, 64)
+		return f
+	case typ == Bool && value == "true":
+		return int64(1)
+	case typ == Bool && value == "false":
+		return int64(0)
+	}
+	if !utf8.ValidString(value) {
+		return []byte(value)
+	}
+	return value
+}
+
+// allocate takes a new page
+func (w *sqliteWriter) allocate() uint32 {
+	w.pages++
+	if w.pages == sqliteLockPage {
+		w.pages++
+	}
+	return w.pages
+}
+
+// writePage writes a page at its place in the file
+func (w *sqliteWriter) writePage(number uint32, page []byte) error {
+	_, err := w.file.WriteAt(page, int64(number-1)*sqlitePageSize)
+	return err
+}
+
+// cell returns the cell of a payload, that of a table b-tree with its rowid or that of
+// an index b-tree, writing the part of the payload the cell cannot hold to overflow pages
+func (w *sqliteWriter) cell(rowid int64, payload []byte, index bool) (sqliteCell, error) {
+	data := sqliteAppendVarint(nil, uint64(len(payload)))
+	if !index {
+		data = sqliteAppendVarint(data, uint64(rowid))
+	}
+	local := sqliteLocal(len(payload), sqlitePageSize, index)
+	data = append(data, payload[:local]...)
+	if local == len(payload) {
+		return sqliteCell{data, rowid}, nil
+	}
+
+	rest := payload[local:]
+	first := w.allocate()
+	data = binary.BigEndian.AppendUint32(data, first)
+	for number := first; number != 0; {
+		page := make([]byte, sqlitePageSize)
+		n := copy(page[4:], rest)
+		rest = rest[n:]
+		next := uint32(0)
+		if len(rest) > 0 {
+			next = w.allocate()
+		}
+		binary.BigEndian.PutUint32(page, next)
+		if err := w.writePage(number, page); err != nil {
+			return sqliteCell{}, err
+		}
+		number = next
+	}
+	return sqliteCell{data, rowid}, nil
+}
+
+// writeTableTree writes a table b-tree holding cells sorted by rowid and returns its
+// root page, which is root unless it is 0. Interior pages hold the highest rowid of each
+// child but the last one
+func (w *sqliteWriter) writeTableTree(cells []sqliteCell, root uint32) (uint32, error) {
+	kind, header := byte(sqliteTableLeaf), 8
+	for {
+		offset := 0
+		if root == 1 {
+			offset = sqliteHeaderSize
+		}
+		if n := sqliteFill(cells, offset+header, kind == sqliteTableInterior); n == len(cells) {
+			if root == 0 {
+				root = w.allocate()
+			}
+			return root, w.writeTreePage(root, kind, cells, offset)
+		}
+
+		// Split the level into pages, the next level holding a cell for each page
+		var parents []sqliteCell
+		for len(cells) > 0 {
+			n := sqliteFill(cells, header, kind == sqliteTableInterior)
+			if n == len(cells) && len(parents) == 0 || n == len(cells)-1 && n > 1 {
+				n = max(n-1, 1) // Leave a page a cell to hold
+			}
+			number := w.allocate()
+			if err := w.writeTreePage(number, kind, cells[:n], 0); err != nil {
+				return 0, err
+			}
+			rowid := cells[n-1].rowid
+			data := sqliteAppendVarint(binary.BigEndian.AppendUint32(nil, number), uint64(rowid))
+			parents = append(parents, sqliteCell{data, rowid})
+			cells = cells[n:]
+		}
+		cells, kind, header = parents, sqliteTableInterior, 12
+	}
+}
+
+// writeIndexTree writes an index b-tree holding cells sorted by key and returns its root
+// page. Unlike table b-trees every entry is held once, those between two pages moving up
+// to their parent
+func (w *sqliteWriter) writeIndexTree(cells []sqliteCell) (uint32, error) {
+	if sqliteFill(cells, 8, false) == len(cells) {
+		root := w.allocate()
+		return root, w.writeTreePage(root, sqliteIndexLeaf, cells, 0)
+	}
+
+	// Write the leaves, the cells between them going up
+	var children []uint32
+	var between []sqliteCell
+	for len(cells) > 0 {
+		n := sqliteFill(cells, 8, false)
+		if n == len(cells)-1 {
+			n-- // Leave the last leaf a cell to hold
+		}
+		number := w.allocate()
+		if err := w.writeTreePage(number, sqliteIndexLeaf, cells[:n], 0); err != nil {
+			return 0, err
+		}
+		children = append(children, number)
+		if n == len(cells) {
+			break
+		}
+		between = append(between, cells[n])
+		cells = cells[n+1:]
+	}
+
+	// Write the interior pages, each cell holding the child on its left
+	for {
+		level := make([]sqliteCell, len(between))
+		for i, c := range between {
+			level[i].data = append(binary.BigEndian.AppendUint32(nil, children[i]), c.data...)
+		}
+		last := children[len(children)-1]
+		if sqliteFill(level, 12, false) == len(level) {
+			root := w.allocate()
+			return root, w.writeTreePage(root, sqliteIndexInterior, append(level, sqliteCell{rightChild(last), 0}), 0)
+		}
+
+		var upChildren []uint32
+		var upBetween []sqliteCell
+		for start := 0; ; {
+			rest := level[start:]
+			n := sqliteFill(rest, 12, false)
+			right := last
+			if n < len(rest) {
+				if n == len(rest)-1 {
+					n-- // Leave the last page a cell to hold
+				}
+				right = children[start+n]
+			}
+			number := w.allocate()
+			if err := w.writeTreePage(number, sqliteIndexInterior, append(rest[:n:n], sqliteCell{rightChild(right), 0}), 0); err != nil {
+				return 0, err
+			}
+			upChildren = append(upChildren, number)
+			if n == len(rest) {
+				break
+			}
+			upBetween = append(upBetween, between[start+n])
+			start += n + 1
+		}
+		children, between = upChildren, upBetween
+	}
+}
+
+// rightChild returns the data of the pseudo cell writeTreePage takes the right-most
+// child of an interior page from
+func rightChild(number uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, number)
+}
+
+// sqliteFill returns how many of the cells a page holds after a header of a size. The
+// last cell of the pages of table interior levels is the right-most child, which takes
+// no room in the cell area
+func sqliteFill(cells []sqliteCell, header int, lastIsChild bool) int {
+	used := header
+	for i, c := range cells {
+		if lastIsChild && i > 0 {
+			used += len(cells[i-1].data) + 2
+		} else if !lastIsChild {
+			used += len(c.data) + 2
+		}
+		if used > sqlitePageSize {
+			return i
+		}
+	}
+	return len(cells)
+}
+
+// writeTreePage writes a b-tree page of a kind holding cells, starting at an offset,
+// which is the size of the file header on the first page. The last cell of interior
+// pages is the right-most child, of which only the page number is kept
+func (w *sqliteWriter) writeTreePage(number uint32, kind byte, cells []sqliteCell, offset int) error {
+	page := make([]byte, sqlitePageSize)
+	header := 8
+	if kind == sqliteTableInterior || kind == sqliteIndexInterior {
+		header = 12
+		copy(page[offset+8:], cells[len(cells)-1].data[:4])
+		cells = cells[:len(cells)-1]
+	}
+	page[offset] = kind
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	end := sqlitePageSize
+	for i, c := range cells {
+		end -= len(c.data)
+		copy(page[end:], c.data)
+		binary.BigEndian.PutUint16(page[offset+header+2*i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(end))
+	return w.writePage(number, page)
+}
+
+// sqliteLocal returns how many bytes of a payload of a size a cell holds in a page with
+// a usable size, the rest going to overflow pages
+func sqliteLocal(size, usable int, index bool) int {
+	most := usable - 35
+	if index {
+		most = (usable-12)*64/255 - 23
+	}
+	if size <= most {
+		return size
+	}
+	least := (usable-12)*32/255 - 23
+	if local := least + (size-least)%(usable-4); local <= most {
+		return local
+	}
+	return least
+}
+
+// sqliteAppendVarint appends a varint of SQLite, big-endian and of at most 9 bytes
+func sqliteAppendVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var groups [8]byte
+	n := 0
+	for {
+		groups[n] = byte(v & 0x7f)
+		n++
+		if v >>= 7; v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		if i > 0 {
+			groups[i] |= 0x80
+		}
+		b = append(b, groups[i])
+	}
+	return b
+}
+
+// sqliteVarint reads a varint of SQLite and returns it with its size, 0 when it is cut
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8 && i < len(b); i++ {
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	if len(b) < 9 {
+		return 0, 0
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+// sqliteRecord returns the record of values as SQLite stores rows and index entries: a
+// header with the serial type of each value, then the values
+func sqliteRecord(values []any) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = append(types, 0)
+		case int64:
+			switch {
+			case v == 0 || v == 1:
+				types = append(types, 8+byte(v))
+			default:
+				size, serial := 8, 6
+				for i, s := range []int{1, 2, 3, 4, 6} {
+					if limit := int64(1) << (8*s - 1); v >= -limit && v < limit {
+						size, serial = s, i+1
+						break
+					}
+				}
+				types = append(types, byte(serial))
+				for i := size - 1; i >= 0; i-- {
+					body = append(body, byte(v>>(8*i)))
+				}
+			}
+		case float64:
+			types = append(types, 7)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			types = sqliteAppendVarint(types, uint64(13+2*len(v)))
+			body = append(body, v...)
+		case []byte:
+			types = sqliteAppendVarint(types, uint64(12+2*len(v)))
+			body = append(body, v...)
+		}
+	}
+	size := len(types) + 1
+	for len(sqliteAppendVarint(nil, uint64(size))) != size-len(types) {
+		size++
+	}
+	record := sqliteAppendVarint(nil, uint64(size))
+	return append(append(record, types...), body...)
+}
+
+// sqliteDecode returns the values of a record
+func sqliteDecode(record []byte) ([]any, error) {
+	size, n := sqliteVarint(record)
+	if n == 0 || size < uint64(n) || size > uint64(len(record)) {
+		return nil, fmt.Errorf("malformed record")
+	}
+	types, body := record[n:size], record[size:]
+	var values []any
+	for len(types) > 0 {
+		serial, n := sqliteVarint(types)
+		if n == 0 || serial == 10 || serial == 11 {
+			return nil, fmt.Errorf("malformed record")
+		}
+		types = types[n:]
+		length := uint64([]int{0, 1, 2, 3, 4, 6, 8, 8, 0, 0}[min(serial, 9)])
+		if serial >= 12 {
+			length = (serial - 12) / 2
+		}
+		if length > uint64(len(body)) {
+			return nil, fmt.Errorf("malformed record")
+		}
+		data := body[:length]
+		body = body[length:]
+		switch {
+		case serial == 0:
+			values = append(values, nil)
+		case serial == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(data)))
+		case serial == 8 || serial == 9:
+			values = append(values, int64(serial-8))
+		case serial < 7:
+			v := int64(int8(data[0]))
+			for _, b := range data[1:] {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+		case serial%2 == 0:
+			values = append(values, bytes.Clone(data))
+		default:
+			values = append(values, string(data))
+		}
+	}
+	return values, nil
+}
+
+// sqliteCompareRecords compares index entries as SQLite does, value by value
+func sqliteCompareRecords(a, b []any) int {
+	for i := range a {
+		if c := sqliteCompare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// sqliteCompare compares values as SQLite sorts them: NULL first, then numbers, text and
+// blobs, text and blobs byte by byte
+func sqliteCompare(a, b any) int {
+	rank := func(v any) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case int64, float64:
+			return 1
+		case string:
+			return 2
+		}
+		return 3
+	}
+	if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+		return c
+	}
+	switch a := a.(type) {
+	case int64:
+		if f, ok := b.(float64); ok {
+			return compareIntFloat(a, f)
+		}
+		return cmp.Compare(a, b.(int64))
+	case float64:
+		if n, ok := b.(int64); ok {
+			return -compareIntFloat(n, a)
+		}
+		return cmp.Compare(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case []byte:
+		return bytes.Compare(a, b.([]byte))
+	}
+	return 0
+}
+
+// compareIntFloat compares an integer and a float without losing digits of either
+func compareIntFloat(n int64, f float64) int {
+	switch {
+	case f < math.MinInt64:
+		return 1
+	case f >= math.MaxInt64:
+		return -1
+	}
+	if c := cmp.Compare(n, int64(f)); c != 0 {
+		return c
+	}
+	return cmp.Compare(float64(n), f)
+}
+
+// ImportSQLite imports the tables of a SQLite database file into tables of the same
+// names, every table when no name is given, and returns the report of each table. Tables
+// that do not exist are created with the columns of the SQLite tables, typed after their
+// declared types, with their primary keys, NOT NULL and UNIQUE constraints and defaults
+// that are values. The rows are inserted as ImportCSV does with the Columns, SkipBadRows
+// and BatchSize options. The file is read as it is on disk, so changes still in its
+// write-ahead log must be checkpointed first, and WITHOUT ROWID tables are not read
+func (db *Database) ImportSQLite(path string, opts ImportOptions, tableNames ...string) (map[string]ImportReport, error) {
+	r, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.file.Close()
+	tables, err := r.tables()
+	if err != nil {
+		return nil, err
+	}
+	if len(tableNames) > 0 {
+		var named []sqliteTable
+		for _, name := range tableNames {
+			i := slices.IndexFunc(tables, func(t sqliteTable) bool { return strings.EqualFold(t.name, name) })
+			if i < 0 {
+				return nil, fmt.Errorf("table %s does not exist in %s", name, path)
+			}
+			named = append(named, tables[i])
+		}
+		tables = named
+	}
+
+	reports := make(map[string]ImportReport, len(tables))
+	for _, t := range tables {
+		tableName := safeName(t.name, "table")
+		report, err := db.importSQLiteTable(r, t, tableName, opts)
+		reports[tableName] = report
+		if err != nil {
+			return reports, fmt.Errorf("table %s: %w", t.name, err)
+		}
+	}
+	return reports, nil
+}
+
+// importSQLiteTable imports a table of a SQLite file into a table, which it creates if
+// needed
+func (db *Database) importSQLiteTable(r *sqliteReader, t sqliteTable, tableName string, opts ImportOptions) (ImportReport, error) {
+	if t.withoutRowid {
+		return ImportReport{}, fmt.Errorf("WITHOUT ROWID tables cannot be imported")
+	}
+	header := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		header[i] = c.name
+	}
+	columns := sheetColumns(header, opts.Columns)
+	for i, c := range t.columns {
+		if c.virtual {
+			columns[i] = ""
+		}
+	}
+	if _, err := db.tableColumns(tableName); err != nil {
+		if err := db.createSQLiteTable(t, tableName, columns); err != nil {
+			return ImportReport{}, err
+		}
+	}
+	im, table, err := db.newImporter(tableName, opts)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	table.mu.RLock()
+	tableColumns := table.Columns
+	table.mu.RUnlock()
+	for _, column := range columns {
+		if column != "" {
+			if err := checkColumns(tableName, tableColumns, []string{column}); err != nil {
+				return ImportReport{}, err
+			}
+		}
+	}
+
+	// Insert the rows batch by batch, in rowid order
+	number := 0
+	err = r.walk(t.root, 0, func(rowid int64, payload []byte) error {
+		number++
+		values, err := sqliteDecode(payload)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", rowid, err)
+		}
+		// Columns added after the row was written are left out, so they get their defaults
+		row := make(map[string]string, len(columns))
+		stored := 0 // Virtual generated columns are not stored
+		for i, c := range t.columns {
+			if c.virtual {
+				continue
+			}
+			if stored++; stored > len(values) || columns[i] == "" {
+				continue
+			}
+			value := values[stored-1]
+			if c.rowid {
+				value = rowid
+			}
+			row[columns[i]] = sqliteText(value)
+		}
+		return im.add(row, 0, number)
+	})
+	if flushErr := im.flush(); err == nil {
+		err = flushErr
+	}
+	return im.report, err
+}
+
+// createSQLiteTable creates the table of a SQLite table with the columns it is imported
+// into
+func (db *Database) createSQLiteTable(t sqliteTable, tableName string, columns []string) error {
+	names := columnNames(t.columns)
+	mapped := func(sqliteColumns []string) []string {
+		mapped := make([]string, len(sqliteColumns))
+		for i, name := range sqliteColumns {
+			if j := slices.Index(names, name); j >= 0 {
+				mapped[i] = columns[j]
+			}
+		}
+		return mapped
+	}
+
+	// The unique index named after the table and "pkey" of an exported table is its key
+	var indexes []sqliteIndex
+	for _, ix := range t.indexes {
+		if ix.unique && ix.name == t.name+"_pkey" && len(t.primaryKey) == 0 && !slices.ContainsFunc(t.columns, func(c sqliteColumn) bool { return c.primaryKey }) {
+			t.primaryKey = ix.columns
+			continue
+		}
+		indexes = append(indexes, ix)
+	}
+
+	var defs []ColumnDef
+	for i, c := range t.columns {
+		if columns[i] == "" {
+			continue
+		}
+		def := ColumnDef{
+			Name:          columns[i],
+			Type:          sqliteColumnType(c.typ),
+			PrimaryKey:    c.primaryKey || len(t.primaryKey) > 0 && slices.Contains(t.primaryKey, c.name),
+			Unique:        c.unique,
+			NotNull:       c.notNull,
+			AutoIncrement: c.rowid,
+		}
+		if c.hasDefault {
+			if value, err := def.Type.normalize(c.defaultValue); err == nil && value != Null {
+				def.Default = value
+			}
+		}
+		defs = append(defs, def)
+	}
+	err := db.CreateTableWithSchema(tableName, defs)
+	if err != nil {
+		return err
+	}
+	for _, unique := range t.unique {
+		if keyed := mapped(unique); !slices.Contains(keyed, "") {
+			if err := db.AddUnique(tableName, keyed...); err != nil {
+				return err
+			}
+		}
+	}
+	for _, ix := range indexes {
+		keyed := mapped(ix.columns)
+		switch {
+		case slices.Contains(keyed, ""):
+		case ix.unique:
+			err = db.CreateUniqueIndex(tableName, keyed...)
+		default:
+			err = db.CreateCompositeIndex(tableName, keyed)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteColumnType returns the column type of a declared SQLite type: the type of the
+// same name, or else the type of its SQLite affinity, String when it has none
+func sqliteColumnType(declared string) ColumnType {
+	name := strings.TrimSpace(strings.ToLower(declared))
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	if t, ok := parseColumnType(name); ok {
+		return t
+	}
+	switch {
+	case strings.Contains(name, "int"):
+		return Int
+	case strings.Contains(name, "char"), strings.Contains(name, "clob"), strings.Contains(name, "text"):
+		return String
+	case strings.Contains(name, "blob"):
+		return Blob
+	case strings.Contains(name, "real"), strings.Contains(name, "floa"), strings.Contains(name, "doub"):
+		return Float
+	}
+	return String
+}
+
+// sqliteText returns a value read from a SQLite file as text, Null for NULL
+func sqliteText(value any) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return Null
+}
+
+// sqliteReader reads the tables of a SQLite database file
+type sqliteReader struct {
+	file     *os.File
+	pageSize int
+	usable   int    // Bytes of each page holding b-tree data
+	pages    uint32 // Number of pages of the file
+}
+
+// openSQLite opens a SQLite database file and reads its header
+func openSQLite(path string) (*sqliteReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newSQLiteReader(file, path)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// newSQLiteReader reads the header of a SQLite database file
+func newSQLiteReader(file *os.File, path string) (*sqliteReader, error) {
+	header := make([]byte, sqliteHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil || string(header[:16]) != sqliteMagic {
+		return nil, fmt.Errorf("%s is not a SQLite database", path)
+	}
+	pageSize := int(binary.BigEndian.Uint16(header[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 || int(header[20]) > pageSize-480 {
+		return nil, fmt.Errorf("%s is not a SQLite database", path)
+	}
+	if encoding := binary.BigEndian.Uint32(header[56:]); encoding > 1 {
+		return nil, fmt.Errorf("%s holds UTF-16 text, which cannot be imported", path)
+	}
+	if header[18] == 2 {
+		if info, err := os.Stat(path + "-wal"); err == nil && info.Size() > 0 {
+			return nil, fmt.Errorf("%s has changes in its write-ahead log, checkpoint them first", path)
+		}
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteReader{
+		file:     file,
+		pageSize: pageSize,
+		usable:   pageSize - int(header[20]),
+		pages:    uint32(info.Size() / int64(pageSize)),
+	}, nil
+}
+
+// sqliteTable is a table of a SQLite database file
+type sqliteTable struct {
+	name         string
+	root         uint32         // Root page of its b-tree
+	columns      []sqliteColumn // Columns in order
+	primaryKey   []string       // Columns of a PRIMARY KEY constraint
+	unique       [][]string     // Columns of UNIQUE constraints
+	indexes      []sqliteIndex  // Indexes on columns
+	withoutRowid bool
+}
+
+// sqliteColumn is a column of a table of a SQLite database file
+type sqliteColumn struct {
+	name         string
+	typ          string // Declared type
+	primaryKey   bool
+	desc         bool // A descending PRIMARY KEY
+	unique       bool
+	notNull      bool
+	defaultValue string
+	hasDefault   bool
+	rowid        bool // The INTEGER PRIMARY KEY column, whose values are the rowids
+	virtual      bool // A generated column that is not stored
+}
+
+// columnNames returns the names of columns of a SQLite table
+func columnNames(columns []sqliteColumn) []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// tables returns the tables of the schema with their indexes on columns, in the order
+// they were created, leaving out the internal tables of SQLite and virtual tables
+func (r *sqliteReader) tables() ([]sqliteTable, error) {
+	var tables []sqliteTable
+	indexes := make(map[string][]sqliteIndex)
+	err := r.walk(1, 0, func(rowid int64, payload []byte) error {
+		values, err := sqliteDecode(payload)
+		if err != nil {
+			return fmt.Errorf("schema: %w", err)
+		}
+		if len(values) < 5 {
+			return nil
+		}
+		name, _ := values[1].(string)
+		tableName, _ := values[2].(string)
+		root, _ := values[3].(int64)
+		sql, _ := values[4].(string)
+		switch {
+		case values[0] == "index":
+			if ix, ok := parseSQLiteIndex(sql); ok {
+				ix.name = name
+				indexes[tableName] = append(indexes[tableName], ix)
+			}
+		case values[0] == "table" && !strings.HasPrefix(strings.ToLower(name), "sqlite_") && root > 0:
+			t := parseSQLiteTable(sql)
+			t.name, t.root = name, uint32(root)
+			tables = append(tables, t)
+		}
+		return nil
+	})
+	for i, t := range tables {
+		tables[i].indexes = indexes[t.name]
+	}
+	return tables, err
+}
+
+// page reads a page of the file
+func (r *sqliteReader) page(number uint32) ([]byte, error) {
+	if number == 0 || number > r.pages {
+		return nil, fmt.Errorf("malformed database: page %d is out of the file", number)
+	}
+	page := make([]byte, r.pageSize)
+	_, err := r.file.ReadAt(page, int64(number-1)*int64(r.pageSize))
+	return page[:r.usable], err
+}
+
+// walk calls a function with the rowid and the payload of the rows of a table b-tree in
+// rowid order, depth being that of its root page in the b-tree
+func (r *sqliteReader) walk(root uint32, depth int, fn func(rowid int64, payload []byte) error) error {
+	if depth > 64 {
+		return fmt.Errorf("malformed database: b-tree of page %d is too deep", root)
+	}
+	page, err := r.page(root)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	if root == 1 {
+		offset = sqliteHeaderSize
+	}
+	kind, header := page[offset], 8
+	switch kind {
+	case sqliteTableInterior:
+		header = 12
+	case sqliteTableLeaf:
+	default:
+		return fmt.Errorf("malformed database: page %d is not a table page", root)
+	}
+	count := int(binary.BigEndian.Uint16(page[offset+3:]))
+	if offset+header+2*count > len(page) {
+		return fmt.Errorf("malformed database: page %d holds too many cells", root)
+	}
+
+	for i := 0; i < count; i++ {
+		at := int(binary.BigEndian.Uint16(page[offset+header+2*i:]))
+		if at >= len(page) {
+			return fmt.Errorf("malformed database: cell %d of page %d is out of the page", i, root)
+		}
+		cell := page[at:]
+		if kind == sqliteTableInterior {
+			if len(cell) < 4 {
+				return fmt.Errorf("malformed database: cell %d of page %d is cut", i, root)
+			}
+			if err := r.walk(binary.BigEndian.Uint32(cell), depth+1, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		size, n := sqliteVarint(cell)
+		rowid, m := sqliteVarint(cell[n:])
+		if n == 0 || m == 0 {
+			return fmt.Errorf("malformed database: cell %d of page %d is cut", i, root)
+		}
+		payload, err := r.payload(cell[n+m:], size)
+		if err != nil {
+			return err
+		}
+		if err := fn(int64(rowid), payload); err != nil {
+			return err
+		}
+	}
+	if kind == sqliteTableInterior {
+		return r.walk(binary.BigEndian.Uint32(page[offset+8:]), depth+1, fn)
+	}
+	return nil
+}
+
+// payload returns the payload of a size of a table cell, reading the part the cell does
+// not hold from its overflow pages
+func (r *sqliteReader) payload(cell []byte, size uint64) ([]byte, error) {
+	if size > uint64(r.pages)*uint64(r.pageSize) {
+		return nil, fmt.Errorf("malformed database: payload of %d bytes is larger than the file", size)
+	}
+	local := sqliteLocal(int(size), r.usable, false)
+	if local > len(cell) || local < int(size) && local+4 > len(cell) {
+		return nil, fmt.Errorf("malformed database: cell is cut")
+	}
+	payload := make([]byte, 0, size)
+	payload = append(payload, cell[:local]...)
+	if local == int(size) {
+		return payload, nil
+	}
+	for next := binary.BigEndian.Uint32(cell[local:]); len(payload) < int(size); {
+		page, err := r.page(next)
+		if err != nil {
+			return nil, err
+		}
+		payload = append(payload, page[4:4+min(int(size)-len(payload), r.usable-4)]...)
+		next = binary.BigEndian.Uint32(page)
+	}
+	return payload, nil
+}
+
+// sqliteToken is a token of the SQL of a SQLite schema
+type sqliteToken struct {
+	text string
+	kind byte // 'w' for words and numbers, 'n' for quoted names, 's' for strings and 'p' for punctuation
+}
+
+// sqliteTokens splits SQL into tokens, leaving out comments
+func sqliteTokens(sql string) []sqliteToken {
+	var tokens []sqliteToken
+	word := func(c byte) bool {
+		return c == '_' || c == '$' || c == '.' || c >= 0x80 || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(sql)
+			}
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing, kind := c, byte('n')
+			switch c {
+			case '[':
+				closing = ']'
+			case '\'':
+				kind = 's'
+			}
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(sql); j++ {
+				if sql[j] == closing {
+					if closing == ']' || j+1 == len(sql) || sql[j+1] != closing {
+						j++
+						break
+					}
+					j++ // Doubled quote
+				}
+				b.WriteByte(sql[j])
+			}
+			tokens = append(tokens, sqliteToken{b.String(), kind})
+			i = j
+		case word(c):
+			j := i + 1
+			for j < len(sql) && (word(sql[j]) || (sql[j] == '+' || sql[j] == '-') &&
+				(sql[j-1] == 'e' || sql[j-1] == 'E') && c >= '0' && c <= '9') {
+				j++
+			}
+			tokens = append(tokens, sqliteToken{sql[i:j], 'w'})
+			i = j
+		default:
+			tokens = append(tokens, sqliteToken{string(c), 'p'})
+			i++
+		}
+	}
+	return tokens
+}
+
+// is reports whether a token is a keyword or a punctuation character
+func (t sqliteToken) is(text string) bool {
+	return (t.kind == 'w' || t.kind == 'p') && strings.EqualFold(t.text, text)
+}
+
+// parseSQLiteTable reads the columns and the constraints of a table from its CREATE
+// TABLE statement
+func parseSQLiteTable(sql string) sqliteTable {
+	var t sqliteTable
+	tokens := sqliteTokens(sql)
+	start := slices.IndexFunc(tokens, func(tok sqliteToken) bool { return tok.is("(") })
+	if start < 0 {
+		return t
+	}
+
+	// Split the definitions at the commas outside parentheses
+	var items [][]sqliteToken
+	var item []sqliteToken
+	depth, end := 0, len(tokens)
+	for i := start + 1; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.is("("):
+			depth++
+		case tok.is(")") && depth == 0:
+			end = i
+		case tok.is(")"):
+			depth--
+		case tok.is(",") && depth == 0:
+			items, item = append(items, item), nil
+			continue
+		}
+		if end < len(tokens) {
+			break
+		}
+		item = append(item, tok)
+	}
+	items = append(items, item)
+	for i := end; i+1 < len(tokens); i++ {
+		if tokens[i].is("without") && tokens[i+1].is("rowid") {
+			t.withoutRowid = true
+		}
+	}
+
+	for _, item := range items {
+		if len(item) == 0 {
+			continue
+		}
+		switch first := item[0]; {
+		case first.is("constraint"), first.is("primary"), first.is("unique"), first.is("check"), first.is("foreign"):
+			for i, tok := range item {
+				switch {
+				case tok.is("primary") && i+2 < len(item) && item[i+1].is("key"):
+					t.primaryKey, _, _ = sqliteNameList(item[i+2:])
+				case tok.is("unique") && i+1 < len(item):
+					if columns, _, ok := sqliteNameList(item[i+1:]); ok {
+						t.unique = append(t.unique, columns)
+					}
+				}
+			}
+		default:
+			t.columns = append(t.columns, parseSQLiteColumn(item))
+		}
+	}
+
+	// An INTEGER PRIMARY KEY holds the rowids, unless the column declares it descending
+	if !t.withoutRowid {
+		for i, c := range t.columns {
+			if strings.EqualFold(c.typ, "integer") && (c.primaryKey && !c.desc || len(t.primaryKey) == 1 && t.primaryKey[0] == c.name) {
+				t.columns[i].rowid = true
+				break
+			}
+		}
+	}
+	return t
+}
+
+// sqliteColumnConstraints are the keywords starting column constraints, which end the
+// declared type of a column
+var sqliteColumnConstraints = []string{"constraint", "primary", "not", "null", "unique", "check", "default", "collate", "references", "generated", "as"}
+
+// parseSQLiteColumn reads a column definition
+func parseSQLiteColumn(item []sqliteToken) sqliteColumn {
+	c := sqliteColumn{name: item[0].text}
+	i := 1
+	var typ []string
+	for ; i < len(item) && !item[i].is("("); i++ {
+		if item[i].kind == 'p' || item[i].kind == 'w' && slices.Contains(sqliteColumnConstraints, strings.ToLower(item[i].text)) {
+			break
+		}
+		typ = append(typ, item[i].text)
+	}
+	c.typ = strings.Join(typ, " ")
+
+	depth := 0
+	for ; i < len(item); i++ {
+		tok := item[i]
+		switch {
+		case tok.is("("):
+			depth++
+		case tok.is(")"):
+			depth--
+		case depth > 0:
+		case tok.is("primary"):
+			c.primaryKey = true
+			c.desc = i+2 < len(item) && item[i+2].is("desc")
+		case tok.is("not") && i+1 < len(item) && item[i+1].is("null"):
+			c.notNull = true
+		case tok.is("unique"):
+			c.unique = true
+		case tok.is("default") && i+1 < len(item):
+			c.defaultValue, c.hasDefault = sqliteDefault(item[i+1:])
+		case tok.is("generated"), tok.is("as"):
+			c.virtual = !slices.ContainsFunc(item[i:], func(tok sqliteToken) bool { return tok.is("stored") })
+		}
+	}
+	return c
+}
+
+// sqliteDefault returns the default value of a column from the tokens after DEFAULT,
+// false when it is NULL or an expression
+func sqliteDefault(tokens []sqliteToken) (string, bool) {
+	sign := ""
+	if tokens[0].is("-") || tokens[0].is("+") {
+		sign, tokens = strings.TrimPrefix(tokens[0].text, "+"), tokens[1:]
+		if len(tokens) == 0 {
+			return "", false
+		}
+	}
+	tok := tokens[0]
+	switch {
+	case tok.kind == 's' || tok.kind == 'n':
+		return tok.text, sign == ""
+	case tok.is("true"):
+		return "1", true
+	case tok.is("false"):
+		return "0", true
+	case tok.kind == 'w' && isFinite(tok.text):
+		return sign + tok.text, true
+	}
+	return "", false
+}
+
+// parseSQLiteIndex reads the columns of an index from its CREATE INDEX statement, false
+// for the indexes on expressions and partial indexes
+func parseSQLiteIndex(sql string) (sqliteIndex, bool) {
+	tokens := sqliteTokens(sql)
+	on := slices.IndexFunc(tokens, func(tok sqliteToken) bool { return tok.is("on") })
+	if on < 0 || on+2 >= len(tokens) {
+		return sqliteIndex{}, false
+	}
+	columns, rest, ok := sqliteNameList(tokens[on+2:])
+	if !ok || len(rest) > 0 {
+		return sqliteIndex{}, false // An expression or a WHERE clause
+	}
+	unique := slices.ContainsFunc(tokens[:on], func(tok sqliteToken) bool { return tok.is("unique") })
+	return sqliteIndex{columns: columns, unique: unique}, true
+}
+
+// sqliteNameList reads the column names of a parenthesized list, whose entries may have
+// a collation and an order, and returns the tokens after it. It returns false when an
+// entry is an expression
+func sqliteNameList(tokens []sqliteToken) ([]string, []sqliteToken, bool) {
+	if len(tokens) == 0 || !tokens[0].is("(") {
+		return nil, nil, false
+	}
+	var names []string
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i].kind != 'w' && tokens[i].kind != 'n' {
+			return nil, nil, false
+		}
+		names = append(names, tokens[i].text)
+		for i++; i < len(tokens); i++ {
+			switch tok := tokens[i]; {
+			case tok.is("collate") && i+1 < len(tokens):
+				i++
+			case tok.is("asc"), tok.is("desc"):
+			case tok.is(","):
+			case tok.is(")"):
+				return names, tokens[i+1:], true
+			default:
+				return nil, nil, false
+			}
+			if tokens[i].is(",") {
+				break
+			}
+		}
+	}
+	return nil, nil, false
+}
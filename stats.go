@@ -0,0 +1,193 @@
+package MyDb
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnStats holds statistics about the values of a column
+type ColumnStats struct {
+	Distinct int    // Number of distinct values, NULL excepted
+	Nulls    int    // Number of rows where the column is NULL
+	Min      string // Smallest value in the order of the column type, empty when all are NULL
+	Max      string // Largest value in the order of the column type, empty when all are NULL
+}
+
+// TableStats holds the statistics of a table gathered by Analyze
+type TableStats struct {
+	Rows       int                    // Number of rows
+	Columns    map[string]ColumnStats // Statistics by column
+	AnalyzedAt time.Time              // When the statistics were gathered
+}
+
+// Analyze gathers the number of rows of a table and, for each column, the number of
+// distinct and NULL values and the smallest and largest values. EXPLAIN uses them to
+// estimate the rows of filters and joins. The statistics are not updated as rows change,
+// so Analyze should run again after large changes
+func (db *Database) Analyze(tableName string) (TableStats, error) {
+	var stats TableStats
+	err := db.alterTable(tableName, func(table *Table) error {
+		stats = table.analyze()
+		table.stats = &stats
+		return nil
+	})
+	if err != nil {
+		return TableStats{}, err
+	}
+	stats.Columns = maps.Clone(stats.Columns)
+	return stats, nil
+}
+
+// Stats returns the statistics of a table gathered by the last Analyze, or false when
+// the table was never analyzed
+func (db *Database) Stats(tableName string) (TableStats, bool, error) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return TableStats{}, false, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	if table.stats == nil {
+		return TableStats{}, false, nil
+	}
+	stats := *table.stats
+	stats.Columns = maps.Clone(stats.Columns)
+	return stats, true, nil
+}
+
+// analyze computes the statistics of the table. The table lock must be held
+func (t *Table) analyze() TableStats {
+	stats := TableStats{Rows: len(t.Rows), Columns: make(map[string]ColumnStats, len(t.Columns)), AnalyzedAt: time.Now()}
+	for _, col := range t.Columns {
+		typ := t.columnDef(col).Type
+		var colStats ColumnStats
+		seen := make(map[string]bool)
+		for _, row := range t.Rows {
+			value, ok := row[col]
+			if !ok || value == Null {
+				colStats.Nulls++
+				continue
+			}
+			// Count values equal under the = operator once, e.g. 1 and 1.0
+			key := joinKey(value)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if len(seen) == 1 || typ.compare(value, colStats.Min) < 0 {
+				colStats.Min = value
+			}
+			if len(seen) == 1 || typ.compare(value, colStats.Max) > 0 {
+				colStats.Max = value
+			}
+		}
+		colStats.Distinct = len(seen)
+		stats.Columns[col] = colStats
+	}
+	return stats
+}
+
+// columnStats returns the statistics of a column gathered by Analyze, or false when
+// its table was never analyzed
+func (db *Database) columnStats(tableName, column string) (ColumnStats, bool) {
+	db.mu.RLock() // Lock db first
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return ColumnStats{}, false
+	}
+
+	table.mu.RLock() // Lock table second
+	defer table.mu.RUnlock()
+	if table.stats == nil {
+		return ColumnStats{}, false
+	}
+	stats, ok := table.stats.Columns[column]
+	return stats, ok
+}
+
+// estimateFilter estimates how many rows satisfy the equalities of a condition, assuming
+// the rows are evenly spread over the distinct values of each column. Columns are looked
+// up in tableName, or in the table of their qualifier in the qualifiers map
+func (db *Database) estimateFilter(tableName string, qualifiers map[string]string, cond expr, rows int) int {
+	for col := range equalities(cond) {
+		if qualifier, name, ok := strings.Cut(col, "."); ok {
+			tableName, col = qualifiers[qualifier], name
+		}
+		if stats, ok := db.columnStats(tableName, col); ok && stats.Distinct > 0 {
+			rows = (rows + stats.Distinct - 1) / stats.Distinct
+		}
+	}
+	return rows
+}
+
+// estimateJoin estimates the rows of an equality join as the product of the rows of its
+// sides divided by the larger number of distinct values of the keys. The qualifiers map
+// the qualifiers of the keys to their tables. It reports false without statistics
+func (db *Database) estimateJoin(qualifiers map[string]string, join *joinClause, left, right int) (int, bool) {
+	distinct := 0
+	for _, key := range []string{join.leftKey, join.rightKey} {
+		qualifier, col, _ := strings.Cut(key, ".")
+		if stats, ok := db.columnStats(qualifiers[qualifier], col); ok {
+			distinct = max(distinct, stats.Distinct)
+		}
+	}
+	if distinct == 0 {
+		return 0, false
+	}
+	return left * right / distinct, true
+}
+
+// queryAnalyze parses "ANALYZE [table]", gathers the statistics of the table, or of
+// every table when none is given, and returns one row per column
+func (db *Database) queryAnalyze(p *parser) (*Result, error) {
+	if err := p.expect("analyze"); err != nil {
+		return nil, err
+	}
+	tables := db.ListTables()
+	if p.peek().kind != tokenEOF {
+		tableName, err := p.parseName()
+		if err != nil {
+			return nil, fmt.Errorf("invalid ANALYZE command: %w", err)
+		}
+		tables = []string{tableName}
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, fmt.Errorf("invalid ANALYZE command: %w", err)
+	}
+
+	result := &Result{Columns: []string{"table", "column", "rows", "distinct", "nulls", "min", "max"}}
+	for _, tableName := range tables {
+		stats, err := db.Analyze(tableName)
+		if err != nil {
+			return nil, err
+		}
+		columns, err := db.tableColumns(tableName)
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range columns {
+			colStats := stats.Columns[col]
+			row := map[string]string{
+				"table":    tableName,
+				"column":   col,
+				"rows":     strconv.Itoa(stats.Rows),
+				"distinct": strconv.Itoa(colStats.Distinct),
+				"nulls":    strconv.Itoa(colStats.Nulls),
+			}
+			if colStats.Distinct > 0 {
+				row["min"], row["max"] = colStats.Min, colStats.Max
+			}
+			result.Rows = append(result.Rows, row)
+		}
+	}
+	return result, nil
+}
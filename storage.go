@@ -0,0 +1,328 @@
+package MyDb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage is where Save saves the tables of a database and Load loads them from. Each
+// table is stored as CSV or Gob data under its name, and the schema as JSON data
+// describing the column definitions, constraints and indexes of every table. Storages are used by one
+// database at a time, which saves or loads one table at a time
+type Storage interface {
+	// ListTables returns the names of the stored tables
+	ListTables() ([]string, error)
+	// LoadTable opens the data of a table, failing with an error wrapping fs.ErrNotExist
+	// when there is none
+	LoadTable(name string) (io.ReadCloser, error)
+	// SaveTable replaces the data of a table with the data that write writes, keeping
+	// the old data when it fails
+	SaveTable(name string, write func(w io.Writer) error) error
+	// DeleteTable removes the data of a table, doing nothing when there is none
+	DeleteTable(name string) error
+	// LoadSchema opens the schema, failing with an error wrapping fs.ErrNotExist when
+	// there is none
+	LoadSchema() (io.ReadCloser, error)
+	// SaveSchema replaces the schema like SaveTable
+	SaveSchema(write func(w io.Writer) error) error
+}
+
+// blobStore is implemented by storages keeping the BLOB values of tables apart from their
+// data, which then holds the hashes of the values. Other storages get the values in the
+// data of the tables, base64 encoded
+type blobStore interface {
+	writeBlob(tableName, value string) (string, error)
+	readBlob(tableName, hash string) (string, error)
+	removeUnusedBlobs(tableName string, used map[string]bool) error
+}
+
+// SetStorage sets where Save saves the tables and Load loads them from, by default a
+// DirStorage of the database directory. nil restores the default. The next Save saves
+// every table, and the write-ahead log stays in the database directory
+func (db *Database) SetStorage(storage Storage) {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	db.storage = storage
+	db.markDirty(nil) // Not saved to the new storage yet
+}
+
+// store returns the storage of the database. The db lock must be held, or Load running
+func (db *Database) store() Storage {
+	if db.storage != nil {
+		return db.storage
+	}
+	return DirStorage{Dir: db.dir()}
+}
+
+// dir returns the database directory, the path set by WithPath or else the name of the
+// database
+func (db *Database) dir() string {
+	if db.path != "" {
+		return db.path
+	}
+	return db.Name
+}
+
+// blobStore returns the storage of the database when it keeps BLOB values apart, which
+// it does not for encrypted databases
+func (db *Database) blobStore() (blobStore, bool) {
+	store, ok := db.store().(blobStore)
+	return store, ok && db.crypter == nil
+}
+
+// DirStorage stores each table in a file of a directory, name.csv for CSV data and
+// name.gob for Gob data, followed by the extension of the codec when compressed, its
+// BLOB values in files named by their hashes in a subdirectory, and the schema in a
+// _schema.json file. Files are written to a temporary file first and renamed over the
+// old one once complete, so that a crash while saving never leaves a partial file behind
+type DirStorage struct {
+	Dir string // Directory of the files, created by the first save
+}
+
+// ListTables returns the names of the table files of the directory
+func (s DirStorage) ListTables() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name, ok := tableFileName(entry.Name())
+		if !entry.IsDir() && ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// LoadTable opens the file of a table, the newest one if a crash left several
+func (s DirStorage) LoadTable(name string) (io.ReadCloser, error) {
+	paths, err := s.tableFiles(name)
+	if err != nil {
+		return nil, err
+	}
+	var newest string
+	var modTime time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err == nil && (newest == "" || info.ModTime().After(modTime)) {
+			newest, modTime = path, info.ModTime()
+		}
+	}
+	if newest == "" {
+		return nil, fmt.Errorf("table %s in %s: %w", name, s.Dir, fs.ErrNotExist)
+	}
+	return os.Open(newest)
+}
+
+// SaveTable writes the file of a table, named after the format of its data, and removes
+// its files in other formats
+func (s DirStorage) SaveTable(name string, write func(w io.Writer) error) error {
+	var head prefixWriter
+	ext := func() string {
+		if bytes.HasPrefix(head.prefix, []byte(gobMagic)) {
+			return ".gob"
+		}
+		return ".csv"
+	}
+	return s.saveTableAs(name, ext, func(w io.Writer) error {
+		return write(io.MultiWriter(w, &head))
+	})
+}
+
+// saveTableAs writes the file of a table with the extension that ext returns once the
+// data is written, and removes the files of the table with other extensions
+func (s DirStorage) saveTableAs(name string, ext func() string, write func(w io.Writer) error) error {
+	tmp := filepath.Join(s.Dir, name+".tmp")
+	if err := s.save(tmp, write); err != nil {
+		return err
+	}
+	path := filepath.Join(s.Dir, name+ext())
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	others, err := s.tableFiles(name)
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		if other == path {
+			continue
+		}
+		if err := os.Remove(other); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	syncDir(s.Dir)
+	return nil
+}
+
+// DeleteTable removes the file of a table, its insert log and its BLOB files
+func (s DirStorage) DeleteTable(name string) error {
+	paths, err := s.tableFiles(name)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := s.removeLog(name); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.blobDir(name))
+}
+
+// LoadSchema opens the schema file
+func (s DirStorage) LoadSchema() (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.Dir, schemaFile))
+}
+
+// SaveSchema writes the schema file
+func (s DirStorage) SaveSchema(write func(w io.Writer) error) error {
+	return s.save(filepath.Join(s.Dir, schemaFile), write)
+}
+
+// save writes a file of the directory atomically and syncs the directory
+func (s DirStorage) save(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := writeAtomic(path, write); err != nil {
+		return err
+	}
+	syncDir(s.Dir)
+	return nil
+}
+
+// tableFiles returns the paths of the files of a table, in any format
+func (s DirStorage) tableFiles(tableName string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.Dir, tableName+".*"))
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, path := range matches {
+		if name, ok := tableFileName(filepath.Base(path)); ok && name == tableName {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// tableFileName returns the name of the table of a file of a DirStorage, and whether it
+// is one: name.csv or name.gob, with the extension of a codec or not
+func tableFileName(file string) (string, bool) {
+	name, exts, _ := strings.Cut(file, ".")
+	format, _, _ := strings.Cut(exts, ".")
+	return name, (format == "csv" || format == "gob") && !strings.HasSuffix(exts, ".tmp")
+}
+
+// prefixWriter keeps the first bytes written to it, enough to recognize a format
+type prefixWriter struct {
+	prefix []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if n := len(gobMagic) - len(w.prefix); n > 0 {
+		w.prefix = append(w.prefix, p[:min(n, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// MemoryStorage keeps the saved tables in memory, for tests and for databases that need
+// no persistence. Its zero value is ready to use
+type MemoryStorage struct {
+	mu     sync.Mutex
+	tables map[string][]byte // Data of the tables by name
+	schema []byte            // Schema, nil before it is saved
+}
+
+// ListTables returns the names of the saved tables in order
+func (s *MemoryStorage) ListTables() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.tables)), nil
+}
+
+// LoadTable returns a reader of the data of a table
+func (s *MemoryStorage) LoadTable(name string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("table %s: %w", name, fs.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// SaveTable keeps the data of a table
+func (s *MemoryStorage) SaveTable(name string, write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tables == nil {
+		s.tables = make(map[string][]byte)
+	}
+	s.tables[name] = buf.Bytes()
+	return nil
+}
+
+// DeleteTable forgets the data of a table
+func (s *MemoryStorage) DeleteTable(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tables, name)
+	return nil
+}
+
+// LoadSchema returns a reader of the schema
+func (s *MemoryStorage) LoadSchema() (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.schema == nil {
+		return nil, fmt.Errorf("schema: %w", fs.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(s.schema)), nil
+}
+
+// SaveSchema keeps the schema
+func (s *MemoryStorage) SaveSchema(write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schema = buf.Bytes()
+	return nil
+}
+
+// readAll reads the data that a storage opened, returning nil without an error when
+// there is none
+func readAll(open func() (io.ReadCloser, error)) ([]byte, error) {
+	r, err := open()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
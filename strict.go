@@ -0,0 +1,28 @@
+package MyDb
+
+import (
+	"fmt"
+)
+
+// SetStrictMode turns strict mode on or off. In strict mode inserted rows must give a
+// value, possibly NULL, to every column without a default, while by default the columns
+// they leave out are NULL. The mode is saved with the database
+func (db *Database) SetStrictMode(enabled bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.strict = enabled
+}
+
+// checkComplete returns an error if an inserted row leaves out a column that gets no
+// value from a default, an auto-increment, an expression or a timestamp
+func (t *Table) checkComplete(tableName string, row map[string]string) error {
+	for _, col := range t.Columns {
+		def := t.columnDef(col)
+		if _, ok := row[col]; ok || def.Default != "" || def.DefaultFunc != "" || def.AutoIncrement ||
+			def.Generated != "" || def.CreatedAt || def.UpdatedAt {
+			continue
+		}
+		return fmt.Errorf("insert into table %s is missing column %s", tableName, col)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package MyDb
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// structField is an exported field of a struct mapped to a column
+type structField struct {
+	column    string   // Column of the field, from its mydb tag or its name in snake case
+	index     []int    // Index of the field, through the embedded structs holding it
+	omitEmpty bool     // Leave the column out of inserted rows when the field holds its zero value
+	options   []string // Options of the mydb tag after the column, omitempty included
+}
+
+// structFieldsCache holds the fields of the struct types mapped so far
+var structFieldsCache sync.Map // reflect.Type -> []structField
+
+// InsertStruct inserts the exported fields of a struct, or of a pointer to one, as a row
+// of a table. A field goes to the column its `mydb:"column"` tag names, or else to its
+// name in snake case, e.g. UserID to user_id, and `mydb:"-"` leaves it out. Values are
+// converted to the types of the columns: numbers, bools, strings, time.Time for dates,
+// []byte for BLOBs, text marshalers, and maps, slices and structs as JSON documents. Nil
+// pointers are NULL, and so are zero values of fields tagged `mydb:"column,omitempty"`
+// or of auto-increment columns, which then get their defaults. Generated and timestamp
+// columns are left out. Given a pointer, InsertStruct fills the struct with the stored
+// row, e.g. with the assigned auto-increment value
+func (db *Database) InsertStruct(tableName string, v any) error {
+	val := reflect.ValueOf(v)
+	isPointer := val.Kind() == reflect.Pointer && !val.IsNil()
+	if isPointer {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return fmt.Errorf("InsertStruct needs a struct or a pointer to one, not %T", v)
+	}
+	row, err := db.structRow(tableName, val)
+	if err != nil {
+		return err
+	}
+	inserted, _, err := db.insertRows(tableName, []map[string]string{row}, false)
+	if err != nil || !isPointer {
+		return err
+	}
+	return scanStruct(inserted[0], val)
+}
+
+// SelectInto fills a slice of structs, or of pointers to structs, with the rows of a
+// table matching the condition, every row when it is nil. Columns go to the fields
+// InsertStruct takes them from, NULL giving fields their zero value and pointers nil,
+// and columns without a field are ignored
+func (db *Database) SelectInto(tableName string, dest any, condition func(row Row) bool) error {
+	if condition == nil {
+		condition = func(row Row) bool { return true }
+	}
+	rows, err := db.SearchRows(tableName, condition)
+	if err != nil {
+		return err
+	}
+	return scanRows(rows, dest)
+}
+
+// scanRows fills a slice of structs, or of pointers to structs, with rows
+func scanRows(rows []map[string]string, dest any) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Pointer || slice.IsNil() || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("rows need a pointer to a slice to be scanned into, not %T", dest)
+	}
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+	structType := elemType
+	if elemType.Kind() == reflect.Pointer {
+		structType = elemType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("rows need a slice of structs or pointers to structs to be scanned into, not %s", slice.Type())
+	}
+	result := reflect.MakeSlice(slice.Type(), len(rows), len(rows))
+	for i, row := range rows {
+		elem := reflect.New(structType)
+		if err := scanStruct(row, elem.Elem()); err != nil {
+			return err
+		}
+		if elemType.Kind() == reflect.Pointer {
+			result.Index(i).Set(elem)
+		} else {
+			result.Index(i).Set(elem.Elem())
+		}
+	}
+	slice.Set(result)
+	return nil
+}
+
+// structRow returns the row a struct inserts into a table
+func (db *Database) structRow(tableName string, val reflect.Value) (map[string]string, error) {
+	defs, err := db.tableDefs(tableName)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]ColumnDef, len(defs))
+	for _, def := range defs {
+		types[def.Name] = def
+	}
+	row := make(map[string]string)
+	for _, f := range structFields(val.Type()) {
+		def := types[f.column]
+		field, err := val.FieldByIndexErr(f.index)
+		if err != nil || def.Generated != "" || def.CreatedAt || def.UpdatedAt {
+			continue // Held by a nil embedded struct, or set by the database
+		}
+		if (f.omitEmpty || def.AutoIncrement) && field.IsZero() {
+			continue
+		}
+		value, err := fieldValue(field, def.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", f.column, err)
+		}
+		row[f.column] = value
+	}
+	return row, nil
+}
+
+// scanStruct sets the fields of a struct from the columns of a row
+func scanStruct(row map[string]string, val reflect.Value) error {
+	for _, f := range structFields(val.Type()) {
+		field := val
+		for _, i := range f.index {
+			if field.Kind() == reflect.Pointer {
+				if field.IsNil() {
+					field.Set(reflect.New(field.Type().Elem()))
+				}
+				field = field.Elem()
+			}
+			field = field.Field(i)
+		}
+		value, ok := row[f.column]
+		if !ok || value == Null {
+			field.SetZero()
+			continue
+		}
+		if err := scanValue(value, field); err != nil {
+			return fmt.Errorf("column %s: %w", f.column, err)
+		}
+	}
+	return nil
+}
+
+// structFields returns the exported fields of a struct type mapped to columns, those of
+// embedded structs included
+func structFields(t reflect.Type) []structField {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.([]structField)
+	}
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("mydb")
+		if tag == "-" {
+			continue
+		}
+		column, options, _ := strings.Cut(tag, ",")
+		embedded := sf.Type
+		if embedded.Kind() == reflect.Pointer {
+			embedded = embedded.Elem()
+		}
+		if sf.Anonymous && column == "" && embedded.Kind() == reflect.Struct && embedded != reflect.TypeOf(time.Time{}) {
+			for _, f := range structFields(embedded) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if column == "" {
+			column = snakeCase(sf.Name)
+		}
+		f := structField{column: column, index: []int{i}}
+		if options != "" {
+			f.options = strings.Split(options, ",")
+			f.omitEmpty = slices.Contains(f.options, "omitempty")
+		}
+		fields = append(fields, f)
+	}
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+// snakeCase returns a Go name in snake case, e.g. user_id for UserID and http_server for
+// HTTPServer
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// fieldValue returns the stored form of the value of a field for a column of a type
+func fieldValue(v reflect.Value, t ColumnType) (string, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return Null, nil
+		}
+		v = v.Elem()
+	}
+	switch x := v.Interface().(type) {
+	case time.Time:
+		if t == Date {
+			return x.Format(dateLayout), nil
+		}
+		return x.UTC().Format(time.RFC3339Nano), nil
+	case []byte:
+		if x == nil {
+			return Null, nil
+		}
+		return string(x), nil
+	case json.RawMessage:
+		if x == nil {
+			return Null, nil
+		}
+		return string(x), nil
+	case encoding.TextMarshaler:
+		text, err := x.MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return boolString(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return Null, nil
+		}
+		fallthrough
+	case reflect.Array, reflect.Struct:
+		data, err := json.Marshal(v.Interface())
+		return string(data), err
+	}
+	return "", fmt.Errorf("cannot store a value of type %s", v.Type())
+}
+
+// scanValue sets a field from the stored form of a value that is not NULL
+func scanValue(value string, v reflect.Value) error {
+	if v.Kind() == reflect.Pointer {
+		p := reflect.New(v.Type().Elem())
+		if err := scanValue(value, p.Elem()); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	switch x := v.Addr().Interface().(type) {
+	case *time.Time:
+		d, ok := parseDateTime(value)
+		if !ok {
+			if d, ok = parseDate(value); !ok {
+				return fmt.Errorf("invalid time %q", value)
+			}
+		}
+		*x = d
+		return nil
+	case *[]byte:
+		*x = []byte(value)
+		return nil
+	case *json.RawMessage:
+		*x = json.RawMessage(value)
+		return nil
+	case encoding.TextUnmarshaler:
+		return x.UnmarshalText([]byte(value))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Interface:
+		v.SetZero() // Unmarshaling into a map or a struct would keep what it held
+		return json.Unmarshal([]byte(value), v.Addr().Interface())
+	default:
+		return fmt.Errorf("cannot scan into a value of type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package MyDb
+
+import (
+	"fmt"
+	"time"
+)
+
+// EnableTimestamps adds the columns created_at and updated_at to a table. They are set
+// to the time a row is inserted and to the time it was last inserted or updated, and
+// cannot be set otherwise. Existing rows get the current time in both
+func (db *Database) EnableTimestamps(tableName string) error {
+	return db.alterTable(tableName, func(table *Table) error {
+		for _, col := range []string{"created_at", "updated_at"} {
+			if contains(table.Columns, col) {
+				return fmt.Errorf("column %s already exists in table %s", col, tableName)
+			}
+		}
+		now := timestampNow()
+		table.Columns = append(append([]string(nil), table.Columns...), "created_at", "updated_at")
+		table.setColumnDef(ColumnDef{Name: "created_at", Type: DateTime, CreatedAt: true})
+		table.setColumnDef(ColumnDef{Name: "updated_at", Type: DateTime, UpdatedAt: true})
+		return table.rewriteRows(tableName, func(row map[string]string) {
+			row["created_at"] = now
+			row["updated_at"] = now
+		})
+	})
+}
+
+// timestampNow returns the current time in the stored form of DateTime values
+func timestampNow() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// touch sets the modification timestamp columns of an updated row
+func (t *Table) touch(row map[string]string, now string) {
+	for _, col := range t.Columns {
+		if t.columnDef(col).UpdatedAt {
+			row[col] = now
+		}
+	}
+}
+
+// splitTimestamps returns a row without its timestamp columns, and their values in stored
+// form, so that a restored row keeps the times it had when it was dumped
+func (t *Table) splitTimestamps(tableName string, row map[string]string) (map[string]string, map[string]string, error) {
+	var times map[string]string
+	for col, value := range row {
+		if def := t.columnDef(col); !def.CreatedAt && !def.UpdatedAt {
+			continue
+		}
+		if times == nil {
+			row, times = copyRow(row), make(map[string]string)
+		}
+		delete(row, col)
+		if value != Null {
+			var err error
+			if value, err = DateTime.normalize(value); err != nil {
+				return nil, nil, fmt.Errorf("column %s of table %s: %w", col, tableName, err)
+			}
+		}
+		if value == Null {
+			continue // Set to the current time like in other inserts, as is an empty value
+		}
+		times[col] = value
+	}
+	return row, times, nil
+}
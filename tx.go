@@ -0,0 +1,291 @@
+package MyDb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultLockTimeout is how long a statement waits for a row locked by another
+// transaction before failing, unless SetLockTimeout changes it
+const DefaultLockTimeout = 10 * time.Second
+
+// ErrLockTimeout is returned, wrapped, by statements that waited too long for a row
+// locked by another transaction
+var ErrLockTimeout = errors.New("lock wait timeout")
+
+// ErrDeadlock is returned, wrapped, by statements of a transaction that would wait for a
+// row locked by a transaction waiting, directly or not, for a row it holds. The
+// transaction keeps its locks, so it should Commit and start again to let the others go on
+var ErrDeadlock = errors.New("deadlock detected")
+
+// Tx is a transaction, a sequence of statements holding locks on the rows they read
+// with SELECT ... FOR UPDATE or change with UPDATE, DELETE and UPSERT until Commit.
+// Other transactions and statements changing those rows wait for the locks, so that two
+// transactions cannot both read and then change the same row. Statements take effect as
+// they run: the locks isolate a transaction from the others, they do not make its
+// statements undoable. A transaction is used by one goroutine at a time
+type Tx struct {
+	db   *Database
+	keys []rowLockKey // Rows locked by the transaction, guarded by the mutex of the row locks
+	done bool         // Whether Commit was called
+}
+
+// rowLockKey identifies a row by its table and the key of its primary key
+type rowLockKey struct {
+	table *Table
+	key   string
+}
+
+// rowLock is the lock of a row held by a transaction
+type rowLock struct {
+	tx       *Tx
+	released chan struct{} // Closed when the transaction ends
+}
+
+// rowLocks are the rows locked by transactions, which rows of tables without a primary
+// key never are
+type rowLocks struct {
+	mu      sync.Mutex
+	held    map[rowLockKey]*rowLock
+	waiting map[*Tx]rowLockKey // Row each waiting transaction waits for, the edges of the wait-for graph
+	timeout time.Duration      // How long to wait for a row before failing
+}
+
+// rowWait is returned by writes finding a row locked by another transaction. The write
+// releases its tables, waits for the row and runs again
+type rowWait struct {
+	tableName string
+	key       rowLockKey
+}
+
+func (w *rowWait) Error() string {
+	return fmt.Sprintf("a row of table %s is locked by another transaction", w.tableName)
+}
+
+// Begin starts a transaction
+func (db *Database) Begin() *Tx {
+	return &Tx{db: db}
+}
+
+// SetLockTimeout sets how long a statement waits for a row locked by another
+// transaction before failing with ErrLockTimeout, DefaultLockTimeout by default. Zero
+// makes statements fail at once
+func (db *Database) SetLockTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("lock timeout cannot be negative")
+	}
+	db.rowLocks.mu.Lock()
+	defer db.rowLocks.mu.Unlock()
+	db.rowLocks.timeout = timeout
+	return nil
+}
+
+// Query runs a SELECT, GET, INSERT, UPSERT, UPDATE or DELETE statement in the
+// transaction. "SELECT ... FOR UPDATE" locks the rows matching its WHERE clause, e.g.
+// "select balance from accounts where id = 1 for update", before reading them
+func (tx *Tx) Query(command string) (*Result, error) {
+	return tx.QueryCtx(context.Background(), command)
+}
+
+// QueryCtx is Query stopping with the error of the context once it is done, including
+// while it waits for rows locked by other transactions
+func (tx *Tx) QueryCtx(ctx context.Context, command string) (*Result, error) {
+	if tx.done {
+		return nil, fmt.Errorf("transaction is already committed")
+	}
+	p, err := newParser(tx.db, command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command: %w", err)
+	}
+	p.tx, p.ctx = tx, ctx
+
+	switch {
+	case p.peek().is("get") || p.peek().is("select"):
+		return tx.db.querySelect(p)
+	case p.peek().is("insert") || p.peek().is("upsert"):
+		return tx.db.queryInsert(p)
+	case p.peek().is("update"):
+		return tx.db.queryUpdate(p)
+	case p.peek().is("delete"):
+		return tx.db.queryDelete(p)
+	}
+	return nil, fmt.Errorf("only SELECT, INSERT, UPDATE and DELETE run in a transaction: %s", command)
+}
+
+// Commit ends the transaction and releases its row locks
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return fmt.Errorf("transaction is already committed")
+	}
+	tx.done = true
+	tx.db.rowLocks.release(tx)
+	return nil
+}
+
+// try locks a row for a transaction unless another one holds it, and reports whether
+// it did. A nil transaction, for a statement outside of one, only tests the row
+func (m *rowLocks) try(tx *Tx, key rowLockKey) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.acquire(tx, key)
+	return ok
+}
+
+// acquire is try for callers holding the mutex, also returning the lock that another
+// transaction holds
+func (m *rowLocks) acquire(tx *Tx, key rowLockKey) (*rowLock, bool) {
+	if lock, held := m.held[key]; held {
+		return lock, lock.tx == tx
+	}
+	if tx != nil {
+		if m.held == nil {
+			m.held = make(map[rowLockKey]*rowLock)
+		}
+		m.held[key] = &rowLock{tx: tx, released: make(chan struct{})}
+		tx.keys = append(tx.keys, key)
+	}
+	return nil, true
+}
+
+// wait waits until no other transaction holds a row and locks it for the transaction,
+// failing with ErrLockTimeout after the lock timeout, with ErrDeadlock when waiting would
+// close a cycle of transactions waiting for each other, or with the error of the context
+// once it is done
+func (m *rowLocks) wait(ctx context.Context, tx *Tx, tableName string, key rowLockKey) error {
+	m.mu.Lock()
+	timer := time.NewTimer(m.timeout)
+	m.mu.Unlock()
+	defer timer.Stop()
+	defer func() {
+		m.mu.Lock()
+		delete(m.waiting, tx)
+		m.mu.Unlock()
+	}()
+
+	for {
+		m.mu.Lock()
+		lock, ok := m.acquire(tx, key)
+		if !ok && m.waitsFor(lock.tx, tx) {
+			m.mu.Unlock()
+			return fmt.Errorf("%w: a row of table %s is locked by a transaction waiting for this one", ErrDeadlock, tableName)
+		}
+		if !ok && tx != nil {
+			if m.waiting == nil {
+				m.waiting = make(map[*Tx]rowLockKey)
+			}
+			m.waiting[tx] = key
+		}
+		m.mu.Unlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-lock.released:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return fmt.Errorf("%w: a row of table %s is locked by another transaction", ErrLockTimeout, tableName)
+		}
+	}
+}
+
+// waitsFor reports whether a transaction waits for another, directly or through the
+// transactions holding the rows it waits for. The mutex must be held
+func (m *rowLocks) waitsFor(waiter, holder *Tx) bool {
+	if holder == nil {
+		return false // Statements outside of a transaction hold no locks
+	}
+	for seen := make(map[*Tx]bool); waiter != nil && !seen[waiter]; {
+		if waiter == holder {
+			return true
+		}
+		seen[waiter] = true
+		key, ok := m.waiting[waiter]
+		if !ok {
+			return false
+		}
+		lock, held := m.held[key]
+		if !held {
+			return false
+		}
+		waiter = lock.tx
+	}
+	return false
+}
+
+// release releases the row locks of a transaction
+func (m *rowLocks) release(tx *Tx) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range tx.keys {
+		close(m.held[key].released)
+		delete(m.held, key)
+	}
+	tx.keys = nil
+}
+
+// lockRows locks rows of a locked table for the transaction of the write, and returns a
+// *rowWait error if another transaction holds one of them
+func (l *tableLocks) lockRows(tableName string, table *Table, rows []map[string]string) error {
+	if table.primaryKey == nil {
+		return nil
+	}
+	for _, row := range rows {
+		key, _ := indexKey(row, table.primaryKey.columns)
+		if !l.rowLocks.try(l.tx, rowLockKey{table: table, key: key}) {
+			return &rowWait{tableName: tableName, key: rowLockKey{table: table, key: key}}
+		}
+	}
+	return nil
+}
+
+// retryLocked runs a write until it finds no row locked by another transaction, waiting
+// for each row it finds locked once it has released its tables
+func (db *Database) retryLocked(ctx context.Context, tx *Tx, write func() error) (err error) {
+	defer db.autoSaveAfter(&err)
+	for {
+		var wait *rowWait
+		if err := write(); !errors.As(err, &wait) {
+			return err
+		}
+		if err := db.rowLocks.wait(ctx, tx, wait.tableName, wait.key); err != nil {
+			return err
+		}
+	}
+}
+
+// lockWhere locks the rows of a table matching a condition for a transaction, waiting
+// for the other transactions holding them, for SELECT ... FOR UPDATE
+func (db *Database) lockWhere(ctx context.Context, tx *Tx, tableName string, match func(row map[string]string) bool) error {
+	db.mu.RLock() // Lock db first
+	table, exists := db.Tables[tableName]
+	if !exists {
+		db.mu.RUnlock()
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := db.use(tableName, table); err != nil {
+		db.mu.RUnlock()
+		return err
+	}
+	table.mu.RLock() // Lock table second
+	primaryKey, rows := table.primaryKey, table.snapshot()
+	table.mu.RUnlock()
+	db.mu.RUnlock()
+
+	if primaryKey == nil {
+		return fmt.Errorf("table %s has no primary key to lock its rows by", tableName)
+	}
+	for _, row := range rows {
+		if !match(row) {
+			continue
+		}
+		key, _ := indexKey(row, primaryKey.columns)
+		if err := db.rowLocks.wait(ctx, tx, tableName, rowLockKey{table: table, key: key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
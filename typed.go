@@ -0,0 +1,255 @@
+package MyDb
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TypedTable is a table whose rows are read and written as values of a struct type,
+// mapped to columns like InsertStruct and SelectInto map them. The untyped API still
+// works on the table
+type TypedTable[T any] struct {
+	db   *Database
+	name string
+}
+
+// OpenTyped returns the table of a database whose rows are values of the struct type T,
+// e.g. OpenTyped[User](db, "users"). When the table does not exist it is created with a
+// column for every field of T, typed after the field: integers are Int, floats Float,
+// bools Bool, time.Time DateTime, []byte Blob, maps, slices and structs JSON, and the
+// others String. Options of the mydb tag after the column declare constraints, e.g.
+// `mydb:"id,primary_key,auto_increment"`, among primary_key, unique, not_null,
+// auto_increment, created_at, updated_at and type=<name> for another type, e.g. date or
+// decimal. When the table exists every field must have a column
+func OpenTyped[T any](db *Database, tableName string) (*TypedTable[T], error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("OpenTyped needs a struct type, not %s", t)
+	}
+	defs, err := structDefs(t)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := db.tableColumns(tableName)
+	if err != nil {
+		if err := db.CreateTableWithSchema(tableName, defs); err != nil {
+			return nil, err
+		}
+		return &TypedTable[T]{db: db, name: tableName}, nil
+	}
+	exists := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		exists[col] = true
+	}
+	for _, def := range defs {
+		if !exists[def.Name] {
+			return nil, fmt.Errorf("table %s has no column %s for type %s", tableName, def.Name, t)
+		}
+	}
+	return &TypedTable[T]{db: db, name: tableName}, nil
+}
+
+// Name returns the name of the table
+func (t *TypedTable[T]) Name() string {
+	return t.name
+}
+
+// Insert inserts a value as a row and returns it as stored, e.g. with its auto-increment
+// column, defaults and timestamps set
+func (t *TypedTable[T]) Insert(v T) (T, error) {
+	err := t.db.InsertStruct(t.name, &v)
+	return v, err
+}
+
+// InsertMany inserts values as rows, all or none, and returns them as stored
+func (t *TypedTable[T]) InsertMany(values []T) ([]T, error) {
+	rows := make([]map[string]string, len(values))
+	for i := range values {
+		row, err := t.db.structRow(t.name, reflect.ValueOf(&values[i]).Elem())
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = row
+	}
+	inserted, _, err := t.db.insertRows(t.name, rows, false)
+	if err != nil {
+		return nil, err
+	}
+	stored := make([]T, len(inserted))
+	for i, row := range inserted {
+		if err := scanStruct(row, reflect.ValueOf(&stored[i]).Elem()); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// All returns every row of the table
+func (t *TypedTable[T]) All() ([]T, error) {
+	return t.Find(nil)
+}
+
+// Find returns the rows of the table matching the condition, every row when it is nil
+func (t *TypedTable[T]) Find(condition func(v T) bool) ([]T, error) {
+	var found []T
+	if condition == nil {
+		err := t.db.SelectInto(t.name, &found, nil)
+		return found, err
+	}
+	match, scanErr := t.match(condition)
+	err := t.db.SelectInto(t.name, &found, match)
+	if *scanErr != nil {
+		return nil, *scanErr
+	}
+	return found, err
+}
+
+// Update replaces the row holding the primary key of a value by the value, and returns
+// how many rows were updated, 0 when no row holds the key. Columns of fields tagged
+// omitempty holding their zero value are left as they are, and so are timestamp and
+// generated columns
+func (t *TypedTable[T]) Update(v T) (int, error) {
+	key, row, err := t.keyed(v)
+	if err != nil {
+		return 0, err
+	}
+	return t.db.UpdateByKey(t.name, key, row)
+}
+
+// Delete removes the row holding the primary key of a value, and returns how many rows
+// were removed, 0 when no row holds the key
+func (t *TypedTable[T]) Delete(v T) (int, error) {
+	key, _, err := t.keyed(v)
+	if err != nil {
+		return 0, err
+	}
+	return t.db.DeleteByKey(t.name, key)
+}
+
+// DeleteWhere removes the rows of the table matching the condition, and returns how many
+// were removed
+func (t *TypedTable[T]) DeleteWhere(condition func(v T) bool) (int, error) {
+	match, scanErr := t.match(condition)
+	deleted, err := t.db.DeleteRows(t.name, match)
+	if *scanErr != nil {
+		return 0, *scanErr
+	}
+	return deleted, err
+}
+
+// match returns a condition on rows calling a condition on values, and where the first
+// row that cannot be read as a value puts its error, such rows not matching
+func (t *TypedTable[T]) match(condition func(v T) bool) (func(row map[string]string) bool, *error) {
+	scanErr := new(error)
+	return func(row map[string]string) bool {
+		var v T
+		if err := scanStruct(row, reflect.ValueOf(&v).Elem()); err != nil {
+			if *scanErr == nil {
+				*scanErr = err
+			}
+			return false
+		}
+		return condition(v)
+	}, scanErr
+}
+
+// keyed returns the primary key of the row of a value and the row
+func (t *TypedTable[T]) keyed(v T) (map[string]string, map[string]string, error) {
+	defs, err := t.db.tableDefs(t.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	row, err := t.db.structRow(t.name, reflect.ValueOf(&v).Elem())
+	if err != nil {
+		return nil, nil, err
+	}
+	key := make(map[string]string)
+	for _, def := range defs {
+		if !def.PrimaryKey {
+			continue
+		}
+		value, ok := row[def.Name]
+		if !ok || value == Null {
+			return nil, nil, fmt.Errorf("value has no %s, part of the primary key of table %s", def.Name, t.name)
+		}
+		key[def.Name] = value
+	}
+	if len(key) == 0 {
+		return nil, nil, fmt.Errorf("table %s has no primary key", t.name)
+	}
+	return key, row, nil
+}
+
+// structDefs returns the definitions of the columns of the fields of a struct type
+func structDefs(t reflect.Type) ([]ColumnDef, error) {
+	fields := structFields(t)
+	defs := make([]ColumnDef, len(fields))
+	for i, f := range fields {
+		def := ColumnDef{Name: f.column}
+		field := t.FieldByIndex(f.index)
+		typ, ok := goColumnType(field.Type)
+		for _, option := range f.options {
+			switch option {
+			case "omitempty":
+			case "primary_key":
+				def.PrimaryKey = true
+			case "unique":
+				def.Unique = true
+			case "not_null":
+				def.NotNull = true
+			case "auto_increment":
+				def.AutoIncrement = true
+			case "created_at":
+				def.CreatedAt = true
+			case "updated_at":
+				def.UpdatedAt = true
+			default:
+				name, found := strings.CutPrefix(option, "type=")
+				if typ, ok = parseColumnType(name); !found || !ok {
+					return nil, fmt.Errorf("unknown option %s of field %s", option, field.Name)
+				}
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("field %s has a type %s with no column type", field.Name, field.Type)
+		}
+		def.Type = typ
+		defs[i] = def
+	}
+	return defs, nil
+}
+
+// goColumnType returns the column type holding the values of a Go type
+func goColumnType(t reflect.Type) (ColumnType, bool) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeFor[time.Time]():
+		return DateTime, true
+	case t == reflect.TypeFor[json.RawMessage]():
+		return JSON, true
+	case t == reflect.TypeFor[[]byte]():
+		return Blob, true
+	case t.Implements(reflect.TypeFor[encoding.TextMarshaler]()):
+		return String, true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return String, true
+	case reflect.Bool:
+		return Bool, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Int, true
+	case reflect.Float32, reflect.Float64:
+		return Float, true
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Interface:
+		return JSON, true
+	}
+	return String, false
+}
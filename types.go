@@ -0,0 +1,529 @@
+package MyDb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType is the type of the values stored in a column
+type ColumnType int
+
+const (
+	String   ColumnType = iota // Any text, the type of columns created without a type
+	Int                        // 64-bit integer
+	Float                      // 64-bit floating point number
+	Bool                       // true or false
+	Date                       // Calendar date, stored as 2006-01-02
+	DateTime                   // Date and time, stored in UTC in RFC 3339 format
+	JSON                       // JSON document, stored in compact form
+	Decimal                    // Exact decimal number, for amounts of money
+	Blob                       // Binary data, saved in files next to the CSV file
+)
+
+// columnTypeNames are the names of the column types, as used in commands and CSV headers
+var columnTypeNames = [...]string{"string", "int", "float", "bool", "date", "datetime", "json", "decimal", "blob"}
+
+// columnTypeSynonyms maps other SQL type names to column types
+var columnTypeSynonyms = map[string]ColumnType{
+	"text": String, "varchar": String, "char": String,
+	"integer": Int, "bigint": Int,
+	"real": Float, "double": Float,
+	"boolean":   Bool,
+	"timestamp": DateTime,
+	"jsonb":     JSON,
+	"numeric":   Decimal,
+	"bytea":     Blob,
+}
+
+// String returns the name of the column type
+func (t ColumnType) String() string {
+	if t < 0 || int(t) >= len(columnTypeNames) {
+		return fmt.Sprintf("ColumnType(%d)", int(t))
+	}
+	return columnTypeNames[t]
+}
+
+// MarshalText returns the name of the column type, for the saved schema
+func (t ColumnType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText sets the column type from its name or SQL synonym
+func (t *ColumnType) UnmarshalText(text []byte) error {
+	typ, ok := parseColumnType(string(text))
+	if !ok {
+		return fmt.Errorf("unknown column type %s", text)
+	}
+	*t = typ
+	return nil
+}
+
+// parseColumnType returns the column type with the given name or SQL synonym, ignoring case
+func parseColumnType(name string) (ColumnType, bool) {
+	name = strings.ToLower(name)
+	for i, typeName := range columnTypeNames {
+		if name == typeName {
+			return ColumnType(i), true
+		}
+	}
+	t, ok := columnTypeSynonyms[name]
+	return t, ok
+}
+
+// dateTimeLayouts are the accepted formats of DateTime values, values without a time zone are UTC
+var dateTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// dateLayout is the format of Date values
+const dateLayout = "2006-01-02"
+
+// normalize checks that a value is valid for the type and returns it in its stored
+// form, e.g. "1" becomes "true" for a Bool. Empty values are Null for every type but
+// String and Blob, whose values may be empty
+func (t ColumnType) normalize(value string) (string, error) {
+	if value == "" {
+		if t == String || t == Blob {
+			return value, nil
+		}
+		return Null, nil
+	}
+	switch t {
+	case Int:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return strconv.FormatInt(n, 10), nil
+		}
+	case Float:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64), nil
+		}
+	case Bool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return boolString(b), nil
+		}
+	case Date:
+		if d, ok := parseDate(value); ok {
+			return d.Format(dateLayout), nil
+		}
+	case DateTime:
+		if d, ok := parseDateTime(value); ok {
+			return d.UTC().Format(time.RFC3339Nano), nil
+		}
+	case JSON:
+		if doc, err := compactJSON(value); err == nil {
+			return doc, nil
+		}
+	case Decimal:
+		if d, ok := parseDecimal(value); ok {
+			return formatDecimal(d), nil
+		}
+	default:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid %s value %q", t, value)
+}
+
+// compare compares two values of the type, returning -1, 0 or 1. Values that are
+// not valid for the type are compared like untyped values
+func (t ColumnType) compare(a, b string) int {
+	switch t {
+	case Int, Float:
+		x, errA := strconv.ParseFloat(a, 64)
+		y, errB := strconv.ParseFloat(b, 64)
+		if errA == nil && errB == nil {
+			return compareFloats(x, y)
+		}
+	case Bool:
+		x, errA := strconv.ParseBool(a)
+		y, errB := strconv.ParseBool(b)
+		if errA == nil && errB == nil {
+			return compareFloats(boolNumber(x), boolNumber(y))
+		}
+	case Decimal:
+		x, okA := parseDecimal(a)
+		y, okB := parseDecimal(b)
+		if okA && okB {
+			return x.Cmp(y)
+		}
+	case Date, DateTime:
+		x, okA := parseDateTime(a)
+		y, okB := parseDateTime(b)
+		if okA && okB {
+			return x.Compare(y)
+		}
+	}
+	return compareValues(a, b)
+}
+
+// parseDateTime parses a value in any of the accepted DateTime formats or in a layout
+// registered with SetDateLayouts
+func parseDateTime(value string) (time.Time, bool) {
+	for _, layout := range dateTimeLayouts {
+		if d, err := time.Parse(layout, value); err == nil {
+			return d, true
+		}
+	}
+	return parseCustomDate(value)
+}
+
+// parseDate parses a Date value in its stored format or in a layout registered with SetDateLayouts
+func parseDate(value string) (time.Time, bool) {
+	if d, err := time.Parse(dateLayout, value); err == nil {
+		return d, true
+	}
+	return parseCustomDate(value)
+}
+
+// compareFloats compares two numbers, returning -1, 0 or 1
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// boolNumber orders false before true
+func boolNumber(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ColumnDef describes a column of a table
+type ColumnDef struct {
+	Name          string     `json:"name"`                     // Column name
+	Type          ColumnType `json:"type,omitempty"`           // Type of the values, String by default
+	PrimaryKey    bool       `json:"primary_key,omitempty"`    // Part of the primary key, which must be unique and not NULL
+	Unique        bool       `json:"unique,omitempty"`         // No two rows may hold the same value, NULL excepted
+	NotNull       bool       `json:"not_null,omitempty"`       // The column may not be NULL
+	Default       string     `json:"default,omitempty"`        // Value of the column in inserted rows that leave it out, empty for none
+	DefaultFunc   string     `json:"default_func,omitempty"`   // Name of a function without arguments computing the default instead, e.g. "now"
+	AutoIncrement bool       `json:"auto_increment,omitempty"` // Inserted rows leaving the column out get the next integer, the column type must be Int
+	Generated     string     `json:"generated,omitempty"`      // Expression computing the column from the others, e.g. "price * qty", empty for a normal column
+	CreatedAt     bool       `json:"created_at,omitempty"`     // Set to the time the row was inserted, the column type must be DateTime
+	UpdatedAt     bool       `json:"updated_at,omitempty"`     // Set to the time the row was last inserted or updated, the column type must be DateTime
+}
+
+// CreateTableWithSchema creates a new table whose columns have types. Values inserted
+// into typed columns are validated and stored in a canonical form, and conditions
+// compare them by type, e.g. dates chronologically and numbers numerically. Columns
+// marked as PrimaryKey together form the primary key of the table, and columns marked
+// as Unique each get their own unique constraint. Generated columns are computed from
+// the other columns of their row whenever it is inserted or updated
+func (db *Database) CreateTableWithSchema(name string, columns []ColumnDef) error {
+	// Parse the expressions of generated columns before locking, as parsing looks up functions
+	generated, err := db.parseGenerated(name, columns)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	// Validate table and column names
+	if !isValidName(name) {
+		return fmt.Errorf("invalid table name: %s", name)
+	}
+	names := make([]string, len(columns))
+	defs := make(map[string]ColumnDef, len(columns))
+	var primaryKey []string
+	autoIncrement := false
+	for i, col := range columns {
+		col, err := db.checkColumnDef(col)
+		if err != nil {
+			return err
+		}
+		if _, exists := defs[col.Name]; exists {
+			return fmt.Errorf("column %s is defined more than once", col.Name)
+		}
+		if col.AutoIncrement {
+			if autoIncrement {
+				return fmt.Errorf("table %s has more than one auto-increment column", name)
+			}
+			autoIncrement = true
+		}
+		names[i] = col.Name
+		defs[col.Name] = col
+		if col.PrimaryKey {
+			primaryKey = append(primaryKey, col.Name)
+		}
+	}
+
+	// Check if the table already exists
+	if _, exists := db.Tables[name]; exists {
+		return fmt.Errorf("table %s already exists", name)
+	}
+
+	// Create the table and initialize Rows
+	delete(db.dropped, name)
+	table := &Table{
+		Columns:   names,
+		Rows:      []map[string]string{}, // Initialize Rows
+		defs:      defs,
+		generated: generated,
+		dirty:     true,
+	}
+	if primaryKey != nil {
+		table.primaryKey = newUniqueIndex("primary key", primaryKey)
+	}
+	for _, col := range columns {
+		if col.Unique {
+			table.unique = append(table.unique, newUniqueIndex("unique key", []string{col.Name}))
+		}
+	}
+	db.Tables[name] = table
+	return db.checkpointDDL()
+}
+
+// checkColumnDef validates the definition of a column, and returns it with its default
+// in stored form and the type of auto-increment and timestamp columns set when left
+// out. The db lock must be held
+func (db *Database) checkColumnDef(col ColumnDef) (ColumnDef, error) {
+	if !isValidName(col.Name) {
+		return col, fmt.Errorf("invalid column name: %s", col.Name)
+	}
+	if col.Type < String || int(col.Type) >= len(columnTypeNames) {
+		return col, fmt.Errorf("invalid type for column %s", col.Name)
+	}
+	if col.Default != "" {
+		if col.DefaultFunc != "" {
+			return col, fmt.Errorf("column %s has both a default value and a default function", col.Name)
+		}
+		value, err := col.Type.normalize(col.Default)
+		if err != nil {
+			return col, fmt.Errorf("default of column %s: %w", col.Name, err)
+		}
+		col.Default = value
+	}
+	if _, ok := db.lookupFunction(col.DefaultFunc); col.DefaultFunc != "" && !ok {
+		return col, fmt.Errorf("unknown function %s in default of column %s", col.DefaultFunc, col.Name)
+	}
+	if col.AutoIncrement {
+		if col.Type == String {
+			col.Type = Int // Auto-increment columns are integers
+		}
+		switch {
+		case col.Type != Int:
+			return col, fmt.Errorf("auto-increment column %s must be of type int", col.Name)
+		case col.Default != "" || col.DefaultFunc != "":
+			return col, fmt.Errorf("auto-increment column %s cannot have a default", col.Name)
+		}
+	}
+	if col.CreatedAt || col.UpdatedAt {
+		if col.Type == String {
+			col.Type = DateTime // Timestamp columns hold date and time
+		}
+		switch {
+		case col.Type != DateTime:
+			return col, fmt.Errorf("timestamp column %s must be of type datetime", col.Name)
+		case col.CreatedAt && col.UpdatedAt:
+			return col, fmt.Errorf("column %s cannot be both a creation and a modification timestamp", col.Name)
+		case col.Default != "" || col.DefaultFunc != "" || col.AutoIncrement || col.Generated != "":
+			return col, fmt.Errorf("timestamp column %s cannot have a default", col.Name)
+		}
+	}
+	return col, nil
+}
+
+// columnDef returns the definition of a column of the table
+func (t *Table) columnDef(column string) ColumnDef {
+	if def, ok := t.defs[column]; ok {
+		return def
+	}
+	return ColumnDef{Name: column}
+}
+
+// setColumnDef records the definition of a column
+func (t *Table) setColumnDef(def ColumnDef) {
+	if t.defs == nil {
+		t.defs = make(map[string]ColumnDef)
+	}
+	t.defs[def.Name] = def
+}
+
+// normalizeRow checks that every value of a row belongs to a column of the table and
+// has the column type, and returns a copy of the row with values in their stored form
+func (t *Table) normalizeRow(tableName string, row map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string, len(row))
+	for col, value := range row {
+		if !contains(t.Columns, col) {
+			return nil, fmt.Errorf("column %s does not exist in table %s", col, tableName)
+		}
+		if value == Null {
+			normalized[col] = value
+			continue
+		}
+		value, err := t.columnDef(col).Type.normalize(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s of table %s: %w", col, tableName, err)
+		}
+		normalized[col] = value
+	}
+	return normalized, nil
+}
+
+// applyDefaults gives the columns that an inserted row leaves out their default
+// values, sets its timestamp columns and returns the value assigned to the
+// auto-increment column, 0 when none was. Columns explicitly set to NULL keep it,
+// except the auto-increment column. The table lock must be held
+func (db *Database) applyDefaults(tableName string, table *Table, row map[string]string) (int64, error) {
+	var id int64
+	now := timestampNow()
+	for _, col := range table.Columns {
+		def := table.columnDef(col)
+		if def.CreatedAt || def.UpdatedAt {
+			row[col] = now
+			continue
+		}
+		value, ok := row[col]
+		if def.AutoIncrement {
+			if !ok || value == Null {
+				table.lastID++
+				id = table.lastID
+				row[col] = strconv.FormatInt(id, 10)
+			} else if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > table.lastID {
+				// Later ids continue after explicit ones
+				table.lastID = n
+			}
+			continue
+		}
+		if ok {
+			continue
+		}
+		switch {
+		case def.DefaultFunc != "":
+			fn, ok := db.lookupFunction(def.DefaultFunc)
+			if !ok {
+				return 0, fmt.Errorf("unknown function %s in default of column %s", def.DefaultFunc, col)
+			}
+			value, err := fn()
+			if err == nil {
+				value, err = def.Type.normalize(value)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("default of column %s of table %s: %w", col, tableName, err)
+			}
+			row[col] = value
+		case def.Default != "":
+			row[col] = def.Default
+		}
+	}
+	return id, nil
+}
+
+// checkNotNull returns an error if one of the rows leaves a NOT NULL column NULL
+func (t *Table) checkNotNull(tableName string, rows []map[string]string) error {
+	for _, col := range t.Columns {
+		if !t.columnDef(col).NotNull {
+			continue
+		}
+		for _, row := range rows {
+			if value, ok := row[col]; !ok || value == Null {
+				return fmt.Errorf("column %s of table %s cannot be NULL", col, tableName)
+			}
+		}
+	}
+	return nil
+}
+
+// header returns the CSV header of the table. Typed columns are written as "name:type",
+// the auto-increment column as "name:int:auto_increment=N", N being the last id, and
+// timestamp columns as "name:datetime:created" or "name:datetime:updated". The first
+// column ends with ":wal=N" when walSeq, the last write-ahead log record held by the file, is set,
+// and with ":log=T" when the table has a token for its insert log
+func (t *Table) header(walSeq int64) []string {
+	header := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		header[i] = col
+		def := t.columnDef(col)
+		first := i == 0 && (walSeq > 0 || t.logToken != "")
+		if def.Type != String || first {
+			header[i] += ":" + def.Type.String()
+		}
+		if def.AutoIncrement {
+			header[i] += ":auto_increment=" + strconv.FormatInt(t.lastID, 10)
+		}
+		if def.CreatedAt {
+			header[i] += ":created"
+		}
+		if def.UpdatedAt {
+			header[i] += ":updated"
+		}
+		if i == 0 && walSeq > 0 {
+			header[i] += ":wal=" + strconv.FormatInt(walSeq, 10)
+		}
+		if i == 0 && t.logToken != "" {
+			header[i] += ":log=" + t.logToken
+		}
+	}
+	return header
+}
+
+// parseHeader returns an empty table with the columns and definitions of a CSV header written by header
+func parseHeader(header []string) (*Table, error) {
+	table := &Table{Columns: make([]string, len(header)), defs: make(map[string]ColumnDef)}
+	for i, field := range header {
+		parts := strings.Split(field, ":")
+		name := parts[0]
+		table.Columns[i] = name
+		if len(parts) == 1 {
+			continue
+		}
+		t, ok := parseColumnType(parts[1])
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s of column %s", parts[1], name)
+		}
+		def := ColumnDef{Name: name, Type: t}
+		for _, attr := range parts[2:] {
+			switch attr {
+			case "created":
+				def.CreatedAt = true
+				continue
+			case "updated":
+				def.UpdatedAt = true
+				continue
+			}
+			if token, found := strings.CutPrefix(attr, "log="); found && i == 0 {
+				table.logToken = token
+				continue
+			}
+			if seq, found := strings.CutPrefix(attr, "wal="); found && i == 0 {
+				n, err := strconv.ParseInt(seq, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid attribute %s of column %s", attr, name)
+				}
+				table.walSeq = n
+				continue
+			}
+			lastID, found := strings.CutPrefix(attr, "auto_increment=")
+			n, err := strconv.ParseInt(lastID, 10, 64)
+			if !found || err != nil {
+				return nil, fmt.Errorf("invalid attribute %s of column %s", attr, name)
+			}
+			def.AutoIncrement = true
+			table.lastID = n
+		}
+		table.defs[name] = def
+	}
+	return table, nil
+}
+
+// tableDefs returns the definitions of the columns of a table in column order
+func (db *Database) tableDefs(tableName string) ([]ColumnDef, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	table, exists := db.Tables[tableName]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	defs := make([]ColumnDef, len(table.Columns))
+	for i, col := range table.Columns {
+		defs[i] = table.columnDef(col)
+	}
+	return defs, nil
+}
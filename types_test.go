@@ -0,0 +1,58 @@
+package MyDb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestEmptyTypedValues checks that empty values of every type but string and blob are
+// stored as NULL, by inserts, updates and the Go API, so that numbers, comparisons and
+// exports never see them
+func TestEmptyTypedValues(t *testing.T) {
+	db := NewDatabase("types_test", WithStorage(&MemoryStorage{}))
+	for _, command := range []string{
+		"create table t has id int, n int, f float, b bool, d date, dt datetime, j json, dec decimal, s",
+		"insert into t values (1, 1, '', '', '', '', '', '', '')",
+		"insert into t (id, n) values (2, '')",
+		"update t set dec = 2.5, s = x where id = 1",
+		"update t set dec = '' where id = 1",
+	} {
+		if _, err := db.Query(command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+	}
+	if err := db.InsertInto("t", map[string]string{"id": "3", "n": "", "s": ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"get from t order by id", "[map[id:1 n:1 s:x] map[id:2] map[id:3 s:]]"},
+		{"select sum(n) as s, count(n) as c from t", "[map[c:1 s:1]]"},
+		{"select id, n + 1 as next from t order by id", "[map[id:1 next:2] map[id:2] map[id:3]]"},
+		{"select id from t where n < 2 order by id", "[map[id:1]]"},
+		{"select id from t where n is null order by id", "[map[id:2] map[id:3]]"},
+	}
+	for _, tt := range tests {
+		res, err := db.Query(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := fmt.Sprint(res.Rows); got != tt.want {
+			t.Errorf("%s returned %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := db.ExportJSON("t", &out, JSONArray); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"id":2,"n":null,`; !strings.Contains(out.String(), want) {
+		t.Errorf("export of the empty int holds no %s:\n%s", want, out.String())
+	}
+}
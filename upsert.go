@@ -0,0 +1,178 @@
+package MyDb
+
+import (
+	"context"
+	"fmt"
+)
+
+// Upsert updates the rows of a table whose key columns hold the same values as
+// data, or inserts data as a new row when there is no such row. The check and the
+// write happen atomically under the table lock
+func (db *Database) Upsert(tableName string, keyColumns []string, data map[string]string) error {
+	_, _, err := db.upsertRows(context.Background(), nil, tableName, []map[string]string{data}, &conflictClause{keys: keyColumns})
+	return err
+}
+
+// upsertRows inserts rows, resolving rows whose key already exists as described
+// by the conflict clause, and returns a copy of each inserted or updated row along
+// with the last auto-increment value assigned, 0 when none was. The updated rows are
+// locked for tx, which is nil outside of a transaction
+func (db *Database) upsertRows(ctx context.Context, tx *Tx, tableName string, rows []map[string]string, conflict *conflictClause) ([]map[string]string, int64, error) {
+	var affected []map[string]string
+	var lastID int64
+	err := db.retryLocked(ctx, tx, func() (err error) {
+		affected, lastID, err = db.tryUpsertRows(tx, tableName, rows, conflict)
+		return err
+	})
+	return affected, lastID, err
+}
+
+// tryUpsertRows is upsertRows without waiting for rows locked by other transactions,
+// for which it returns a *rowWait error
+func (db *Database) tryUpsertRows(tx *Tx, tableName string, rows []map[string]string, conflict *conflictClause) ([]map[string]string, int64, error) {
+	// Lock the table and the tables referenced by it or referencing it
+	table, l, err := db.lockTables(tx, tableName, updating)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer l.unlock()
+
+	// Validate the key, data and assignment columns
+	if len(conflict.keys) == 0 {
+		return nil, 0, fmt.Errorf("upsert into table %s requires at least one key column", tableName)
+	}
+	if err := checkColumns(tableName, table.Columns, conflict.keys); err != nil {
+		return nil, 0, err
+	}
+	set := conflict.set
+	if set != nil {
+		if err := table.checkWritable(tableName, set); err != nil {
+			return nil, 0, err
+		}
+		if set, err = table.normalizeRow(tableName, set); err != nil {
+			return nil, 0, err
+		}
+	}
+	normalized := make([]map[string]string, len(rows))
+	for i, data := range rows {
+		if err := table.checkWritable(tableName, data); err != nil {
+			return nil, 0, err
+		}
+		row, err := table.normalizeRow(tableName, data)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, key := range conflict.keys {
+			if value, ok := row[key]; !ok || value == Null {
+				return nil, 0, fmt.Errorf("upsert into table %s is missing key column %s", tableName, key)
+			}
+		}
+		if l.strict {
+			// The row is inserted when it has no conflict
+			if err := table.checkComplete(tableName, row); err != nil {
+				return nil, 0, err
+			}
+		}
+		normalized[i] = row
+	}
+
+	// Insert or update each row
+	// Remember the replaced rows in case a later row breaks a constraint
+	rowCount := len(table.Rows)
+	var positions []int
+	var replaced []map[string]string
+	rollback := func() {
+		for i := len(positions) - 1; i >= 0; i-- {
+			table.Rows[positions[i]] = replaced[i]
+		}
+		table.Rows = table.Rows[:rowCount]
+		table.rebuildIndexes(tableName)
+	}
+
+	var affected []map[string]string
+	var lastID int64
+	change := walChange{Table: tableName}
+	for _, data := range normalized {
+		key := rowKey(data, conflict.keys)
+		matched := false
+		for i, row := range table.Rows {
+			if rowKey(row, conflict.keys) != key {
+				continue
+			}
+			matched = true
+			if conflict.doNothing {
+				continue
+			}
+			changes := set
+			if changes == nil {
+				changes = data
+			}
+			err := l.lockRows(tableName, table, []map[string]string{row})
+			if err != nil {
+				rollback()
+				return nil, 0, err
+			}
+			newRow := copyRow(row)
+			applyChanges(newRow, changes)
+			table.touch(newRow, timestampNow())
+			err = table.computeGenerated(tableName, newRow)
+			removeNulls(newRow)
+			if err == nil {
+				err = table.checkRows(tableName, []map[string]string{newRow}, []map[string]string{row})
+			}
+			if err == nil {
+				err = l.checkReferences(tableName, table, []map[string]string{newRow})
+			}
+			if err == nil {
+				err = l.checkReferenced(tableName, []map[string]string{row}, []map[string]string{newRow})
+			}
+			if err != nil {
+				rollback()
+				return nil, 0, err
+			}
+			// The new version replaces the row, which snapshots may still be reading
+			positions = append(positions, i)
+			replaced = append(replaced, row)
+			table.unindexRows([]map[string]string{row})
+			table.ownRows()
+			table.Rows[i] = newRow
+			table.indexRows([]map[string]string{newRow})
+			change.Update = append(change.Update, [2]map[string]string{row, newRow})
+			affected = append(affected, copyRow(newRow))
+		}
+		if !matched {
+			row := copyRow(data)
+			id, err := db.applyDefaults(tableName, table, row)
+			if err == nil {
+				err = table.computeGenerated(tableName, row)
+			}
+			if err != nil {
+				rollback()
+				return nil, 0, err
+			}
+			if id != 0 {
+				lastID = id
+			}
+			removeNulls(row)
+			err = table.checkRows(tableName, []map[string]string{row}, nil)
+			if err == nil {
+				err = l.checkReferences(tableName, table, []map[string]string{row})
+			}
+			if err != nil {
+				rollback()
+				return nil, 0, err
+			}
+			table.Rows = append(table.Rows, row)
+			table.indexRows([]map[string]string{row})
+			change.Insert = append(change.Insert, row)
+			affected = append(affected, copyRow(row))
+		}
+	}
+
+	// Log the changes before the tables are unlocked, as no other write sees them until then
+	if err := l.log(change); err != nil {
+		rollback()
+		return nil, 0, err
+	}
+	return affected, lastID, nil
+}
@@ -0,0 +1,90 @@
+package MyDb
+
+import (
+	"context"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+)
+
+// VacuumStats reports the space reclaimed by Vacuum
+type VacuumStats struct {
+	Slots      int   // Unused row slots freed from the rows of the tables
+	DiskBefore int64 // Bytes of the files of the database before, 0 unless its storage is a directory or a file
+	DiskAfter  int64 // Bytes of the files of the database after, 0 unless its storage is a directory or a file
+}
+
+// Vacuum reclaims the space left by deleted rows. The rows of every table are copied to
+// a slice of their size and the indexes rebuilt, as neither shrinks when rows are
+// deleted, then every table is saved, which rewrites the files without the deleted rows,
+// merges the insert logs into them and empties the write-ahead log. Memory freed is
+// returned to the operating system
+func (db *Database) Vacuum() (VacuumStats, error) {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	stats := VacuumStats{DiskBefore: db.diskUsage()}
+	if err := db.useAll(); err != nil {
+		return VacuumStats{}, err
+	}
+	l := &tableLocks{tables: maps.Clone(db.Tables), write: make(map[*Table]bool)}
+	for _, table := range l.tables {
+		l.write[table] = true
+	}
+	l.lock() // Lock tables second
+	for tableName, table := range l.tables {
+		stats.Slots += cap(table.Rows) - len(table.Rows)
+		rows := make([]map[string]string, len(table.Rows))
+		copy(rows, table.Rows)
+		table.Rows = rows
+		table.shared.Store(false)
+		if err := table.rebuildIndexes(tableName); err != nil {
+			l.unlock()
+			return VacuumStats{}, err
+		}
+	}
+	l.unlock()
+
+	db.markDirty(nil)
+	if err := db.saveLocked(context.Background()); err != nil {
+		return VacuumStats{}, err
+	}
+	debug.FreeOSMemory()
+	stats.DiskAfter = db.diskUsage()
+	return stats, nil
+}
+
+// diskUsage returns the bytes of the files of the database, its write-ahead log included,
+// or 0 when its storage is neither a directory nor a file. The db lock must be held
+func (db *Database) diskUsage() int64 {
+	var size int64
+	switch s := db.store().(type) {
+	case DirStorage:
+		archive := db.wal.archiveDir()
+		filepath.WalkDir(s.Dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if entry.IsDir() && archive != "" && path != s.Dir && filepath.Clean(path) == filepath.Clean(archive) {
+				return filepath.SkipDir // The archive keeps history rather than the database
+			}
+			if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+				size += info.Size()
+			}
+			return nil
+		})
+		return size
+	case *FileStorage:
+		if info, err := os.Stat(s.path); err == nil {
+			size = info.Size()
+		}
+	default:
+		return 0
+	}
+	if info, err := os.Stat(db.walPath()); err == nil {
+		size += info.Size()
+	}
+	return size
+}
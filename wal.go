@@ -0,0 +1,422 @@
+package MyDb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// walFile is the name of the write-ahead log in the database directory
+const walFile = "_wal.log"
+
+// DefaultCheckpointSize is the size of the write-ahead log past which the next write
+// saves the database and empties the log, unless SetCheckpointSize changes it
+const DefaultCheckpointSize = 16 << 20
+
+// writeAheadLog is the journal of the changes to rows since the last Save. Each write
+// appends a record of its changes and syncs it to disk before changing the tables, and
+// Load replays the records on top of the saved files
+type writeAheadLog struct {
+	mu             sync.Mutex
+	file           *os.File // Open log, nil when the log is off
+	size           int64    // Size of the log
+	seq            int64    // Sequence number of the last record
+	checkpointSize int64    // Size past which the database is saved, 0 to only save on Save
+	archive        string   // Directory where the records are archived, empty when they are not
+	crypter        *crypter // Encrypts the records, nil when they are not encrypted
+}
+
+// walRecord is a line of the log, the changes of one write to the rows of its tables
+type walRecord struct {
+	Seq     int64       `json:"seq"`
+	Time    time.Time   `json:"time,omitzero"` // When the write was made
+	Changes []walChange `json:"changes"`
+}
+
+// walChange is the changes of a write to the rows of a table. Replaying them inserts the
+// new rows, then replaces the updated ones and removes the deleted ones, which are found
+// by their values
+type walChange struct {
+	Table  string                 `json:"table"`
+	Insert []map[string]string    `json:"insert,omitempty"`
+	Update [][2]map[string]string `json:"update,omitempty"` // Old and new version of each updated row
+	Delete []map[string]string    `json:"delete,omitempty"`
+}
+
+// SetWAL turns the write-ahead log on or off. While it is on, every insert, update and
+// delete is recorded in the _wal.log file of the database directory and synced to disk
+// before it takes effect, and Load replays the log on top of the saved tables, so that
+// no write is lost on a crash. Save empties the log, as does every schema change, which
+// saves the database instead of being recorded. Turning the log on saves the database
+// first, as writes are recorded against the files of the directory
+func (db *Database) SetWAL(enabled bool) error {
+	db.mu.Lock() // Lock db first
+	defer db.mu.Unlock()
+
+	if !enabled {
+		db.wal.mu.Lock()
+		defer db.wal.mu.Unlock()
+		if db.wal.file == nil {
+			return nil
+		}
+		err := db.wal.file.Close()
+		db.wal.file = nil
+		return err
+	}
+	if db.wal.enabled() {
+		return nil
+	}
+	// The tables and rows not saved yet would be missing under the records
+	if err := db.saveLocked(context.Background()); err != nil {
+		return err
+	}
+	db.wal.mu.Lock()
+	defer db.wal.mu.Unlock()
+	file, err := os.OpenFile(db.walPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	db.wal.file, db.wal.size = file, info.Size()
+	return nil
+}
+
+// SetCheckpointSize sets the size of the write-ahead log past which the next write saves
+// the database and empties the log, DefaultCheckpointSize by default. Zero leaves the
+// log growing until Save
+func (db *Database) SetCheckpointSize(size int64) error {
+	if size < 0 {
+		return fmt.Errorf("checkpoint size cannot be negative")
+	}
+	db.wal.mu.Lock()
+	defer db.wal.mu.Unlock()
+	db.wal.checkpointSize = size
+	return nil
+}
+
+// walPath returns the path of the write-ahead log
+func (db *Database) walPath() string {
+	return filepath.Join(db.dir(), walFile)
+}
+
+// enabled reports whether the log is on
+func (w *writeAheadLog) enabled() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file != nil
+}
+
+// full reports whether the log grew past the checkpoint size
+func (w *writeAheadLog) full() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file != nil && w.checkpointSize > 0 && w.size >= w.checkpointSize
+}
+
+// lastSeq returns the sequence number of the last record
+func (w *writeAheadLog) lastSeq() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq
+}
+
+// append records changes and syncs them to disk, doing nothing when the log is off
+func (w *writeAheadLog) append(changes []walChange) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(walRecord{Seq: w.seq + 1, Time: time.Now(), Changes: changes})
+	if err != nil {
+		return err
+	}
+	if w.crypter != nil {
+		if line, err = w.crypter.sealLine(line); err != nil {
+			return err
+		}
+	}
+	line = append(line, '\n')
+	if _, err = w.file.Write(line); err == nil {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		w.file.Truncate(w.size) // Drop the partly written record
+		return fmt.Errorf("failed to write to the write-ahead log: %w", err)
+	}
+	w.seq++
+	w.size += int64(len(line))
+	return nil
+}
+
+// reset empties the log once the database is saved, appending its records to the archive
+// when it is archived, or removes it when the log is off so
+// that Load does not replay it on top of newer files
+func (w *writeAheadLog) reset(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if w.archive != "" && w.size > 0 {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = appendFile(filepath.Join(w.archive, walArchiveFile), data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to archive the write-ahead log: %w", err)
+		}
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.size = 0
+	return w.file.Sync()
+}
+
+// log records the changes of a write before it takes effect, marks its tables as changed
+// and counts it as unsaved. The locks of the write must be held, so that the records of
+// writes to the same rows follow their order
+func (l *tableLocks) log(changes ...walChange) error {
+	changes = slices.DeleteFunc(changes, func(c walChange) bool {
+		return len(c.Insert) == 0 && len(c.Update) == 0 && len(c.Delete) == 0
+	})
+	if l.wal == nil || len(changes) == 0 {
+		return nil
+	}
+	if err := l.wal.append(changes); err != nil {
+		return err
+	}
+	var inserted int
+	for _, change := range changes {
+		table := l.tables[change.Table]
+		if len(change.Update) > 0 || len(change.Delete) > 0 {
+			table.dirty = true
+		} else {
+			table.inserted = true // Save can append the rows to the insert log
+		}
+		inserted += len(change.Insert)
+	}
+	l.autoSave.pending.Add(1)
+	l.pager.grow(inserted)
+	return nil
+}
+
+// checkpointDDL counts a schema change as an unsaved write and saves the database when
+// the log is on, as the log only records changes to rows, or when auto-save is due. The
+// db lock must be held, but no table lock
+func (db *Database) checkpointDDL() error {
+	db.autoSave.pending.Add(1)
+	if !db.wal.enabled() && !db.autoSave.due() {
+		return nil
+	}
+	if err := db.saveLocked(context.Background()); err != nil {
+		return err
+	}
+	if dir := db.wal.archiveDir(); dir != "" {
+		return db.writeBase(dir) // The archived records cannot be replayed across the change
+	}
+	return nil
+}
+
+// replayWAL applies the records of the log to tables loaded from their files, skipping
+// the records that the file of a table already holds. seqs are the sequence numbers of
+// the last record held by each file. A record cut short by a crash while it was written
+// is removed from the log, as its write never took effect
+func (db *Database) replayWAL(tables map[string]*Table, seqs map[string]int64) error {
+	var lastSeq int64
+	for _, seq := range seqs {
+		lastSeq = max(lastSeq, seq)
+	}
+	defer func() {
+		db.wal.mu.Lock()
+		db.wal.seq = max(db.wal.seq, lastSeq)
+		db.wal.mu.Unlock()
+	}()
+
+	data, err := os.ReadFile(db.walPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	offset, seq, err := db.replayRecords(data, tables, seqs, time.Time{})
+	lastSeq = max(lastSeq, seq)
+	if err != nil || offset == int64(len(data)) {
+		return err
+	}
+	return os.Truncate(db.walPath(), offset) // The last record was cut short
+}
+
+// replayRecords applies the records of data, lines of a log, to tables, skipping those
+// that the files of the tables hold like replayWAL, and those written after until unless
+// it is zero. It returns the offset past the last record applied or skipped, short of
+// the end of data when the last record is cut short, and the sequence number of the last
+// record read
+func (db *Database) replayRecords(data []byte, tables map[string]*Table, seqs map[string]int64, until time.Time) (int64, int64, error) {
+	replayed := make(map[string]*replayedTable)
+	var offset, lastSeq int64
+	for rest := data; len(rest) > 0; {
+		line, next, complete := bytes.Cut(rest, []byte("\n"))
+		size := int64(len(line)) + 1
+		if complete {
+			var err error
+			if line, err = db.openWALLine(line); err != nil {
+				return 0, 0, fmt.Errorf("invalid %s: record at offset %d: %w", walFile, offset, err)
+			}
+		}
+		var record walRecord
+		if !complete || json.Unmarshal(line, &record) != nil {
+			if complete && len(next) > 0 {
+				return 0, 0, fmt.Errorf("invalid %s: record at offset %d is corrupt", walFile, offset)
+			}
+			break // The last record was cut short
+		}
+		if !until.IsZero() && record.Time.After(until) {
+			break
+		}
+		offset += size
+		rest = next
+		lastSeq = max(lastSeq, record.Seq)
+
+		for _, change := range record.Changes {
+			table, exists := tables[change.Table]
+			if !exists {
+				return 0, 0, fmt.Errorf("invalid %s: table %s does not exist", walFile, change.Table)
+			}
+			if record.Seq <= seqs[change.Table] {
+				continue // The file of the table was saved after the record
+			}
+			r, ok := replayed[change.Table]
+			if !ok {
+				if _, err := db.loadEvicted(change.Table, table); err != nil {
+					return 0, 0, err
+				}
+				r = newReplayedTable(table)
+				replayed[change.Table] = r
+			}
+			if err := r.apply(change); err != nil {
+				return 0, 0, fmt.Errorf("invalid %s: %w", walFile, err)
+			}
+		}
+	}
+
+	for tableName, r := range replayed {
+		if err := r.finish(tableName); err != nil {
+			return 0, 0, fmt.Errorf("failed to replay %s: %w", walFile, err)
+		}
+	}
+	return offset, lastSeq, nil
+}
+
+// openWALLine returns a complete line of the log decrypted when the database has a key,
+// refusing encrypted lines without a key and plain ones with a key
+func (db *Database) openWALLine(line []byte) ([]byte, error) {
+	plain := bytes.HasPrefix(line, []byte("{"))
+	if db.crypter != nil {
+		if plain {
+			return nil, fmt.Errorf("record is not encrypted")
+		}
+		return db.crypter.openLine(line)
+	}
+	if !plain && len(line) > 0 {
+		return nil, fmt.Errorf("record is encrypted, open the database with its key")
+	}
+	return line, nil
+}
+
+// replayedTable is a table whose rows the log changes, with the positions of its rows by
+// their values to find the updated and deleted ones
+type replayedTable struct {
+	table     *Table
+	positions map[string][]int // Positions of the rows by rowKey over every column, nil once removed
+}
+
+// newReplayedTable indexes the rows of a table for replaying changes to them
+func newReplayedTable(table *Table) *replayedTable {
+	r := &replayedTable{table: table, positions: make(map[string][]int, len(table.Rows))}
+	for i, row := range table.Rows {
+		key := rowKey(row, table.Columns)
+		r.positions[key] = append(r.positions[key], i)
+	}
+	return r
+}
+
+// apply replays the changes of a write to the table
+func (r *replayedTable) apply(change walChange) error {
+	t := r.table
+	for _, row := range change.Insert {
+		key := rowKey(row, t.Columns)
+		r.positions[key] = append(r.positions[key], len(t.Rows))
+		t.Rows = append(t.Rows, row)
+	}
+	for _, update := range change.Update {
+		i, ok := r.take(update[0])
+		if !ok {
+			return fmt.Errorf("updated row of table %s is missing", change.Table)
+		}
+		t.Rows[i] = update[1]
+		key := rowKey(update[1], t.Columns)
+		r.positions[key] = append(r.positions[key], i)
+	}
+	for _, row := range change.Delete {
+		i, ok := r.take(row)
+		if !ok {
+			return fmt.Errorf("deleted row of table %s is missing", change.Table)
+		}
+		t.Rows[i] = nil
+	}
+	return nil
+}
+
+// take removes a row from the positions and returns its position
+func (r *replayedTable) take(row map[string]string) (int, bool) {
+	key := rowKey(row, r.table.Columns)
+	positions := r.positions[key]
+	if len(positions) == 0 {
+		return 0, false
+	}
+	i := positions[len(positions)-1]
+	r.positions[key] = positions[:len(positions)-1]
+	return i, true
+}
+
+// finish drops the deleted rows, catches up the auto-increment counter with the inserted
+// rows and rebuilds the indexes of the table
+func (r *replayedTable) finish(tableName string) error {
+	t := r.table
+	rows := make([]map[string]string, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		if row != nil {
+			rows = append(rows, row)
+		}
+	}
+	t.Rows = rows
+	t.dirty = true // The saved data of the table lacks the replayed changes
+	for _, col := range t.Columns {
+		if !t.columnDef(col).AutoIncrement {
+			continue
+		}
+		for _, row := range rows {
+			if n, err := strconv.ParseInt(row[col], 10, 64); err == nil && n > t.lastID {
+				t.lastID = n
+			}
+		}
+	}
+	return t.rebuildIndexes(tableName)
+}
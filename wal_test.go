@@ -0,0 +1,280 @@
+package MyDb
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// walTestDB returns a database saved in a temporary directory with the write-ahead log
+// on, holding the tables of the log tests
+func walTestDB(t *testing.T, options ...Option) *Database {
+	t.Helper()
+	db := NewDatabase("wal_test", append([]Option{WithPath(t.TempDir())}, options...)...)
+	for _, command := range []string{
+		"create table users (id int primary key, name, age int)",
+		"create table posts (id int primary key, user_id int references users (id) on delete cascade, title)",
+		"create table notes has text",
+		"insert into users values (1, Ann, 30), (2, Bob, 40)",
+		"insert into posts values (1, 1, Hello), (2, 2, Hi)",
+	} {
+		if _, err := db.Query(command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetWAL(true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.SetWAL(false) })
+	return db
+}
+
+// walTestRows returns the rows of every table of the log tests in order
+func walTestRows(t *testing.T, db *Database) map[string][]map[string]string {
+	t.Helper()
+	rows := make(map[string][]map[string]string)
+	for _, query := range []string{"get from users order by id", "get from posts order by id", "get from notes order by text"} {
+		res, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		rows[query] = res.Rows
+	}
+	return rows
+}
+
+// TestWALReplay checks that loading a database that was not saved after its writes, as
+// after a crash, replays them from the log
+func TestWALReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+	}{
+		{"insert", []string{"insert into users values (3, Cy, 50)"}},
+		{"update", []string{"update users set age = 31 where id = 1"}},
+		{"delete cascading", []string{"delete from users where id = 2"}},
+		{"update of a key", []string{"update posts set id = 10 where id = 1"}},
+		{"equal rows", []string{"insert into notes values (x), (x), (y)", "delete from notes where text = y", "update notes set text = z where text = x"}},
+		{"upsert", []string{"upsert into users values (1, Ann, 32), (4, Di, 20) on conflict (id)"}},
+		{"transaction", []string{"begin", "insert into users values (5, Ed, 60)", "update users set name = Edd where id = 5", "commit"}},
+		{"many writes", []string{"insert into notes values (a)", "update notes set text = b where text = a", "update notes set text = c where text = b", "delete from notes where text = c", "insert into notes values (d)"}},
+	}
+	for _, tt := range tests {
+		db := walTestDB(t)
+		var tx *Tx
+		for _, command := range tt.commands {
+			var err error
+			switch {
+			case command == "begin":
+				tx = db.Begin()
+			case command == "commit":
+				err, tx = tx.Commit(), nil
+			case tx != nil:
+				_, err = tx.Query(command)
+			default:
+				_, err = db.Query(command)
+			}
+			if err != nil {
+				t.Fatalf("%s: %s: %v", tt.name, command, err)
+			}
+		}
+		loaded, err := LoadDatabase("wal_test", WithPath(db.dir()))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got, want := walTestRows(t, loaded), walTestRows(t, db); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: loaded rows\n%v\nwant\n%v", tt.name, got, want)
+		}
+	}
+}
+
+// TestWALUnsaved checks that turning the log on saves the tables created and the rows
+// changed before, so that the log is replayed on top of them
+func TestWALUnsaved(t *testing.T) {
+	db := NewDatabase("wal_test", WithPath(t.TempDir()))
+	for _, command := range []string{
+		"create table users (id int primary key, name, age int)",
+		"create table posts (id int primary key, user_id int references users (id) on delete cascade, title)",
+		"create table notes has text",
+		"insert into users values (1, Ann, 30), (2, Bob, 40)",
+	} {
+		if _, err := db.Query(command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+	}
+	if err := db.SetWAL(true); err != nil {
+		t.Fatal(err)
+	}
+	defer db.SetWAL(false)
+	if _, err := db.Query("insert into users values (3, Cy, 50)"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDatabase("wal_test", WithPath(db.dir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := walTestRows(t, loaded), walTestRows(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded rows\n%v\nwant\n%v", got, want)
+	}
+}
+
+// TestWALRecord checks the records of the log, one line of JSON for each write holding
+// the changes to the rows of each table, and that Save empties the log
+func TestWALRecord(t *testing.T) {
+	db := walTestDB(t)
+	for _, command := range []string{
+		"insert into users values (3, Cy, 50)",
+		"update users set age = 41 where id = 2",
+		"delete from users where id = 1",
+	} {
+		if _, err := db.Query(command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+	}
+	data, err := os.ReadFile(db.walPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{"seq":1,"changes":[{"table":"users","insert":[{"age":"50","id":"3","name":"Cy"}]}]}`,
+		`{"seq":2,"changes":[{"table":"users","update":[[{"age":"40","id":"2","name":"Bob"},{"age":"41","id":"2","name":"Bob"}]]}]}`,
+		`{"seq":3,"changes":[{"table":"posts","delete":[{"id":"1","title":"Hello","user_id":"1"}]},{"table":"users","delete":[{"age":"30","id":"1","name":"Ann"}]}]}`,
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("log holds %d records, want %d:\n%s", len(lines), len(want), data)
+	}
+	for i, line := range lines {
+		var record walRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("record %d: %v", i+1, err)
+		}
+		if record.Time.IsZero() {
+			t.Errorf("record %d has no time", i+1)
+		}
+		got, _ := json.Marshal(walRecord{Seq: record.Seq, Changes: record.Changes})
+		if string(got) != want[i] {
+			t.Errorf("record %d is\n%s\nwant\n%s", i+1, got, want[i])
+		}
+	}
+
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(db.walPath()); err != nil || info.Size() != 0 {
+		t.Errorf("Save left the log %v (%v), want it empty", info, err)
+	}
+}
+
+// TestWALCutRecord checks that a record cut short by a crash while it was written is
+// dropped on load, and that a corrupt record before others is refused
+func TestWALCutRecord(t *testing.T) {
+	db := walTestDB(t)
+	if _, err := db.Query("insert into users values (3, Cy, 50)"); err != nil {
+		t.Fatal(err)
+	}
+	want := walTestRows(t, db)
+	if _, err := db.Query("insert into users values (4, Di, 20)"); err != nil {
+		t.Fatal(err)
+	}
+	db.SetWAL(false)
+	data, err := os.ReadFile(db.walPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := bytes.IndexByte(data, '\n') + 1
+	cut := data[:len(data)-10]
+	if err := os.WriteFile(db.walPath(), cut, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDatabase("wal_test", WithPath(db.dir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := walTestRows(t, loaded); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded rows\n%v\nwant\n%v", got, want)
+	}
+	if info, err := os.Stat(db.walPath()); err != nil || info.Size() != int64(first) {
+		t.Errorf("load left a log of %v bytes (%v), want the %d of its complete record", info.Size(), err, first)
+	}
+
+	corrupt := append([]byte("{not json}\n"), data...)
+	if err := os.WriteFile(db.walPath(), corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDatabase("wal_test", WithPath(db.dir())); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("loading a corrupt log returned %v, want an error", err)
+	}
+}
+
+// TestWALCheckpoint checks that the log is emptied once it grows past the checkpoint
+// size and by schema changes, the database being saved instead, and that the rows are
+// loaded back either way
+func TestWALCheckpoint(t *testing.T) {
+	db := walTestDB(t)
+	if err := db.SetCheckpointSize(200); err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{
+		"insert into notes values (a)",
+		"insert into notes values (b)",
+		"insert into notes values (c)",
+		"insert into notes values (d)",
+	} {
+		if _, err := db.Query(command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+		if info, err := os.Stat(db.walPath()); err != nil || info.Size() > 200+100 {
+			t.Errorf("after %s the log holds %v bytes (%v), want it emptied past 200", command, info.Size(), err)
+		}
+	}
+	if _, err := db.Query("alter table notes add column extra"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(db.walPath()); err != nil || info.Size() != 0 {
+		t.Errorf("a schema change left a log of %v bytes (%v), want it empty", info.Size(), err)
+	}
+	if _, err := db.Query("insert into notes values (e, f)"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDatabase("wal_test", WithPath(db.dir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := walTestRows(t, loaded), walTestRows(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded rows\n%v\nwant\n%v", got, want)
+	}
+}
+
+// TestWALEncrypted checks that the records of an encrypted database are encrypted, and
+// replayed with its key only
+func TestWALEncrypted(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	db := walTestDB(t, WithEncryptionKey(key))
+	if _, err := db.Query("insert into users values (3, Secret, 50)"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(db.walPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("Secret")) {
+		t.Errorf("the log holds a row in clear: %s", data)
+	}
+	loaded, err := LoadDatabase("wal_test", WithPath(db.dir()), WithEncryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := walTestRows(t, loaded), walTestRows(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded rows\n%v\nwant\n%v", got, want)
+	}
+	if _, err := LoadDatabase("wal_test", WithPath(db.dir())); err == nil {
+		t.Errorf("loading an encrypted database without its key succeeded")
+	}
+}
@@ -0,0 +1,782 @@
+package MyDb
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XLSXOptions tells ImportXLSX which sheets of a workbook to import and how to create
+// the tables of the sheets that have none
+type XLSXOptions struct {
+	Sheets     []string              // Names of the sheets to import, every sheet when empty
+	Tables     map[string]string     // Table of sheets by name, by default the sheet name with the characters names cannot hold replaced by _
+	InferTypes bool                  // Give the tables created for sheets the types their values have, int, float, bool, date or datetime, rather than string columns
+	Types      map[string]ColumnType // Types of columns of the created tables by name, which override the inferred ones
+}
+
+// maxSheetRows is the number of rows a sheet holds, its header row included
+const maxSheetRows = 1048576
+
+// excelEpoch is day 0 of the dates of workbooks, and excelEpoch1904 that of workbooks
+// using the 1904 date system
+var (
+	excelEpoch     = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	excelEpoch1904 = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// ImportXLSX imports the sheets of an Excel workbook into tables, the first row of each
+// sheet naming its columns, and returns the report of each table. The table of a sheet is
+// created when it does not exist, with string columns named after the first row unless
+// InferTypes is set. The rows are inserted as ImportCSV does with the Columns, SkipBadRows
+// and BatchSize options, empty cells being NULL, dates being read as such and the values
+// of BLOB columns being decoded from base64 as ExportXLSX writes them
+func (db *Database) ImportXLSX(r io.ReaderAt, size int64, xlsx XLSXOptions, opts ImportOptions) (map[string]ImportReport, error) {
+	book, err := openWorkbook(r, size)
+	if err != nil {
+		return nil, err
+	}
+	sheets := book.sheets
+	if len(xlsx.Sheets) > 0 {
+		sheets = nil
+		for _, name := range xlsx.Sheets {
+			sheet, ok := book.sheet(name)
+			if !ok {
+				return nil, fmt.Errorf("sheet %s does not exist", name)
+			}
+			sheets = append(sheets, sheet)
+		}
+	}
+
+	reports := make(map[string]ImportReport, len(sheets))
+	for _, sheet := range sheets {
+		tableName, ok := xlsx.Tables[sheet.name]
+		if !ok {
+			tableName = safeName(sheet.name, "sheet")
+		}
+		report, err := db.importSheet(book, sheet, tableName, xlsx, opts)
+		reports[tableName] = report
+		if err != nil {
+			return reports, fmt.Errorf("sheet %s: %w", sheet.name, err)
+		}
+	}
+	return reports, nil
+}
+
+// importSheet imports a sheet of a workbook into a table, which it creates if needed
+func (db *Database) importSheet(book *workbook, sheet xlsxSheet, tableName string, xlsx XLSXOptions, opts ImportOptions) (ImportReport, error) {
+	// Map the columns of the sheet to those of the table
+	header, err := book.header(sheet)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	columns := sheetColumns(header, opts.Columns)
+	if _, err := db.tableColumns(tableName); err != nil {
+		if header == nil {
+			return ImportReport{}, nil // Nothing to create a table from
+		}
+		if err := db.createSheetTable(book, sheet, tableName, columns, xlsx); err != nil {
+			return ImportReport{}, err
+		}
+	}
+	im, table, err := db.newImporter(tableName, opts)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	table.mu.RLock()
+	tableColumns := table.Columns
+	var blobs []string
+	for _, col := range tableColumns {
+		if table.columnDef(col).Type == Blob {
+			blobs = append(blobs, col)
+		}
+	}
+	table.mu.RUnlock()
+	for _, column := range columns {
+		if column != "" {
+			if err := checkColumns(tableName, tableColumns, []string{column}); err != nil {
+				return ImportReport{}, err
+			}
+		}
+	}
+
+	// Insert the rows batch by batch
+	number := 0
+	err = book.readRows(sheet, func(line int, cells []string) error {
+		row := sheetRow(columns, cells)
+		if len(row) == 0 {
+			return nil // Every cell left out
+		}
+		number++
+		for _, col := range blobs {
+			if value, ok := row[col]; ok {
+				decoded, err := decodeInlineBlob(value)
+				if err != nil {
+					return im.reject(ImportError{Line: line, Row: number, Err: fmt.Errorf("column %s: %w", col, err)})
+				}
+				row[col] = decoded
+			}
+		}
+		return im.add(row, line, number)
+	})
+	if flushErr := im.flush(); err == nil {
+		err = flushErr
+	}
+	return im.report, err
+}
+
+// sheetColumns returns the table column of each column of a sheet from its header row:
+// the one the mapping gives, "" to leave it out, or else its name with the characters
+// names cannot hold replaced by _, "column_<n>" when it has none
+func sheetColumns(header []string, mapping map[string]string) []string {
+	columns := make([]string, len(header))
+	for i, name := range header {
+		if column, mapped := mapping[name]; mapped {
+			columns[i] = column
+			continue
+		}
+		name = safeName(name, "column_"+strconv.Itoa(i+1))
+		column := name
+		for n := 2; contains(columns, column); n++ {
+			column = name + "_" + strconv.Itoa(n)
+		}
+		columns[i] = column
+	}
+	return columns
+}
+
+// sheetRow returns the row of the cells of a sheet, empty cells being NULL
+func sheetRow(columns, cells []string) map[string]string {
+	row := make(map[string]string, len(cells))
+	for i, value := range cells {
+		if i < len(columns) && columns[i] != "" && value != "" {
+			row[columns[i]] = value
+		}
+	}
+	return row
+}
+
+// createSheetTable creates the table of a sheet with its columns, typed after their
+// values when types are inferred
+func (db *Database) createSheetTable(book *workbook, sheet xlsxSheet, tableName string, columns []string, xlsx XLSXOptions) error {
+	inferences := make([]typeInference, len(columns))
+	if xlsx.InferTypes {
+		err := book.readRows(sheet, func(line int, cells []string) error {
+			for i := 0; i < len(cells) && i < len(columns); i++ {
+				inferences[i].add(cells[i])
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	var defs []ColumnDef
+	for i, column := range columns {
+		if column == "" {
+			continue
+		}
+		def := ColumnDef{Name: column, Type: inferences[i].columnType()}
+		if t, ok := xlsx.Types[column]; ok {
+			def.Type = t
+		}
+		defs = append(defs, def)
+	}
+	return db.CreateTableWithSchema(tableName, defs)
+}
+
+// safeName returns a name with the characters names cannot hold replaced by _, or
+// fallback when it has none of the others
+func safeName(name, fallback string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(name) {
+		if r < 128 && (r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	safe := b.String()
+	if strings.Trim(safe, "_") == "" {
+		return fallback
+	}
+	if safe[0] >= '0' && safe[0] <= '9' {
+		safe = "_" + safe
+	}
+	return safe
+}
+
+// ExportXLSX writes tables to any writer as an Excel workbook with a sheet named after
+// each table, every table when no name is given. The first row of a sheet holds the column
+// names, and values are written as numbers, booleans and dates after the types of their
+// columns, NULL as empty cells and BLOB values base64 encoded. The tables are
+// snapshotted at once, so writes go on while the workbook is written
+func (db *Database) ExportXLSX(w io.Writer, tableNames ...string) error {
+	tables, err := db.snapshotTables(tableNames...)
+	if err != nil {
+		return err
+	}
+	if len(tableNames) == 0 {
+		for tableName := range tables {
+			tableNames = append(tableNames, tableName)
+		}
+		sort.Strings(tableNames)
+	}
+	for _, tableName := range tableNames {
+		if len(tables[tableName].Rows)+1 > maxSheetRows {
+			return fmt.Errorf("table %s has more rows than a sheet holds", tableName)
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	var sheets, types, rels strings.Builder
+	var names []string
+	for i, tableName := range tableNames {
+		name := sheetName(tableName, names)
+		names = append(names, name)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, name, i+1, i+1)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(tableNames)+1)
+	files := []struct{ name, data string }{
+		{"[Content_Types].xml", xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` + types.String() + `</Types>`},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, file.data); err != nil {
+			return err
+		}
+	}
+	for i, tableName := range tableNames {
+		fw, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeSheet(fw, tables[tableName]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// xmlHeader starts the XML files of workbooks
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// Styles of the cells of exported workbooks, by index in xlsxStyles
+const (
+	dateStyle     = 1
+	dateTimeStyle = 2
+	headerStyle   = 3
+)
+
+// xlsxStyles are the styles of exported workbooks: the default one, ISO dates, ISO
+// dates and times and bold text
+const xlsxStyles = xmlHeader + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`
+
+// sheetName returns the name of the sheet of a table, which Excel limits to 31 characters
+// and which must differ from the names taken regardless of case
+func sheetName(tableName string, taken []string) string {
+	name := tableName
+	for n := 2; ; n++ {
+		if len(name) > 31 {
+			name = name[:31]
+		}
+		free := true
+		for _, other := range taken {
+			free = free && !strings.EqualFold(other, name)
+		}
+		if free {
+			return name
+		}
+		suffix := "_" + strconv.Itoa(n)
+		name = tableName[:min(len(tableName), 31-len(suffix))] + suffix
+	}
+}
+
+// writeSheet writes the worksheet of a table, with its column names in a frozen first row
+func writeSheet(w io.Writer, table *Table) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xmlHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews><sheetData>`)
+	bw.WriteString(`<row r="1">`)
+	for i, col := range table.Columns {
+		writeCell(bw, i, 1, col, String, headerStyle)
+	}
+	bw.WriteString(`</row>`)
+	for i, row := range table.Rows {
+		fmt.Fprintf(bw, `<row r="%d">`, i+2)
+		for j, col := range table.Columns {
+			if value, ok := row[col]; ok && value != "" {
+				writeCell(bw, j, i+2, value, table.columnDef(col).Type, 0)
+			}
+		}
+		bw.WriteString(`</row>`)
+	}
+	bw.WriteString(`</sheetData></worksheet>`)
+	return bw.Flush()
+}
+
+// writeCell writes a cell holding a value of a column type, in a style when it is not 0
+func writeCell(w *bufio.Writer, column, line int, value string, t ColumnType, style int) {
+	fmt.Fprintf(w, `<c r="%s%d"`, cellColumn(column), line)
+	if style != 0 {
+		fmt.Fprintf(w, ` s="%d"`, style)
+	}
+	switch {
+	case (t == Int || t == Float || t == Decimal) && isFinite(value):
+		w.WriteString(`><v>` + value + `</v></c>`)
+		return
+	case t == Bool && (value == "true" || value == "false"):
+		w.WriteString(` t="b"><v>` + strconv.Itoa(map[string]int{"false": 0, "true": 1}[value]) + `</v></c>`)
+		return
+	case t == Date || t == DateTime:
+		if d, ok := parseDateTime(value); ok {
+			days := float64(d.Sub(excelEpoch)) / float64(24*time.Hour)
+			style := dateTimeStyle
+			if t == Date {
+				style = dateStyle
+			}
+			fmt.Fprintf(w, ` s="%d"><v>%s</v></c>`, style, strconv.FormatFloat(days, 'f', -1, 64))
+			return
+		}
+	case t == Blob:
+		value = encodeInlineBlob(value)
+	}
+	w.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+	xml.EscapeText(w, []byte(value))
+	w.WriteString(`</t></is></c>`)
+}
+
+// cellColumn returns the letters of a column of a sheet, "A" for the first one
+func cellColumn(i int) string {
+	letters := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		letters = string(rune('A'+(i-1)%26)) + letters
+	}
+	return letters
+}
+
+// workbook is an Excel workbook being imported
+type workbook struct {
+	files   map[string]*zip.File // Files of the workbook by path
+	sheets  []xlsxSheet          // Sheets in order
+	strings []string             // Shared strings of the cells
+	formats []dateFormat         // Date format of each cell style
+	epoch   time.Time            // Day 0 of the dates
+}
+
+// xlsxSheet is a sheet of a workbook
+type xlsxSheet struct {
+	name string // Name of the sheet
+	path string // Path of its worksheet in the workbook
+}
+
+// dateFormat tells whether a cell style formats numbers as dates
+type dateFormat int
+
+const (
+	notDate      dateFormat = iota // The style shows numbers
+	dateOnly                       // The style shows dates without times
+	timeOnly                       // The style shows times without dates
+	dateWithTime                   // The style shows dates and times
+)
+
+// builtinDateFormats are the date formats of the built-in number formats by id
+var builtinDateFormats = map[int]dateFormat{
+	14: dateOnly, 15: dateOnly, 16: dateOnly, 17: dateOnly, 22: dateWithTime,
+	18: timeOnly, 19: timeOnly, 20: timeOnly, 21: timeOnly, 45: timeOnly, 46: timeOnly, 47: timeOnly,
+}
+
+// xlsxRels are the relationships of a part of a workbook
+type xlsxRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is the text of a shared string or an inline string, plain or in runs
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+// xlsxRow is a row of a worksheet
+type xlsxRow struct {
+	R     int `xml:"r,attr"`
+	Cells []struct {
+		R  string   `xml:"r,attr"`
+		T  string   `xml:"t,attr"`
+		S  int      `xml:"s,attr"`
+		V  string   `xml:"v"`
+		Is xlsxText `xml:"is"`
+	} `xml:"c"`
+}
+
+// openWorkbook reads the sheets, the shared strings and the styles of a workbook
+func openWorkbook(r io.ReaderAt, size int64) (*workbook, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX workbook: %w", err)
+	}
+	b := &workbook{files: make(map[string]*zip.File), epoch: excelEpoch}
+	for _, f := range zr.File {
+		b.files[f.Name] = f
+	}
+
+	// Find the workbook part and its parts from the relationships
+	bookPath := "xl/workbook.xml"
+	var rels xlsxRels
+	if err := b.decode("_rels/.rels", &rels); err != nil {
+		return nil, err
+	}
+	for _, rel := range rels.Rels {
+		if strings.HasSuffix(rel.Type, "/officeDocument") {
+			bookPath = strings.TrimPrefix(rel.Target, "/")
+		}
+	}
+	var book struct {
+		Pr struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := b.decode(bookPath, &book); err != nil {
+		return nil, err
+	}
+	if book.Pr.Date1904 == "1" || book.Pr.Date1904 == "true" {
+		b.epoch = excelEpoch1904
+	}
+	rels = xlsxRels{}
+	if err := b.decode(path.Join(path.Dir(bookPath), "_rels", path.Base(bookPath)+".rels"), &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Rels {
+		target := path.Join(path.Dir(bookPath), rel.Target)
+		if strings.HasPrefix(rel.Target, "/") {
+			target = strings.TrimPrefix(rel.Target, "/")
+		}
+		targets[rel.ID] = target
+		switch {
+		case strings.HasSuffix(rel.Type, "/sharedStrings"):
+			var sst struct {
+				Items []xlsxText `xml:"si"`
+			}
+			if err := b.decode(target, &sst); err != nil {
+				return nil, err
+			}
+			b.strings = make([]string, len(sst.Items))
+			for i, item := range sst.Items {
+				b.strings[i] = item.String()
+			}
+		case strings.HasSuffix(rel.Type, "/styles"):
+			if err := b.readStyles(target); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, sheet := range book.Sheets {
+		if target, ok := targets[sheet.ID]; ok {
+			b.sheets = append(b.sheets, xlsxSheet{name: sheet.Name, path: target})
+		}
+	}
+	return b, nil
+}
+
+// decode decodes an XML file of the workbook
+func (b *workbook) decode(name string, v any) error {
+	f, ok := b.files[name]
+	if !ok {
+		return fmt.Errorf("invalid XLSX workbook: %s is missing", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("invalid XLSX workbook: %s: %w", name, err)
+	}
+	return nil
+}
+
+// readStyles reads which cell styles of the workbook format dates
+func (b *workbook) readStyles(name string) error {
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := b.decode(name, &styles); err != nil {
+		return err
+	}
+	formats := make(map[int]dateFormat)
+	for id, format := range builtinDateFormats {
+		formats[id] = format
+	}
+	for _, numFmt := range styles.NumFmts {
+		formats[numFmt.ID] = parseDateFormat(numFmt.Code)
+	}
+	b.formats = make([]dateFormat, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		b.formats[i] = formats[xf.NumFmtID]
+	}
+	return nil
+}
+
+// parseDateFormat returns whether a number format code formats dates, e.g. "yyyy-mm-dd",
+// leaving out its quoted text, escaped characters and bracketed colors and locales.
+// Elapsed times such as "[h]:mm" are numbers
+func parseDateFormat(code string) dateFormat {
+	var date, clock bool
+	quoted := false
+	for i := 0; i < len(code); i++ {
+		c := code[i] | 0x20 // Lower case letters
+		switch {
+		case code[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case code[i] == '\\':
+			i++
+		case code[i] == '[':
+			end := strings.IndexByte(code[i:], ']')
+			if end < 0 {
+				return notDate
+			}
+			if elapsed := strings.ToLower(code[i+1 : i+end]); strings.Trim(elapsed, "hms") == "" && elapsed != "" {
+				return notDate
+			}
+			i += end
+		case c == 'y' || c == 'd':
+			date = true
+		case c == 'h' || c == 's':
+			clock = true
+		case c == 'm':
+			// Minutes follow hours or come before seconds, months are dates
+			date = date || !clock && !beforeSeconds(code[i:])
+		}
+	}
+	switch {
+	case date && clock:
+		return dateWithTime
+	case date:
+		return dateOnly
+	case clock:
+		return timeOnly
+	}
+	return notDate
+}
+
+// beforeSeconds reports whether the letters m of a number format code starting it are
+// followed by seconds, e.g. "mm:ss", with only separators between them
+func beforeSeconds(code string) bool {
+	rest := strings.TrimLeft(code, "mM")
+	rest = strings.TrimLeft(rest, ":. ")
+	return rest != "" && rest[0]|0x20 == 's'
+}
+
+// sheet returns the sheet with the given name
+func (b *workbook) sheet(name string) (xlsxSheet, bool) {
+	for _, sheet := range b.sheets {
+		if sheet.name == name {
+			return sheet, true
+		}
+	}
+	return xlsxSheet{}, false
+}
+
+// errStopRows stops reading the rows of a sheet
+var errStopRows = errors.New("stop reading rows")
+
+// header returns the cells of the first row of a sheet, nil when it has none
+func (b *workbook) header(sheet xlsxSheet) ([]string, error) {
+	var header []string
+	err := b.eachRow(sheet, func(line int, cells []string) error {
+		header = cells
+		return errStopRows
+	})
+	if err == errStopRows {
+		err = nil
+	}
+	return header, err
+}
+
+// readRows calls fn with the number and the cells of each row of a sheet after the first
+func (b *workbook) readRows(sheet xlsxSheet, fn func(line int, cells []string) error) error {
+	first := true
+	return b.eachRow(sheet, func(line int, cells []string) error {
+		if first {
+			first = false
+			return nil
+		}
+		return fn(line, cells)
+	})
+}
+
+// eachRow calls fn with the number and the cells of each row of a sheet holding a value,
+// streaming its worksheet
+func (b *workbook) eachRow(sheet xlsxSheet, fn func(line int, cells []string) error) error {
+	f, ok := b.files[sheet.path]
+	if !ok {
+		return fmt.Errorf("invalid XLSX workbook: %s is missing", sheet.path)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	dec := xml.NewDecoder(rc)
+	line := 0
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid XLSX worksheet %s: %w", sheet.name, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row xlsxRow
+		if err := dec.DecodeElement(&row, &start); err != nil {
+			return fmt.Errorf("invalid XLSX worksheet %s: %w", sheet.name, err)
+		}
+		if line++; row.R > 0 {
+			line = row.R
+		}
+
+		var cells []string
+		empty := true
+		for i, cell := range row.Cells {
+			column := i
+			if cell.R != "" {
+				column = cellIndex(cell.R)
+			}
+			if column < 0 || column >= 16384 {
+				return fmt.Errorf("invalid XLSX worksheet %s: invalid cell %s", sheet.name, cell.R)
+			}
+			var value string
+			switch cell.T {
+			case "s":
+				if n, err := strconv.Atoi(cell.V); err == nil && n >= 0 && n < len(b.strings) {
+					value = b.strings[n]
+				}
+			case "inlineStr":
+				value = cell.Is.String()
+			case "b":
+				value = strconv.FormatBool(cell.V == "1")
+			case "e":
+				// Errors such as #DIV/0! are NULL
+			case "str", "d":
+				value = cell.V
+			default:
+				value = b.number(cell.V, cell.S)
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			cells[column] = value
+			empty = empty && value == ""
+		}
+		if empty {
+			continue
+		}
+		if err := fn(line, cells); err != nil {
+			return err
+		}
+	}
+}
+
+// number returns the value of a number cell in a style, a date or a time when the style
+// formats it as one
+func (b *workbook) number(value string, style int) string {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	format := notDate
+	if style >= 0 && style < len(b.formats) {
+		format = b.formats[style]
+	}
+	if format == notDate || f < 0 || format == timeOnly && f >= 1 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	t := b.epoch.Add(time.Duration(math.Round(f*24*3600*1000)) * time.Millisecond)
+	switch {
+	case format == timeOnly:
+		return t.Format("15:04:05")
+	case format == dateOnly && f == math.Trunc(f):
+		return t.Format(dateLayout)
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// cellIndex returns the column of a cell reference such as "B7", 0 for column A
+func cellIndex(ref string) int {
+	n := 0
+	for _, r := range ref {
+		r &^= 0x20 // Upper case letters
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		n = n*26 + int(r-'A'+1)
+	}
+	return n - 1
+}
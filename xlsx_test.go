@@ -0,0 +1,242 @@
+package MyDb
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCellColumn checks the letters of columns against those Excel gives them, up to
+// XFD, its last column
+func TestCellColumn(t *testing.T) {
+	tests := []struct {
+		index   int
+		letters string
+	}{
+		{0, "A"}, {1, "B"}, {25, "Z"}, {26, "AA"}, {51, "AZ"}, {52, "BA"},
+		{701, "ZZ"}, {702, "AAA"}, {16383, "XFD"},
+	}
+	for _, tt := range tests {
+		if got := cellColumn(tt.index); got != tt.letters {
+			t.Errorf("cellColumn(%d) = %s, want %s", tt.index, got, tt.letters)
+		}
+		if got := cellIndex(tt.letters + "12"); got != tt.index {
+			t.Errorf("cellIndex(%s12) = %d, want %d", tt.letters, got, tt.index)
+		}
+	}
+	if got := cellIndex("xfd1"); got != 16383 {
+		t.Errorf("cellIndex(xfd1) = %d, want 16383", got)
+	}
+}
+
+// TestParseDateFormat checks which number format codes format dates, with codes Excel
+// writes for its date, time and number formats
+func TestParseDateFormat(t *testing.T) {
+	tests := []struct {
+		code string
+		want dateFormat
+	}{
+		{"yyyy-mm-dd", dateOnly},
+		{"m/d/yy", dateOnly},
+		{"d-mmm-yy", dateOnly},
+		{"[$-409]mmmm d, yyyy;@", dateOnly},
+		{"dddd, mmmm dd, yyyy", dateOnly},
+		{"yyyy-mm-dd hh:mm:ss", dateWithTime},
+		{"m/d/yy h:mm", dateWithTime},
+		{"h:mm AM/PM", timeOnly},
+		{"h:mm:ss", timeOnly},
+		{"mm:ss", timeOnly},
+		{"mm:ss.0", timeOnly},
+		{"[h]:mm:ss", notDate},
+		{"[mm]:ss", notDate},
+		{"0.00", notDate},
+		{"#,##0.00 [$€-407]", notDate},
+		{"[Red]#,##0;[Blue]-#,##0", notDate},
+		{`"Day "0`, notDate},
+		{`\d0`, notDate},
+		{"General", notDate},
+	}
+	for _, tt := range tests {
+		if got := parseDateFormat(tt.code); got != tt.want {
+			t.Errorf("parseDateFormat(%q) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+// TestXLSXNumber checks the values of number cells against the dates Excel shows for
+// their serial numbers, in the 1900 and the 1904 date systems
+func TestXLSXNumber(t *testing.T) {
+	formats := []dateFormat{notDate, dateOnly, dateWithTime, timeOnly}
+	tests := []struct {
+		epoch1904 bool
+		value     string
+		style     int
+		want      string
+	}{
+		{false, "45292", 1, "2024-01-01"},
+		{false, "36526", 1, "2000-01-01"},
+		{false, "61", 1, "1900-03-01"},
+		{false, "45292.75", 2, "2024-01-01T18:00:00Z"},
+		{false, "45292.5", 1, "2024-01-01T12:00:00Z"},
+		{false, "0.5", 3, "12:00:00"},
+		{false, "0.010416666666666666", 3, "00:15:00"},
+		{false, "1.25", 3, "1.25"},
+		{false, "45292", 0, "45292"},
+		{false, "1.50", 0, "1.5"},
+		{false, "1E-3", 0, "0.001"},
+		{false, "-1", 1, "-1"},
+		{false, "45292", 9, "45292"},
+		{true, "43830", 1, "2024-01-01"},
+		{true, "0", 1, "1904-01-01"},
+	}
+	for _, tt := range tests {
+		b := &workbook{formats: formats, epoch: excelEpoch}
+		if tt.epoch1904 {
+			b.epoch = excelEpoch1904
+		}
+		if got := b.number(tt.value, tt.style); got != tt.want {
+			t.Errorf("number(%s, %d) with 1904 dates %v = %s, want %s", tt.value, tt.style, tt.epoch1904, got, tt.want)
+		}
+	}
+}
+
+// TestWriteCell checks the cells written for values of every column type
+func TestWriteCell(t *testing.T) {
+	tests := []struct {
+		value string
+		typ   ColumnType
+		want  string
+	}{
+		{"42", Int, `<c r="B3"><v>42</v></c>`},
+		{"-1.5e3", Float, `<c r="B3"><v>-1.5e3</v></c>`},
+		{"NaN", Float, `<c r="B3" t="inlineStr"><is><t xml:space="preserve">NaN</t></is></c>`},
+		{"12.50", Decimal, `<c r="B3"><v>12.50</v></c>`},
+		{"true", Bool, `<c r="B3" t="b"><v>1</v></c>`},
+		{"false", Bool, `<c r="B3" t="b"><v>0</v></c>`},
+		{"2024-01-01", Date, `<c r="B3" s="1"><v>45292</v></c>`},
+		{"2024-01-01T18:00:00Z", DateTime, `<c r="B3" s="2"><v>45292.75</v></c>`},
+		{"a < b & c", String, `<c r="B3" t="inlineStr"><is><t xml:space="preserve">a &lt; b &amp; c</t></is></c>`},
+		{" 7", String, `<c r="B3" t="inlineStr"><is><t xml:space="preserve"> 7</t></is></c>`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		writeCell(w, 1, 3, tt.value, tt.typ, 0)
+		w.Flush()
+		if got := buf.String(); got != tt.want {
+			t.Errorf("writeCell(%q, %s) = %s, want %s", tt.value, tt.typ, got, tt.want)
+		}
+	}
+}
+
+// TestImportXLSX imports a workbook laid out as Excel saves them, with shared strings in
+// runs, cells left out, error cells, formula strings and date styles
+func TestImportXLSX(t *testing.T) {
+	const rels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`
+	files := map[string]string{
+		"_rels/.rels": rels + `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`,
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<workbookPr date1904="false"/><sheets><sheet name="Orders 2024" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": rels +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>` +
+			`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="/xl/styles.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="5" uniqueCount="5">` +
+			`<si><t>id</t></si><si><t>customer</t></si><si><t>ordered</t></si><si><t>paid</t></si>` +
+			`<si><r><rPr><b/></rPr><t>Ann </t></r><r><t>Lee</t></r></si></sst>`,
+		"xl/styles.xml": `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<numFmts count="1"><numFmt numFmtId="164" formatCode="dd/mm/yyyy\ hh:mm"/></numFmts>` +
+			`<cellXfs count="3"><xf numFmtId="0"/><xf numFmtId="14" applyNumberFormat="1"/><xf numFmtId="164" applyNumberFormat="1"/></cellXfs></styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c><c r="E1" t="s"><v>3</v></c></row>` +
+			`<row r="2"><c r="A2"><v>1</v></c><c r="B2" t="s"><v>4</v></c><c r="C2" s="1"><v>45292</v></c><c r="D2" t="b"><v>1</v></c></row>` +
+			`<row r="4"><c r="A4"><v>2</v></c><c r="C4" s="2"><v>45292.75</v></c><c r="D4" t="e"><v>#N/A</v></c></row>` +
+			`<row r="5"><c r="B5" t="str"><f>"x"&amp;"y"</f><v>xy</v></c></row>` +
+			`<row r="6"><c r="A6" s="1"/></row>` +
+			`<row r="7"><c r="A7"><v>3</v></c><c r="B7" t="inlineStr"><is><t>Bob</t></is></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDatabase("xlsx_test", WithStorage(&MemoryStorage{}))
+	reports, err := db.ImportXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()), XLSXOptions{InferTypes: true}, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := reports["Orders_2024"]; report.Rows != 4 {
+		t.Errorf("imported %+v, want 4 rows in table Orders_2024", reports)
+	}
+	table := db.Tables["Orders_2024"]
+	if want := []string{"id", "customer", "ordered", "paid", "paid_2"}; !reflect.DeepEqual(table.Columns, want) {
+		t.Errorf("columns %v, want %v", table.Columns, want)
+	}
+	wantTypes := map[string]ColumnType{"id": Int, "customer": String, "ordered": DateTime, "paid": Bool}
+	for col, typ := range wantTypes {
+		if got := table.columnDef(col).Type; got != typ {
+			t.Errorf("column %s has type %s, want %s", col, got, typ)
+		}
+	}
+	want := []map[string]string{
+		{"id": "1", "customer": "Ann Lee", "ordered": "2024-01-01T00:00:00Z", "paid": "true"},
+		{"id": "2", "ordered": "2024-01-01T18:00:00Z"},
+		{"customer": "xy"},
+		{"id": "3", "customer": "Bob"},
+	}
+	if !reflect.DeepEqual(table.Rows, want) {
+		t.Errorf("rows\n%v\nwant\n%v", table.Rows, want)
+	}
+}
+
+// TestXLSXRoundTrip checks that importing an exported workbook into tables of the same
+// columns gives back their rows
+func TestXLSXRoundTrip(t *testing.T) {
+	schema := "create table items (id int primary key, name, price decimal, weight float, stock bool, added date, seen datetime, data blob)"
+	db := NewDatabase("xlsx_test", WithStorage(&MemoryStorage{}))
+	if _, err := db.Query(schema); err != nil {
+		t.Fatal(err)
+	}
+	rows := []map[string]string{
+		{"id": "1", "name": "Ann <&> \"Lee\"", "price": "12.5", "weight": "0.25", "stock": "true", "added": "2024-02-29", "seen": "2024-02-29T23:59:59Z", "data": "\x00\x01\xff"},
+		{"id": "2", "name": "  spaces  ", "price": "-0.001", "weight": "1e+21", "stock": "false", "added": "1900-03-01", "seen": "2000-01-01T12:30:00.5Z"},
+		{"id": "3", "name": strings.Repeat("日本", 100)},
+		{"id": "4"},
+	}
+	if err := db.InsertMany("items", rows); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := db.ExportXLSX(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := NewDatabase("xlsx_test", WithStorage(&MemoryStorage{}))
+	if _, err := imported.Query(schema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imported.ImportXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()), XLSXOptions{}, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := db.Query("get from items order by id")
+	got, err := imported.Query("get from items order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Rows, want.Rows) {
+		t.Errorf("imported rows\n%v\nwant\n%v", got.Rows, want.Rows)
+	}
+}
@@ -0,0 +1,471 @@
+package MyDb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the documents of YAML data into the values encoding/json decodes with
+// UseNumber: maps, slices, strings, json.Number, bools and nil. It reads block and flow
+// mappings and sequences, plain and quoted scalars, | and > block scalars, comments and
+// "---" separators, which can be followed by the document, but not anchors, tags or plain
+// scalars over several lines
+func parseYAML(data []byte) ([]any, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	raw := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	var docs []any
+	start := 0
+	for i := 0; i <= len(raw); i++ {
+		next := i + 1
+		if i < len(raw) {
+			marker := strings.TrimRight(stripYAMLComment(raw[i]), " ")
+			if strings.HasPrefix(marker, "--- ") {
+				// The document starts on the line of its marker, e.g. "--- |"
+				raw[i], next = "   "+raw[i][3:], i
+			} else if marker != "---" && marker != "..." {
+				continue
+			}
+		}
+		doc, empty, err := parseYAMLDocument(raw, start, i)
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			docs = append(docs, doc)
+		}
+		start = next
+	}
+	return docs, nil
+}
+
+// yamlLine is a line of YAML data holding content
+type yamlLine struct {
+	number int    // Line number, from 1
+	indent int    // Number of leading spaces
+	text   string // Content after the indentation, without comment
+}
+
+// yamlParser parses the lines of a YAML document
+type yamlParser struct {
+	raw   []string   // Lines of the data, read again by block scalars
+	lines []yamlLine // Lines of the document holding content
+	pos   int        // Line being parsed
+}
+
+// parseYAMLDocument parses the document held by raw lines from start to end, reporting
+// whether it is empty
+func parseYAMLDocument(raw []string, start, end int) (any, bool, error) {
+	p := &yamlParser{raw: raw}
+	for i := start; i < end; i++ {
+		text := strings.TrimRight(stripYAMLComment(raw[i]), " \t")
+		content := strings.TrimLeft(text, " ")
+		if content == "" || content[0] == '%' { // Blank, comment or directive
+			continue
+		}
+		indent := len(text) - len(content)
+		if content[0] == '\t' {
+			return nil, false, fmt.Errorf("line %d: tabs cannot indent YAML", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: indent, text: content})
+	}
+	if len(p.lines) == 0 {
+		return nil, true, nil
+	}
+	doc, err := p.node(-1)
+	if err == nil && p.pos < len(p.lines) {
+		err = fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return doc, false, err
+}
+
+// node parses the node starting at the current line, nested in a node indented by
+// parent spaces
+func (p *yamlParser) node(parent int) (any, error) {
+	line := p.lines[p.pos]
+	if isYAMLItem(line.text) {
+		return p.sequence(line.indent)
+	}
+	if _, _, ok, err := splitYAMLKey(line); ok || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return p.mapping(line.indent)
+	}
+	p.pos++
+	return p.value(line.text, parent, line.number, false)
+}
+
+// sequence parses the items of a block sequence indented by indent spaces
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isYAMLItem(line.text) {
+			break
+		}
+		rest := strings.TrimLeft(line.text[1:], " ")
+		var item any
+		var err error
+		if _, _, isKey, _ := splitYAMLKey(yamlLine{text: rest}); isKey || isYAMLItem(rest) {
+			// The rest of the line starts a node indented past the dash
+			p.lines[p.pos].indent, p.lines[p.pos].text = indent+len(line.text)-len(rest), rest
+			item, err = p.node(indent)
+		} else {
+			p.pos++
+			item, err = p.value(rest, indent, line.number, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, p.checkEnd(indent)
+}
+
+// mapping parses the entries of a block mapping indented by indent spaces
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	m := make(map[string]any)
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || isYAMLItem(line.text) {
+			break
+		}
+		key, rest, ok, err := splitYAMLKey(line)
+		if err == nil && !ok {
+			err = fmt.Errorf("line %d: expected \"key: value\"", line.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := m[key]; exists {
+			return nil, fmt.Errorf("line %d: key %s is repeated", line.number, key)
+		}
+		p.pos++
+		if m[key], err = p.value(rest, indent, line.number, true); err != nil {
+			return nil, err
+		}
+	}
+	return m, p.checkEnd(indent)
+}
+
+// checkEnd returns an error when the line after a node indented by indent spaces is
+// indented further, which no node can start
+func (p *yamlParser) checkEnd(indent int) error {
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return nil
+}
+
+// value parses the value written after a key or a dash on a line, or on the lines after
+// it when there is none. A sequence may be indented as its key when inKey is set
+func (p *yamlParser) value(text string, parent, number int, inKey bool) (any, error) {
+	switch {
+	case text == "":
+		if p.pos == len(p.lines) {
+			return nil, nil
+		}
+		next := p.lines[p.pos]
+		if next.indent > parent || inKey && next.indent == parent && isYAMLItem(next.text) {
+			return p.node(parent)
+		}
+		return nil, nil
+	case text[0] == '|' || text[0] == '>':
+		return p.blockScalar(text, parent, number)
+	case text[0] == '[' || text[0] == '{':
+		// Flow collections go on until their brackets close
+		for flowDepth(text) > 0 && p.pos < len(p.lines) {
+			text += " " + p.lines[p.pos].text
+			p.pos++
+		}
+	}
+	return parseYAMLFlow(text, number)
+}
+
+// flowDepth returns the number of flow collections a line of YAML opens and leaves open
+func flowDepth(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case '"', '\'':
+			if _, end, err := readYAMLQuoted(text, i); err == nil {
+				i = end - 1
+			}
+		}
+	}
+	return depth
+}
+
+// blockScalar parses a | or > block scalar whose header is on a line, from the lines
+// after it indented past parent spaces
+func (p *yamlParser) blockScalar(header string, parent, number int) (string, error) {
+	chomp := byte(0)
+	for _, c := range header[1:] {
+		switch {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = byte(c)
+		default:
+			return "", fmt.Errorf("line %d: unsupported block scalar header %s", number, header)
+		}
+	}
+
+	// Read the lines indented further than the parent, blank lines included
+	var lines []string
+	indent, last := -1, number
+	for i := number; i < len(p.raw); i++ {
+		text := strings.TrimRight(p.raw[i], " \t")
+		content := strings.TrimLeft(text, " ")
+		if content != "" && (len(text)-len(content) <= parent || indent >= 0 && len(text)-len(content) < indent) {
+			break
+		}
+		if content == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if indent < 0 {
+			indent = len(text) - len(content)
+		}
+		lines = append(lines, text[indent:])
+		last = i + 1
+	}
+	for p.pos < len(p.lines) && p.lines[p.pos].number <= last {
+		p.pos++
+	}
+	lines = lines[:last-number] // Trailing blank lines only count for chomping
+
+	var sb strings.Builder
+	for i, line := range lines {
+		switch {
+		case i == 0:
+		case header[0] == '|' || line == "":
+			sb.WriteByte('\n')
+		case lines[i-1] != "":
+			sb.WriteByte(' ') // Folded lines, a blank line being a line break
+		}
+		sb.WriteString(line)
+	}
+	value := sb.String()
+	switch {
+	case chomp == '-' || value == "":
+		return value, nil
+	case chomp == '+':
+		return value + "\n" + strings.Repeat("\n", p.blankLinesAfter(last)), nil
+	}
+	return value + "\n", nil
+}
+
+// blankLinesAfter returns the number of blank lines after a line of the data
+func (p *yamlParser) blankLinesAfter(number int) int {
+	n := 0
+	for i := number; i < len(p.raw) && strings.TrimSpace(p.raw[i]) == ""; i++ {
+		n++
+	}
+	return n
+}
+
+// isYAMLItem reports whether the content of a line starts an item of a block sequence
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a line holding "key: value" into the key and the value, and
+// reports whether it does
+func splitYAMLKey(line yamlLine) (string, string, bool, error) {
+	text := line.text
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return "", "", false, nil
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		key, end, err := readYAMLQuoted(text, 0)
+		if err != nil {
+			return "", "", false, fmt.Errorf("line %d: %w", line.number, err)
+		}
+		rest := strings.TrimLeft(text[end:], " ")
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false, nil
+		}
+		return key, strings.TrimSpace(rest[1:]), true, nil
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// stripYAMLComment removes the comment ending a line, a # at its start or after a space
+// outside quoted scalars
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,:-", line[i-1]) >= 0):
+			quote = c
+		}
+	}
+	return line
+}
+
+// readYAMLQuoted reads the quoted scalar starting at position i of a text and returns it
+// with the position after it
+func readYAMLQuoted(text string, i int) (string, int, error) {
+	quote := text[i]
+	for j := i + 1; j < len(text); j++ {
+		switch {
+		case quote == '"' && text[j] == '\\':
+			j++
+		case quote == '\'' && text[j] == '\'' && j+1 < len(text) && text[j+1] == '\'':
+			j++ // '' is a quote
+		case text[j] == quote:
+			if quote == '\'' {
+				return strings.ReplaceAll(text[i+1:j], "''", "'"), j + 1, nil
+			}
+			value, err := strconv.Unquote(text[i : j+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", text[i:j+1])
+			}
+			return value, j + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string %s", text[i:])
+}
+
+// parseYAMLFlow parses a scalar, or a flow sequence or mapping, written on one line
+func parseYAMLFlow(text string, number int) (any, error) {
+	f := &yamlFlow{text: text}
+	value, err := f.value("")
+	if err == nil {
+		f.skipSpaces()
+		if f.pos < len(text) {
+			err = fmt.Errorf("unexpected %s", text[f.pos:])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", number, err)
+	}
+	return value, nil
+}
+
+// yamlFlow reads the values of a line of YAML in flow style
+type yamlFlow struct {
+	text string
+	pos  int
+}
+
+func (f *yamlFlow) skipSpaces() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+// value reads a value, plain scalars ending at one of the stop characters
+func (f *yamlFlow) value(stop string) (any, error) {
+	f.skipSpaces()
+	if f.pos == len(f.text) {
+		return nil, nil
+	}
+	switch f.text[f.pos] {
+	case '[':
+		f.pos++
+		items := []any{}
+		for {
+			f.skipSpaces()
+			if f.pos < len(f.text) && f.text[f.pos] == ']' {
+				f.pos++
+				return items, nil
+			}
+			item, err := f.value(",]")
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.pos++
+		m := make(map[string]any)
+		for {
+			f.skipSpaces()
+			if f.pos < len(f.text) && f.text[f.pos] == '}' {
+				f.pos++
+				return m, nil
+			}
+			key, err := f.value(":,}")
+			if err != nil {
+				return nil, err
+			}
+			f.skipSpaces()
+			var value any
+			if f.pos < len(f.text) && f.text[f.pos] == ':' {
+				f.pos++
+				if value, err = f.value(",}"); err != nil {
+					return nil, err
+				}
+			}
+			m[fmt.Sprint(key)] = value
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		value, end, err := readYAMLQuoted(f.text, f.pos)
+		f.pos = end
+		return value, err
+	}
+	start := f.pos
+	for f.pos < len(f.text) && !strings.ContainsRune(stop, rune(f.text[f.pos])) {
+		f.pos++
+	}
+	return yamlScalar(strings.TrimSpace(f.text[start:f.pos])), nil
+}
+
+// separator reads the comma after an item of a flow collection, or leaves its closing
+// bracket to read
+func (f *yamlFlow) separator(closing byte) error {
+	f.skipSpaces()
+	switch {
+	case f.pos == len(f.text):
+		return fmt.Errorf("missing %c", closing)
+	case f.text[f.pos] == ',':
+		f.pos++
+		return nil
+	case f.text[f.pos] == closing:
+		return nil
+	}
+	return fmt.Errorf("expected , or %c at %s", closing, f.text[f.pos:])
+}
+
+// yamlScalar returns the value of a plain scalar: nil for null, a bool, a json.Number for
+// numbers written as JSON writes them, and a string otherwise, e.g. for 007
+func yamlScalar(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if (s[0] == '-' || s[0] >= '0' && s[0] <= '9') && json.Valid([]byte(s)) {
+		return json.Number(s)
+	}
+	return s
+}
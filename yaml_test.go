@@ -0,0 +1,378 @@
+package MyDb
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseYAML checks documents against the values PyYAML 6 loads from them, examples
+// of the YAML specification included, limited to scalars YAML 1.1 and 1.2 resolve alike
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		json string
+	}{
+		{
+			"spec 2.1 sequence of scalars",
+			`- Mark McGwire
+- Sammy Sosa
+- Ken Griffey
+`,
+			`[["Mark McGwire","Sammy Sosa","Ken Griffey"]]`,
+		},
+		{
+			"spec 2.2 mapping scalars to scalars",
+			`hr:  65    # Home runs
+avg: 0.278 # Batting average
+rbi: 147   # Runs Batted In
+`,
+			`[{"hr":65,"avg":0.278,"rbi":147}]`,
+		},
+		{
+			"spec 2.3 mapping scalars to sequences",
+			`american:
+  - Boston Red Sox
+  - Detroit Tigers
+  - New York Yankees
+national:
+  - New York Mets
+  - Chicago Cubs
+  - Atlanta Braves
+`,
+			`[{"american":["Boston Red Sox","Detroit Tigers","New York Yankees"],"national":["New York Mets","Chicago Cubs","Atlanta Braves"]}]`,
+		},
+		{
+			"spec 2.4 sequence of mappings",
+			`-
+  name: Mark McGwire
+  hr:   65
+  avg:  0.278
+-
+  name: Sammy Sosa
+  hr:   63
+  avg:  0.288
+`,
+			`[[{"name":"Mark McGwire","hr":65,"avg":0.278},{"name":"Sammy Sosa","hr":63,"avg":0.288}]]`,
+		},
+		{
+			"spec 2.5 sequence of sequences",
+			`- [name        , hr, avg  ]
+- [Mark McGwire, 65, 0.278]
+- [Sammy Sosa  , 63, 0.288]
+`,
+			`[[["name","hr","avg"],["Mark McGwire",65,0.278],["Sammy Sosa",63,0.288]]]`,
+		},
+		{
+			"spec 2.6 mapping of mappings",
+			`Mark McGwire: {hr: 65, avg: 0.278}
+Sammy Sosa: {
+    hr: 63,
+    avg: 0.288
+  }
+`,
+			`[{"Mark McGwire":{"hr":65,"avg":0.278},"Sammy Sosa":{"hr":63,"avg":0.288}}]`,
+		},
+		{
+			"spec 2.7 two documents",
+			`# Ranking of 1998 home runs
+---
+- Mark McGwire
+- Sammy Sosa
+- Ken Griffey
+
+# Team ranking
+---
+- Chicago Cubs
+- St Louis Cardinals
+`,
+			`[["Mark McGwire","Sammy Sosa","Ken Griffey"],["Chicago Cubs","St Louis Cardinals"]]`,
+		},
+		{
+			"spec 2.12 compact nested mapping",
+			`---
+# Products purchased
+- item    : Super Hoop
+  quantity: 1
+- item    : Basketball
+  quantity: 4
+- item    : Big Shoes
+  quantity: 1
+`,
+			`[[{"item":"Super Hoop","quantity":1},{"item":"Basketball","quantity":4},{"item":"Big Shoes","quantity":1}]]`,
+		},
+		{
+			"spec 2.13 literal newlines preserved",
+			`# ASCII Art
+--- |
+  \//||\/||
+  // ||  ||__
+`,
+			`["\\//||\\/||\n// ||  ||__\n"]`,
+		},
+		{
+			"spec 2.14 folded newlines become spaces",
+			`--- >
+  Mark McGwire's
+  year was crippled
+  by a knee injury.
+`,
+			`["Mark McGwire's year was crippled by a knee injury.\n"]`,
+		},
+		{
+			"spec 2.16 indentation determines scope",
+			`name: Mark McGwire
+accomplishment: >
+  Mark set a major league
+  home run record in 1998.
+stats: |
+  65 Home Runs
+  0.278 Batting Average
+`,
+			`[{"name":"Mark McGwire","accomplishment":"Mark set a major league home run record in 1998.\n","stats":"65 Home Runs\n0.278 Batting Average\n"}]`,
+		},
+		{
+			"spec 2.17 quoted scalars",
+			`unicode: "Sosa did fine.\u263A"
+control: "\b1998\t1999\t2000\n"
+single: '"Howdy!" he cried.'
+quoted: ' # Not a ''comment''.'
+tie-fighter: '|\-*-/|'
+`,
+			`[{"unicode":"Sosa did fine.☺","control":"\b1998\t1999\t2000\n","single":"\"Howdy!\" he cried.","quoted":" # Not a 'comment'.","tie-fighter":"|\\-*-/|"}]`,
+		},
+		{
+			"spec 2.21 miscellaneous",
+			`null:
+booleans: [ true, false ]
+string: '012345'
+`,
+			`[{"null":null,"booleans":[true,false],"string":"012345"}]`,
+		},
+		{
+			"spec 8.4 chomping final line break",
+			`strip: |-
+  text
+clip: |
+  text
+keep: |+
+  text
+`,
+			`[{"strip":"text","clip":"text\n","keep":"text\n"}]`,
+		},
+		{
+			"spec 8.5 chomping trailing lines",
+			` # Strip
+  # Comments:
+strip: |-
+  # text
+
+ # Clip
+  # comments:
+
+clip: |
+  # text
+
+ # Keep
+  # comments:
+
+keep: |+
+  # text
+
+ # Trail
+  # comments.
+`,
+			`[{"strip":"# text","clip":"# text\n","keep":"# text\n\n"}]`,
+		},
+		{
+			"folded paragraphs",
+			`text: >
+  first
+  line
+
+  second
+  paragraph
+tail: 1
+`,
+			`[{"text":"first line\nsecond paragraph\n","tail":1}]`,
+		},
+		{
+			"sequence indented as its key",
+			`rows:
+- {id: 1, name: Ann}
+- id: 2
+  name: Bob
+  tags: [a, 'b c']
+`,
+			`[{"rows":[{"id":1,"name":"Ann"},{"id":2,"name":"Bob","tags":["a","b c"]}]}]`,
+		},
+		{
+			"flow collections",
+			`empty list: []
+empty map: {}
+nested: [[1, 2], {a: [x, y]}, "q, r"]
+`,
+			`[{"empty list":[],"empty map":{},"nested":[[1,2],{"a":["x","y"]},"q, r"]}]`,
+		},
+		{
+			"windows line endings",
+			"a: 1\r\nb:\r\n  - x\r\n",
+			`[{"a":1,"b":["x"]}]`,
+		},
+	}
+	for _, tt := range tests {
+		docs, err := parseYAML([]byte(tt.yaml))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var want []any
+		if err := json.Unmarshal([]byte(tt.json), &want); err != nil {
+			t.Fatal(err)
+		}
+		if got := yamlTestValues(docs); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: parsed %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+// yamlTestValues returns values with their json.Number numbers as float64, as decoded
+// without UseNumber
+func yamlTestValues(docs []any) []any {
+	data, _ := json.Marshal(docs)
+	var values []any
+	json.Unmarshal(data, &values)
+	return values
+}
+
+// TestYAMLScalars checks the values of plain scalars, numbers keeping the form they are
+// written in and numbers JSON does not write, such as 007, being strings
+func TestYAMLScalars(t *testing.T) {
+	tests := []struct {
+		scalar string
+		want   any
+	}{
+		{"42", json.Number("42")},
+		{"-0.5", json.Number("-0.5")},
+		{"1.50", json.Number("1.50")},
+		{"6.02e+23", json.Number("6.02e+23")},
+		{"007", "007"},
+		{"+1", "+1"},
+		{".5", ".5"},
+		{"0x1F", "0x1F"},
+		{"1_000", "1_000"},
+		{"~", nil},
+		{"Null", nil},
+		{"TRUE", true},
+		{"false", false},
+		{"yes", "yes"},
+		{"2024-01-02", "2024-01-02"},
+	}
+	for _, tt := range tests {
+		if got := yamlScalar(tt.scalar); got != tt.want {
+			t.Errorf("yamlScalar(%q) = %#v, want %#v", tt.scalar, got, tt.want)
+		}
+	}
+}
+
+// TestYAMLErrors checks that YAML outside of the subset, or invalid, is refused with the
+// line at fault
+func TestYAMLErrors(t *testing.T) {
+	tests := []struct {
+		yaml string
+		err  string
+	}{
+		{"a: 1\n\tb: 2\n", "line 2: tabs cannot indent YAML"},
+		{"a: 1\na: 2\n", "line 2: key a is repeated"},
+		{"a: 'open\n", "line 1: unterminated string 'open"},
+		{"a: [1, 2\n", "line 1: missing ]"},
+		{"a: {b: 1} c\n", "line 1: unexpected c"},
+		{"a: |2\n  x\n", "line 1: unsupported block scalar header |2"},
+		{"a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"a: 1\nb\n", "line 2: expected \"key: value\""},
+	}
+	for _, tt := range tests {
+		_, err := parseYAML([]byte(tt.yaml))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("parseYAML(%q) returned error %v, want %s", tt.yaml, err, tt.err)
+		}
+	}
+}
+
+// TestLoadFixtures loads JSON and YAML fixtures in the order of their names, creating a
+// table declared with its columns and another with inferred types
+func TestLoadFixtures(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"01_users.yml": `table: users
+columns:
+  - {name: id, type: int, primary_key: true}
+  - {name: name, not_null: true}
+  - {name: bio}
+rows:
+  - {id: 1, name: Ann, bio: "likes \"quotes\""}
+  - id: 2
+    name: Bob
+    bio: |
+      two
+      lines
+`,
+		"02_posts.json": `[{"id": 1, "user_id": 1, "title": "Hello", "score": 1.5}, {"id": 2, "user_id": 2, "title": "Again", "score": 2}]`,
+		"03_tags.yaml": `---
+table: tags
+rows:
+  - {name: go}
+---
+table: labels
+rows: [{name: db}]
+`,
+		"README.md": "not a fixture",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := NewDatabase("fixtures_test", WithStorage(&MemoryStorage{}))
+	if err := db.LoadFixtures(dir, InTransaction()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []map[string]string
+	}{
+		{"get from users order by id", []map[string]string{{"id": "1", "name": "Ann", "bio": `likes "quotes"`}, {"id": "2", "name": "Bob", "bio": "two\nlines\n"}}},
+		{"select title, score from posts order by id", []map[string]string{{"title": "Hello", "score": "1.5"}, {"title": "Again", "score": "2"}}},
+		{"get from tags", []map[string]string{{"name": "go"}}},
+		{"get from labels", []map[string]string{{"name": "db"}}},
+	}
+	for _, tt := range tests {
+		res, err := db.Query(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(res.Rows, tt.want) {
+			t.Errorf("%s returned %v, want %v", tt.query, res.Rows, tt.want)
+		}
+	}
+	if def := db.Tables["users"].columnDef("id"); def.Type != Int || !def.PrimaryKey {
+		t.Errorf("column users.id is %+v, want an int primary key", def)
+	}
+
+	// A failing fixture leaves the database as it was
+	if err := os.WriteFile(filepath.Join(dir, "04_users.yml"), []byte("- {id: 1, name: Dup}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fresh := NewDatabase("fixtures_test", WithStorage(&MemoryStorage{}))
+	if err := fresh.LoadFixtures(dir, InTransaction()); err == nil || !strings.Contains(err.Error(), "users") {
+		t.Errorf("loading a duplicate key returned %v, want an error on table users", err)
+	}
+	if len(fresh.Tables) != 0 {
+		t.Errorf("a failed load left tables %v", fresh.Tables)
+	}
+}